@@ -0,0 +1,81 @@
+package amqplimiter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consume starts a consumer on queue whose deliveries are paced by limiter,
+// so workers honor a processing rate against the downstreams they share.
+// The channel's prefetch is set to the limiter's bucket size: a worker never
+// holds more unacknowledged messages than it may process in one burst, and
+// the rest stay on the broker for other workers. Deliveries must be
+// acknowledged by the caller.
+//
+//	deliveries, err := amqplimiter.Consume(ctx, ch, "emails", "", rateLimiter)
+//	for d := range deliveries {
+//		send(d)
+//		d.Ack(false)
+//	}
+func Consume(ctx context.Context, ch *amqp.Channel, queue, consumer string, limiter core.RateLimiter) (<-chan amqp.Delivery, error) {
+	if err := ch.Qos(Prefetch(limiter), 0, false); err != nil {
+		return nil, err
+	}
+	deliveries, err := ch.Consume(queue, consumer, false, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return Pace(ctx, deliveries, limiter), nil
+}
+
+// Prefetch is the prefetch count matching limiter's bucket size.
+func Prefetch(limiter core.RateLimiter) int {
+	return int(limiter.Config().RATE_LIMIT)
+}
+
+// Pace passes deliveries on no faster than limiter allows. The returned
+// channel is closed when deliveries is, or when ctx is done, in which case
+// a delivery still waiting for its turn is requeued.
+//
+// The limiter sees a delivery as a request for /<exchange>/<routing key>
+// with the delivery headers as its headers; KEY_BY_PATH gives every
+// routing key its own budget.
+func Pace(ctx context.Context, deliveries <-chan amqp.Delivery, limiter core.RateLimiter) <-chan amqp.Delivery {
+	paced := make(chan amqp.Delivery)
+
+	go func() {
+		defer close(paced)
+
+		for d := range deliveries {
+			if _, err := limiter.Wait(requestFor(ctx, d)); err != nil {
+				d.Nack(false, true)
+				return
+			}
+
+			select {
+			case paced <- d:
+			case <-ctx.Done():
+				d.Nack(false, true)
+				return
+			}
+		}
+	}()
+	return paced
+}
+
+// requestFor describes a delivery as the *http.Request the limiter works on.
+func requestFor(ctx context.Context, d amqp.Delivery) *http.Request {
+	request := &http.Request{
+		URL:    &url.URL{Path: "/" + d.Exchange + "/" + d.RoutingKey},
+		Header: http.Header{},
+	}
+	for name, value := range d.Headers {
+		request.Header.Set(name, fmt.Sprint(value))
+	}
+	return request.WithContext(ctx)
+}
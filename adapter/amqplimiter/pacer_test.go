@@ -0,0 +1,80 @@
+package amqplimiter
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// fakeAcknowledger records the deliveries nacked for requeueing.
+type fakeAcknowledger struct {
+	requeued []uint64
+	mx       sync.Mutex
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error { return nil }
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+	if requeue {
+		a.requeued = append(a.requeued, tag)
+	}
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error { return nil }
+
+func TestPace(t *testing.T) {
+	tests := []struct {
+		name         string
+		keyByPath    bool
+		routingKeys  []string
+		wantPassed   int
+		wantRequeued int
+	}{
+		{name: "shared budget", routingKeys: []string{"email", "sms"}, wantPassed: 1, wantRequeued: 1},
+		{name: "per routing key", keyByPath: true, routingKeys: []string{"email", "sms", "email"}, wantPassed: 2, wantRequeued: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        func(r *http.Request) string { return "worker" },
+				KEY_BY_PATH:     test.keyByPath,
+			})
+			if Prefetch(limiter) != 1 {
+				t.Fatalf("prefetch %d, want the bucket size", Prefetch(limiter))
+			}
+
+			acknowledger := &fakeAcknowledger{}
+			deliveries := make(chan amqp.Delivery, len(test.routingKeys))
+			for i, routingKey := range test.routingKeys {
+				deliveries <- amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: uint64(i), Exchange: "notify", RoutingKey: routingKey}
+			}
+			close(deliveries)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			passed := 0
+			for range Pace(ctx, deliveries, limiter) {
+				passed++
+			}
+
+			if passed != test.wantPassed {
+				t.Fatalf("passed %d deliveries, want %d", passed, test.wantPassed)
+			}
+			if len(acknowledger.requeued) != test.wantRequeued {
+				t.Fatalf("requeued %d deliveries, want %d", len(acknowledger.requeued), test.wantRequeued)
+			}
+		})
+	}
+}
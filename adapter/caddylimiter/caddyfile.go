@@ -0,0 +1,113 @@
+package caddylimiter
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("token_bucket_rate_limit", parseHandler)
+	httpcaddyfile.RegisterDirectiveOrder("token_bucket_rate_limit", httpcaddyfile.Before, "basic_auth")
+	httpcaddyfile.RegisterHandlerDirective("token_bucket_status", parseStatusHandler)
+	httpcaddyfile.RegisterDirectiveOrder("token_bucket_status", httpcaddyfile.Before, "respond")
+}
+
+func parseHandler(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(Handler)
+	err := handler.UnmarshalCaddyfile(h.Dispenser)
+	return handler, err
+}
+
+func parseStatusHandler(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(StatusHandler)
+	err := handler.UnmarshalCaddyfile(h.Dispenser)
+	return handler, err
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens:
+//
+//	token_bucket_rate_limit [<zone>] {
+//		rate_limit        <requests>
+//		refill_interval   <duration>
+//		global_rate_limit <requests>
+//		key               <placeholder>
+//		key_by_path
+//		max_wait          <duration>
+//	}
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next()
+	if d.NextArg() {
+		h.Zone = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+
+	for d.NextBlock(0) {
+		option := d.Val()
+		switch option {
+		case "key_by_path":
+			h.KeyByPath = true
+			continue
+		}
+
+		if !d.NextArg() {
+			return d.ArgErr()
+		}
+		value := d.Val()
+		if d.NextArg() {
+			return d.ArgErr()
+		}
+
+		var err error
+		switch option {
+		case "rate_limit":
+			h.RateLimit, err = strconv.ParseInt(value, 10, 64)
+		case "global_rate_limit":
+			h.GlobalRateLimit, err = strconv.ParseInt(value, 10, 64)
+		case "refill_interval":
+			h.RefillInterval, err = parseDuration(value)
+		case "max_wait":
+			h.MaxWait, err = parseDuration(value)
+		case "key":
+			h.Key = value
+		default:
+			return d.Errf("unknown option %q", option)
+		}
+		if err != nil {
+			return d.Errf("%s: %v", option, err)
+		}
+	}
+	return nil
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens:
+//
+//	token_bucket_status [<zone>] [status|reset_key|reset_all]
+func (h *StatusHandler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	d.Next()
+	if d.NextArg() {
+		h.Zone = d.Val()
+	}
+	if d.NextArg() {
+		h.Action = d.Val()
+	}
+	if d.NextArg() {
+		return d.ArgErr()
+	}
+	return nil
+}
+
+func parseDuration(value string) (caddy.Duration, error) {
+	d, err := caddy.ParseDuration(value)
+	return caddy.Duration(d), err
+}
+
+var (
+	_ caddyfile.Unmarshaler = (*Handler)(nil)
+	_ caddyfile.Unmarshaler = (*StatusHandler)(nil)
+)
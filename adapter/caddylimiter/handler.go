@@ -0,0 +1,226 @@
+package caddylimiter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+}
+
+// limiters keeps each zone's limiter across config reloads, as long as
+// the zone's limits are unchanged, so reloading Caddy doesn't refill every
+// bucket.
+var limiters = caddy.NewUsagePool()
+
+// zone is a limiter named by the handlers of one config that use it. A
+// reload provisions the new config's zones before the old config's are
+// cleaned up, so a name can have one zone per config for a while.
+type zone struct {
+	poolKey string
+	limiter core.RateLimiter
+	config  context.Context
+	refs    int
+}
+
+var (
+	// zones maps zone names to their zones, the newest last, which the
+	// status handlers report on.
+	zones   = map[string][]*zone{}
+	zonesMx sync.Mutex
+)
+
+// acquireZone counts h as a user of its zone in the config of ctx. Within
+// one config, every handler naming a zone must give it the same limits.
+func acquireZone(ctx context.Context, h *Handler) error {
+	zonesMx.Lock()
+	defer zonesMx.Unlock()
+
+	for _, z := range zones[h.Zone] {
+		if z.config != ctx {
+			continue
+		}
+		if z.poolKey != h.poolKey {
+			return fmt.Errorf("zone %q is configured with different limits elsewhere; give separate limits separate zones", h.Zone)
+		}
+		z.refs++
+		return nil
+	}
+	zones[h.Zone] = append(zones[h.Zone], &zone{poolKey: h.poolKey, limiter: h.limiter, config: ctx, refs: 1})
+	return nil
+}
+
+// releaseZone drops h as a user of its zone, forgetting the zone once no
+// handler of its config uses it.
+func releaseZone(ctx context.Context, h *Handler) {
+	zonesMx.Lock()
+	defer zonesMx.Unlock()
+
+	list := zones[h.Zone]
+	for i, z := range list {
+		if z.config != ctx || z.poolKey != h.poolKey {
+			continue
+		}
+		if z.refs--; z.refs > 0 {
+			return
+		}
+		list = append(list[:i:i], list[i+1:]...)
+		break
+	}
+	if len(list) == 0 {
+		delete(zones, h.Zone)
+		return
+	}
+	zones[h.Zone] = list
+}
+
+// zoneLimiter returns the limiter of the newest zone named name.
+func zoneLimiter(name string) (core.RateLimiter, bool) {
+	zonesMx.Lock()
+	defer zonesMx.Unlock()
+
+	list := zones[name]
+	if len(list) == 0 {
+		return nil, false
+	}
+	return list[len(list)-1].limiter, true
+}
+
+// Handler is the http.handlers.token_bucket_rate_limit module. Handlers
+// naming the same zone share one limiter and must configure it alike; give
+// routes separate zones for separate limits.
+type Handler struct {
+	// Names the limiter. Defaults to "default".
+	Zone string `json:"zone,omitempty"`
+	// Requests a key may make, refilled one per refill interval.
+	RateLimit       int64          `json:"rate_limit,omitempty"`
+	RefillInterval  caddy.Duration `json:"refill_interval,omitempty"`
+	GlobalRateLimit int64          `json:"global_rate_limit,omitempty"`
+	// Groups requests into buckets. Placeholders are expanded, e.g.
+	// "{http.request.header.X-Api-Key}". Defaults to the client IP.
+	Key string `json:"key,omitempty"`
+	// Gives every path its own bucket.
+	KeyByPath bool `json:"key_by_path,omitempty"`
+	// Lets requests wait up to this long for a token instead of being
+	// rejected.
+	MaxWait caddy.Duration `json:"max_wait,omitempty"`
+
+	limiter core.RateLimiter
+	poolKey string
+	config  context.Context
+}
+
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.token_bucket_rate_limit",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+type pooledLimiter struct {
+	core.RateLimiter
+	stop context.CancelFunc
+}
+
+// Destruct stops the limiter once no config uses it.
+func (p pooledLimiter) Destruct() error {
+	p.stop()
+	return nil
+}
+
+func (h *Handler) Provision(ctx caddy.Context) error {
+	if h.Zone == "" {
+		h.Zone = "default"
+	}
+	if h.Key == "" {
+		h.Key = "{http.request.remote.host}"
+	}
+
+	h.poolKey = fmt.Sprintf("%s/%d/%d/%d/%s/%t/%d", h.Zone, h.RateLimit, h.RefillInterval,
+		h.GlobalRateLimit, h.Key, h.KeyByPath, h.MaxWait)
+	pooled, _, err := limiters.LoadOrNew(h.poolKey, func() (caddy.Destructor, error) {
+		limiter := core.New()
+		limiter.SetConfig(core.RateLimiterConfig{
+			RATE_LIMIT:             h.RateLimit,
+			REFILL_INTERVAL:        time.Duration(h.RefillInterval),
+			GLOBAL_RATE_LIMIT:      h.GlobalRateLimit,
+			GLOBAL_REFILL_INTERVAL: time.Duration(h.RefillInterval),
+			KEY_FUNC:               placeholderKey(h.Key),
+			KEY_BY_PATH:            h.KeyByPath,
+			MAX_WAIT:               time.Duration(h.MaxWait),
+		})
+		run, stop := context.WithCancel(context.Background())
+		limiter.RunContext(run)
+		return pooledLimiter{RateLimiter: limiter, stop: stop}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.limiter = pooled.(pooledLimiter).RateLimiter
+	h.config = ctx.Context
+	if err := acquireZone(h.config, h); err != nil {
+		limiters.Delete(h.poolKey)
+		h.poolKey = ""
+		return err
+	}
+	return nil
+}
+
+func (h *Handler) Validate() error {
+	if h.RateLimit <= 0 {
+		return fmt.Errorf("rate_limit must be positive")
+	}
+	if h.RefillInterval <= 0 {
+		return fmt.Errorf("refill_interval must be positive")
+	}
+	return nil
+}
+
+func (h *Handler) Cleanup() error {
+	if h.poolKey == "" {
+		return nil
+	}
+	releaseZone(h.config, h)
+	_, err := limiters.Delete(h.poolKey)
+	return err
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if !stdhttp.Allow(h.limiter, w, r) {
+		return nil
+	}
+	return next.ServeHTTP(w, r)
+}
+
+// placeholderKey is a KEY_FUNC expanding key's placeholders for each
+// request.
+func placeholderKey(key string) func(r *http.Request) string {
+	if !strings.Contains(key, "{") {
+		return func(r *http.Request) string { return key }
+	}
+	return func(r *http.Request) string {
+		repl, ok := r.Context().Value(caddy.ReplacerCtxKey).(*caddy.Replacer)
+		if !ok {
+			return r.RemoteAddr
+		}
+		return repl.ReplaceAll(key, "")
+	}
+}
+
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddy.Validator             = (*Handler)(nil)
+	_ caddy.CleanerUpper          = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+)
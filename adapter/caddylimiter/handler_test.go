@@ -0,0 +1,74 @@
+package caddylimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func newConfig(t *testing.T) caddy.Context {
+	ctx, cancel := caddy.NewContext(caddy.Context{Context: context.Background()})
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func provision(t *testing.T, ctx caddy.Context, zone string, rateLimit int64) (*Handler, error) {
+	t.Helper()
+	h := &Handler{Zone: zone, RateLimit: rateLimit, RefillInterval: caddy.Duration(time.Second)}
+	return h, h.Provision(ctx)
+}
+
+func TestZones(t *testing.T) {
+	tests := []struct {
+		name      string
+		sameConf  bool
+		rateLimit int64
+		wantErr   bool
+	}{
+		{name: "same limits, same config", sameConf: true, rateLimit: 10},
+		{name: "other limits, same config", sameConf: true, rateLimit: 20, wantErr: true},
+		{name: "other limits, reloaded config", rateLimit: 20},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			zone := t.Name()
+			first := newConfig(t)
+			a, err := provision(t, first, zone, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			second := first
+			if !test.sameConf {
+				second = newConfig(t)
+			}
+			b, err := provision(t, second, zone, test.rateLimit)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Provision error %v, want error %v", err, test.wantErr)
+			}
+			if err != nil {
+				b.Cleanup()
+				if limiter, _ := zoneLimiter(zone); limiter != a.limiter {
+					t.Fatal("rejected handler replaced the zone's limiter")
+				}
+				a.Cleanup()
+			} else {
+				if limiter, _ := zoneLimiter(zone); limiter != b.limiter {
+					t.Fatal("zone doesn't report the newest limiter")
+				}
+				a.Cleanup()
+				if limiter, ok := zoneLimiter(zone); !ok || limiter != b.limiter {
+					t.Fatal("cleaning up the first handler dropped the zone")
+				}
+				b.Cleanup()
+			}
+
+			if _, ok := zoneLimiter(zone); ok {
+				t.Fatal("zone kept after every handler was cleaned up")
+			}
+		})
+	}
+}
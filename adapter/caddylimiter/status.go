@@ -0,0 +1,72 @@
+package caddylimiter
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(StatusHandler{})
+}
+
+// StatusHandler is the http.handlers.token_bucket_status module, serving a
+// zone's bucket status or resetting its buckets. Guard it like any admin
+// route.
+type StatusHandler struct {
+	// The zone to report on. Defaults to "default".
+	Zone string `json:"zone,omitempty"`
+	// "status" (the default), "reset_key" or "reset_all".
+	Action string `json:"action,omitempty"`
+}
+
+func (StatusHandler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.token_bucket_status",
+		New: func() caddy.Module { return new(StatusHandler) },
+	}
+}
+
+func (h *StatusHandler) Provision(ctx caddy.Context) error {
+	if h.Zone == "" {
+		h.Zone = "default"
+	}
+	if h.Action == "" {
+		h.Action = "status"
+	}
+	return nil
+}
+
+func (h *StatusHandler) Validate() error {
+	switch h.Action {
+	case "status", "reset_key", "reset_all":
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", h.Action)
+}
+
+func (h *StatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	limiter, ok := zoneLimiter(h.Zone)
+	if !ok {
+		return caddyhttp.Error(http.StatusNotFound, fmt.Errorf("no rate limit zone %q", h.Zone))
+	}
+
+	switch h.Action {
+	case "reset_key":
+		stdhttp.ResetKey(limiter)(w, r)
+	case "reset_all":
+		stdhttp.ResetAll(limiter)(w, r)
+	default:
+		stdhttp.GetBucketStatus(limiter)(w, r)
+	}
+	return nil
+}
+
+var (
+	_ caddy.Provisioner           = (*StatusHandler)(nil)
+	_ caddy.Validator             = (*StatusHandler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*StatusHandler)(nil)
+)
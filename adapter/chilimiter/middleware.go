@@ -0,0 +1,42 @@
+package chilimiter
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/go-chi/chi/v5"
+)
+
+// Middleware limits requests like stdhttp.Middleware and records chi's
+// route pattern for KEY_BY_PATH. chi only knows the full pattern once it
+// has routed, so attach it with With to key by e.g. /users/{id}:
+//
+//	r.With(chilimiter.Middleware(rateLimiter)).Get("/users/{id}", getUser)
+//
+// Under Use the pattern covers only the routers matched so far.
+func Middleware(limiter core.RateLimiter) func(http.Handler) http.Handler {
+	routeTemplates := stdhttp.RouteTemplates(RoutePattern)
+	limit := stdhttp.Middleware(limiter)
+	return func(next http.Handler) http.Handler {
+		return routeTemplates(limit(next))
+	}
+}
+
+// Limit gives a router or route its own limiter, configured and running.
+func Limit(config core.RateLimiterConfig) func(http.Handler) http.Handler {
+	limiter := core.New()
+	limiter.SetConfig(config)
+	limiter.Run()
+	return Middleware(limiter)
+}
+
+// RoutePattern returns the route pattern chi matched for the request, or ""
+// outside a chi router.
+func RoutePattern(r *http.Request) string {
+	routeContext := chi.RouteContext(r.Context())
+	if routeContext == nil {
+		return ""
+	}
+	return routeContext.RoutePattern()
+}
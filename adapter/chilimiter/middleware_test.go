@@ -0,0 +1,58 @@
+package chilimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/go-chi/chi/v5"
+)
+
+func TestMiddlewareKeysByRoutePattern(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      core.PathKeyMode
+		paths     []string
+		wantCodes []int
+	}{
+		{
+			name:      "route pattern",
+			mode:      core.PathTemplate,
+			paths:     []string{"/users/1", "/users/2", "/teams/1"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:      "raw path",
+			mode:      core.PathRaw,
+			paths:     []string{"/users/1", "/users/2", "/users/1"},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_BY_PATH: true, PATH_KEY_MODE: test.mode})
+			r := chi.NewRouter()
+			ok := func(w http.ResponseWriter, r *http.Request) {}
+			r.With(Middleware(limiter)).Get("/users/{id}", ok)
+			r.With(Middleware(limiter)).Get("/teams/{id}", ok)
+
+			for i, path := range test.paths {
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != test.wantCodes[i] {
+					t.Fatalf("request %d to %s: status %d, want %d", i, path, w.Code, test.wantCodes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRoutePatternOutsideChi(t *testing.T) {
+	if got := RoutePattern(httptest.NewRequest(http.MethodGet, "/users/1", nil)); got != "" {
+		t.Fatalf("RoutePattern = %q outside a chi router, want empty", got)
+	}
+}
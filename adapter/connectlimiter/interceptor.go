@@ -0,0 +1,175 @@
+package connectlimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"connectrpc.com/connect"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Interceptor is the connect-go counterpart of the grpclimiter
+// interceptors. On handlers it limits calls and stream creation, failing
+// rejected calls with CodeResourceExhausted and a google.rpc.RetryInfo
+// detail; on clients it paces outbound calls until the limiter has a token.
+//
+//	mux.Handle(greetv1connect.NewGreetServiceHandler(greeter,
+//		connect.WithInterceptors(connectlimiter.NewInterceptor(rateLimiter, nil))))
+type Interceptor struct {
+	limiter  core.RateLimiter
+	messages *core.LimitProfile
+}
+
+// NewInterceptor returns an interceptor for limiter. A non-nil messages
+// profile also paces the messages each handler stream receives.
+func NewInterceptor(limiter core.RateLimiter, messages *core.LimitProfile) *Interceptor {
+	return &Interceptor{limiter: limiter, messages: messages}
+}
+
+func (i *Interceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		request := requestFor(ctx, req.Spec(), req.Peer(), req.Header())
+		if req.Spec().IsClient {
+			if err := pace(i.limiter, request); err != nil {
+				return nil, err
+			}
+			return next(ctx, req)
+		}
+
+		d, err := i.allow(request)
+		if err != nil {
+			return nil, err
+		}
+		res, err := next(ctx, req)
+		if res != nil && !d.Exempt {
+			i.limiter.WriteHeaders(res.Header(), d)
+		}
+		return res, err
+	}
+}
+
+func (i *Interceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		request := requestFor(ctx, spec, conn.Peer(), conn.RequestHeader())
+		if err := pace(i.limiter, request); err != nil {
+			return &failedClientConn{StreamingClientConn: conn, err: err}
+		}
+		return conn
+	}
+}
+
+func (i *Interceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		request := requestFor(ctx, conn.Spec(), conn.Peer(), conn.RequestHeader())
+		d, err := i.allow(request)
+		if err != nil {
+			return err
+		}
+		if !d.Exempt {
+			i.limiter.WriteHeaders(conn.ResponseHeader(), d)
+		}
+		if i.messages != nil {
+			conn = &limitedHandlerConn{
+				StreamingHandlerConn: conn,
+				ctx:                  ctx,
+				messages:             core.NewMessageLimiter(*i.messages),
+			}
+		}
+		return next(ctx, conn)
+	}
+}
+
+// allow charges a handler call and returns the error for rejected ones.
+func (i *Interceptor) allow(request *http.Request) (core.Decision, error) {
+	d := i.limiter.Decide(request)
+	if d.Allowed {
+		return d, nil
+	}
+
+	err := connect.NewError(connect.CodeResourceExhausted,
+		fmt.Errorf("Too many requests, retry after %f second", d.RetryAfter.Seconds()))
+	if detail, detailErr := connect.NewErrorDetail(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(d.RetryAfter),
+	}); detailErr == nil {
+		err.AddDetail(detail)
+	}
+	i.limiter.WriteHeaders(err.Meta(), d)
+	return d, err
+}
+
+// pace waits for a token for an outbound call.
+func pace(limiter core.RateLimiter, request *http.Request) error {
+	if _, err := limiter.Wait(request); err != nil {
+		return contextError(err)
+	}
+	return nil
+}
+
+// contextError turns the error of a cancelled or expired context into the
+// matching connect error.
+func contextError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return connect.NewError(connect.CodeDeadlineExceeded, err)
+	}
+	return connect.NewError(connect.CodeCanceled, err)
+}
+
+// requestFor describes a call as the *http.Request the limiter works on:
+// the procedure is the URL path, so KEY_BY_PATH keys by procedure. Handlers
+// see the caller's address as RemoteAddr, clients the server's as Host.
+func requestFor(ctx context.Context, spec connect.Spec, peer connect.Peer, header http.Header) *http.Request {
+	request := &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: spec.Procedure},
+		Header: header,
+	}
+	if spec.IsClient {
+		request.Host = peer.Addr
+	} else {
+		request.RemoteAddr = peer.Addr
+	}
+	return request.WithContext(ctx)
+}
+
+// failedClientConn fails every operation of a stream that never got a
+// token.
+type failedClientConn struct {
+	connect.StreamingClientConn
+	err error
+}
+
+func (c *failedClientConn) Send(interface{}) error {
+	return c.err
+}
+
+func (c *failedClientConn) Receive(interface{}) error {
+	return c.err
+}
+
+func (c *failedClientConn) CloseRequest() error {
+	return c.err
+}
+
+func (c *failedClientConn) CloseResponse() error {
+	return c.err
+}
+
+// limitedHandlerConn paces the messages received on one handler stream.
+type limitedHandlerConn struct {
+	connect.StreamingHandlerConn
+	ctx      context.Context
+	messages core.ConnLimiter
+}
+
+func (c *limitedHandlerConn) Receive(m interface{}) error {
+	if err := c.messages.Wait(c.ctx); err != nil {
+		return contextError(err)
+	}
+	return c.StreamingHandlerConn.Receive(m)
+}
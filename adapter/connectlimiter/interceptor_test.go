@@ -0,0 +1,104 @@
+package connectlimiter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const pingProcedure = "/test.v1.TestService/Ping"
+
+func ping(ctx context.Context, req *connect.Request[emptypb.Empty]) (*connect.Response[emptypb.Empty], error) {
+	return connect.NewResponse(&emptypb.Empty{}), nil
+}
+
+// newServer serves ping behind handlerOptions and returns a client for it
+// built with clientOptions.
+func newServer(t *testing.T, handlerOptions []connect.HandlerOption, clientOptions []connect.ClientOption) *connect.Client[emptypb.Empty, emptypb.Empty] {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.Handle(pingProcedure, connect.NewUnaryHandler(pingProcedure, ping, handlerOptions...))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return connect.NewClient[emptypb.Empty, emptypb.Empty](server.Client(), server.URL+pingProcedure, clientOptions...)
+}
+
+func newLimiter(keyFunc func(r *http.Request) string) core.RateLimiter {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: keyFunc})
+	return limiter
+}
+
+func TestHandlerInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyFunc     func(r *http.Request) string
+		header      string
+		wantLimited bool
+	}{
+		{name: "same caller", keyFunc: func(r *http.Request) string { return core.StripPort(r.RemoteAddr) }, header: "one", wantLimited: true},
+		{name: "other API key", keyFunc: func(r *http.Request) string { return r.Header.Get("X-Api-Key") }, header: "two", wantLimited: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newServer(t, []connect.HandlerOption{connect.WithInterceptors(NewInterceptor(newLimiter(test.keyFunc), nil))}, nil)
+
+			first := connect.NewRequest(&emptypb.Empty{})
+			first.Header().Set("X-Api-Key", "one")
+			res, err := client.CallUnary(context.Background(), first)
+			if err != nil {
+				t.Fatalf("first call failed: %v", err)
+			}
+			if res.Header().Get("X-RateLimit-Remaining") != "0" {
+				t.Fatalf("X-RateLimit-Remaining = %q, want 0", res.Header().Get("X-RateLimit-Remaining"))
+			}
+
+			second := connect.NewRequest(&emptypb.Empty{})
+			second.Header().Set("X-Api-Key", test.header)
+			_, err = client.CallUnary(context.Background(), second)
+			if !test.wantLimited {
+				if err != nil {
+					t.Fatalf("second call failed: %v", err)
+				}
+				return
+			}
+
+			var connectErr *connect.Error
+			if !errors.As(err, &connectErr) || connectErr.Code() != connect.CodeResourceExhausted {
+				t.Fatalf("second call error %v, want %v", err, connect.CodeResourceExhausted)
+			}
+			for _, detail := range connectErr.Details() {
+				if value, _ := detail.Value(); value != nil {
+					if _, ok := value.(*errdetails.RetryInfo); ok {
+						return
+					}
+				}
+			}
+			t.Fatal("rejection carries no RetryInfo")
+		})
+	}
+}
+
+func TestClientInterceptorPaces(t *testing.T) {
+	limiter := newLimiter(func(r *http.Request) string { return r.Host })
+	client := newServer(t, nil, []connect.ClientOption{connect.WithInterceptors(NewInterceptor(limiter, nil))})
+
+	if _, err := client.CallUnary(context.Background(), connect.NewRequest(&emptypb.Empty{})); err != nil {
+		t.Fatalf("first call failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := client.CallUnary(ctx, connect.NewRequest(&emptypb.Empty{}))
+	if code := connect.CodeOf(err); code != connect.CodeDeadlineExceeded {
+		t.Fatalf("second call code %v, want %v", code, connect.CodeDeadlineExceeded)
+	}
+}
@@ -0,0 +1,49 @@
+package echolimiter
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimitMiddleware limits the requests reaching the next echo handler.
+func RateLimitMiddleware(limiter core.RateLimiter) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			allowed, err := allow(limiter, c)
+			if !allowed {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// allow charges the request and sets the rate limit headers. Rejected
+// requests get their response written and false is returned.
+func allow(limiter core.RateLimiter, c echo.Context) (bool, error) {
+	request := c.Request()
+	if path := c.Path(); path != "" {
+		request = core.WithRouteTemplate(request, path)
+		c.SetRequest(request)
+	}
+	d := limiter.Decide(request)
+
+	if d.Exempt {
+		return true, nil
+	}
+	limiter.WriteHeaders(c.Response().Header(), d)
+	if d.Allowed {
+		return true, nil
+	}
+
+	challenge := limiter.Config().CHALLENGE_HANDLER
+	if challenge != nil && challenge(c.Response(), request, d.Key) {
+		return false, nil
+	}
+	return false, c.JSON(http.StatusTooManyRequests, map[string]interface{}{
+		"success": false,
+		"message": "Too many requests",
+	})
+}
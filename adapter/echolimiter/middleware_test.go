@@ -0,0 +1,59 @@
+package echolimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    core.RateLimiterConfig
+		paths     []string
+		wantCodes []int
+	}{
+		{
+			name:      "past the limit",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return "client" }},
+			paths:     []string{"/users/1", "/users/2"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "keyed by route template",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_BY_PATH: true},
+			paths:     []string{"/users/1", "/users/2", "/health"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:      "keyed by raw path",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_BY_PATH: true, PATH_KEY_MODE: core.PathRaw},
+			paths:     []string{"/users/1", "/users/2", "/users/1"},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(test.config)
+			e := echo.New()
+			e.Use(RateLimitMiddleware(limiter))
+			ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+			e.GET("/users/:id", ok)
+			e.GET("/health", ok)
+
+			for i, path := range test.paths {
+				w := httptest.NewRecorder()
+				e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != test.wantCodes[i] {
+					t.Fatalf("request %d to %s: status %d, want %d", i, path, w.Code, test.wantCodes[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package echolimiter
+
+import (
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/labstack/echo/v4"
+)
+
+// GetBucketStatus reports the limiter's current bucket status.
+func GetBucketStatus(limiter core.RateLimiter) echo.HandlerFunc {
+	return echo.WrapHandler(stdhttp.GetBucketStatus(limiter))
+}
+
+// StreamBucketStatus streams bucket status snapshots over Server-Sent Events.
+func StreamBucketStatus(limiter core.RateLimiter) echo.HandlerFunc {
+	return echo.WrapHandler(stdhttp.StreamBucketStatus(limiter))
+}
+
+// ResetKey clears the bucket of the key given in the "key" query parameter.
+func ResetKey(limiter core.RateLimiter) echo.HandlerFunc {
+	return echo.WrapHandler(stdhttp.ResetKey(limiter))
+}
+
+// ResetAll clears every bucket.
+func ResetAll(limiter core.RateLimiter) echo.HandlerFunc {
+	return echo.WrapHandler(stdhttp.ResetAll(limiter))
+}
@@ -0,0 +1,214 @@
+package envoyrls
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// DescriptorRule limits the descriptors of a domain whose entries match
+// Entries, in order. An entry written "key" matches any value and gives
+// each value its own bucket; "key=value" matches that value only.
+type DescriptorRule struct {
+	Domain  string
+	Entries []string
+	Limit   core.LimitProfile
+}
+
+// Service implements Envoy's envoy.service.ratelimit.v3.RateLimitService on
+// top of core limiters, so Envoy, Contour and Istio global rate limit
+// filters can use this package as their backend:
+//
+//	server := grpc.NewServer()
+//	rlsv3.RegisterRateLimitServiceServer(server, envoyrls.NewService(rules))
+type Service struct {
+	rlsv3.UnimplementedRateLimitServiceServer
+	rules    []DescriptorRule
+	limiters []core.RateLimiter
+	// Limiters for the limit overrides Envoy sends, by profile.
+	overrides map[core.LimitProfile]core.RateLimiter
+	mx        sync.Mutex
+}
+
+// NewService returns a service applying the first matching rule to each
+// descriptor. Descriptors no rule matches are never limited.
+func NewService(rules []DescriptorRule) *Service {
+	s := &Service{rules: rules, overrides: map[core.LimitProfile]core.RateLimiter{}}
+	for _, rule := range rules {
+		s.limiters = append(s.limiters, newLimiter(rule.Limit))
+	}
+	return s
+}
+
+type descriptorKey struct{}
+
+func newLimiter(profile core.LimitProfile) core.RateLimiter {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      profile.RATE_LIMIT,
+		REFILL_INTERVAL: profile.REFILL_INTERVAL,
+		KEY_FUNC: func(r *http.Request) string {
+			key, _ := r.Context().Value(descriptorKey{}).(string)
+			return key
+		},
+		HEADER_POLICY: &core.HeaderPolicy{
+			Limit:      "x-ratelimit-limit",
+			Remaining:  "x-ratelimit-remaining",
+			RetryAfter: "retry-after",
+		},
+	})
+	limiter.Run()
+	return limiter
+}
+
+func (s *Service) ShouldRateLimit(ctx context.Context, request *rlsv3.RateLimitRequest) (*rlsv3.RateLimitResponse, error) {
+	hits := int64(request.GetHitsAddend())
+	if hits == 0 {
+		hits = 1
+	}
+
+	response := &rlsv3.RateLimitResponse{OverallCode: rlsv3.RateLimitResponse_OK}
+	var tightest *core.Decision
+	var tightestLimiter core.RateLimiter
+	for _, descriptor := range request.GetDescriptors() {
+		limiter, profile := s.limiterFor(request.GetDomain(), descriptor)
+		if limiter == nil {
+			response.Statuses = append(response.Statuses, &rlsv3.RateLimitResponse_DescriptorStatus{
+				Code: rlsv3.RateLimitResponse_OK,
+			})
+			continue
+		}
+
+		key := request.GetDomain() + "|" + descriptorString(descriptor)
+		httpRequest, _ := http.NewRequestWithContext(context.WithValue(ctx, descriptorKey{}, key), http.MethodPost, "/", nil)
+		d := limiter.Decide(core.WithCost(httpRequest, hits))
+
+		status := &rlsv3.RateLimitResponse_DescriptorStatus{
+			Code:           rlsv3.RateLimitResponse_OK,
+			CurrentLimit:   currentLimit(profile),
+			LimitRemaining: uint32(d.Remaining),
+		}
+		if !d.Allowed {
+			status.Code = rlsv3.RateLimitResponse_OVER_LIMIT
+			status.DurationUntilReset = durationpb.New(d.RetryAfter)
+			response.OverallCode = rlsv3.RateLimitResponse_OVER_LIMIT
+		}
+		response.Statuses = append(response.Statuses, status)
+
+		if tightest == nil || (tightest.Allowed && !d.Allowed) || (tightest.Allowed == d.Allowed && d.Remaining < tightest.Remaining) {
+			tightest, tightestLimiter = &d, limiter
+		}
+	}
+
+	if tightest != nil {
+		tightestLimiter.VisitHeaders(*tightest, func(name string, value []byte) {
+			response.ResponseHeadersToAdd = append(response.ResponseHeadersToAdd, &corev3.HeaderValue{
+				Key:   name,
+				Value: string(value),
+			})
+		})
+	}
+	return response, nil
+}
+
+// limiterFor returns the limiter for a descriptor and its profile: that of
+// the limit override Envoy sent, or of the first matching rule.
+func (s *Service) limiterFor(domain string, descriptor *ratelimitv3.RateLimitDescriptor) (core.RateLimiter, core.LimitProfile) {
+	if override := descriptor.GetLimit(); override != nil && override.GetRequestsPerUnit() > 0 {
+		// The override's unit enum numbers its units like the response's.
+		unit := rlsv3.RateLimitResponse_RateLimit_Unit(override.GetUnit())
+		profile := core.LimitProfile{
+			RATE_LIMIT:      int64(override.GetRequestsPerUnit()),
+			REFILL_INTERVAL: unitDuration(unit) / time.Duration(override.GetRequestsPerUnit()),
+		}
+
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		limiter, ok := s.overrides[profile]
+		if !ok {
+			limiter = newLimiter(profile)
+			s.overrides[profile] = limiter
+		}
+		return limiter, profile
+	}
+
+	for i, rule := range s.rules {
+		if rule.Domain == domain && matches(rule.Entries, descriptor.GetEntries()) {
+			return s.limiters[i], rule.Limit
+		}
+	}
+	return nil, core.LimitProfile{}
+}
+
+// matches reports whether entries match a rule's entry patterns.
+func matches(patterns []string, entries []*ratelimitv3.RateLimitDescriptor_Entry) bool {
+	if len(patterns) != len(entries) {
+		return false
+	}
+	for i, pattern := range patterns {
+		key, value, hasValue := strings.Cut(pattern, "=")
+		if entries[i].GetKey() != key || (hasValue && entries[i].GetValue() != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func descriptorString(descriptor *ratelimitv3.RateLimitDescriptor) string {
+	parts := make([]string, len(descriptor.GetEntries()))
+	for i, entry := range descriptor.GetEntries() {
+		parts[i] = entry.GetKey() + "=" + entry.GetValue()
+	}
+	return strings.Join(parts, "|")
+}
+
+// currentLimit describes a token bucket's sustained rate the way Envoy
+// reports limits, in the largest unit that keeps the count whole.
+func currentLimit(profile core.LimitProfile) *rlsv3.RateLimitResponse_RateLimit {
+	units := []rlsv3.RateLimitResponse_RateLimit_Unit{
+		rlsv3.RateLimitResponse_RateLimit_SECOND,
+		rlsv3.RateLimitResponse_RateLimit_MINUTE,
+		rlsv3.RateLimitResponse_RateLimit_HOUR,
+		rlsv3.RateLimitResponse_RateLimit_DAY,
+	}
+	if profile.REFILL_INTERVAL <= 0 {
+		return nil
+	}
+	for _, unit := range units {
+		if unitDuration(unit) >= profile.REFILL_INTERVAL {
+			return &rlsv3.RateLimitResponse_RateLimit{
+				RequestsPerUnit: uint32(unitDuration(unit) / profile.REFILL_INTERVAL),
+				Unit:            unit,
+			}
+		}
+	}
+	return &rlsv3.RateLimitResponse_RateLimit{RequestsPerUnit: 1, Unit: rlsv3.RateLimitResponse_RateLimit_DAY}
+}
+
+func unitDuration(unit rlsv3.RateLimitResponse_RateLimit_Unit) time.Duration {
+	switch unit {
+	case rlsv3.RateLimitResponse_RateLimit_SECOND:
+		return time.Second
+	case rlsv3.RateLimitResponse_RateLimit_MINUTE:
+		return time.Minute
+	case rlsv3.RateLimitResponse_RateLimit_HOUR:
+		return time.Hour
+	case rlsv3.RateLimitResponse_RateLimit_DAY:
+		return 24 * time.Hour
+	case rlsv3.RateLimitResponse_RateLimit_WEEK:
+		return 7 * 24 * time.Hour
+	case rlsv3.RateLimitResponse_RateLimit_MONTH:
+		return 30 * 24 * time.Hour
+	case rlsv3.RateLimitResponse_RateLimit_YEAR:
+		return 365 * 24 * time.Hour
+	}
+	return time.Second
+}
@@ -0,0 +1,116 @@
+package envoyrls
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	ratelimitv3 "github.com/envoyproxy/go-control-plane/envoy/extensions/common/ratelimit/v3"
+	rlsv3 "github.com/envoyproxy/go-control-plane/envoy/service/ratelimit/v3"
+)
+
+func descriptor(entries ...string) *ratelimitv3.RateLimitDescriptor {
+	d := &ratelimitv3.RateLimitDescriptor{}
+	for i := 0; i+1 < len(entries); i += 2 {
+		d.Entries = append(d.Entries, &ratelimitv3.RateLimitDescriptor_Entry{Key: entries[i], Value: entries[i+1]})
+	}
+	return d
+}
+
+func TestShouldRateLimit(t *testing.T) {
+	rules := []DescriptorRule{
+		{Domain: "edge", Entries: []string{"remote_address"}, Limit: core.LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: time.Minute}},
+		{Domain: "edge", Entries: []string{"path=/login"}, Limit: core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Minute}},
+	}
+
+	tests := []struct {
+		name        string
+		domain      string
+		first       *ratelimitv3.RateLimitDescriptor
+		second      *ratelimitv3.RateLimitDescriptor
+		hits        uint32
+		wantOverall rlsv3.RateLimitResponse_Code
+	}{
+		{
+			name:        "same value",
+			domain:      "edge",
+			first:       descriptor("remote_address", "203.0.113.7"),
+			second:      descriptor("remote_address", "203.0.113.7"),
+			wantOverall: rlsv3.RateLimitResponse_OVER_LIMIT,
+		},
+		{
+			name:        "other value",
+			domain:      "edge",
+			first:       descriptor("remote_address", "203.0.113.7"),
+			second:      descriptor("remote_address", "203.0.113.8"),
+			wantOverall: rlsv3.RateLimitResponse_OK,
+		},
+		{
+			name:        "fixed value",
+			domain:      "edge",
+			first:       descriptor("path", "/login"),
+			second:      descriptor("path", "/login"),
+			wantOverall: rlsv3.RateLimitResponse_OK,
+		},
+		{
+			name:        "hits addend",
+			domain:      "edge",
+			first:       descriptor("path", "/login"),
+			second:      descriptor("path", "/login"),
+			hits:        2,
+			wantOverall: rlsv3.RateLimitResponse_OVER_LIMIT,
+		},
+		{
+			name:        "no rule",
+			domain:      "other",
+			first:       descriptor("remote_address", "203.0.113.7"),
+			second:      descriptor("remote_address", "203.0.113.7"),
+			wantOverall: rlsv3.RateLimitResponse_OK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service := NewService(rules)
+			for i, d := range []*ratelimitv3.RateLimitDescriptor{test.first, test.second} {
+				response, err := service.ShouldRateLimit(context.Background(), &rlsv3.RateLimitRequest{
+					Domain:      test.domain,
+					Descriptors: []*ratelimitv3.RateLimitDescriptor{d},
+					HitsAddend:  test.hits,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := rlsv3.RateLimitResponse_OK
+				if i == 1 {
+					want = test.wantOverall
+				}
+				if response.OverallCode != want {
+					t.Fatalf("call %d: overall code %v, want %v", i, response.OverallCode, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCurrentLimit(t *testing.T) {
+	tests := []struct {
+		interval time.Duration
+		wantN    uint32
+		wantUnit rlsv3.RateLimitResponse_RateLimit_Unit
+	}{
+		{interval: 100 * time.Millisecond, wantN: 10, wantUnit: rlsv3.RateLimitResponse_RateLimit_SECOND},
+		{interval: time.Second, wantN: 1, wantUnit: rlsv3.RateLimitResponse_RateLimit_SECOND},
+		{interval: 6 * time.Second, wantN: 10, wantUnit: rlsv3.RateLimitResponse_RateLimit_MINUTE},
+		{interval: 2 * time.Hour, wantN: 12, wantUnit: rlsv3.RateLimitResponse_RateLimit_DAY},
+		{interval: 48 * time.Hour, wantN: 1, wantUnit: rlsv3.RateLimitResponse_RateLimit_DAY},
+	}
+
+	for _, test := range tests {
+		got := currentLimit(core.LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: test.interval})
+		if got.RequestsPerUnit != test.wantN || got.Unit != test.wantUnit {
+			t.Errorf("%v: %d per %v, want %d per %v", test.interval, got.RequestsPerUnit, got.Unit, test.wantN, test.wantUnit)
+		}
+	}
+}
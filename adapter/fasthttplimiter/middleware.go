@@ -0,0 +1,60 @@
+package fasthttplimiter
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/internal/fastrequest"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// tooManyRequests is the default rejection body, encoded once.
+const tooManyRequests = `{"message":"Too many requests","success":false}` + "\n"
+
+// RateLimitMiddleware returns a wrapper limiting the requests reaching a
+// fasthttp handler.
+func RateLimitMiddleware(limiter core.RateLimiter) func(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			if Allow(limiter, ctx) {
+				h(ctx)
+			}
+		}
+	}
+}
+
+// Allow charges the request and sets the rate limit headers. Rejected
+// requests get their response written and false is returned. Key funcs see
+// the request's headers, path and client address but not its body.
+func Allow(limiter core.RateLimiter, ctx *fasthttp.RequestCtx) bool {
+	request := fastrequest.New(ctx)
+	d := limiter.Decide(request)
+
+	if d.Exempt {
+		return true
+	}
+	limiter.VisitHeaders(d, ctx.Response.Header.SetBytesV)
+	if d.Allowed {
+		return true
+	}
+
+	challenge := limiter.Config().CHALLENGE_HANDLER
+	if challenge != nil && runChallenge(ctx, challenge, request, d.Key) {
+		return false
+	}
+	ctx.SetStatusCode(fasthttp.StatusTooManyRequests)
+	ctx.SetContentType("application/json")
+	ctx.SetBodyString(tooManyRequests)
+	return false
+}
+
+// runChallenge calls a net/http CHALLENGE_HANDLER against the fasthttp
+// response.
+func runChallenge(ctx *fasthttp.RequestCtx, challenge core.ChallengeHandler, request *http.Request, key string) bool {
+	handled := false
+	fasthttpadaptor.NewFastHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = challenge(w, request, key)
+	}))(ctx)
+	return handled
+}
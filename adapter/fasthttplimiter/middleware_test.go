@@ -0,0 +1,86 @@
+package fasthttplimiter
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/valyala/fasthttp"
+)
+
+func newCtx(uri, ip string, header map[string]string) *fasthttp.RequestCtx {
+	var request fasthttp.Request
+	request.SetRequestURI(uri)
+	for name, value := range header {
+		request.Header.Set(name, value)
+	}
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Init(&request, &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}, nil)
+	return ctx
+}
+
+func clientIP(r *http.Request) string {
+	return core.StripPort(r.RemoteAddr)
+}
+
+func TestAllowReadsRequestCtx(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyFunc func(r *http.Request) string
+		first   *fasthttp.RequestCtx
+		second  *fasthttp.RequestCtx
+		want    int
+	}{
+		{
+			name:    "same client address",
+			keyFunc: clientIP,
+			first:   newCtx("http://example.com/a", "203.0.113.7", nil),
+			second:  newCtx("http://example.com/b", "203.0.113.7", nil),
+			want:    fasthttp.StatusTooManyRequests,
+		},
+		{
+			name:    "other client address",
+			keyFunc: clientIP,
+			first:   newCtx("http://example.com/a", "203.0.113.7", nil),
+			second:  newCtx("http://example.com/a", "203.0.113.8", nil),
+			want:    fasthttp.StatusOK,
+		},
+		{
+			name:    "header key",
+			keyFunc: func(r *http.Request) string { return r.Header.Get("X-Api-Key") },
+			first:   newCtx("http://example.com/a", "203.0.113.7", map[string]string{"X-Api-Key": "one"}),
+			second:  newCtx("http://example.com/a", "203.0.113.8", map[string]string{"X-Api-Key": "one"}),
+			want:    fasthttp.StatusTooManyRequests,
+		},
+		{
+			name:    "path and query key",
+			keyFunc: func(r *http.Request) string { return r.URL.Path + "?" + r.URL.RawQuery },
+			first:   newCtx("http://example.com/a?page=1", "203.0.113.7", nil),
+			second:  newCtx("http://example.com/a?page=2", "203.0.113.7", nil),
+			want:    fasthttp.StatusOK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        test.keyFunc,
+			})
+			handler := RateLimitMiddleware(limiter)(func(ctx *fasthttp.RequestCtx) {})
+
+			handler(test.first)
+			if code := test.first.Response.StatusCode(); code != fasthttp.StatusOK {
+				t.Fatalf("first request status %d, want 200", code)
+			}
+			handler(test.second)
+			if code := test.second.Response.StatusCode(); code != test.want {
+				t.Fatalf("second request status %d, want %d", code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package fasthttplimiter
+
+import (
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// GetBucketStatus reports the limiter's current bucket status.
+func GetBucketStatus(limiter core.RateLimiter) fasthttp.RequestHandler {
+	return fasthttpadaptor.NewFastHTTPHandlerFunc(stdhttp.GetBucketStatus(limiter))
+}
+
+// ResetKey clears the bucket of the key given in the "key" query parameter.
+func ResetKey(limiter core.RateLimiter) fasthttp.RequestHandler {
+	return fasthttpadaptor.NewFastHTTPHandlerFunc(stdhttp.ResetKey(limiter))
+}
+
+// ResetAll clears every bucket.
+func ResetAll(limiter core.RateLimiter) fasthttp.RequestHandler {
+	return fasthttpadaptor.NewFastHTTPHandlerFunc(stdhttp.ResetAll(limiter))
+}
@@ -0,0 +1,89 @@
+package fiberlimiter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/internal/fastrequest"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+type fiberCtxKey struct{}
+
+// RateLimitMiddleware limits the requests reaching the next fiber handler.
+// The limiter sees the request, without its body, as an *http.Request, so
+// core key funcs work unchanged; KeyFromLocals and Ctx give them access to
+// fiber's context. Requests are keyed by the template of the route they
+// match, whether the middleware is mounted with app.Use or on the route.
+func RateLimitMiddleware(limiter core.RateLimiter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		allowed, err := allow(limiter, c)
+		if !allowed {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// Ctx returns the fiber context a request passed to a key func came from,
+// or nil outside this adapter.
+func Ctx(r *http.Request) *fiber.Ctx {
+	c, _ := r.Context().Value(fiberCtxKey{}).(*fiber.Ctx)
+	return c
+}
+
+// KeyFromLocals returns a KEY_FUNC keying by the string stored in fiber's
+// locals under name, e.g. a user ID set by an auth middleware. Requests
+// without it are keyed by client IP.
+func KeyFromLocals(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		c := Ctx(r)
+		if c == nil {
+			return "ip:" + core.StripPort(r.RemoteAddr)
+		}
+		if key, ok := c.Locals(name).(string); ok && key != "" {
+			return key
+		}
+		return "ip:" + c.IP()
+	}
+}
+
+// allow charges the request and sets the rate limit headers. Rejected
+// requests get their response written and false is returned.
+func allow(limiter core.RateLimiter, c *fiber.Ctx) (bool, error) {
+	request := fastrequest.New(c.Context())
+	request = request.WithContext(context.WithValue(c.UserContext(), fiberCtxKey{}, c))
+	if template := routeTemplate(c); template != "" && template != "/" {
+		request = core.WithRouteTemplate(request, template)
+	}
+	d := limiter.Decide(request)
+
+	if d.Exempt {
+		return true, nil
+	}
+	limiter.VisitHeaders(d, c.Response().Header.SetBytesV)
+	if d.Allowed {
+		return true, nil
+	}
+
+	challenge := limiter.Config().CHALLENGE_HANDLER
+	if challenge != nil && runChallenge(c, challenge, request, d.Key) {
+		return false, nil
+	}
+	return false, c.Status(http.StatusTooManyRequests).JSON(map[string]interface{}{
+		"success": false,
+		"message": "Too many requests",
+	})
+}
+
+// runChallenge calls a net/http CHALLENGE_HANDLER against fiber's
+// response.
+func runChallenge(c *fiber.Ctx, challenge core.ChallengeHandler, request *http.Request, key string) bool {
+	handled := false
+	fasthttpadaptor.NewFastHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handled = challenge(w, request, key)
+	}))(c.Context())
+	return handled
+}
@@ -0,0 +1,117 @@
+package fiberlimiter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// routeTable is an app's routes by method, excluding middleware, as of the
+// handler count it was built at.
+type routeTable struct {
+	handlers  uint32
+	routes    map[string][]fiber.Route
+	templates map[string]map[string]bool
+}
+
+// routeTables caches each app's routeTable.
+var routeTables sync.Map
+
+// routeTemplate returns the template of the route a request is for, e.g.
+// /users/:id, or "" if none matches. Mounted with app.Use, the middleware's
+// own route is just the prefix it was mounted at, so unless that is one of
+// the app's routes, the routes registered for the request's method are
+// matched against its path instead, the first registered winning as in
+// fiber.
+func routeTemplate(c *fiber.Ctx) string {
+	app := c.App()
+	table, _ := routeTables.Load(app)
+	if t, ok := table.(*routeTable); !ok || t.handlers != app.HandlersCount() {
+		table = newRouteTable(app)
+		routeTables.Store(app, table)
+	}
+
+	config := app.Config()
+	path := c.Path()
+	if !config.StrictRouting {
+		path = strings.TrimRight(path, "/")
+	}
+	if route := c.Route(); route != nil && table.(*routeTable).templates[c.Method()][route.Path] {
+		return route.Path
+	}
+	for _, r := range table.(*routeTable).routes[c.Method()] {
+		if matchRoute(r.Path, path, !config.CaseSensitive) {
+			return r.Path
+		}
+	}
+	return ""
+}
+
+func newRouteTable(app *fiber.App) *routeTable {
+	table := &routeTable{
+		handlers:  app.HandlersCount(),
+		routes:    map[string][]fiber.Route{},
+		templates: map[string]map[string]bool{},
+	}
+	for _, route := range app.GetRoutes(true) {
+		table.routes[route.Method] = append(table.routes[route.Method], route)
+		if table.templates[route.Method] == nil {
+			table.templates[route.Method] = map[string]bool{}
+		}
+		table.templates[route.Method][route.Path] = true
+	}
+	return table
+}
+
+// matchRoute reports whether path matches a fiber route template segment
+// by segment. Parameters (:id) match any segment, optional ones (:id?) also
+// a missing one, and wildcards (*, +) the rest of the path. Segments mixing
+// literals and parameters, such as /:file.:ext, match by their literal
+// prefix only.
+func matchRoute(template, path string, fold bool) bool {
+	templateSegments := segments(template)
+	pathSegments := segments(path)
+
+	for i, segment := range templateSegments {
+		switch {
+		case strings.HasPrefix(segment, "*"):
+			return true
+		case strings.HasPrefix(segment, "+"):
+			return i < len(pathSegments)
+		case i >= len(pathSegments):
+			for _, rest := range templateSegments[i:] {
+				if !strings.HasSuffix(rest, "?") && !strings.HasPrefix(rest, "*") {
+					return false
+				}
+			}
+			return true
+		case strings.HasPrefix(segment, ":"):
+		case strings.Contains(segment, ":"):
+			if !hasPrefix(pathSegments[i], segment[:strings.IndexByte(segment, ':')], fold) {
+				return false
+			}
+		case fold && !strings.EqualFold(segment, pathSegments[i]), !fold && segment != pathSegments[i]:
+			return false
+		}
+	}
+	return len(pathSegments) == len(templateSegments)
+}
+
+func segments(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func hasPrefix(s, prefix string, fold bool) bool {
+	if len(s) < len(prefix) {
+		return false
+	}
+	if fold {
+		return strings.EqualFold(s[:len(prefix)], prefix)
+	}
+	return s[:len(prefix)] == prefix
+}
@@ -0,0 +1,112 @@
+package fiberlimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		fold     bool
+		want     bool
+	}{
+		{template: "/", path: "", want: true},
+		{template: "/users", path: "/users", want: true},
+		{template: "/users", path: "/Users", want: false},
+		{template: "/users", path: "/Users", fold: true, want: true},
+		{template: "/users/:id", path: "/users/42", want: true},
+		{template: "/users/:id", path: "/users", want: false},
+		{template: "/users/:id", path: "/users/42/posts", want: false},
+		{template: "/users/:id?", path: "/users", want: true},
+		{template: "/files/*", path: "/files/a/b", want: true},
+		{template: "/files/*", path: "/files", want: true},
+		{template: "/files/+", path: "/files", want: false},
+		{template: "/files/+", path: "/files/a", want: true},
+		{template: "/img/v:version", path: "/img/v2", want: true},
+		{template: "/img/v:version", path: "/img/x2", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.template+" "+test.path, func(t *testing.T) {
+			if got := matchRoute(test.template, test.path, test.fold); got != test.want {
+				t.Fatalf("matchRoute(%q, %q) = %v, want %v", test.template, test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMiddlewareRouteTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mount  func(app *fiber.App, middleware fiber.Handler)
+		target string
+		want   string
+	}{
+		{
+			name: "app.Use",
+			mount: func(app *fiber.App, middleware fiber.Handler) {
+				app.Use(middleware)
+			},
+			target: "/users/42",
+			want:   "/users/:id",
+		},
+		{
+			name: "group Use",
+			mount: func(app *fiber.App, middleware fiber.Handler) {
+				app.Group("/api", middleware).Get("/users/:id", func(c *fiber.Ctx) error { return nil })
+			},
+			target: "/api/users/42",
+			want:   "/api/users/:id",
+		},
+		{
+			name: "on the route",
+			mount: func(app *fiber.App, middleware fiber.Handler) {
+				app.Get("/posts/:slug", middleware, func(c *fiber.Ctx) error { return nil })
+			},
+			target: "/posts/hello",
+			want:   "/posts/:slug",
+		},
+		{
+			// Falls back to the raw path.
+			name: "unmatched",
+			mount: func(app *fiber.App, middleware fiber.Handler) {
+				app.Use(middleware)
+			},
+			target: "/missing",
+			want:   "/missing",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got string
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{
+				RATE_LIMIT:      10,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC: func(r *http.Request) string {
+					got = core.RouteTemplate(r)
+					return "client"
+				},
+			})
+
+			app := fiber.New()
+			test.mount(app, RateLimitMiddleware(limiter))
+			app.Get("/users/:id", func(c *fiber.Ctx) error { return nil })
+
+			if _, err := app.Test(httptest.NewRequest(http.MethodGet, test.target, nil)); err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Fatalf("route template %q, want %q", got, test.want)
+			}
+		})
+	}
+}
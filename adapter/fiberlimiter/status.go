@@ -0,0 +1,23 @@
+package fiberlimiter
+
+import (
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// GetBucketStatus reports the limiter's current bucket status.
+func GetBucketStatus(limiter core.RateLimiter) fiber.Handler {
+	return adaptor.HTTPHandlerFunc(stdhttp.GetBucketStatus(limiter))
+}
+
+// ResetKey clears the bucket of the key given in the "key" query parameter.
+func ResetKey(limiter core.RateLimiter) fiber.Handler {
+	return adaptor.HTTPHandlerFunc(stdhttp.ResetKey(limiter))
+}
+
+// ResetAll clears every bucket.
+func ResetAll(limiter core.RateLimiter) fiber.Handler {
+	return adaptor.HTTPHandlerFunc(stdhttp.ResetAll(limiter))
+}
@@ -0,0 +1,41 @@
+package ginlimiter
+
+import (
+	"io"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+// BandwidthMiddleware paces the response bytes written by later handlers.
+func BandwidthMiddleware(limiter core.BandwidthLimiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Writer = &pacedWriter{
+			ResponseWriter: ctx.Writer,
+			paced:          limiter.PaceWriter(ctx.Request, ctx.Writer),
+		}
+		ctx.Next()
+	}
+}
+
+// UploadMiddleware paces, or with REJECT_OVER_LIMIT fails, the reads of the
+// request body made by later handlers.
+func UploadMiddleware(limiter core.BandwidthLimiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request.Body = limiter.PaceBody(ctx.Request)
+		ctx.Next()
+	}
+}
+
+type pacedWriter struct {
+	gin.ResponseWriter
+	paced io.Writer
+}
+
+func (w *pacedWriter) Write(data []byte) (int, error) {
+	return w.paced.Write(data)
+}
+
+func (w *pacedWriter) WriteString(s string) (int, error) {
+	return w.paced.Write([]byte(s))
+}
@@ -0,0 +1,22 @@
+package ginlimiter
+
+import (
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+// Limit gives a single route its own limiter, configured and running:
+//
+//	r.POST("/upload", ginlimiter.Limit(uploadHandler, core.RateLimiterConfig{
+//		RATE_LIMIT:      10,
+//		REFILL_INTERVAL: time.Minute,
+//	}))
+func Limit(handler gin.HandlerFunc, config core.RateLimiterConfig) gin.HandlerFunc {
+	limiter := newRunningLimiter(config)
+
+	return func(ctx *gin.Context) {
+		if allow(limiter, ctx) {
+			handler(ctx)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package ginlimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		limit     int64
+		paths     []string
+		wantCodes []int
+	}{
+		{
+			name:      "within the limit",
+			limit:     2,
+			paths:     []string{"/upload", "/upload"},
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name:      "past the limit",
+			limit:     1,
+			paths:     []string{"/upload", "/upload"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "other routes unaffected",
+			limit:     1,
+			paths:     []string{"/upload", "/upload", "/other"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := gin.New()
+			ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+			engine.GET("/upload", Limit(ok, core.RateLimiterConfig{
+				RATE_LIMIT:      test.limit,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        func(r *http.Request) string { return "client" },
+			}))
+			engine.GET("/other", ok)
+
+			for i, path := range test.paths {
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+				if w.Code != test.wantCodes[i] {
+					t.Fatalf("request %d to %s: status %d, want %d", i, path, w.Code, test.wantCodes[i])
+				}
+			}
+		})
+	}
+}
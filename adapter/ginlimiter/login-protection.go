@@ -0,0 +1,31 @@
+package ginlimiter
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+// LoginProtectionMiddleware rejects login attempts from locked out keys and
+// reports the outcome of every other attempt to the protector.
+func LoginProtectionMiddleware(protector core.LoginProtector) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key, allowed, retryAfter := protector.Allow(ctx.Request)
+
+		if !allowed {
+			ctx.Writer.Header().Set("Retry-After", fmt.Sprintf("%f second", retryAfter.Seconds()))
+
+			ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+				"success": false,
+				"message": "Too many failed login attempts",
+			})
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+		protector.Record(key, ctx.Request, ctx.Writer.Status())
+	}
+}
@@ -0,0 +1,45 @@
+package ginlimiter
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+func RateLimitMiddleware(limiter core.RateLimiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if allow(limiter, ctx) {
+			ctx.Next()
+		}
+	}
+}
+
+// allow charges the request and sets the rate limit headers. Rejected
+// requests get their response written and the context aborted.
+func allow(limiter core.RateLimiter, ctx *gin.Context) bool {
+	if fullPath := ctx.FullPath(); fullPath != "" {
+		ctx.Request = core.WithRouteTemplate(ctx.Request, fullPath)
+	}
+	d := limiter.Decide(ctx.Request)
+
+	if d.Exempt {
+		return true
+	}
+	limiter.WriteHeaders(ctx.Writer.Header(), d)
+	if d.Allowed {
+		return true
+	}
+
+	challenge := limiter.Config().CHALLENGE_HANDLER
+	if challenge != nil && challenge(ctx.Writer, ctx.Request, d.Key) {
+		ctx.Abort()
+		return false
+	}
+	ctx.JSON(http.StatusTooManyRequests, map[string]interface{}{
+		"success": false,
+		"message": "Too many requests",
+	})
+	ctx.Abort()
+	return false
+}
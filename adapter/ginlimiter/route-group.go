@@ -0,0 +1,116 @@
+package ginlimiter
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+// LimitGroup is a gin RouterGroup with a default limit that child groups and
+// routes inherit or override. Only one limit ever applies to a request: the
+// route's own override if it has one, otherwise that of the innermost group
+// with a limit. Overrides may be tighter or looser than the parent's.
+type LimitGroup struct {
+	*gin.RouterGroup
+	policies *groupPolicies
+}
+
+// groupPolicies is shared by a LimitGroup and all of its children. Routes
+// may be registered while requests are served, hence the lock.
+type groupPolicies struct {
+	routes map[string]core.RateLimiter
+	groups map[string]core.RateLimiter
+	mx     sync.RWMutex
+}
+
+// NewLimitGroup attaches config as the default limit for every route
+// registered on group.
+func NewLimitGroup(group *gin.RouterGroup, config core.RateLimiterConfig) *LimitGroup {
+	policies := &groupPolicies{
+		routes: map[string]core.RateLimiter{},
+		groups: map[string]core.RateLimiter{},
+	}
+	policies.groups[group.BasePath()] = newRunningLimiter(config)
+
+	group.Use(func(ctx *gin.Context) {
+		if allow(policies.resolve(ctx.Request.Method, ctx.FullPath()), ctx) {
+			ctx.Next()
+		}
+	})
+
+	return &LimitGroup{RouterGroup: group, policies: policies}
+}
+
+// Group creates a child group. With a nil config the child inherits the
+// parent's limit.
+func (g *LimitGroup) Group(relativePath string, config *core.RateLimiterConfig, handlers ...gin.HandlerFunc) *LimitGroup {
+	child := g.RouterGroup.Group(relativePath, handlers...)
+	if config != nil {
+		g.policies.mx.Lock()
+		g.policies.groups[child.BasePath()] = newRunningLimiter(*config)
+		g.policies.mx.Unlock()
+	}
+	return &LimitGroup{RouterGroup: child, policies: g.policies}
+}
+
+// LimitRoute registers a route whose limit replaces the group's.
+func (g *LimitGroup) LimitRoute(httpMethod, relativePath string, config core.RateLimiterConfig, handlers ...gin.HandlerFunc) gin.IRoutes {
+	routes := g.RouterGroup.Handle(httpMethod, relativePath, handlers...)
+
+	g.policies.mx.Lock()
+	defer g.policies.mx.Unlock()
+	g.policies.routes[httpMethod+" "+joinRoutePath(g.RouterGroup, relativePath)] = newRunningLimiter(config)
+	return routes
+}
+
+// resolve returns the limiter that applies to a route template.
+func (p *groupPolicies) resolve(method, fullPath string) core.RateLimiter {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	if limiter, ok := p.routes[method+" "+fullPath]; ok {
+		return limiter
+	}
+
+	var best core.RateLimiter
+	bestLength := -1
+	for basePath, limiter := range p.groups {
+		if hasPathPrefix(fullPath, basePath) && len(basePath) > bestLength {
+			best, bestLength = limiter, len(basePath)
+		}
+	}
+	if best == nil {
+		// Unmatched routes have no template, so fall back to the
+		// outermost group.
+		for basePath, limiter := range p.groups {
+			if bestLength < 0 || len(basePath) < bestLength {
+				best, bestLength = limiter, len(basePath)
+			}
+		}
+	}
+	return best
+}
+
+func newRunningLimiter(config core.RateLimiterConfig) core.RateLimiter {
+	limiter := core.New()
+	limiter.SetConfig(config)
+	limiter.Run()
+	return limiter
+}
+
+// hasPathPrefix reports whether path lies under prefix on a segment boundary.
+func hasPathPrefix(path, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		return true
+	}
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// joinRoutePath is the full path gin registers relativePath under in
+// group, which gin works out the same way for a child group's base path.
+func joinRoutePath(group *gin.RouterGroup, relativePath string) string {
+	return group.Group(relativePath).BasePath()
+}
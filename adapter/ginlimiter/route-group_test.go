@@ -0,0 +1,53 @@
+package ginlimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+func TestLimitRouteMatchesGinPaths(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		basePath     string
+		relativePath string
+		requestPath  string
+	}{
+		{name: "plain", basePath: "/api", relativePath: "/users", requestPath: "/api/users"},
+		{name: "double slash", basePath: "/api/", relativePath: "//users", requestPath: "/api/users"},
+		{name: "trailing slash", basePath: "/api", relativePath: "/users/", requestPath: "/api/users/"},
+		{name: "dot segments", basePath: "/api/v1/..", relativePath: "./users", requestPath: "/api/users"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			engine := gin.New()
+			group := NewLimitGroup(engine.Group(test.basePath), core.RateLimiterConfig{
+				RATE_LIMIT:      100,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        func(r *http.Request) string { return "client" },
+			})
+			group.LimitRoute(http.MethodGet, test.relativePath, core.RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        func(r *http.Request) string { return "client" },
+			}, func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+			var codes []int
+			for i := 0; i < 2; i++ {
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.requestPath, nil))
+				codes = append(codes, w.Code)
+			}
+			if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+				t.Fatalf("status codes %v, want [200 429]", codes)
+			}
+		})
+	}
+}
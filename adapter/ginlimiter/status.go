@@ -0,0 +1,76 @@
+package ginlimiter
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+// GetBucketStatus reports the limiter's status, listing the buckets of
+// keys a page at a time as stdhttp.GetBucketStatus does.
+func GetBucketStatus(limiter core.RateLimiter) gin.HandlerFunc {
+	return gin.WrapF(stdhttp.GetBucketStatus(limiter))
+}
+
+// StreamBucketStatus sends live bucket status as Server-Sent Events.
+func StreamBucketStatus(limiter core.RateLimiter) gin.HandlerFunc {
+	return gin.WrapF(stdhttp.StreamBucketStatus(limiter))
+}
+
+// ResetKey resets the bucket of the key given in the "key" query parameter.
+// It only answers POST and DELETE, so links and prefetches can't reset
+// buckets.
+func ResetKey(limiter core.RateLimiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !resetMethodAllowed(ctx) {
+			return
+		}
+		key := ctx.Query("key")
+		if key == "" {
+			ctx.JSON(http.StatusBadRequest, map[string]interface{}{
+				"success": false,
+				"message": "key is required",
+			})
+			return
+		}
+
+		limiter.ResetKey(key)
+		ctx.JSON(http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "Bucket reset",
+		})
+	}
+}
+
+// ResetAll resets every bucket. Like ResetKey, it only answers POST and
+// DELETE.
+func ResetAll(limiter core.RateLimiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !resetMethodAllowed(ctx) {
+			return
+		}
+		limiter.ResetAll()
+
+		ctx.JSON(http.StatusOK, map[string]interface{}{
+			"success": true,
+			"message": "All buckets reset",
+		})
+	}
+}
+
+// resetMethodAllowed answers requests to the reset handlers that are not
+// POST or DELETE with 405 Method Not Allowed.
+func resetMethodAllowed(ctx *gin.Context) bool {
+	if method := ctx.Request.Method; method == http.MethodPost || method == http.MethodDelete {
+		return true
+	}
+
+	ctx.Header("Allow", "POST, DELETE")
+	ctx.AbortWithStatusJSON(http.StatusMethodNotAllowed, map[string]interface{}{
+		"success": false,
+		"message": "use POST or DELETE",
+	})
+	return false
+}
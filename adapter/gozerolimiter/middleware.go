@@ -0,0 +1,85 @@
+package gozerolimiter
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/zeromicro/go-zero/rest"
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+// RateLimitError is what ErrorHandlerMiddleware passes to httpx.ErrorCtx
+// for rejected requests.
+type RateLimitError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded, retry after %s", e.RetryAfter)
+}
+
+// Middleware limits the requests of a go-zero REST server or route group.
+// Rejected requests get the JSON 429 response:
+//
+//	server.Use(gozerolimiter.Middleware(rateLimiter))
+//	server.AddRoutes(routes, rest.WithMiddlewares([]rest.Middleware{gozerolimiter.Middleware(apiLimiter)}, ...))
+//
+// zrpc servers are gRPC servers; use grpclimiter.UnaryServerInterceptor with
+// AddUnaryInterceptors.
+func Middleware(limiter core.RateLimiter) rest.Middleware {
+	return middleware(limiter, func(w http.ResponseWriter, r *http.Request, d core.Decision) {
+		httpx.WriteJsonCtx(r.Context(), w, http.StatusTooManyRequests, map[string]interface{}{
+			"success": false,
+			"message": "Too many requests",
+		})
+	})
+}
+
+// ErrorHandlerMiddleware is Middleware handing rejections to httpx.ErrorCtx
+// as a *RateLimitError, so the handler registered with
+// httpx.SetErrorHandlerCtx encodes them like the service's other errors.
+// It should answer a *RateLimitError with a 429.
+func ErrorHandlerMiddleware(limiter core.RateLimiter) rest.Middleware {
+	return middleware(limiter, func(w http.ResponseWriter, r *http.Request, d core.Decision) {
+		httpx.ErrorCtx(r.Context(), w, &RateLimitError{Key: d.Key, RetryAfter: d.RetryAfter})
+	})
+}
+
+func middleware(limiter core.RateLimiter, reject func(w http.ResponseWriter, r *http.Request, d core.Decision)) rest.Middleware {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			d := limiter.Decide(r)
+
+			if d.Exempt {
+				next(w, r)
+				return
+			}
+			limiter.WriteHeaders(w.Header(), d)
+			if d.Allowed {
+				next(w, r)
+				return
+			}
+
+			challenge := limiter.Config().CHALLENGE_HANDLER
+			if challenge != nil && challenge(w, r, d.Key) {
+				return
+			}
+			reject(w, r, d)
+		}
+	}
+}
+
+// ClaimKey returns a KEY_FUNC keying requests by the named JWT claim, which
+// go-zero's JWT middleware stores in the request context, falling back to
+// the client IP for anonymous requests.
+func ClaimKey(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if value := r.Context().Value(name); value != nil {
+			return fmt.Sprintf("%s:%v", name, value)
+		}
+		return "ip:" + core.StripPort(r.RemoteAddr)
+	}
+}
@@ -0,0 +1,87 @@
+package gozerolimiter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/zeromicro/go-zero/rest"
+	"github.com/zeromicro/go-zero/rest/httpx"
+)
+
+func clientKey(r *http.Request) string {
+	return core.StripPort(r.RemoteAddr)
+}
+
+func TestMiddleware(t *testing.T) {
+	httpx.SetErrorHandlerCtx(func(ctx context.Context, err error) (int, any) {
+		var limited *RateLimitError
+		if errors.As(err, &limited) {
+			return http.StatusTooManyRequests, map[string]string{"error": "slow down"}
+		}
+		return http.StatusInternalServerError, nil
+	})
+	defer httpx.SetErrorHandlerCtx(nil)
+
+	tests := []struct {
+		name       string
+		middleware func(limiter core.RateLimiter) rest.Middleware
+		wantBody   string
+	}{
+		{name: "JSON response", middleware: Middleware, wantBody: `"Too many requests"`},
+		{name: "error handler", middleware: ErrorHandlerMiddleware, wantBody: `"slow down"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: clientKey})
+			handler := test.middleware(limiter)(func(w http.ResponseWriter, r *http.Request) {})
+
+			wantCodes := []int{http.StatusOK, http.StatusTooManyRequests}
+			for i, want := range wantCodes {
+				w := httptest.NewRecorder()
+				handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				if w.Code != want {
+					t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+				}
+				if w.Header().Get("X-RateLimit-Remaining") == "" {
+					t.Fatalf("request %d: no X-RateLimit-Remaining header", i)
+				}
+				if want == http.StatusTooManyRequests && !strings.Contains(w.Body.String(), test.wantBody) {
+					t.Fatalf("body %q, want it to contain %s", w.Body.String(), test.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestClaimKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		claim any
+		want  string
+	}{
+		{name: "claim", claim: "alice", want: "sub:alice"},
+		{name: "numeric claim", claim: 42, want: "sub:42"},
+		{name: "anonymous", want: "ip:203.0.113.7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = "203.0.113.7:1234"
+			if test.claim != nil {
+				r = r.WithContext(context.WithValue(r.Context(), "sub", test.claim))
+			}
+			if got := ClaimKey("sub")(r); got != test.want {
+				t.Fatalf("key %q, want %q", got, test.want)
+			}
+		})
+	}
+}
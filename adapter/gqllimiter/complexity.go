@@ -0,0 +1,98 @@
+package gqllimiter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/99designs/gqlgen/complexity"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// ComplexityLimit is a gqlgen extension that charges each operation as many
+// tokens as its calculated complexity, instead of one per HTTP request, so
+// a single expensive query can't slip through on a cheap request's budget.
+// Wrap the server in Middleware so the limiter sees the HTTP request:
+//
+//	srv := handler.NewDefaultServer(generated.NewExecutableSchema(cfg))
+//	srv.Use(gqllimiter.NewComplexityLimit(rateLimiter))
+//	http.Handle("/query", gqllimiter.Middleware(srv))
+type ComplexityLimit struct {
+	limiter core.RateLimiter
+	schema  graphql.ExecutableSchema
+}
+
+// NewComplexityLimit returns the extension for limiter.
+func NewComplexityLimit(limiter core.RateLimiter) *ComplexityLimit {
+	return &ComplexityLimit{limiter: limiter}
+}
+
+func (c *ComplexityLimit) ExtensionName() string {
+	return "RateLimitComplexity"
+}
+
+func (c *ComplexityLimit) Validate(schema graphql.ExecutableSchema) error {
+	c.schema = schema
+	return nil
+}
+
+// MutateOperationContext charges the operation before it runs. Rejected
+// operations fail with a RATE_LIMITED error carrying retryAfter seconds.
+func (c *ComplexityLimit) MutateOperationContext(ctx context.Context, rc *graphql.OperationContext) *gqlerror.Error {
+	cost := int64(complexity.Calculate(c.schema, rc.Operation, rc.Variables))
+	if cost < 1 {
+		cost = 1
+	}
+
+	exchange := exchangeFrom(ctx)
+	d := c.limiter.Decide(core.WithCost(exchange.request, cost))
+	if d.Exempt {
+		return nil
+	}
+	if exchange.w != nil {
+		c.limiter.WriteHeaders(exchange.w.Header(), d)
+	}
+	if d.Allowed {
+		return nil
+	}
+
+	return &gqlerror.Error{
+		Message: fmt.Sprintf("Too many requests, query complexity %d exceeds the remaining budget", cost),
+		Extensions: map[string]interface{}{
+			"code":       "RATE_LIMITED",
+			"retryAfter": d.RetryAfter.Seconds(),
+		},
+	}
+}
+
+type exchangeKey struct{}
+
+// exchange is the HTTP request and response an operation came in on.
+type exchange struct {
+	request *http.Request
+	w       http.ResponseWriter
+}
+
+// Middleware makes the HTTP request and response visible to
+// ComplexityLimit, so KEY_FUNC can key by client and the rate limit
+// headers reach the client.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		e := &exchange{w: w}
+		request = request.WithContext(context.WithValue(request.Context(), exchangeKey{}, e))
+		e.request = request
+		next.ServeHTTP(w, request)
+	})
+}
+
+// exchangeFrom returns the exchange Middleware stored, or one with a bare
+// request carrying ctx when the server isn't wrapped.
+func exchangeFrom(ctx context.Context) *exchange {
+	if e, ok := ctx.Value(exchangeKey{}).(*exchange); ok {
+		return e
+	}
+	request, _ := http.NewRequestWithContext(ctx, http.MethodPost, "/", nil)
+	return &exchange{request: request}
+}
@@ -0,0 +1,75 @@
+package gqllimiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// fakeSchema charges users(first: n) n times the complexity of a user.
+type fakeSchema struct {
+	schema *ast.Schema
+}
+
+func (s fakeSchema) Schema() *ast.Schema { return s.schema }
+
+func (s fakeSchema) Complexity(typeName, fieldName string, childComplexity int, args map[string]any) (int, bool) {
+	if typeName == "Query" && fieldName == "users" {
+		return int(args["first"].(int64)) * childComplexity, true
+	}
+	return 0, false
+}
+
+func (s fakeSchema) Exec(ctx context.Context) graphql.ResponseHandler { return nil }
+
+func TestComplexityLimit(t *testing.T) {
+	schema := gqlparser.MustLoadSchema(&ast.Source{Input: `
+		type Query { users(first: Int!): [User!]! }
+		type User { name: String! }
+	`})
+
+	tests := []struct {
+		name          string
+		query         string
+		wantAllowed   bool
+		wantRemaining string
+	}{
+		{name: "cheap query", query: `{ users(first: 2) { name } }`, wantAllowed: true, wantRemaining: "8"},
+		{name: "within the budget", query: `{ users(first: 10) { name } }`, wantAllowed: true, wantRemaining: "0"},
+		{name: "over the budget", query: `{ users(first: 11) { name } }`, wantAllowed: false, wantRemaining: "10"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return "client" }})
+			extension := NewComplexityLimit(limiter)
+			extension.Validate(fakeSchema{schema: schema})
+
+			doc := gqlparser.MustLoadQuery(schema, test.query)
+			rc := &graphql.OperationContext{Operation: doc.Operations[0]}
+
+			w := httptest.NewRecorder()
+			Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				err := extension.MutateOperationContext(r.Context(), rc)
+				if allowed := err == nil; allowed != test.wantAllowed {
+					t.Fatalf("allowed = %v, want %v (%v)", allowed, test.wantAllowed, err)
+				}
+				if err != nil && err.Extensions["code"] != "RATE_LIMITED" {
+					t.Fatalf("error code %v, want RATE_LIMITED", err.Extensions["code"])
+				}
+			})).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/query", nil))
+
+			if got := w.Header().Get("X-RateLimit-Remaining"); got != test.wantRemaining {
+				t.Fatalf("X-RateLimit-Remaining = %q, want %q", got, test.wantRemaining)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: admin.proto
+
+package adminpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	RateLimitAdmin_ListLimiters_FullMethodName = "/ratelimit.admin.v1.RateLimitAdmin/ListLimiters"
+	RateLimitAdmin_ListKeys_FullMethodName     = "/ratelimit.admin.v1.RateLimitAdmin/ListKeys"
+	RateLimitAdmin_InspectKey_FullMethodName   = "/ratelimit.admin.v1.RateLimitAdmin/InspectKey"
+	RateLimitAdmin_ResetKey_FullMethodName     = "/ratelimit.admin.v1.RateLimitAdmin/ResetKey"
+	RateLimitAdmin_ResetAll_FullMethodName     = "/ratelimit.admin.v1.RateLimitAdmin/ResetAll"
+	RateLimitAdmin_SetLimit_FullMethodName     = "/ratelimit.admin.v1.RateLimitAdmin/SetLimit"
+	RateLimitAdmin_GetLists_FullMethodName     = "/ratelimit.admin.v1.RateLimitAdmin/GetLists"
+	RateLimitAdmin_AllowKey_FullMethodName     = "/ratelimit.admin.v1.RateLimitAdmin/AllowKey"
+	RateLimitAdmin_DenyKey_FullMethodName      = "/ratelimit.admin.v1.RateLimitAdmin/DenyKey"
+	RateLimitAdmin_UnlistKey_FullMethodName    = "/ratelimit.admin.v1.RateLimitAdmin/UnlistKey"
+)
+
+// RateLimitAdminClient is the client API for RateLimitAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// RateLimitAdmin manages limiters at runtime, as the admin REST API of
+// adapter/stdhttp does.
+type RateLimitAdminClient interface {
+	// The limiters and their limits.
+	ListLimiters(ctx context.Context, in *ListLimitersRequest, opts ...grpc.CallOption) (*ListLimitersResponse, error)
+	// Every key's bucket.
+	ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error)
+	// One key's buckets. Fails with NOT_FOUND if the key has none.
+	InspectKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ListKeysResponse, error)
+	// Reset a key.
+	ResetKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Reset every key.
+	ResetAll(ctx context.Context, in *LimiterRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Adjust a limiter's limit. Fields left zero keep their value.
+	SetLimit(ctx context.Context, in *SetLimitRequest, opts ...grpc.CallOption) (*Empty, error)
+	// The allow and deny lists.
+	GetLists(ctx context.Context, in *LimiterRequest, opts ...grpc.CallOption) (*KeyLists, error)
+	// Allow a key.
+	AllowKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Deny a key, for a while or until removed.
+	DenyKey(ctx context.Context, in *DenyKeyRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Take a key off the lists.
+	UnlistKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error)
+}
+
+type rateLimitAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewRateLimitAdminClient(cc grpc.ClientConnInterface) RateLimitAdminClient {
+	return &rateLimitAdminClient{cc}
+}
+
+func (c *rateLimitAdminClient) ListLimiters(ctx context.Context, in *ListLimitersRequest, opts ...grpc.CallOption) (*ListLimitersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListLimitersResponse)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_ListLimiters_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) ListKeys(ctx context.Context, in *ListKeysRequest, opts ...grpc.CallOption) (*ListKeysResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListKeysResponse)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_ListKeys_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) InspectKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*ListKeysResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListKeysResponse)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_InspectKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) ResetKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_ResetKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) ResetAll(ctx context.Context, in *LimiterRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_ResetAll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) SetLimit(ctx context.Context, in *SetLimitRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_SetLimit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) GetLists(ctx context.Context, in *LimiterRequest, opts ...grpc.CallOption) (*KeyLists, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyLists)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_GetLists_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) AllowKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_AllowKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) DenyKey(ctx context.Context, in *DenyKeyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_DenyKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *rateLimitAdminClient) UnlistKey(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, RateLimitAdmin_UnlistKey_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RateLimitAdminServer is the server API for RateLimitAdmin service.
+// All implementations must embed UnimplementedRateLimitAdminServer
+// for forward compatibility.
+//
+// RateLimitAdmin manages limiters at runtime, as the admin REST API of
+// adapter/stdhttp does.
+type RateLimitAdminServer interface {
+	// The limiters and their limits.
+	ListLimiters(context.Context, *ListLimitersRequest) (*ListLimitersResponse, error)
+	// Every key's bucket.
+	ListKeys(context.Context, *ListKeysRequest) (*ListKeysResponse, error)
+	// One key's buckets. Fails with NOT_FOUND if the key has none.
+	InspectKey(context.Context, *KeyRequest) (*ListKeysResponse, error)
+	// Reset a key.
+	ResetKey(context.Context, *KeyRequest) (*Empty, error)
+	// Reset every key.
+	ResetAll(context.Context, *LimiterRequest) (*Empty, error)
+	// Adjust a limiter's limit. Fields left zero keep their value.
+	SetLimit(context.Context, *SetLimitRequest) (*Empty, error)
+	// The allow and deny lists.
+	GetLists(context.Context, *LimiterRequest) (*KeyLists, error)
+	// Allow a key.
+	AllowKey(context.Context, *KeyRequest) (*Empty, error)
+	// Deny a key, for a while or until removed.
+	DenyKey(context.Context, *DenyKeyRequest) (*Empty, error)
+	// Take a key off the lists.
+	UnlistKey(context.Context, *KeyRequest) (*Empty, error)
+	mustEmbedUnimplementedRateLimitAdminServer()
+}
+
+// UnimplementedRateLimitAdminServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRateLimitAdminServer struct{}
+
+func (UnimplementedRateLimitAdminServer) ListLimiters(context.Context, *ListLimitersRequest) (*ListLimitersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLimiters not implemented")
+}
+func (UnimplementedRateLimitAdminServer) ListKeys(context.Context, *ListKeysRequest) (*ListKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListKeys not implemented")
+}
+func (UnimplementedRateLimitAdminServer) InspectKey(context.Context, *KeyRequest) (*ListKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method InspectKey not implemented")
+}
+func (UnimplementedRateLimitAdminServer) ResetKey(context.Context, *KeyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetKey not implemented")
+}
+func (UnimplementedRateLimitAdminServer) ResetAll(context.Context, *LimiterRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetAll not implemented")
+}
+func (UnimplementedRateLimitAdminServer) SetLimit(context.Context, *SetLimitRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetLimit not implemented")
+}
+func (UnimplementedRateLimitAdminServer) GetLists(context.Context, *LimiterRequest) (*KeyLists, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLists not implemented")
+}
+func (UnimplementedRateLimitAdminServer) AllowKey(context.Context, *KeyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AllowKey not implemented")
+}
+func (UnimplementedRateLimitAdminServer) DenyKey(context.Context, *DenyKeyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DenyKey not implemented")
+}
+func (UnimplementedRateLimitAdminServer) UnlistKey(context.Context, *KeyRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnlistKey not implemented")
+}
+func (UnimplementedRateLimitAdminServer) mustEmbedUnimplementedRateLimitAdminServer() {}
+func (UnimplementedRateLimitAdminServer) testEmbeddedByValue()                        {}
+
+// UnsafeRateLimitAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to RateLimitAdminServer will
+// result in compilation errors.
+type UnsafeRateLimitAdminServer interface {
+	mustEmbedUnimplementedRateLimitAdminServer()
+}
+
+func RegisterRateLimitAdminServer(s grpc.ServiceRegistrar, srv RateLimitAdminServer) {
+	// If the following call pancis, it indicates UnimplementedRateLimitAdminServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&RateLimitAdmin_ServiceDesc, srv)
+}
+
+func _RateLimitAdmin_ListLimiters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListLimitersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).ListLimiters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_ListLimiters_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).ListLimiters(ctx, req.(*ListLimitersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_ListKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).ListKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_ListKeys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).ListKeys(ctx, req.(*ListKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_InspectKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).InspectKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_InspectKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).InspectKey(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_ResetKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).ResetKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_ResetKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).ResetKey(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_ResetAll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LimiterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).ResetAll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_ResetAll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).ResetAll(ctx, req.(*LimiterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_SetLimit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetLimitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).SetLimit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_SetLimit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).SetLimit(ctx, req.(*SetLimitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_GetLists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LimiterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).GetLists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_GetLists_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).GetLists(ctx, req.(*LimiterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_AllowKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).AllowKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_AllowKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).AllowKey(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_DenyKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DenyKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).DenyKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_DenyKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).DenyKey(ctx, req.(*DenyKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RateLimitAdmin_UnlistKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RateLimitAdminServer).UnlistKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RateLimitAdmin_UnlistKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RateLimitAdminServer).UnlistKey(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// RateLimitAdmin_ServiceDesc is the grpc.ServiceDesc for RateLimitAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var RateLimitAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ratelimit.admin.v1.RateLimitAdmin",
+	HandlerType: (*RateLimitAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListLimiters",
+			Handler:    _RateLimitAdmin_ListLimiters_Handler,
+		},
+		{
+			MethodName: "ListKeys",
+			Handler:    _RateLimitAdmin_ListKeys_Handler,
+		},
+		{
+			MethodName: "InspectKey",
+			Handler:    _RateLimitAdmin_InspectKey_Handler,
+		},
+		{
+			MethodName: "ResetKey",
+			Handler:    _RateLimitAdmin_ResetKey_Handler,
+		},
+		{
+			MethodName: "ResetAll",
+			Handler:    _RateLimitAdmin_ResetAll_Handler,
+		},
+		{
+			MethodName: "SetLimit",
+			Handler:    _RateLimitAdmin_SetLimit_Handler,
+		},
+		{
+			MethodName: "GetLists",
+			Handler:    _RateLimitAdmin_GetLists_Handler,
+		},
+		{
+			MethodName: "AllowKey",
+			Handler:    _RateLimitAdmin_AllowKey_Handler,
+		},
+		{
+			MethodName: "DenyKey",
+			Handler:    _RateLimitAdmin_DenyKey_Handler,
+		},
+		{
+			MethodName: "UnlistKey",
+			Handler:    _RateLimitAdmin_UnlistKey_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin.proto",
+}
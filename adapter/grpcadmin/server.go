@@ -0,0 +1,211 @@
+package grpcadmin
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/grpcadmin/adminpb"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type ServerConfig struct {
+	// Limiters managed by name, e.g. {"api": apiLimiter, "login": loginLimiter}.
+	LIMITERS map[string]core.RateLimiter
+	// Decides whether a call may use the service, e.g. by checking a token
+	// in the incoming metadata. Calls it refuses fail with
+	// codes.Unauthenticated. Nil serves everyone, so the server must be
+	// protected some other way.
+	AUTH func(ctx context.Context) bool
+}
+
+// Server implements the RateLimitAdmin service of admin.proto, the admin
+// REST API of stdhttp.NewAdmin as gRPC, for tooling that wants typed
+// calls:
+//
+//	server := grpc.NewServer()
+//	adminpb.RegisterRateLimitAdminServer(server, grpcadmin.NewServer(grpcadmin.ServerConfig{
+//		LIMITERS: map[string]core.RateLimiter{"api": apiLimiter},
+//		AUTH:     checkToken,
+//	}))
+//
+// Calls naming an unknown limiter fail with codes.NotFound, and SetLimit
+// with a limit Validate refuses fails with codes.InvalidArgument.
+type Server struct {
+	adminpb.UnimplementedRateLimitAdminServer
+	ServerConfig
+}
+
+func NewServer(config ServerConfig) *Server {
+	return &Server{ServerConfig: config}
+}
+
+// authorize fails the call unless AUTH lets it through.
+func (s *Server) authorize(ctx context.Context) error {
+	if s.AUTH != nil && !s.AUTH(ctx) {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	return nil
+}
+
+// limiter authorizes the call and looks up the limiter it names.
+func (s *Server) limiter(ctx context.Context, name string) (core.RateLimiter, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	limiter, ok := s.LIMITERS[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no such limiter %q", name)
+	}
+	return limiter, nil
+}
+
+func (s *Server) ListLimiters(ctx context.Context, request *adminpb.ListLimitersRequest) (*adminpb.ListLimitersResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	response := &adminpb.ListLimitersResponse{}
+	for name, limiter := range s.LIMITERS {
+		config := limiter.Config()
+		bucketStatus := limiter.Status()
+		response.Limiters = append(response.Limiters, &adminpb.Limiter{
+			Name:           name,
+			RateLimit:      config.RATE_LIMIT,
+			RefillInterval: durationpb.New(config.REFILL_INTERVAL),
+			Keyed:          config.Keyed(),
+			Tokens:         bucketStatus.CurrentBucketSize,
+			TrackedKeys:    int32(bucketStatus.TrackedKeys),
+		})
+	}
+	sort.Slice(response.Limiters, func(i, j int) bool { return response.Limiters[i].Name < response.Limiters[j].Name })
+	return response, nil
+}
+
+func (s *Server) ListKeys(ctx context.Context, request *adminpb.ListKeysRequest) (*adminpb.ListKeysResponse, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	return keysResponse(limiter.Keys()), nil
+}
+
+func (s *Server) InspectKey(ctx context.Context, request *adminpb.KeyRequest) (*adminpb.ListKeysResponse, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	statuses := limiter.InspectKey(request.GetKey())
+	if len(statuses) == 0 {
+		return nil, status.Error(codes.NotFound, "key has no bucket")
+	}
+	return keysResponse(statuses), nil
+}
+
+func (s *Server) ResetKey(ctx context.Context, request *adminpb.KeyRequest) (*adminpb.Empty, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	limiter.ResetKey(request.GetKey())
+	return &adminpb.Empty{}, nil
+}
+
+func (s *Server) ResetAll(ctx context.Context, request *adminpb.LimiterRequest) (*adminpb.Empty, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	limiter.ResetAll()
+	return &adminpb.Empty{}, nil
+}
+
+// SetLimit applies the new limit with the limiter's SetLimit, as
+// stdhttp.NewAdmin does.
+func (s *Server) SetLimit(ctx context.Context, request *adminpb.SetLimitRequest) (*adminpb.Empty, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	var interval time.Duration
+	if request.RefillInterval != nil {
+		interval = request.RefillInterval.AsDuration()
+		if interval <= 0 {
+			return nil, status.Error(codes.InvalidArgument, "refill_interval must be a positive duration")
+		}
+	}
+	if err := limiter.SetLimit(request.GetRateLimit(), interval); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return &adminpb.Empty{}, nil
+}
+
+func (s *Server) GetLists(ctx context.Context, request *adminpb.LimiterRequest) (*adminpb.KeyLists, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	lists := limiter.KeyLists()
+	response := &adminpb.KeyLists{Allowed: lists.Allowed, Denied: map[string]*timestamppb.Timestamp{}}
+	for key, until := range lists.Denied {
+		response.Denied[key] = timestamp(until)
+	}
+	return response, nil
+}
+
+func (s *Server) AllowKey(ctx context.Context, request *adminpb.KeyRequest) (*adminpb.Empty, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	limiter.AllowKey(request.GetKey())
+	return &adminpb.Empty{}, nil
+}
+
+func (s *Server) DenyKey(ctx context.Context, request *adminpb.DenyKeyRequest) (*adminpb.Empty, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	d := request.GetDuration().AsDuration()
+	if d < 0 {
+		return nil, status.Error(codes.InvalidArgument, "duration must not be negative")
+	}
+	limiter.DenyKey(request.GetKey(), d)
+	return &adminpb.Empty{}, nil
+}
+
+func (s *Server) UnlistKey(ctx context.Context, request *adminpb.KeyRequest) (*adminpb.Empty, error) {
+	limiter, err := s.limiter(ctx, request.GetLimiter())
+	if err != nil {
+		return nil, err
+	}
+	limiter.UnlistKey(request.GetKey())
+	return &adminpb.Empty{}, nil
+}
+
+func keysResponse(statuses []core.KeyStatus) *adminpb.ListKeysResponse {
+	response := &adminpb.ListKeysResponse{}
+	for _, key := range statuses {
+		response.Keys = append(response.Keys, &adminpb.KeyStatus{
+			Key:         key.Key,
+			Set:         key.Set,
+			Tokens:      key.Tokens,
+			Limit:       key.Limit,
+			LastSeen:    timestamp(key.LastSeen),
+			LockedUntil: timestamp(key.LockedUntil),
+		})
+	}
+	return response
+}
+
+// timestamp converts t, leaving the zero time unset.
+func timestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
@@ -0,0 +1,185 @@
+package grpcadmin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/grpcadmin/adminpb"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestServer(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      2,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	decide := func(client string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		return limiter.Decide(r).Allowed
+	}
+	decide("alice")
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	adminpb.RegisterRateLimitAdminServer(server, NewServer(ServerConfig{
+		LIMITERS: map[string]core.RateLimiter{"api": limiter},
+		AUTH: func(ctx context.Context) bool {
+			md, _ := metadata.FromIncomingContext(ctx)
+			return len(md.Get("authorization")) == 1 && md.Get("authorization")[0] == "Bearer t0ken"
+		},
+	}))
+	go server.Serve(listener)
+	defer server.Stop()
+
+	cc, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+	client := adminpb.NewRateLimitAdminClient(cc)
+	authorized := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer t0ken")
+
+	steps := []struct {
+		name     string
+		call     func(ctx context.Context) error
+		noAuth   bool
+		wantCode codes.Code
+		check    func() bool
+	}{
+		{
+			name: "unauthorized",
+			call: func(ctx context.Context) error {
+				_, err := client.ListLimiters(ctx, &adminpb.ListLimitersRequest{})
+				return err
+			},
+			noAuth:   true,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name: "list limiters",
+			call: func(ctx context.Context) error {
+				response, err := client.ListLimiters(ctx, &adminpb.ListLimitersRequest{})
+				if err == nil && (len(response.Limiters) != 1 || response.Limiters[0].Name != "api" || response.Limiters[0].RateLimit != 2) {
+					t.Errorf("limiters %v", response.Limiters)
+				}
+				return err
+			},
+		},
+		{
+			name: "unknown limiter",
+			call: func(ctx context.Context) error {
+				_, err := client.ListKeys(ctx, &adminpb.ListKeysRequest{Limiter: "web"})
+				return err
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "inspect key",
+			call: func(ctx context.Context) error {
+				response, err := client.InspectKey(ctx, &adminpb.KeyRequest{Limiter: "api", Key: "alice"})
+				if err == nil && (len(response.Keys) != 1 || int(response.Keys[0].Tokens) != 1 || response.Keys[0].LastSeen == nil) {
+					t.Errorf("keys %v", response.Keys)
+				}
+				return err
+			},
+		},
+		{
+			name: "inspect unknown key",
+			call: func(ctx context.Context) error {
+				_, err := client.InspectKey(ctx, &adminpb.KeyRequest{Limiter: "api", Key: "bob"})
+				return err
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "reset key",
+			call: func(ctx context.Context) error {
+				_, err := client.ResetKey(ctx, &adminpb.KeyRequest{Limiter: "api", Key: "alice"})
+				return err
+			},
+			check: func() bool { return len(limiter.InspectKey("alice")) == 0 },
+		},
+		{
+			name: "set limit",
+			call: func(ctx context.Context) error {
+				_, err := client.SetLimit(ctx, &adminpb.SetLimitRequest{Limiter: "api", RateLimit: 5, RefillInterval: durationpb.New(time.Minute)})
+				return err
+			},
+			check: func() bool {
+				config := limiter.Config()
+				return config.RATE_LIMIT == 5 && config.REFILL_INTERVAL == time.Minute
+			},
+		},
+		{
+			name: "set invalid limit",
+			call: func(ctx context.Context) error {
+				_, err := client.SetLimit(ctx, &adminpb.SetLimitRequest{Limiter: "api", RefillInterval: durationpb.New(-time.Second)})
+				return err
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "deny key",
+			call: func(ctx context.Context) error {
+				_, err := client.DenyKey(ctx, &adminpb.DenyKeyRequest{Limiter: "api", Key: "mallory", Duration: durationpb.New(time.Minute)})
+				return err
+			},
+			check: func() bool { return !decide("mallory") },
+		},
+		{
+			name: "get lists",
+			call: func(ctx context.Context) error {
+				lists, err := client.GetLists(ctx, &adminpb.LimiterRequest{Limiter: "api"})
+				if err == nil && lists.Denied["mallory"] == nil {
+					t.Errorf("lists %v", lists)
+				}
+				return err
+			},
+		},
+		{
+			name: "unlist key",
+			call: func(ctx context.Context) error {
+				_, err := client.UnlistKey(ctx, &adminpb.KeyRequest{Limiter: "api", Key: "mallory"})
+				return err
+			},
+			check: func() bool { return decide("mallory") },
+		},
+		{
+			name: "allow key",
+			call: func(ctx context.Context) error {
+				_, err := client.AllowKey(ctx, &adminpb.KeyRequest{Limiter: "api", Key: "carol"})
+				return err
+			},
+			check: func() bool { return len(limiter.KeyLists().Allowed) == 1 },
+		},
+	}
+
+	for _, step := range steps {
+		ctx := authorized
+		if step.noAuth {
+			ctx = context.Background()
+		}
+		if code := status.Code(step.call(ctx)); code != step.wantCode {
+			t.Errorf("%s: code %v, want %v", step.name, code, step.wantCode)
+		}
+		if step.check != nil && !step.check() {
+			t.Errorf("%s: limiter unchanged", step.name)
+		}
+	}
+}
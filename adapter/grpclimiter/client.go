@@ -0,0 +1,43 @@
+package grpclimiter
+
+import (
+	"context"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryClientInterceptor paces outbound unary RPCs, holding each call until
+// the limiter has a token for it so a client stays under an upstream's
+// limit instead of being throttled or banned. The request the limiter sees
+// carries the outgoing metadata and has the dial target as its host.
+//
+//	grpc.NewClient(target, grpc.WithUnaryInterceptor(grpclimiter.UnaryClientInterceptor(rateLimiter)))
+func UnaryClientInterceptor(limiter core.RateLimiter) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := pace(ctx, limiter, method, cc); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor paces how often outbound streams are opened.
+func StreamClientInterceptor(limiter core.RateLimiter) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := pace(ctx, limiter, method, cc); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// pace waits for a token, failing with the context's status if the call is
+// cancelled or times out first.
+func pace(ctx context.Context, limiter core.RateLimiter, method string, cc *grpc.ClientConn) error {
+	if _, err := limiter.Wait(outgoingRequestFor(ctx, method, cc.Target())); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return nil
+}
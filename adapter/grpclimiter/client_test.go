@@ -0,0 +1,65 @@
+package grpclimiter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	cc, err := grpc.NewClient("passthrough:///upstream.example.com:443", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cc.Close()
+
+	tests := []struct {
+		name     string
+		keyFunc  func(r *http.Request) string
+		second   context.Context
+		wantCode codes.Code
+	}{
+		{
+			name:     "same upstream",
+			keyFunc:  func(r *http.Request) string { return r.Host },
+			second:   context.Background(),
+			wantCode: codes.DeadlineExceeded,
+		},
+		{
+			name:     "other tenant",
+			keyFunc:  func(r *http.Request) string { return r.Header.Get("x-tenant") },
+			second:   metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "two"),
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: test.keyFunc})
+			interceptor := UnaryClientInterceptor(limiter)
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return nil
+			}
+
+			first := metadata.AppendToOutgoingContext(context.Background(), "x-tenant", "one")
+			if err := interceptor(first, "/helloworld.Greeter/SayHello", nil, nil, cc, invoker); err != nil {
+				t.Fatalf("first call failed: %v", err)
+			}
+			ctx, cancel := context.WithTimeout(test.second, 20*time.Millisecond)
+			defer cancel()
+			err := interceptor(ctx, "/helloworld.Greeter/SayHello", nil, nil, cc, invoker)
+			if code := status.Code(err); code != test.wantCode {
+				t.Fatalf("second call code %v, want %v", code, test.wantCode)
+			}
+		})
+	}
+}
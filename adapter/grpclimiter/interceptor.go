@@ -0,0 +1,59 @@
+package grpclimiter
+
+import (
+	"context"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// UnaryServerInterceptor limits unary RPCs. Rejected calls fail with
+// codes.ResourceExhausted:
+//
+//	grpc.NewServer(grpc.UnaryInterceptor(grpclimiter.UnaryServerInterceptor(rateLimiter)))
+func UnaryServerInterceptor(limiter core.RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := allow(ctx, limiter, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// allow charges the RPC and sends the rate limit headers as response
+// metadata. It returns the status error for rejected RPCs.
+func allow(ctx context.Context, limiter core.RateLimiter, fullMethod string) error {
+	d := limiter.Decide(requestFor(ctx, fullMethod))
+
+	if d.Exempt {
+		return nil
+	}
+	header := metadata.MD{}
+	limiter.VisitHeaders(d, func(name string, value []byte) {
+		header.Set(name, string(value))
+	})
+	grpc.SetHeader(ctx, header)
+	if d.Allowed {
+		return nil
+	}
+	return rejection(d)
+}
+
+// rejection is the status returned for a rejected RPC. It carries a
+// google.rpc.RetryInfo detail so standard client retry policies back off
+// for as long as the limiter asks.
+func rejection(d core.Decision) error {
+	st := status.Newf(codes.ResourceExhausted, "Too many requests, retry after %f second", d.RetryAfter.Seconds())
+	withRetry, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(d.RetryAfter),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withRetry.Err()
+}
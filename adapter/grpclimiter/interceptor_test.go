@@ -0,0 +1,110 @@
+package grpclimiter
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// incoming returns the context of an RPC from the peer at ip carrying md.
+func incoming(ip string, md map[string]string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+	return metadata.NewIncomingContext(ctx, metadata.New(md))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      core.RateLimiterConfig
+		second      context.Context
+		secondRoute string
+		wantCode    codes.Code
+	}{
+		{
+			name:        "same peer",
+			config:      core.RateLimiterConfig{KEY_FUNC: PeerKey},
+			second:      incoming("203.0.113.7", nil),
+			secondRoute: "/helloworld.Greeter/SayHello",
+			wantCode:    codes.ResourceExhausted,
+		},
+		{
+			name:        "other peer",
+			config:      core.RateLimiterConfig{KEY_FUNC: PeerKey},
+			second:      incoming("203.0.113.8", nil),
+			secondRoute: "/helloworld.Greeter/SayHello",
+			wantCode:    codes.OK,
+		},
+		{
+			name:        "same metadata key from another peer",
+			config:      core.RateLimiterConfig{KEY_FUNC: MetadataKey("x-api-key")},
+			second:      incoming("203.0.113.8", map[string]string{"x-api-key": "one"}),
+			secondRoute: "/helloworld.Greeter/SayHello",
+			wantCode:    codes.ResourceExhausted,
+		},
+		{
+			name:        "other method",
+			config:      core.RateLimiterConfig{KEY_BY_PATH: true},
+			second:      incoming("203.0.113.7", nil),
+			secondRoute: "/helloworld.Greeter/SayGoodbye",
+			wantCode:    codes.OK,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := test.config
+			config.RATE_LIMIT = 1
+			config.REFILL_INTERVAL = time.Hour
+			limiter := core.New()
+			limiter.SetConfig(config)
+			interceptor := UnaryServerInterceptor(limiter)
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+			first := incoming("203.0.113.7", map[string]string{"x-api-key": "one"})
+			if _, err := interceptor(first, nil, &grpc.UnaryServerInfo{FullMethod: "/helloworld.Greeter/SayHello"}, handler); err != nil {
+				t.Fatalf("first call failed: %v", err)
+			}
+			_, err := interceptor(test.second, nil, &grpc.UnaryServerInfo{FullMethod: test.secondRoute}, handler)
+			if code := status.Code(err); code != test.wantCode {
+				t.Fatalf("second call code %v, want %v", code, test.wantCode)
+			}
+		})
+	}
+}
+
+func TestRejectionRetryInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+	}{
+		{name: "seconds", retryAfter: 3 * time.Second},
+		{name: "sub-second", retryAfter: 250 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			st := status.Convert(rejection(core.Decision{RetryAfter: test.retryAfter}))
+			if st.Code() != codes.ResourceExhausted {
+				t.Fatalf("code %v, want %v", st.Code(), codes.ResourceExhausted)
+			}
+			for _, detail := range st.Details() {
+				if info, ok := detail.(*errdetails.RetryInfo); ok {
+					if got := info.RetryDelay.AsDuration(); got != test.retryAfter {
+						t.Fatalf("retry delay %v, want %v", got, test.retryAfter)
+					}
+					return
+				}
+			}
+			t.Fatal("rejection carries no RetryInfo")
+		})
+	}
+}
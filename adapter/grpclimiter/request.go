@@ -0,0 +1,68 @@
+package grpclimiter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// requestFor describes an RPC as the *http.Request the limiter works on, so
+// gRPC services share the HTTP configuration model: the full method is the
+// URL path (KEY_BY_PATH keys by method), incoming metadata are the headers
+// and the peer address is RemoteAddr.
+func requestFor(ctx context.Context, fullMethod string) *http.Request {
+	md, _ := metadata.FromIncomingContext(ctx)
+	request := newRequest(ctx, fullMethod, md)
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		request.RemoteAddr = p.Addr.String()
+	}
+	return request
+}
+
+// outgoingRequestFor describes an outbound RPC the same way, with the
+// target the client connection dials as the host.
+func outgoingRequestFor(ctx context.Context, fullMethod, target string) *http.Request {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	request := newRequest(ctx, fullMethod, md)
+	request.Host = target
+	return request
+}
+
+func newRequest(ctx context.Context, fullMethod string, md metadata.MD) *http.Request {
+	request := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: fullMethod},
+		Proto:      "HTTP/2.0",
+		ProtoMajor: 2,
+		Header:     http.Header{},
+	}
+	for name, values := range md {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+	if authority := md.Get(":authority"); len(authority) > 0 {
+		request.Host = authority[0]
+	}
+	return request.WithContext(ctx)
+}
+
+// PeerKey is a KEY_FUNC keying RPCs by the caller's IP address.
+func PeerKey(r *http.Request) string {
+	return "ip:" + core.StripPort(r.RemoteAddr)
+}
+
+// MetadataKey returns a KEY_FUNC keying RPCs by the named metadata value,
+// e.g. an API key, falling back to the caller's IP address.
+func MetadataKey(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		if value := r.Header.Get(name); value != "" {
+			return name + ":" + value
+		}
+		return PeerKey(r)
+	}
+}
@@ -0,0 +1,39 @@
+package grpclimiter
+
+import (
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// StreamServerInterceptor limits how often streams are opened and, with a
+// non-nil messages profile, how fast each stream may receive messages. A
+// stream over its message limit is paced rather than failed: RecvMsg waits
+// for a token, which pushes back on the client through flow control.
+//
+//	grpc.NewServer(grpc.StreamInterceptor(grpclimiter.StreamServerInterceptor(rateLimiter,
+//		&core.LimitProfile{RATE_LIMIT: 50, REFILL_INTERVAL: 20 * time.Millisecond})))
+func StreamServerInterceptor(limiter core.RateLimiter, messages *core.LimitProfile) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := allow(ss.Context(), limiter, info.FullMethod); err != nil {
+			return err
+		}
+		if messages != nil {
+			ss = &limitedServerStream{ServerStream: ss, messages: core.NewMessageLimiter(*messages)}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// limitedServerStream paces the messages received on one stream.
+type limitedServerStream struct {
+	grpc.ServerStream
+	messages core.ConnLimiter
+}
+
+func (s *limitedServerStream) RecvMsg(m interface{}) error {
+	if err := s.messages.Wait(s.Context()); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return s.ServerStream.RecvMsg(m)
+}
@@ -0,0 +1,63 @@
+package grpclimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeServerStream is a server stream whose messages are always ready.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeServerStream) Context() context.Context    { return s.ctx }
+func (s *fakeServerStream) RecvMsg(m interface{}) error { return nil }
+
+func TestStreamServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages *core.LimitProfile
+		recv     int
+		wantCode codes.Code
+	}{
+		{name: "unlimited messages", recv: 5, wantCode: codes.OK},
+		{name: "within the message limit", messages: &core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour}, recv: 5, wantCode: codes.OK},
+		{name: "past the message limit", messages: &core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour}, recv: 3, wantCode: codes.DeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: PeerKey})
+			interceptor := StreamServerInterceptor(limiter, test.messages)
+			info := &grpc.StreamServerInfo{FullMethod: "/chat.Chat/Talk"}
+
+			ctx, cancel := context.WithTimeout(incoming("203.0.113.7", nil), 20*time.Millisecond)
+			defer cancel()
+			err := interceptor(nil, &fakeServerStream{ctx: ctx}, info, func(srv interface{}, ss grpc.ServerStream) error {
+				for i := 0; i < test.recv; i++ {
+					if err := ss.RecvMsg(nil); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if code := status.Code(err); code != test.wantCode {
+				t.Fatalf("stream code %v, want %v", code, test.wantCode)
+			}
+
+			// The stream used up the peer's only token for opening streams.
+			err = interceptor(nil, &fakeServerStream{ctx: incoming("203.0.113.7", nil)}, info, func(srv interface{}, ss grpc.ServerStream) error { return nil })
+			if code := status.Code(err); code != codes.ResourceExhausted {
+				t.Fatalf("second stream code %v, want %v", code, codes.ResourceExhausted)
+			}
+		})
+	}
+}
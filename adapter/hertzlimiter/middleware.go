@@ -0,0 +1,58 @@
+package hertzlimiter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/adaptor"
+	"github.com/cloudwego/hertz/pkg/common/utils"
+)
+
+// RateLimitMiddleware limits the requests reaching the next hertz handler:
+//
+//	h := server.Default()
+//	h.Use(hertzlimiter.RateLimitMiddleware(rateLimiter))
+func RateLimitMiddleware(limiter core.RateLimiter) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		if allow(limiter, c, ctx) {
+			ctx.Next(c)
+		}
+	}
+}
+
+// allow charges the request and sets the rate limit headers. Rejected
+// requests get their response written and the context aborted.
+func allow(limiter core.RateLimiter, c context.Context, ctx *app.RequestContext) bool {
+	request, err := adaptor.GetCompatRequest(&ctx.Request)
+	if err != nil {
+		ctx.AbortWithError(http.StatusBadRequest, err)
+		return false
+	}
+	request = request.WithContext(c)
+	request.RemoteAddr = ctx.RemoteAddr().String()
+	if fullPath := ctx.FullPath(); fullPath != "" {
+		request = core.WithRouteTemplate(request, fullPath)
+	}
+	d := limiter.Decide(request)
+
+	if d.Exempt {
+		return true
+	}
+	limiter.VisitHeaders(d, ctx.Response.Header.SetBytesV)
+	if d.Allowed {
+		return true
+	}
+
+	challenge := limiter.Config().CHALLENGE_HANDLER
+	if challenge != nil && challenge(adaptor.GetCompatResponseWriter(&ctx.Response), request, d.Key) {
+		ctx.Abort()
+		return false
+	}
+	ctx.AbortWithStatusJSON(http.StatusTooManyRequests, utils.H{
+		"success": false,
+		"message": "Too many requests",
+	})
+	return false
+}
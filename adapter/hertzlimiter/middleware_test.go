@@ -0,0 +1,61 @@
+package hertzlimiter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    core.RateLimiterConfig
+		paths     []string
+		wantCodes []int
+	}{
+		{
+			name:      "past the limit",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return "client" }},
+			paths:     []string{"/users/1", "/users/2"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name:      "keyed by route template",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_BY_PATH: true},
+			paths:     []string{"/users/1", "/users/2", "/health"},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:      "keyed by raw path",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return r.URL.Path }},
+			paths:     []string{"/users/1", "/users/2", "/users/1"},
+			wantCodes: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(test.config)
+			engine := route.NewEngine(config.NewOptions(nil))
+			engine.Use(RateLimitMiddleware(limiter))
+			ok := func(c context.Context, ctx *app.RequestContext) { ctx.Status(http.StatusOK) }
+			engine.GET("/users/:id", ok)
+			engine.GET("/health", ok)
+
+			for i, path := range test.paths {
+				w := ut.PerformRequest(engine, http.MethodGet, path, nil)
+				if code := w.Result().StatusCode(); code != test.wantCodes[i] {
+					t.Fatalf("request %d to %s: status %d, want %d", i, path, code, test.wantCodes[i])
+				}
+			}
+		})
+	}
+}
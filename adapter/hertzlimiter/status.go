@@ -0,0 +1,38 @@
+package hertzlimiter
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/adaptor"
+)
+
+// GetBucketStatus reports the limiter's current bucket status.
+func GetBucketStatus(limiter core.RateLimiter) app.HandlerFunc {
+	return wrap(stdhttp.GetBucketStatus(limiter))
+}
+
+// ResetKey clears the bucket of the key given in the "key" query parameter.
+func ResetKey(limiter core.RateLimiter) app.HandlerFunc {
+	return wrap(stdhttp.ResetKey(limiter))
+}
+
+// ResetAll clears every bucket.
+func ResetAll(limiter core.RateLimiter) app.HandlerFunc {
+	return wrap(stdhttp.ResetAll(limiter))
+}
+
+// wrap runs a net/http handler against hertz's request and response.
+func wrap(handler http.HandlerFunc) app.HandlerFunc {
+	return func(c context.Context, ctx *app.RequestContext) {
+		request, err := adaptor.GetCompatRequest(&ctx.Request)
+		if err != nil {
+			ctx.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+		handler(adaptor.GetCompatResponseWriter(&ctx.Response), request.WithContext(c))
+	}
+}
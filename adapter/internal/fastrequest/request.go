@@ -0,0 +1,38 @@
+// Package fastrequest builds the *http.Request the limiter decides on from a
+// fasthttp request without copying its body.
+package fastrequest
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/valyala/fasthttp"
+)
+
+// New returns ctx's method, path, query, headers, host and client address
+// as an *http.Request with an empty body and ctx as its context, which is
+// all the limiter and key funcs look at. It is much cheaper than fasthttpadaptor.ConvertRequest,
+// which parses the full URI and copies the body on every request.
+func New(ctx *fasthttp.RequestCtx) *http.Request {
+	header := make(http.Header, ctx.Request.Header.Len())
+	ctx.Request.Header.VisitAll(func(key, value []byte) {
+		header.Add(string(key), string(value))
+	})
+
+	request := &http.Request{
+		Method:     string(ctx.Method()),
+		URL:        &url.URL{Path: string(ctx.Path()), RawQuery: string(ctx.QueryArgs().QueryString())},
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       http.NoBody,
+		Host:       string(ctx.Host()),
+		RemoteAddr: ctx.RemoteAddr().String(),
+		RequestURI: string(ctx.RequestURI()),
+	}
+	if ctx.IsTLS() {
+		request.TLS = ctx.TLSConnectionState()
+	}
+	return request.WithContext(ctx)
+}
@@ -0,0 +1,82 @@
+package kafkalimiter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/segmentio/kafka-go"
+)
+
+// Handler processes one consumed message.
+type Handler func(ctx context.Context, msg kafka.Message) error
+
+// Pace wraps handler so messages are handled no faster than messages
+// allows and, when bytes is not nil, no faster than bytes allows for their
+// key and value, keeping consumers from overwhelming the databases and
+// services behind them. A message waits for its turn until ctx is done, in
+// which case the context's error is returned and handler is not called.
+//
+//	handle := kafkalimiter.Pace(process, messageLimiter, nil)
+//	for {
+//		msg, err := reader.FetchMessage(ctx)
+//		if err != nil {
+//			return err
+//		}
+//		if err := handle(ctx, msg); err != nil {
+//			return err
+//		}
+//		reader.CommitMessages(ctx, msg)
+//	}
+//
+// The limiters see a message as a request for /<topic>/<partition> with
+// the topic as its host and the message headers as its headers; key them
+// with TopicKey or PartitionKey. Without a KEY_FUNC all messages share one
+// bucket.
+func Pace(handler Handler, messages core.RateLimiter, bytes core.BandwidthLimiter) Handler {
+	return func(ctx context.Context, msg kafka.Message) error {
+		request := requestFor(ctx, msg)
+		if messages != nil {
+			if _, err := messages.Wait(request); err != nil {
+				return err
+			}
+		}
+		if bytes != nil {
+			paced := bytes.PaceWriter(request, io.Discard)
+			if _, err := paced.Write(msg.Key); err != nil {
+				return err
+			}
+			if _, err := paced.Write(msg.Value); err != nil {
+				return err
+			}
+		}
+		return handler(ctx, msg)
+	}
+}
+
+// requestFor describes a message as the *http.Request the limiters work on.
+func requestFor(ctx context.Context, msg kafka.Message) *http.Request {
+	request := &http.Request{
+		URL:    &url.URL{Path: "/" + msg.Topic + "/" + strconv.Itoa(msg.Partition)},
+		Host:   msg.Topic,
+		Header: http.Header{},
+	}
+	for _, header := range msg.Headers {
+		request.Header.Add(header.Key, string(header.Value))
+	}
+	return request.WithContext(ctx)
+}
+
+// TopicKey is a KEY_FUNC giving each topic its own budget.
+func TopicKey(r *http.Request) string {
+	return "topic:" + r.Host
+}
+
+// PartitionKey is a KEY_FUNC giving each partition of each topic its own
+// budget.
+func PartitionKey(r *http.Request) string {
+	return "partition:" + r.URL.Path[1:]
+}
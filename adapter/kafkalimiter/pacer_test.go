@@ -0,0 +1,69 @@
+package kafkalimiter
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestPace(t *testing.T) {
+	tests := []struct {
+		name       string
+		keyFunc    func(r *http.Request) string
+		second     kafka.Message
+		wantHandle bool
+	}{
+		{name: "same topic", keyFunc: TopicKey, second: kafka.Message{Topic: "orders", Partition: 1}, wantHandle: false},
+		{name: "other topic", keyFunc: TopicKey, second: kafka.Message{Topic: "payments"}, wantHandle: true},
+		{name: "other partition", keyFunc: PartitionKey, second: kafka.Message{Topic: "orders", Partition: 1}, wantHandle: true},
+		{
+			name:       "header key",
+			keyFunc:    func(r *http.Request) string { return r.Header.Get("tenant") },
+			second:     kafka.Message{Topic: "payments", Headers: []kafka.Header{{Key: "tenant", Value: []byte("acme")}}},
+			wantHandle: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: test.keyFunc})
+			handled := 0
+			handle := Pace(func(ctx context.Context, msg kafka.Message) error {
+				handled++
+				return nil
+			}, limiter, nil)
+
+			first := kafka.Message{Topic: "orders", Headers: []kafka.Header{{Key: "tenant", Value: []byte("acme")}}}
+			if err := handle(context.Background(), first); err != nil {
+				t.Fatal(err)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := handle(ctx, test.second)
+			if (err == nil) != test.wantHandle || (handled == 2) != test.wantHandle {
+				t.Fatalf("second message: error %v after %d handled, want handled %v", err, handled, test.wantHandle)
+			}
+		})
+	}
+}
+
+func TestPaceBytes(t *testing.T) {
+	bytes := core.NewBandwidthLimiter()
+	bytes.SetConfig(core.BandwidthLimiterConfig{BYTES_PER_SECOND: 10, BURST: 10})
+	handle := Pace(func(ctx context.Context, msg kafka.Message) error { return nil }, nil, bytes)
+
+	msg := kafka.Message{Topic: "orders", Key: []byte("key"), Value: []byte("value")}
+	if err := handle(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := handle(ctx, msg); err != context.DeadlineExceeded {
+		t.Fatalf("message over the byte budget: error %v, want context.DeadlineExceeded", err)
+	}
+}
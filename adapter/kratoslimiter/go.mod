@@ -0,0 +1,22 @@
+module github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/kratoslimiter
+
+go 1.22.2
+
+require (
+	github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter v0.0.0
+	github.com/go-kratos/kratos/v2 v2.8.4
+	google.golang.org/grpc v1.70.0
+)
+
+require (
+	github.com/go-kratos/aegis v0.2.0 // indirect
+	github.com/go-playground/form/v4 v4.2.0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/gorilla/mux v1.8.1 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241202173237-19429a94021a // indirect
+	google.golang.org/protobuf v1.36.4 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter => ../..
@@ -0,0 +1,108 @@
+// Package kratoslimiter limits Kratos services with a Kratos middleware,
+// working the same over the HTTP and gRPC transports.
+package kratoslimiter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/middleware"
+	"github.com/go-kratos/kratos/v2/transport"
+	khttp "github.com/go-kratos/kratos/v2/transport/http"
+	"google.golang.org/grpc/peer"
+)
+
+// Reason is the reason of the errors rejected requests fail with.
+const Reason = "RATELIMIT"
+
+// Middleware limits the requests reaching a Kratos handler. Rejected
+// requests fail with a Kratos error of code 429 and reason Reason, which
+// the server's error encoder writes as any other error, and a
+// "retry_after" metadata entry in seconds:
+//
+//	http.NewServer(http.Middleware(kratoslimiter.Middleware(rateLimiter)))
+//	grpc.NewServer(grpc.Middleware(kratoslimiter.Middleware(rateLimiter)))
+//
+// The limiter sees the request as an *http.Request whose path is the
+// operation, e.g. /helloworld.Greeter/SayHello, so KEY_BY_PATH keys by
+// operation, and whose headers are the transport's request headers.
+func Middleware(limiter core.RateLimiter) middleware.Middleware {
+	return func(handler middleware.Handler) middleware.Handler {
+		return func(ctx context.Context, req any) (any, error) {
+			tr, ok := transport.FromServerContext(ctx)
+			if !ok {
+				return handler(ctx, req)
+			}
+
+			d := limiter.Decide(requestFor(ctx, tr))
+			if d.Exempt {
+				return handler(ctx, req)
+			}
+			limiter.VisitHeaders(d, func(name string, value []byte) {
+				tr.ReplyHeader().Set(name, string(value))
+			})
+			if !d.Allowed {
+				return nil, rejection(d)
+			}
+			return handler(ctx, req)
+		}
+	}
+}
+
+// requestFor describes a Kratos request as the *http.Request the limiter
+// works on, with the client's address from the HTTP request or gRPC peer.
+func requestFor(ctx context.Context, tr transport.Transporter) *http.Request {
+	request := &http.Request{
+		Method: http.MethodPost,
+		URL:    &url.URL{Path: tr.Operation()},
+		Header: http.Header{},
+	}
+	header := tr.RequestHeader()
+	for _, name := range header.Keys() {
+		for _, value := range header.Values(name) {
+			request.Header.Add(name, value)
+		}
+	}
+
+	if ht, ok := tr.(khttp.Transporter); ok && ht.Request() != nil {
+		request.Method = ht.Request().Method
+		request.Host = ht.Request().Host
+		request.RemoteAddr = ht.Request().RemoteAddr
+	} else if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		request.RemoteAddr = p.Addr.String()
+	}
+	return request.WithContext(ctx)
+}
+
+// rejection is the error a rejected request fails with.
+func rejection(d core.Decision) error {
+	return errors.New(http.StatusTooManyRequests, Reason, "Too many requests").
+		WithMetadata(map[string]string{"retry_after": strconv.FormatInt(int64(d.RetryAfter.Seconds()+0.999), 10)})
+}
+
+// PeerKey is a KEY_FUNC keying requests by the client's IP address.
+func PeerKey(r *http.Request) string {
+	return "ip:" + core.StripPort(r.RemoteAddr)
+}
+
+// MetadataKey returns a KEY_FUNC keying requests by the named Kratos
+// metadata value, e.g. an x-md-global-tenant propagated from upstream
+// services, or else the request header of that name, falling back to the
+// client's IP address.
+func MetadataKey(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		value := r.Header.Get(name)
+		if md, ok := metadata.FromServerContext(r.Context()); ok && md.Get(name) != "" {
+			value = md.Get(name)
+		}
+		if value != "" {
+			return name + ":" + value
+		}
+		return PeerKey(r)
+	}
+}
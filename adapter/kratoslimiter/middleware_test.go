@@ -0,0 +1,135 @@
+package kratoslimiter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/go-kratos/kratos/v2/errors"
+	"github.com/go-kratos/kratos/v2/metadata"
+	"github.com/go-kratos/kratos/v2/transport"
+	"google.golang.org/grpc/peer"
+)
+
+type headerCarrier http.Header
+
+func (h headerCarrier) Get(key string) string      { return http.Header(h).Get(key) }
+func (h headerCarrier) Set(key, value string)      { http.Header(h).Set(key, value) }
+func (h headerCarrier) Add(key, value string)      { http.Header(h).Add(key, value) }
+func (h headerCarrier) Values(key string) []string { return http.Header(h).Values(key) }
+
+func (h headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(h))
+	for key := range h {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// fakeTransport is a gRPC transport.Transporter for one call.
+type fakeTransport struct {
+	operation string
+	request   headerCarrier
+	reply     headerCarrier
+}
+
+func (t *fakeTransport) Kind() transport.Kind            { return transport.KindGRPC }
+func (t *fakeTransport) Endpoint() string                { return "grpc://127.0.0.1:9000" }
+func (t *fakeTransport) Operation() string               { return t.operation }
+func (t *fakeTransport) RequestHeader() transport.Header { return t.request }
+func (t *fakeTransport) ReplyHeader() transport.Header   { return t.reply }
+
+// call runs a call from the client at ip through handler and returns the
+// transport it ran on.
+func call(handler func(ctx context.Context, req any) (any, error), ip string, header, md map[string]string) (*fakeTransport, error) {
+	tr := &fakeTransport{operation: "/helloworld.Greeter/SayHello", request: headerCarrier{}, reply: headerCarrier{}}
+	for name, value := range header {
+		tr.request.Set(name, value)
+	}
+	ctx := transport.NewServerContext(context.Background(), tr)
+	ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}})
+	if md != nil {
+		values := map[string][]string{}
+		for name, value := range md {
+			values[name] = []string{value}
+		}
+		ctx = metadata.NewServerContext(ctx, metadata.New(values))
+	}
+	_, err := handler(ctx, nil)
+	return tr, err
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyFunc     func(r *http.Request) string
+		firstIP     string
+		secondIP    string
+		header      map[string]string
+		md          map[string]string
+		wantLimited bool
+	}{
+		{name: "same peer", keyFunc: PeerKey, firstIP: "203.0.113.7", secondIP: "203.0.113.7", wantLimited: true},
+		{name: "other peer", keyFunc: PeerKey, firstIP: "203.0.113.7", secondIP: "203.0.113.8", wantLimited: false},
+		{
+			name:        "metadata",
+			keyFunc:     MetadataKey("x-md-global-tenant"),
+			firstIP:     "203.0.113.7",
+			secondIP:    "203.0.113.8",
+			md:          map[string]string{"x-md-global-tenant": "acme"},
+			wantLimited: true,
+		},
+		{
+			name:        "header",
+			keyFunc:     MetadataKey("x-api-key"),
+			firstIP:     "203.0.113.7",
+			secondIP:    "203.0.113.8",
+			header:      map[string]string{"x-api-key": "one"},
+			wantLimited: true,
+		},
+		{
+			name:        "operation",
+			keyFunc:     func(r *http.Request) string { return r.URL.Path },
+			firstIP:     "203.0.113.7",
+			secondIP:    "203.0.113.8",
+			wantLimited: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        test.keyFunc,
+			})
+			handler := Middleware(limiter)(func(ctx context.Context, req any) (any, error) { return "ok", nil })
+
+			if _, err := call(handler, test.firstIP, test.header, test.md); err != nil {
+				t.Fatalf("first call failed: %v", err)
+			}
+			tr, err := call(handler, test.secondIP, test.header, test.md)
+			if !test.wantLimited {
+				if err != nil {
+					t.Fatalf("second call failed: %v", err)
+				}
+				return
+			}
+
+			e := errors.FromError(err)
+			if e == nil || e.Code != http.StatusTooManyRequests || e.Reason != Reason {
+				t.Fatalf("second call error = %v, want a 429 %s error", err, Reason)
+			}
+			if e.Metadata["retry_after"] == "" {
+				t.Fatal("rejection has no retry_after metadata")
+			}
+			if len(tr.reply.Keys()) == 0 {
+				t.Fatal("rejection set no reply headers")
+			}
+		})
+	}
+}
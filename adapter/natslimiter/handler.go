@@ -0,0 +1,93 @@
+package natslimiter
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/nats-io/nats.go"
+)
+
+type ThrottleConfig struct {
+	// Negatively acknowledges excess JetStream messages, asking the server
+	// to redeliver them once the bucket has a token again, instead of
+	// dropping them. Only use it on JetStream subscriptions; on core NATS
+	// the nak would be sent to the message's reply subject.
+	NAK_EXCESS bool
+	// Called for every message over the limit, after it was dropped or
+	// nak-ed.
+	ON_EXCESS func(msg *nats.Msg, d core.Decision)
+}
+
+// ThrottleStats counts the messages a Throttle turned away.
+type ThrottleStats struct {
+	Dropped int64
+	Naked   int64
+}
+
+// Throttle limits the messages a subscription handles, so bursty
+// publishers can't flood subscribers. Messages over the limit are dropped
+// or nak-ed; the limiter's own status counts them as denied.
+type Throttle struct {
+	ThrottleConfig
+	limiter core.RateLimiter
+	dropped int64
+	naked   int64
+}
+
+func NewThrottle(limiter core.RateLimiter, config ThrottleConfig) *Throttle {
+	return &Throttle{ThrottleConfig: config, limiter: limiter}
+}
+
+// Handler wraps handler so it only sees messages the limiter allows. The
+// limiter sees a message as a request with the subject as its path and
+// host and the message headers as its headers; use SubjectKey for
+// per-subject rates.
+//
+//	throttle := natslimiter.NewThrottle(rateLimiter, natslimiter.ThrottleConfig{})
+//	nc.Subscribe("orders.>", throttle.Handler(handleOrder))
+func (t *Throttle) Handler(handler nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		d := t.limiter.Decide(requestFor(msg))
+		if d.Allowed || d.Exempt {
+			handler(msg)
+			return
+		}
+
+		if t.NAK_EXCESS && msg.NakWithDelay(d.RetryAfter) == nil {
+			atomic.AddInt64(&t.naked, 1)
+		} else {
+			atomic.AddInt64(&t.dropped, 1)
+		}
+		if t.ON_EXCESS != nil {
+			t.ON_EXCESS(msg, d)
+		}
+	}
+}
+
+func (t *Throttle) Stats() ThrottleStats {
+	return ThrottleStats{
+		Dropped: atomic.LoadInt64(&t.dropped),
+		Naked:   atomic.LoadInt64(&t.naked),
+	}
+}
+
+// requestFor describes a message as the *http.Request the limiter works on.
+func requestFor(msg *nats.Msg) *http.Request {
+	request := &http.Request{
+		URL:    &url.URL{Path: "/" + msg.Subject},
+		Host:   msg.Subject,
+		Header: http.Header(msg.Header),
+	}
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+	return request.WithContext(context.Background())
+}
+
+// SubjectKey is a KEY_FUNC giving each subject its own budget.
+func SubjectKey(r *http.Request) string {
+	return "subject:" + r.Host
+}
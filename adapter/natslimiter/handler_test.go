@@ -0,0 +1,71 @@
+package natslimiter
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/nats-io/nats.go"
+)
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		name        string
+		keyFunc     func(r *http.Request) string
+		config      ThrottleConfig
+		subjects    []string
+		wantHandled int
+		wantStats   ThrottleStats
+	}{
+		{
+			name:        "shared budget",
+			keyFunc:     func(r *http.Request) string { return "all" },
+			subjects:    []string{"orders.new", "orders.paid", "orders.new"},
+			wantHandled: 1,
+			wantStats:   ThrottleStats{Dropped: 2},
+		},
+		{
+			name:        "per subject",
+			keyFunc:     SubjectKey,
+			subjects:    []string{"orders.new", "orders.paid", "orders.new"},
+			wantHandled: 2,
+			wantStats:   ThrottleStats{Dropped: 1},
+		},
+		{
+			// Core NATS messages can't be nak-ed, so they are dropped.
+			name:        "nak without JetStream",
+			keyFunc:     SubjectKey,
+			config:      ThrottleConfig{NAK_EXCESS: true},
+			subjects:    []string{"orders.new", "orders.new"},
+			wantHandled: 1,
+			wantStats:   ThrottleStats{Dropped: 1},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: test.keyFunc})
+			excess := 0
+			test.config.ON_EXCESS = func(msg *nats.Msg, d core.Decision) { excess++ }
+			throttle := NewThrottle(limiter, test.config)
+
+			handled := 0
+			handler := throttle.Handler(func(msg *nats.Msg) { handled++ })
+			for _, subject := range test.subjects {
+				handler(&nats.Msg{Subject: subject})
+			}
+
+			if handled != test.wantHandled {
+				t.Fatalf("handled %d messages, want %d", handled, test.wantHandled)
+			}
+			if stats := throttle.Stats(); stats != test.wantStats {
+				t.Fatalf("stats %+v, want %+v", stats, test.wantStats)
+			}
+			if excess != len(test.subjects)-test.wantHandled {
+				t.Fatalf("ON_EXCESS called %d times, want %d", excess, len(test.subjects)-test.wantHandled)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package netlimiter
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// PaceConn shapes the bandwidth of conn, for proxies and tunnels: reads and
+// writes are charged to every limiter in turn, under the key its KEY_FUNC
+// gives a request from the peer's address. Connections sharing a key share
+// a pool; for a budget of the connection's own, pass a limiter made for it
+// alone:
+//
+//	perConn := core.NewBandwidthLimiter()
+//	perConn.SetConfig(core.BandwidthLimiterConfig{BYTES_PER_SECOND: 64 << 10})
+//	conn = netlimiter.PaceConn(conn, sharedPool, perConn)
+//
+// Pacing waits until the connection is closed. With REJECT_OVER_LIMIT,
+// reads over the budget fail with core.ErrUploadRateLimited.
+func PaceConn(conn net.Conn, limiters ...core.BandwidthLimiter) net.Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	paced := &pacedConn{Conn: conn, reader: conn, writer: conn, cancel: cancel}
+
+	for _, limiter := range limiters {
+		request := (&http.Request{
+			URL:        &url.URL{},
+			Header:     http.Header{},
+			RemoteAddr: conn.RemoteAddr().String(),
+			Body:       io.NopCloser(paced.reader),
+		}).WithContext(ctx)
+		paced.reader = limiter.PaceBody(request)
+		paced.writer = limiter.PaceWriter(request, paced.writer)
+	}
+	return paced
+}
+
+type pacedConn struct {
+	net.Conn
+	reader io.Reader
+	writer io.Writer
+	cancel context.CancelFunc
+}
+
+func (c *pacedConn) Read(data []byte) (int, error) {
+	return c.reader.Read(data)
+}
+
+func (c *pacedConn) Write(data []byte) (int, error) {
+	return c.writer.Write(data)
+}
+
+func (c *pacedConn) Close() error {
+	c.cancel()
+	return c.Conn.Close()
+}
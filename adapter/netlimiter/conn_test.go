@@ -0,0 +1,74 @@
+package netlimiter
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestPaceConnReads(t *testing.T) {
+	tests := []struct {
+		name    string
+		reject  bool
+		payload string
+		wantErr error
+	}{
+		{name: "within the burst", payload: strings.Repeat("x", 10)},
+		{name: "paced", payload: strings.Repeat("x", 20)},
+		{name: "rejected", reject: true, payload: strings.Repeat("x", 20), wantErr: core.ErrUploadRateLimited},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.NewBandwidthLimiter()
+			limiter.SetConfig(core.BandwidthLimiterConfig{BYTES_PER_SECOND: 1000, BURST: 10, REJECT_OVER_LIMIT: test.reject})
+
+			server, client := net.Pipe()
+			conn := PaceConn(server, limiter)
+			defer conn.Close()
+			go func() {
+				client.Write([]byte(test.payload))
+				client.Close()
+			}()
+
+			got, err := io.ReadAll(conn)
+			if err != test.wantErr {
+				t.Fatalf("read error %v, want %v", err, test.wantErr)
+			}
+			if err == nil && string(got) != test.payload {
+				t.Fatalf("read %q, want %q", got, test.payload)
+			}
+		})
+	}
+}
+
+func TestPaceConnCloseStopsWrites(t *testing.T) {
+	limiter := core.NewBandwidthLimiter()
+	limiter.SetConfig(core.BandwidthLimiterConfig{BYTES_PER_SECOND: 1, BURST: 1})
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go io.Copy(io.Discard, client)
+	conn := PaceConn(server, limiter)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := conn.Write([]byte("more than a second's worth"))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("write finished without an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("write kept waiting after Close")
+	}
+}
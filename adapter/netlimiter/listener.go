@@ -0,0 +1,150 @@
+package netlimiter
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// LimitListener throttles the connections l accepts, before any protocol
+// is parsed. Each connection is charged as a request whose RemoteAddr is
+// the peer's address, so KEY_FUNC can key by IP; rejected connections are
+// closed straight away. With MAX_WAIT, Accept returns connections at once
+// and each waits for its token on its own, for up to MAX_WAIT, before its
+// first read or write goes through, so one client being held never stalls
+// the others. A positive maxConns also caps the connections open at once:
+// Accept blocks until one closes.
+func LimitListener(l net.Listener, limiter core.RateLimiter, maxConns int) net.Listener {
+	limited := &limitedListener{Listener: l, limiter: limiter, done: make(chan struct{})}
+	if maxConns > 0 {
+		limited.slots = make(chan struct{}, maxConns)
+	}
+	return limited
+}
+
+type limitedListener struct {
+	net.Listener
+	limiter   core.RateLimiter
+	slots     chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *limitedListener) Accept() (net.Conn, error) {
+	for {
+		if l.slots != nil {
+			select {
+			case l.slots <- struct{}{}:
+			case <-l.done:
+				return nil, net.ErrClosed
+			}
+		}
+
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			l.release()
+			return nil, err
+		}
+
+		if wait := l.limiter.Config().MAX_WAIT; wait > 0 {
+			return l.hold(conn, wait), nil
+		}
+		d := l.limiter.Decide(connRequest(conn))
+		if d.Allowed {
+			return &limitedConn{Conn: conn, release: l.release}, nil
+		}
+		conn.Close()
+		l.release()
+	}
+}
+
+// hold returns conn gated on its token, which it waits for in the
+// background for up to wait, and closes it if none frees up.
+func (l *limitedListener) hold(conn net.Conn, wait time.Duration) *limitedConn {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	held := &limitedConn{Conn: conn, release: l.release, ready: make(chan struct{}), cancel: cancel}
+
+	go func() {
+		defer cancel()
+		d, _ := l.limiter.Wait(connRequest(conn).WithContext(ctx))
+		if !d.Allowed {
+			held.rejected = true
+			held.Close()
+		}
+		close(held.ready)
+	}()
+	return held
+}
+
+func (l *limitedListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// release frees a connection slot.
+func (l *limitedListener) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// connRequest describes a connection as the request the limiter works on.
+func connRequest(conn net.Conn) *http.Request {
+	return &http.Request{
+		URL:        &url.URL{},
+		Header:     http.Header{},
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+}
+
+// limitedConn frees its slot once, on the first Close. A held connection
+// has ready closed once its wait is over, and fails reads and writes if it
+// was rejected.
+type limitedConn struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+	ready     chan struct{}
+	rejected  bool
+	cancel    context.CancelFunc
+}
+
+func (c *limitedConn) Read(data []byte) (int, error) {
+	if err := c.admitted(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(data)
+}
+
+func (c *limitedConn) Write(data []byte) (int, error) {
+	if err := c.admitted(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(data)
+}
+
+// admitted waits out a held connection's wait.
+func (c *limitedConn) admitted() error {
+	if c.ready == nil {
+		return nil
+	}
+	<-c.ready
+	if c.rejected {
+		return net.ErrClosed
+	}
+	return nil
+}
+
+func (c *limitedConn) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	err := c.Conn.Close()
+	c.closeOnce.Do(c.release)
+	return err
+}
@@ -0,0 +1,101 @@
+package netlimiter
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// pipeListener accepts the server ends of pipes made by dial.
+type pipeListener struct {
+	conns chan net.Conn
+}
+
+func (l *pipeListener) dial() {
+	server, _ := net.Pipe()
+	l.conns <- server
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	conn, ok := <-l.conns
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+
+func (l *pipeListener) Close() error   { return nil }
+func (l *pipeListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestLimitListenerMaxWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		refill    time.Duration
+		maxWait   time.Duration
+		closeHeld bool
+		want      error
+	}{
+		{name: "admitted once a token frees up", refill: 20 * time.Millisecond, maxWait: time.Second},
+		{name: "rejected after MAX_WAIT", refill: time.Hour, maxWait: 20 * time.Millisecond, want: net.ErrClosed},
+		{name: "closed while held", refill: time.Hour, maxWait: time.Hour, closeHeld: true, want: net.ErrClosed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: test.refill,
+				MAX_WAIT:        test.maxWait,
+				KEY_FUNC:        func(r *http.Request) string { return "client" },
+			})
+			inner := &pipeListener{conns: make(chan net.Conn, 3)}
+			l := LimitListener(inner, limiter, 0)
+
+			inner.dial()
+			first, err := l.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer first.Close()
+			if err := first.(*limitedConn).admitted(); err != nil {
+				t.Fatalf("first connection: %v", err)
+			}
+
+			// Held connections must not stall the ones behind them.
+			inner.dial()
+			inner.dial()
+			accepted := make(chan net.Conn, 2)
+			go func() {
+				for i := 0; i < 2; i++ {
+					conn, err := l.Accept()
+					if err != nil {
+						return
+					}
+					accepted <- conn
+				}
+			}()
+			var conns []net.Conn
+			for i := 0; i < 2; i++ {
+				select {
+				case conn := <-accepted:
+					conns = append(conns, conn)
+					defer conn.Close()
+				case <-time.After(time.Second):
+					t.Fatalf("accepted %d held connections, want 2", i)
+				}
+			}
+
+			if test.closeHeld {
+				conns[0].Close()
+			}
+			if err := conns[0].(*limitedConn).admitted(); !errors.Is(err, test.want) {
+				t.Fatalf("held connection: %v, want %v", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+// Package opalimiter lets an OPA policy decide which limit applies to a
+// request and whether it bypasses limiting, so rate limit policy can live
+// in the same Rego repositories as authorization. The policy is queried
+// through an Evaluator, either an embedded OPA:
+//
+//	query, err := rego.New(rego.Query("data.ratelimit.decision"), rego.Load([]string{"policy/"}, nil)).PrepareForEval(ctx)
+//	evaluate := func(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+//		results, err := query.Eval(ctx, rego.EvalInput(input))
+//		if err != nil || len(results) == 0 {
+//			return nil, err
+//		}
+//		return results[0].Expressions[0].Value, nil
+//	}
+//
+// or an OPA server, with HTTPEvaluator. The Rules of a Policy go into the
+// limiter's POLICY:
+//
+//	policy := opalimiter.New(opalimiter.Config{
+//		EVALUATOR: evaluate,
+//		LIMITS:    map[string]core.LimitProfile{"free": {RATE_LIMIT: 10, REFILL_INTERVAL: time.Second}},
+//	})
+//	limiter.SetConfig(core.RateLimiterConfig{
+//		...
+//		POLICY: policy.Rules(),
+//	})
+//
+// The query is given the request as input.method, input.path,
+// input.client_ip, input.headers, input.tenant and input.route, and its
+// value is the decision, e.g. {"action": "limit", "limit": "free"}:
+//
+//	package ratelimit
+//
+//	decision := {"action": "allow"} if {
+//		input.client_ip == "198.51.100.7"
+//	} else := {"action": "limit", "limit": "free"} if {
+//		not input.headers["x-plan"]
+//	}
+//
+// An undefined decision leaves the request to the limiter's other rules.
+package opalimiter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// Evaluator queries the policy with input and returns the value of the
+// decision, nil if it is undefined.
+type Evaluator func(ctx context.Context, input map[string]interface{}) (interface{}, error)
+
+// Decision is what the policy decides for a request.
+type Decision struct {
+	// "allow", "deny", "challenge" or "limit", as core's PolicyAllow,
+	// PolicyDeny, PolicyChallenge and PolicyLimit.
+	Action string `json:"action"`
+	// Name of the LIMITS profile of "limit" decisions.
+	Limit string `json:"limit"`
+}
+
+type Config struct {
+	EVALUATOR Evaluator
+	// Profiles "limit" decisions pick by name. Each is a rule of its own,
+	// named "opa limit " + name, with buckets of its own.
+	LIMITS map[string]core.LimitProfile
+	// Request headers given to the policy, lower-cased. Others are left
+	// out of the input, and of the cache key.
+	HEADERS []string
+	// Tells the policy the request's tenant, if set.
+	TENANT func(r *http.Request) string
+	// How long a decision is reused for requests with the same input.
+	// Defaults to ten seconds. Negative disables the cache, and then the
+	// policy is evaluated for each rule of Rules a request is matched
+	// against.
+	CACHE_TTL time.Duration
+	// Most decisions cached. Defaults to 10000.
+	CACHE_SIZE int
+	// Called when the policy fails to evaluate or decides something this
+	// package doesn't know. Requests with the same input are left to the
+	// limiter's other rules for CACHE_TTL.
+	ON_ERROR func(err error)
+}
+
+// Policy evaluates the OPA policy for requests, caching its decisions.
+type Policy struct {
+	Config
+	cache map[string]cached
+	mx    sync.Mutex
+}
+
+type cached struct {
+	decision Decision
+	// Whether the policy decided anything.
+	ok      bool
+	expires time.Time
+}
+
+func New(config Config) *Policy {
+	if config.CACHE_TTL == 0 {
+		config.CACHE_TTL = 10 * time.Second
+	}
+	if config.CACHE_SIZE <= 0 {
+		config.CACHE_SIZE = 10000
+	}
+	headers := make([]string, len(config.HEADERS))
+	for i, header := range config.HEADERS {
+		headers[i] = strings.ToLower(header)
+	}
+	config.HEADERS = headers
+	return &Policy{Config: config, cache: map[string]cached{}}
+}
+
+// Rules returns the rules applying the policy's decisions, to be put in
+// the limiter's POLICY, alone or after rules of its own.
+func (p *Policy) Rules() core.Policy {
+	rules := core.Policy{
+		{NAME: "opa allow", MATCH: []core.Matcher{p.decides("allow", "")}, ACTION: core.PolicyAllow},
+		{NAME: "opa deny", MATCH: []core.Matcher{p.decides("deny", "")}, ACTION: core.PolicyDeny},
+		{NAME: "opa challenge", MATCH: []core.Matcher{p.decides("challenge", "")}, ACTION: core.PolicyChallenge},
+	}
+	names := make([]string, 0, len(p.LIMITS))
+	for name := range p.LIMITS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rules = append(rules, core.PolicyRule{
+			NAME:    "opa limit " + name,
+			MATCH:   []core.Matcher{p.decides("limit", name)},
+			ACTION:  core.PolicyLimit,
+			PROFILE: p.LIMITS[name],
+		})
+	}
+	return rules
+}
+
+// decides matches requests the policy decides action, and limit, for.
+func (p *Policy) decides(action, limit string) core.Matcher {
+	return func(r *http.Request, clientIP string) bool {
+		d, ok := p.Decide(r, clientIP)
+		return ok && d.Action == action && d.Limit == limit
+	}
+}
+
+// Decide returns the policy's decision for a request, from the cache if
+// a request with the same input was decided within CACHE_TTL. ok is false
+// if the decision is undefined or the policy failed.
+func (p *Policy) Decide(r *http.Request, clientIP string) (d Decision, ok bool) {
+	input := p.input(r, clientIP)
+	key := ""
+	if p.CACHE_TTL > 0 {
+		data, _ := json.Marshal(input)
+		key = string(data)
+		if d, ok, hit := p.cached(key); hit {
+			return d, ok
+		}
+	}
+
+	d, ok, err := p.evaluate(r.Context(), input)
+	if err != nil && p.ON_ERROR != nil {
+		p.ON_ERROR(err)
+	}
+	// Failures are cached as undefined decisions, so every rule of a
+	// request doesn't try again.
+	if p.CACHE_TTL > 0 {
+		p.store(key, cached{decision: d, ok: ok, expires: time.Now().Add(p.CACHE_TTL)})
+	}
+	return d, ok
+}
+
+func (p *Policy) input(r *http.Request, clientIP string) map[string]interface{} {
+	headers := map[string]string{}
+	for _, name := range p.HEADERS {
+		if value := r.Header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	input := map[string]interface{}{
+		"method":    r.Method,
+		"path":      r.URL.Path,
+		"client_ip": clientIP,
+		"headers":   headers,
+	}
+	if p.TENANT != nil {
+		input["tenant"] = p.TENANT(r)
+	}
+	if route, ok := core.RouteTemplateFromContext(r.Context()); ok {
+		input["route"] = route
+	}
+	return input
+}
+
+func (p *Policy) evaluate(ctx context.Context, input map[string]interface{}) (Decision, bool, error) {
+	value, err := p.EVALUATOR(ctx, input)
+	if err != nil || value == nil {
+		return Decision{}, false, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Decision{}, false, err
+	}
+	var d Decision
+	if err := json.Unmarshal(data, &d); err != nil {
+		return Decision{}, false, fmt.Errorf("opalimiter: decision %s isn't an object", data)
+	}
+	switch d.Action {
+	case "allow", "deny", "challenge":
+		d.Limit = ""
+	case "limit":
+		if _, ok := p.LIMITS[d.Limit]; !ok {
+			return Decision{}, false, fmt.Errorf("opalimiter: decision picks unknown limit %q", d.Limit)
+		}
+	default:
+		return Decision{}, false, fmt.Errorf("opalimiter: decision has unknown action %q", d.Action)
+	}
+	return d, true, nil
+}
+
+func (p *Policy) cached(key string) (d Decision, ok, hit bool) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	entry, hit := p.cache[key]
+	if !hit || time.Now().After(entry.expires) {
+		return Decision{}, false, false
+	}
+	return entry.decision, entry.ok, true
+}
+
+// store caches a decision. A full cache drops its expired decisions, or
+// every decision if none have expired.
+func (p *Policy) store(key string, entry cached) {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if len(p.cache) >= p.CACHE_SIZE {
+		now := time.Now()
+		for key, entry := range p.cache {
+			if now.After(entry.expires) {
+				delete(p.cache, key)
+			}
+		}
+		if len(p.cache) >= p.CACHE_SIZE {
+			p.cache = map[string]cached{}
+		}
+	}
+	p.cache[key] = entry
+}
+
+// HTTPEvaluator queries the decision at path, e.g. "ratelimit/decision",
+// through the Data API of the OPA server at address, e.g.
+// http://127.0.0.1:8181, for OPA run as a sidecar rather than embedded.
+// client defaults to one timing out after a second.
+func HTTPEvaluator(address, path string, client *http.Client) Evaluator {
+	if client == nil {
+		client = &http.Client{Timeout: time.Second}
+	}
+	url := strings.TrimSuffix(address, "/") + "/v1/data/" + strings.Trim(path, "/")
+
+	return func(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+		body, err := json.Marshal(map[string]interface{}{"input": input})
+		if err != nil {
+			return nil, err
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/json")
+
+		response, err := client.Do(request)
+		if err != nil {
+			return nil, err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			message, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+			return nil, fmt.Errorf("opalimiter: %s: %s", response.Status, strings.TrimSpace(string(message)))
+		}
+		// An undefined decision has no result.
+		var result struct {
+			Result interface{} `json:"result"`
+		}
+		if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+			return nil, err
+		}
+		return result.Result, nil
+	}
+}
@@ -0,0 +1,177 @@
+package opalimiter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// decide stands for a Rego policy: the office is let through, scrapers
+// turned away, free plans limited, "broken" requests fail and the rest
+// are undefined.
+func decide(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+	headers := input["headers"].(map[string]string)
+	switch {
+	case input["client_ip"] == "198.51.100.7":
+		return map[string]interface{}{"action": "allow"}, nil
+	case headers["x-scraper"] != "":
+		return map[string]interface{}{"action": "deny"}, nil
+	case headers["x-plan"] == "free":
+		return map[string]interface{}{"action": "limit", "limit": "free"}, nil
+	case headers["x-plan"] == "gold":
+		return map[string]interface{}{"action": "limit", "limit": "gold"}, nil
+	case input["path"] == "/broken":
+		return nil, errors.New("policy failed")
+	}
+	return nil, nil
+}
+
+func TestPolicy(t *testing.T) {
+	var evaluations, failures atomic.Int64
+	policy := New(Config{
+		EVALUATOR: func(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+			evaluations.Add(1)
+			return decide(ctx, input)
+		},
+		LIMITS:   map[string]core.LimitProfile{"free": {RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour}},
+		HEADERS:  []string{"X-Scraper", "X-Plan"},
+		ON_ERROR: func(err error) { failures.Add(1) },
+	})
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      3,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return core.StripPort(r.RemoteAddr) },
+		POLICY:          policy.Rules(),
+	})
+
+	tests := []struct {
+		name   string
+		ip     string
+		path   string
+		header [2]string
+		// Decisions asked for; the last one is checked.
+		times        int
+		wantRule     string
+		wantAllowed  bool
+		wantFailures int64
+	}{
+		{name: "allow", ip: "198.51.100.7", path: "/", times: 5, wantRule: "opa allow", wantAllowed: true},
+		{name: "deny", ip: "203.0.113.1", path: "/", header: [2]string{"X-Scraper", "1"}, times: 1, wantRule: "opa deny"},
+		{name: "limit", ip: "203.0.113.2", path: "/", header: [2]string{"X-Plan", "free"}, times: 2, wantRule: "opa limit free"},
+		{name: "undefined", ip: "203.0.113.3", path: "/", times: 2, wantRule: "default", wantAllowed: true},
+		{name: "unknown limit", ip: "203.0.113.4", path: "/", header: [2]string{"X-Plan", "gold"}, times: 1, wantRule: "default", wantAllowed: true, wantFailures: 1},
+		{name: "failing policy", ip: "203.0.113.5", path: "/broken", times: 1, wantRule: "default", wantAllowed: true, wantFailures: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			evaluations.Store(0)
+			failures.Store(0)
+			var d core.Decision
+			for i := 0; i < test.times; i++ {
+				r := httptest.NewRequest(http.MethodGet, test.path, nil)
+				r.RemoteAddr = test.ip + ":1234"
+				if test.header[0] != "" {
+					r.Header.Set(test.header[0], test.header[1])
+				}
+				d = limiter.Decide(r)
+			}
+			if d.Rule != test.wantRule || d.Allowed != test.wantAllowed {
+				t.Fatalf("decision %+v", d)
+			}
+			if evaluations.Load() != 1 || failures.Load() != test.wantFailures {
+				t.Fatalf("policy evaluated %d times, failing %d", evaluations.Load(), failures.Load())
+			}
+		})
+	}
+}
+
+func TestPolicyCacheExpires(t *testing.T) {
+	var evaluations int
+	policy := New(Config{
+		EVALUATOR: func(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+			evaluations++
+			return map[string]interface{}{"action": "allow"}, nil
+		},
+		CACHE_TTL:  20 * time.Millisecond,
+		CACHE_SIZE: 1,
+	})
+	request := func(path string) {
+		if _, ok := policy.Decide(httptest.NewRequest(http.MethodGet, path, nil), "203.0.113.1"); !ok {
+			t.Fatal("no decision")
+		}
+	}
+
+	steps := []struct {
+		name            string
+		path            string
+		sleep           time.Duration
+		wantEvaluations int
+	}{
+		{name: "first", path: "/a", wantEvaluations: 1},
+		{name: "cached", path: "/a", wantEvaluations: 1},
+		{name: "other input past the size", path: "/b", wantEvaluations: 2},
+		{name: "dropped for it", path: "/a", wantEvaluations: 3},
+		{name: "expired", path: "/a", sleep: 30 * time.Millisecond, wantEvaluations: 4},
+	}
+	for _, step := range steps {
+		time.Sleep(step.sleep)
+		request(step.path)
+		if evaluations != step.wantEvaluations {
+			t.Fatalf("%s: %d evaluations, want %d", step.name, evaluations, step.wantEvaluations)
+		}
+	}
+}
+
+func TestHTTPEvaluator(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/data/ratelimit/decision" {
+			http.NotFound(w, r)
+			return
+		}
+		var body struct {
+			Input map[string]interface{} `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body.Input["path"] {
+		case "/undefined":
+			w.Write([]byte(`{}`))
+		case "/broken":
+			http.Error(w, `{"code": "internal_error"}`, http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"result": {"action": "limit", "limit": "free"}}`))
+		}
+	}))
+	defer server.Close()
+	evaluate := HTTPEvaluator(server.URL, "/ratelimit/decision", nil)
+
+	tests := []struct {
+		path    string
+		want    interface{}
+		wantErr bool
+	}{
+		{path: "/", want: map[string]interface{}{"action": "limit", "limit": "free"}},
+		{path: "/undefined", want: nil},
+		{path: "/broken", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			got, err := evaluate(context.Background(), map[string]interface{}{"path": test.path})
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v", err)
+			}
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(test.want)
+			if !test.wantErr && string(gotJSON) != string(wantJSON) {
+				t.Fatalf("result %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
@@ -0,0 +1,327 @@
+package stdhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+type AdminConfig struct {
+	// Limiters managed by name, e.g. {"api": apiLimiter, "login": loginLimiter}.
+	LIMITERS map[string]core.RateLimiter
+	// Path the endpoints are served under. Defaults to "/admin/ratelimit".
+	PREFIX string
+	// Decides whether a request may use the endpoints, e.g. BearerAuth.
+	// Requests it refuses get 401 or 403 as with RequireAuth. Nil serves
+	// everyone, so the handler must be protected some other way.
+	AUTH AuthFunc
+}
+
+// limiterInfo is what the admin API shows of a limiter.
+type limiterInfo struct {
+	Name           string            `json:"name"`
+	RateLimit      int64             `json:"rate_limit"`
+	RefillInterval string            `json:"refill_interval"`
+	Keyed          bool              `json:"keyed"`
+	Status         core.BucketStatus `json:"status"`
+}
+
+// limitUpdate is the body of a request adjusting a limiter's limit.
+type limitUpdate struct {
+	RateLimit      int64  `json:"rate_limit"`
+	RefillInterval string `json:"refill_interval"`
+}
+
+// NewAdmin returns a handler to mount on any router, managing limiters at
+// runtime:
+//
+//	GET    /admin/ratelimit/limiters                     the limiters and their limits
+//	GET    /admin/ratelimit/limiters/{name}/keys         every key's bucket
+//	GET    /admin/ratelimit/limiters/{name}/keys/{key}   one key's buckets
+//	DELETE /admin/ratelimit/limiters/{name}/keys/{key}   reset a key
+//	DELETE /admin/ratelimit/limiters/{name}/keys         reset every key
+//	PUT    /admin/ratelimit/limiters/{name}/limit        {"rate_limit": 200, "refill_interval": "5ms"}
+//	GET    /admin/ratelimit/limiters/{name}/lists        the allow and deny lists
+//	PUT    /admin/ratelimit/limiters/{name}/allow/{key}  allow a key
+//	PUT    /admin/ratelimit/limiters/{name}/deny/{key}   deny a key, for ?for=10m or until removed
+//	DELETE /admin/ratelimit/limiters/{name}/allow/{key}  take a key off the lists
+//	DELETE /admin/ratelimit/limiters/{name}/deny/{key}
+//	PUT    /admin/ratelimit/limiters/{name}/brake        engage a limiter's emergency brake, for ?for=10m or BRAKE_DURATION
+//	DELETE /admin/ratelimit/limiters/{name}/brake        release it
+//	GET    /admin/ratelimit/state                        every limiter's core.State, by name
+//	PUT    /admin/ratelimit/state                        import such an export
+//	GET    /admin/ratelimit/brake                        every limiter's core.BrakeStatus, by name
+//	PUT    /admin/ratelimit/brake                        engage every limiter's brake, for ?for=10m or BRAKE_DURATION
+//	DELETE /admin/ratelimit/brake                        release every brake
+//
+// Adjusting a limit applies it with SetLimit, so in-memory buckets start
+// over under the new limit. The bucket shared by unkeyed requests keeps
+// the refill ticker it was run with.
+//
+// Exporting the state from one instance and importing it into another,
+// e.g. the new color of a blue/green deploy or an instance on another
+// STORE, carries over every quota, lock and ban. The export fails rather
+// than leave out buckets that couldn't be read.
+//
+// The emergency brake clamps limits to BRAKE_FRACTION of themselves, and
+// those of BRAKE_RULES to theirs, until it releases by itself, for
+// incident response when a dependency is overloaded.
+func NewAdmin(config AdminConfig) http.Handler {
+	if config.PREFIX == "" {
+		config.PREFIX = "/admin/ratelimit"
+	}
+	prefix := strings.TrimSuffix(config.PREFIX, "/")
+	limiters := prefix + "/limiters"
+	admin := &admin{AdminConfig: config, mux: http.NewServeMux()}
+
+	admin.mux.HandleFunc("GET "+limiters, admin.listLimiters)
+	admin.mux.HandleFunc("GET "+limiters+"/{name}/keys", admin.withLimiter(admin.listKeys))
+	admin.mux.HandleFunc("DELETE "+limiters+"/{name}/keys", admin.withLimiter(admin.resetAll))
+	admin.mux.HandleFunc("GET "+limiters+"/{name}/keys/{key...}", admin.withLimiter(admin.inspectKey))
+	admin.mux.HandleFunc("DELETE "+limiters+"/{name}/keys/{key...}", admin.withLimiter(admin.resetKey))
+	admin.mux.HandleFunc("PUT "+limiters+"/{name}/limit", admin.withLimiter(admin.setLimit))
+	admin.mux.HandleFunc("GET "+limiters+"/{name}/lists", admin.withLimiter(admin.lists))
+	admin.mux.HandleFunc("PUT "+limiters+"/{name}/allow/{key...}", admin.withLimiter(admin.allowKey))
+	admin.mux.HandleFunc("PUT "+limiters+"/{name}/deny/{key...}", admin.withLimiter(admin.denyKey))
+	admin.mux.HandleFunc("DELETE "+limiters+"/{name}/allow/{key...}", admin.withLimiter(admin.unlistKey))
+	admin.mux.HandleFunc("DELETE "+limiters+"/{name}/deny/{key...}", admin.withLimiter(admin.unlistKey))
+	admin.mux.HandleFunc("PUT "+limiters+"/{name}/brake", admin.withLimiter(admin.engageBrake))
+	admin.mux.HandleFunc("DELETE "+limiters+"/{name}/brake", admin.withLimiter(admin.releaseBrake))
+	admin.mux.HandleFunc("GET "+prefix+"/state", admin.exportState)
+	admin.mux.HandleFunc("PUT "+prefix+"/state", admin.importState)
+	admin.mux.HandleFunc("GET "+prefix+"/brake", admin.brakes)
+	admin.mux.HandleFunc("PUT "+prefix+"/brake", admin.engageBrakes)
+	admin.mux.HandleFunc("DELETE "+prefix+"/brake", admin.releaseBrakes)
+	return admin
+}
+
+type admin struct {
+	AdminConfig
+	mux *http.ServeMux
+}
+
+func (a *admin) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	if authorize(a.AUTH, w, request) {
+		a.mux.ServeHTTP(w, request)
+	}
+}
+
+// withLimiter looks up the limiter named in the path, answering 404 if
+// there is none.
+func (a *admin) withLimiter(handle func(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter)) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		limiter, ok := a.LIMITERS[request.PathValue("name")]
+		if !ok {
+			writeAdmin(w, http.StatusNotFound, false, "no such limiter")
+			return
+		}
+		handle(w, request, limiter)
+	}
+}
+
+func (a *admin) listLimiters(w http.ResponseWriter, request *http.Request) {
+	infos := make([]limiterInfo, 0, len(a.LIMITERS))
+	for name, limiter := range a.LIMITERS {
+		config := limiter.Config()
+		infos = append(infos, limiterInfo{
+			Name:           name,
+			RateLimit:      config.RATE_LIMIT,
+			RefillInterval: config.REFILL_INTERVAL.String(),
+			Keyed:          config.Keyed(),
+			Status:         limiter.Status(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	writeJSON(w, http.StatusOK, infos)
+}
+
+func (a *admin) listKeys(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	keys := limiter.Keys()
+	if keys == nil {
+		keys = []core.KeyStatus{}
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (a *admin) inspectKey(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	statuses := limiter.InspectKey(request.PathValue("key"))
+	if len(statuses) == 0 {
+		writeAdmin(w, http.StatusNotFound, false, "key has no bucket")
+		return
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (a *admin) resetKey(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	limiter.ResetKey(request.PathValue("key"))
+	writeAdmin(w, http.StatusOK, true, "Bucket reset")
+}
+
+func (a *admin) resetAll(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	limiter.ResetAll()
+	writeAdmin(w, http.StatusOK, true, "All buckets reset")
+}
+
+func (a *admin) setLimit(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	var update limitUpdate
+	if err := json.NewDecoder(request.Body).Decode(&update); err != nil {
+		writeAdmin(w, http.StatusBadRequest, false, err.Error())
+		return
+	}
+	var interval time.Duration
+	if update.RefillInterval != "" {
+		var err error
+		interval, err = time.ParseDuration(update.RefillInterval)
+		if err != nil || interval <= 0 {
+			writeAdmin(w, http.StatusBadRequest, false, "refill_interval must be a positive duration")
+			return
+		}
+	}
+	if err := limiter.SetLimit(update.RateLimit, interval); err != nil {
+		writeAdmin(w, http.StatusBadRequest, false, err.Error())
+		return
+	}
+	writeAdmin(w, http.StatusOK, true, "Limit updated")
+}
+
+func (a *admin) lists(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	writeJSON(w, http.StatusOK, limiter.KeyLists())
+}
+
+func (a *admin) allowKey(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	limiter.AllowKey(request.PathValue("key"))
+	writeAdmin(w, http.StatusOK, true, "Key allowed")
+}
+
+func (a *admin) denyKey(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	var d time.Duration
+	if value := request.URL.Query().Get("for"); value != "" {
+		var err error
+		if d, err = time.ParseDuration(value); err != nil || d <= 0 {
+			writeAdmin(w, http.StatusBadRequest, false, "for must be a positive duration")
+			return
+		}
+	}
+	limiter.DenyKey(request.PathValue("key"), d)
+	writeAdmin(w, http.StatusOK, true, "Key denied")
+}
+
+func (a *admin) unlistKey(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	limiter.UnlistKey(request.PathValue("key"))
+	writeAdmin(w, http.StatusOK, true, "Key unlisted")
+}
+
+func (a *admin) exportState(w http.ResponseWriter, request *http.Request) {
+	states := make(map[string]core.State, len(a.LIMITERS))
+	for name, limiter := range a.LIMITERS {
+		state, err := limiter.ExportState()
+		if err != nil {
+			writeAdmin(w, http.StatusInternalServerError, false, err.Error())
+			return
+		}
+		states[name] = state
+	}
+	writeJSON(w, http.StatusOK, states)
+}
+
+// importState imports the state of every limiter in the body, refusing
+// bodies naming limiters there aren't before importing any.
+func (a *admin) importState(w http.ResponseWriter, request *http.Request) {
+	var states map[string]core.State
+	if err := json.NewDecoder(request.Body).Decode(&states); err != nil {
+		writeAdmin(w, http.StatusBadRequest, false, err.Error())
+		return
+	}
+	for name := range states {
+		if _, ok := a.LIMITERS[name]; !ok {
+			writeAdmin(w, http.StatusBadRequest, false, "no such limiter: "+name)
+			return
+		}
+	}
+
+	var errs []error
+	for name, state := range states {
+		if err := a.LIMITERS[name].ImportState(state); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		writeAdmin(w, http.StatusInternalServerError, false, err.Error())
+		return
+	}
+	writeAdmin(w, http.StatusOK, true, "State imported")
+}
+
+func (a *admin) engageBrake(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	d, ok := brakeDuration(w, request)
+	if !ok {
+		return
+	}
+	limiter.EngageBrake(d)
+	writeAdmin(w, http.StatusOK, true, "Brake engaged")
+}
+
+func (a *admin) releaseBrake(w http.ResponseWriter, request *http.Request, limiter core.RateLimiter) {
+	limiter.ReleaseBrake()
+	writeAdmin(w, http.StatusOK, true, "Brake released")
+}
+
+func (a *admin) brakes(w http.ResponseWriter, request *http.Request) {
+	brakes := make(map[string]core.BrakeStatus, len(a.LIMITERS))
+	for name, limiter := range a.LIMITERS {
+		brakes[name] = limiter.BrakeStatus()
+	}
+	writeJSON(w, http.StatusOK, brakes)
+}
+
+func (a *admin) engageBrakes(w http.ResponseWriter, request *http.Request) {
+	d, ok := brakeDuration(w, request)
+	if !ok {
+		return
+	}
+	for _, limiter := range a.LIMITERS {
+		limiter.EngageBrake(d)
+	}
+	writeAdmin(w, http.StatusOK, true, "Brakes engaged")
+}
+
+func (a *admin) releaseBrakes(w http.ResponseWriter, request *http.Request) {
+	for _, limiter := range a.LIMITERS {
+		limiter.ReleaseBrake()
+	}
+	writeAdmin(w, http.StatusOK, true, "Brakes released")
+}
+
+// brakeDuration reads how long to brake for from ?for, zero for the
+// limiter's BRAKE_DURATION, answering 400 if it isn't a positive duration.
+func brakeDuration(w http.ResponseWriter, request *http.Request) (time.Duration, bool) {
+	value := request.URL.Query().Get("for")
+	if value == "" {
+		return 0, true
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		writeAdmin(w, http.StatusBadRequest, false, "for must be a positive duration")
+		return 0, false
+	}
+	return d, true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeAdmin answers in the shape of the reset handlers.
+func writeAdmin(w http.ResponseWriter, status int, success bool, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"success": success,
+		"message": message,
+	})
+}
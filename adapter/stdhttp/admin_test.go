@@ -0,0 +1,238 @@
+package stdhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestAdmin(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      2,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	admin := NewAdmin(AdminConfig{
+		LIMITERS: map[string]core.RateLimiter{"api": limiter},
+		AUTH:     BearerAuth("t0ken"),
+	})
+	decide := func(client string) bool {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		return limiter.Decide(r).Allowed
+	}
+	decide("alice")
+
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		noAuth   bool
+		want     int
+		wantBody string
+		check    func() bool
+	}{
+		{name: "without auth", method: http.MethodGet, path: "/limiters", noAuth: true, want: http.StatusUnauthorized},
+		{name: "list limiters", method: http.MethodGet, path: "/limiters", want: http.StatusOK, wantBody: `"name":"api"`},
+		{name: "unknown limiter", method: http.MethodGet, path: "/limiters/web/keys", want: http.StatusNotFound},
+		{name: "list keys", method: http.MethodGet, path: "/limiters/api/keys", want: http.StatusOK, wantBody: `"Key":"alice"`},
+		{name: "inspect key", method: http.MethodGet, path: "/limiters/api/keys/alice", want: http.StatusOK, wantBody: `"Tokens":1`},
+		{name: "inspect unknown key", method: http.MethodGet, path: "/limiters/api/keys/bob", want: http.StatusNotFound},
+		{name: "deny key", method: http.MethodPut, path: "/limiters/api/deny/bob?for=1m", want: http.StatusOK, check: func() bool { return !decide("bob") }},
+		{name: "lists", method: http.MethodGet, path: "/limiters/api/lists", want: http.StatusOK, wantBody: `"bob":`},
+		{name: "unlist key", method: http.MethodDelete, path: "/limiters/api/deny/bob", want: http.StatusOK, check: func() bool { return decide("bob") }},
+		{name: "bad deny duration", method: http.MethodPut, path: "/limiters/api/deny/bob?for=soon", want: http.StatusBadRequest},
+		{name: "reset key", method: http.MethodDelete, path: "/limiters/api/keys/alice", want: http.StatusOK, check: func() bool { return decide("alice") && decide("alice") }},
+		{name: "allow key", method: http.MethodPut, path: "/limiters/api/allow/alice", want: http.StatusOK, check: func() bool { return decide("alice") }},
+		{name: "set limit", method: http.MethodPut, path: "/limiters/api/limit", body: `{"rate_limit": 5, "refill_interval": "1m"}`, want: http.StatusOK, check: func() bool {
+			return limiter.Config().RATE_LIMIT == 5 && limiter.Config().REFILL_INTERVAL == time.Minute
+		}},
+		{name: "bad limit", method: http.MethodPut, path: "/limiters/api/limit", body: `{"refill_interval": "-1s"}`, want: http.StatusBadRequest},
+		{name: "wrong method", method: http.MethodPost, path: "/limiters/api/keys/alice", want: http.StatusMethodNotAllowed},
+	}
+	for _, step := range steps {
+		r := httptest.NewRequest(step.method, "/admin/ratelimit"+step.path, strings.NewReader(step.body))
+		if !step.noAuth {
+			r.Header.Set("Authorization", "Bearer t0ken")
+		}
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, r)
+
+		if w.Code != step.want {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, w.Code, step.want, w.Body)
+		}
+		if !json.Valid(w.Body.Bytes()) && w.Code != http.StatusMethodNotAllowed {
+			t.Fatalf("%s: body %q isn't JSON", step.name, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), step.wantBody) {
+			t.Fatalf("%s: body %s, want %s in it", step.name, w.Body, step.wantBody)
+		}
+		if step.check != nil && !step.check() {
+			t.Fatalf("%s: the limiter wasn't changed", step.name)
+		}
+	}
+}
+
+func TestAdminState(t *testing.T) {
+	newAdmin := func() (http.Handler, func(client string) bool) {
+		limiter := core.New()
+		limiter.SetConfig(core.RateLimiterConfig{
+			RATE_LIMIT:      2,
+			REFILL_INTERVAL: time.Hour,
+			KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+		})
+		decide := func(client string) bool {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Client", client)
+			return limiter.Decide(r).Allowed
+		}
+		return NewAdmin(AdminConfig{LIMITERS: map[string]core.RateLimiter{"api": limiter}}), decide
+	}
+	serve := func(admin http.Handler, method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(method, "/admin/ratelimit/state", strings.NewReader(body)))
+		return w
+	}
+
+	blue, decideBlue := newAdmin()
+	decideBlue("alice")
+	decideBlue("alice")
+	blue.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/admin/ratelimit/limiters/api/deny/bob", nil))
+	export := serve(blue, http.MethodGet, "")
+	if export.Code != http.StatusOK {
+		t.Fatalf("export status %d: %s", export.Code, export.Body)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+		// Whether alice and bob are let through afterwards.
+		wantAlice, wantBob bool
+	}{
+		{name: "malformed", body: `{"api":`, want: http.StatusBadRequest, wantAlice: true, wantBob: true},
+		{name: "unknown limiter", body: `{"web": {"Version": 1}}`, want: http.StatusBadRequest, wantAlice: true, wantBob: true},
+		{name: "unknown version", body: `{"api": {"Version": 99}}`, want: http.StatusInternalServerError, wantAlice: true, wantBob: true},
+		{name: "export", body: export.Body.String(), want: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			green, decideGreen := newAdmin()
+			w := serve(green, http.MethodPut, test.body)
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.want, w.Body)
+			}
+			if alice, bob := decideGreen("alice"), decideGreen("bob"); alice != test.wantAlice || bob != test.wantBob {
+				t.Fatalf("alice let through %v, bob %v", alice, bob)
+			}
+		})
+	}
+}
+
+func TestAdminBrake(t *testing.T) {
+	newLimiter := func() core.RateLimiter {
+		limiter := core.New()
+		limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour})
+		return limiter
+	}
+	api, login := newLimiter(), newLimiter()
+	admin := NewAdmin(AdminConfig{LIMITERS: map[string]core.RateLimiter{"api": api, "login": login}})
+	braking := func(apiWant, loginWant bool) func() bool {
+		return func() bool {
+			return api.BrakeStatus().Engaged == apiWant && login.BrakeStatus().Engaged == loginWant
+		}
+	}
+
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		want     int
+		wantBody string
+		check    func() bool
+	}{
+		{name: "status", method: http.MethodGet, path: "/brake", want: http.StatusOK, wantBody: `"api":{"Engaged":false`},
+		{name: "engage one", method: http.MethodPut, path: "/limiters/login/brake?for=5m", want: http.StatusOK, check: braking(false, true)},
+		{name: "status engaged", method: http.MethodGet, path: "/brake", want: http.StatusOK, wantBody: `"login":{"Engaged":true`},
+		{name: "release one", method: http.MethodDelete, path: "/limiters/login/brake", want: http.StatusOK, check: braking(false, false)},
+		{name: "engage all", method: http.MethodPut, path: "/brake", want: http.StatusOK, check: func() bool {
+			return braking(true, true)() && time.Until(api.BrakeStatus().Until) > 14*time.Minute
+		}},
+		{name: "release all", method: http.MethodDelete, path: "/brake", want: http.StatusOK, check: braking(false, false)},
+		{name: "bad duration", method: http.MethodPut, path: "/brake?for=-1m", want: http.StatusBadRequest, check: braking(false, false)},
+		{name: "unknown limiter", method: http.MethodPut, path: "/limiters/web/brake", want: http.StatusNotFound},
+	}
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		admin.ServeHTTP(w, httptest.NewRequest(step.method, "/admin/ratelimit"+step.path, nil))
+
+		if w.Code != step.want {
+			t.Fatalf("%s: status %d, want %d: %s", step.name, w.Code, step.want, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), step.wantBody) {
+			t.Fatalf("%s: body %s, want %s in it", step.name, w.Body, step.wantBody)
+		}
+		if step.check != nil && !step.check() {
+			t.Fatalf("%s: the brakes weren't changed", step.name)
+		}
+	}
+}
+
+func TestAdminSetLimitUnderLoad(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1000000,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return "alice" },
+		KEY_BY_PATH:     true,
+		PATH_KEY_MODE:   core.PathRaw,
+	})
+	admin := NewAdmin(AdminConfig{LIMITERS: map[string]core.RateLimiter{"api": limiter}})
+	key := func() string {
+		return limiter.Decide(httptest.NewRequest(http.MethodGet, "/users/1", nil)).Key
+	}
+	want := key()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					key()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"rate_limit": %d}`, 1000000+i)
+		admin.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/admin/ratelimit/limiters/api/limit", strings.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if got := key(); got != want {
+		t.Fatalf("key %q after setting the limit, want %q", got, want)
+	}
+	if limit := limiter.Config().RATE_LIMIT; limit != 1000019 {
+		t.Fatalf("limit %d", limit)
+	}
+}
@@ -0,0 +1,114 @@
+package stdhttp
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// AuthFunc decides whether a request may use the status or admin
+// endpoints, returning nil to let it through. Requests without valid
+// credentials should get an *Unauthenticated error and are answered 401
+// Unauthorized; any other error, such as ErrForbidden for credentials
+// lacking the right, is answered 403 Forbidden.
+type AuthFunc func(r *http.Request) error
+
+// Unauthenticated is the error of an AuthFunc for a request without valid
+// credentials.
+type Unauthenticated struct {
+	// Sent as WWW-Authenticate, e.g. `Basic realm="ratelimit"`, if set.
+	Challenge string
+}
+
+func (e *Unauthenticated) Error() string {
+	return "unauthorized"
+}
+
+// ErrForbidden is the error of an AuthFunc for a request whose
+// credentials are valid but don't allow it.
+var ErrForbidden = errors.New("forbidden")
+
+// RequireAuth serves next only to requests auth lets through, e.g. to
+// protect the status handlers:
+//
+//	auth := stdhttp.BearerAuth(os.Getenv("STATUS_TOKEN"))
+//	http.Handle("/bucket", stdhttp.RequireAuth(auth, stdhttp.GetBucketStatus(rateLimiter)))
+func RequireAuth(auth AuthFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		if authorize(auth, w, request) {
+			next.ServeHTTP(w, request)
+		}
+	})
+}
+
+// authorize answers the request with 401 or 403 unless auth lets it
+// through, reporting whether it did. A nil auth lets everyone through.
+func authorize(auth AuthFunc, w http.ResponseWriter, request *http.Request) bool {
+	if auth == nil {
+		return true
+	}
+	err := auth(request)
+	if err == nil {
+		return true
+	}
+	var unauthenticated *Unauthenticated
+	if errors.As(err, &unauthenticated) {
+		if unauthenticated.Challenge != "" {
+			w.Header().Set("WWW-Authenticate", unauthenticated.Challenge)
+		}
+		writeAdmin(w, http.StatusUnauthorized, false, "unauthorized")
+		return false
+	}
+	writeAdmin(w, http.StatusForbidden, false, "forbidden")
+	return false
+}
+
+// BearerAuth lets through requests with one of the tokens as their
+// "Authorization: Bearer" header.
+func BearerAuth(tokens ...string) AuthFunc {
+	return func(r *http.Request) error {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !oneOf(token, tokens) {
+			return &Unauthenticated{Challenge: "Bearer"}
+		}
+		return nil
+	}
+}
+
+// APIKeyAuth lets through requests with one of the keys in the header,
+// e.g. "X-API-Key".
+func APIKeyAuth(header string, keys ...string) AuthFunc {
+	return func(r *http.Request) error {
+		if !oneOf(r.Header.Get(header), keys) {
+			return &Unauthenticated{}
+		}
+		return nil
+	}
+}
+
+// BasicAuth lets through requests with the HTTP basic credentials of one
+// of the users, by name and password.
+func BasicAuth(realm string, users map[string]string) AuthFunc {
+	challenge := `Basic realm="` + strings.ReplaceAll(realm, `"`, `\"`) + `"`
+	return func(r *http.Request) error {
+		name, password, ok := r.BasicAuth()
+		want, known := users[name]
+		if !ok || !known || subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+			return &Unauthenticated{Challenge: challenge}
+		}
+		return nil
+	}
+}
+
+// oneOf reports whether value is one of the non-empty secrets, comparing
+// in constant time.
+func oneOf(value string, secrets []string) bool {
+	found := false
+	for _, secret := range secrets {
+		if secret != "" && subtle.ConstantTimeCompare([]byte(value), []byte(secret)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,66 @@
+package stdhttp
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAuth(t *testing.T) {
+	readOnly := func(r *http.Request) error {
+		if err := BearerAuth("reader", "admin")(r); err != nil {
+			return err
+		}
+		if r.Method != http.MethodGet && r.Header.Get("Authorization") != "Bearer admin" {
+			return ErrForbidden
+		}
+		return nil
+	}
+
+	tests := []struct {
+		name          string
+		auth          AuthFunc
+		method        string
+		header        string
+		value         string
+		basicUser     string
+		basicPassword string
+		want          int
+		wantChallenge string
+	}{
+		{name: "no auth", want: http.StatusOK},
+		{name: "bearer", auth: BearerAuth("t0ken"), header: "Authorization", value: "Bearer t0ken", want: http.StatusOK},
+		{name: "bearer missing", auth: BearerAuth("t0ken"), want: http.StatusUnauthorized, wantChallenge: "Bearer"},
+		{name: "bearer wrong", auth: BearerAuth("t0ken"), header: "Authorization", value: "Bearer nope", want: http.StatusUnauthorized, wantChallenge: "Bearer"},
+		{name: "bearer empty token", auth: BearerAuth(""), header: "Authorization", value: "Bearer ", want: http.StatusUnauthorized, wantChallenge: "Bearer"},
+		{name: "api key", auth: APIKeyAuth("X-API-Key", "k1", "k2"), header: "X-API-Key", value: "k2", want: http.StatusOK},
+		{name: "api key wrong", auth: APIKeyAuth("X-API-Key", "k1"), header: "X-API-Key", value: "k2", want: http.StatusUnauthorized},
+		{name: "basic", auth: BasicAuth("ratelimit", map[string]string{"ops": "s3cret"}), basicUser: "ops", basicPassword: "s3cret", want: http.StatusOK},
+		{name: "basic wrong", auth: BasicAuth("ratelimit", map[string]string{"ops": "s3cret"}), basicUser: "ops", basicPassword: "nope", want: http.StatusUnauthorized, wantChallenge: `Basic realm="ratelimit"`},
+		{name: "custom allowed", auth: readOnly, method: http.MethodGet, header: "Authorization", value: "Bearer reader", want: http.StatusOK},
+		{name: "custom forbidden", auth: readOnly, method: http.MethodDelete, header: "Authorization", value: "Bearer reader", want: http.StatusForbidden},
+		{name: "custom error", auth: func(r *http.Request) error { return errors.New("directory down") }, want: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := RequireAuth(test.auth, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/bucket", nil)
+			if test.header != "" {
+				r.Header.Set(test.header, test.value)
+			}
+			if test.basicUser != "" {
+				r.SetBasicAuth(test.basicUser, test.basicPassword)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != test.want || w.Header().Get("WWW-Authenticate") != test.wantChallenge {
+				t.Fatalf("status %d, challenge %q; want %d, %q", w.Code, w.Header().Get("WWW-Authenticate"), test.want, test.wantChallenge)
+			}
+		})
+	}
+}
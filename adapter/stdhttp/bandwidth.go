@@ -0,0 +1,46 @@
+package stdhttp
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// BandwidthMiddleware paces the response bytes written by next.
+func BandwidthMiddleware(limiter core.BandwidthLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		next.ServeHTTP(&pacedResponseWriter{
+			ResponseWriter: w,
+			paced:          limiter.PaceWriter(request, w),
+		}, request)
+	})
+}
+
+// UploadMiddleware paces, or with REJECT_OVER_LIMIT fails, the reads of the
+// request body made by next.
+func UploadMiddleware(limiter core.BandwidthLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		request.Body = limiter.PaceBody(request)
+		next.ServeHTTP(w, request)
+	})
+}
+
+type pacedResponseWriter struct {
+	http.ResponseWriter
+	paced io.Writer
+}
+
+func (w *pacedResponseWriter) Write(data []byte) (int, error) {
+	return w.paced.Write(data)
+}
+
+func (w *pacedResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *pacedResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,98 @@
+package stdhttp
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// Middleware adapts limiter to the func(http.Handler) http.Handler shape
+// chi, gorilla/mux and alice chain:
+//
+//	r.Use(stdhttp.Middleware(rateLimiter))
+func Middleware(limiter core.RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return RateLimitMiddleware(limiter, next)
+	}
+}
+
+// Limit gives a router, subrouter or single route its own limiter,
+// configured and running, overriding whatever limit its parent uses:
+//
+//	api.Use(stdhttp.Limit(core.RateLimiterConfig{
+//		RATE_LIMIT:      100,
+//		REFILL_INTERVAL: time.Second,
+//	}))
+func Limit(config core.RateLimiterConfig) func(http.Handler) http.Handler {
+	limiter := core.New()
+	limiter.SetConfig(config)
+	limiter.Run()
+	return Middleware(limiter)
+}
+
+// RouteTemplates records the route template templateFunc reports for each
+// request, so KEY_BY_PATH keys by it. Chain it before the limiter. With
+// gorilla/mux, whose middleware runs after matching:
+//
+//	r.Use(stdhttp.RouteTemplates(func(r *http.Request) string {
+//		template, _ := mux.CurrentRoute(r).GetPathTemplate()
+//		return template
+//	}))
+func RouteTemplates(templateFunc func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			if template := templateFunc(request); template != "" {
+				request = core.WithRouteTemplate(request, template)
+			}
+			next.ServeHTTP(w, request)
+		})
+	}
+}
+
+type MiddlewareConfig struct {
+	// Requests for which SKIP returns true bypass the limiter, e.g. health
+	// checks.
+	SKIP func(r *http.Request) bool
+	// Writes the response for rejected requests, after the rate limit
+	// headers are set. Defaults to a JSON 429.
+	REJECT_HANDLER http.Handler
+}
+
+// NewMiddleware is Middleware with options, for alice and other
+// func(http.Handler) http.Handler chains:
+//
+//	chain := alice.New(stdhttp.NewMiddleware(rateLimiter, stdhttp.MiddlewareConfig{
+//		SKIP: func(r *http.Request) bool { return r.URL.Path == "/healthz" },
+//	}))
+func NewMiddleware(limiter core.RateLimiter, config MiddlewareConfig) func(http.Handler) http.Handler {
+	handler := NewNegroniHandler(limiter, config)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			handler.ServeHTTP(w, request, next.ServeHTTP)
+		})
+	}
+}
+
+// NegroniHandler implements negroni.Handler, so the limiter can be added to
+// a negroni stack without an adapter:
+//
+//	n := negroni.Classic()
+//	n.Use(stdhttp.NewNegroniHandler(rateLimiter, stdhttp.MiddlewareConfig{}))
+type NegroniHandler struct {
+	MiddlewareConfig
+	limiter core.RateLimiter
+}
+
+func NewNegroniHandler(limiter core.RateLimiter, config MiddlewareConfig) *NegroniHandler {
+	return &NegroniHandler{MiddlewareConfig: config, limiter: limiter}
+}
+
+func (h *NegroniHandler) ServeHTTP(w http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	if h.SKIP != nil && h.SKIP(request) {
+		next(w, request)
+		return
+	}
+	if allow(h.limiter, w, request, h.REJECT_HANDLER) {
+		next(w, request)
+	}
+}
@@ -0,0 +1,77 @@
+package stdhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestRouteTemplates(t *testing.T) {
+	var got string
+	handler := RouteTemplates(func(r *http.Request) string { return "/users/{id}" })(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = core.RouteTemplate(r) }))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	if got != "/users/{id}" {
+		t.Fatalf("route template %q, want %q", got, "/users/{id}")
+	}
+}
+
+func TestNewMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    MiddlewareConfig
+		path      string
+		wantCodes []int
+	}{
+		{name: "default rejection", path: "/", wantCodes: []int{http.StatusOK, http.StatusTooManyRequests}},
+		{
+			name:      "skipped",
+			config:    MiddlewareConfig{SKIP: func(r *http.Request) bool { return r.URL.Path == "/healthz" }},
+			path:      "/healthz",
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name: "custom rejection",
+			config: MiddlewareConfig{REJECT_HANDLER: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})},
+			path:      "/",
+			wantCodes: []int{http.StatusOK, http.StatusServiceUnavailable},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: clientKey})
+			handler := NewMiddleware(limiter, test.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i, want := range test.wantCodes {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+				if w.Code != want {
+					t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNegroniHandler(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: clientKey})
+	handler := NewNegroniHandler(limiter, MiddlewareConfig{})
+
+	calls := 0
+	next := func(w http.ResponseWriter, r *http.Request) { calls++ }
+	for i := 0; i < 2; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil), next)
+	}
+	if calls != 1 {
+		t.Fatalf("next called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,86 @@
+package stdhttp
+
+import (
+	_ "embed"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+// Ban is a key the dashboard shows as blocked, by the deny list or by a
+// lockout such as ThrottleKey's.
+type Ban struct {
+	Key string `json:"key"`
+	// "denylist", or "throttled" for a lockout.
+	Reason string `json:"reason"`
+	// Zero for a denial until the key is unlisted.
+	Until time.Time `json:"until"`
+}
+
+// Dashboard returns a single-page dashboard of the limiter, showing its
+// tokens and rejection rate live, the keys rejected most and the keys
+// blocked. The page reads the limiter from "events", a
+// StreamBucketStatus, and "bans", next to it, so the handler is mounted on
+// a subtree with its prefix stripped:
+//
+//	mux.Handle("/ratelimit/dashboard/", http.StripPrefix("/ratelimit/dashboard", stdhttp.Dashboard(limiter)))
+//
+// Keys are hashed unless DEBUG_RAW_KEYS is set, as in the status events.
+// The dashboard can reset nothing, but it shows who is being limited, so
+// it belongs behind the same protection as the status endpoints, e.g.
+// RequireAuth.
+func Dashboard(limiter core.RateLimiter) http.Handler {
+	events := StreamBucketStatus(limiter)
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		switch {
+		case strings.HasSuffix(request.URL.Path, "/events"):
+			events(w, request)
+		case strings.HasSuffix(request.URL.Path, "/bans"):
+			writeJSON(w, http.StatusOK, bans(limiter, time.Now()))
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(dashboardPage)
+		}
+	})
+}
+
+// bans lists the keys on the deny list and the keys locked out, soonest
+// released first.
+func bans(limiter core.RateLimiter, now time.Time) []Ban {
+	show := func(key string) string { return key }
+	if !limiter.Config().DEBUG_RAW_KEYS {
+		show = core.HashKey
+	}
+
+	bans := []Ban{}
+	for key, until := range limiter.KeyLists().Denied {
+		bans = append(bans, Ban{Key: show(key), Reason: "denylist", Until: until})
+	}
+	// A key is locked in every set of buckets it has, so it is shown once,
+	// until its last lock ends.
+	locked := map[string]time.Time{}
+	for _, status := range limiter.Keys() {
+		if status.LockedUntil.After(now) && status.LockedUntil.After(locked[status.Key]) {
+			locked[status.Key] = status.LockedUntil
+		}
+	}
+	for key, until := range locked {
+		bans = append(bans, Ban{Key: show(key), Reason: "throttled", Until: until})
+	}
+	sort.Slice(bans, func(i, j int) bool {
+		if bans[i].Until.IsZero() != bans[j].Until.IsZero() {
+			return bans[j].Until.IsZero()
+		}
+		if !bans[i].Until.Equal(bans[j].Until) {
+			return bans[i].Until.Before(bans[j].Until)
+		}
+		return bans[i].Key < bans[j].Key
+	})
+	return bans
+}
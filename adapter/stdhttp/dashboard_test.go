@@ -0,0 +1,54 @@
+package stdhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestDashboard(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      2,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	limiter.DenyKey("mallory", 0)
+	limiter.ThrottleKey("trudy", 0, time.Minute)
+
+	mux := http.NewServeMux()
+	mux.Handle("/ratelimit/dashboard/", http.StripPrefix("/ratelimit/dashboard", Dashboard(limiter)))
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ratelimit/dashboard/", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") || !strings.Contains(w.Body.String(), `EventSource(base + "events")`) {
+		t.Fatalf("page: status %d, type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ratelimit/dashboard/bans", nil))
+	var got []Ban
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := []Ban{
+		{Key: core.HashKey("trudy"), Reason: "throttled"},
+		{Key: core.HashKey("mallory"), Reason: "denylist"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("bans %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Key != want[i].Key || got[i].Reason != want[i].Reason {
+			t.Errorf("ban %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if !got[0].Until.After(time.Now()) || !got[1].Until.IsZero() {
+		t.Errorf("bans until %v and %v", got[0].Until, got[1].Until)
+	}
+}
@@ -0,0 +1,53 @@
+package stdhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// RateLimitMiddleware limits the requests reaching next.
+func RateLimitMiddleware(limiter core.RateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		if Allow(limiter, w, request) {
+			next.ServeHTTP(w, request)
+		}
+	})
+}
+
+// Allow charges the request and sets the rate limit headers. Rejected
+// requests get their response written and false is returned.
+func Allow(limiter core.RateLimiter, w http.ResponseWriter, request *http.Request) bool {
+	return allow(limiter, w, request, nil)
+}
+
+// allow is Allow with reject, when not nil, writing the response for
+// rejected requests instead of the JSON 429 body.
+func allow(limiter core.RateLimiter, w http.ResponseWriter, request *http.Request, reject http.Handler) bool {
+	d := limiter.Decide(request)
+
+	if d.Exempt {
+		return true
+	}
+	limiter.WriteHeaders(w.Header(), d)
+	if d.Allowed {
+		return true
+	}
+
+	challenge := limiter.Config().CHALLENGE_HANDLER
+	if challenge != nil && challenge(w, request, d.Key) {
+		return false
+	}
+	if reject != nil {
+		reject.ServeHTTP(w, request)
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"message": "Too many requests",
+	})
+	return false
+}
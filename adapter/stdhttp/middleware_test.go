@@ -0,0 +1,77 @@
+package stdhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func clientKey(r *http.Request) string {
+	return core.StripPort(r.RemoteAddr)
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    core.RateLimiterConfig
+		wantCodes []int
+	}{
+		{
+			name:      "within the limit",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour, KEY_FUNC: clientKey},
+			wantCodes: []int{http.StatusOK, http.StatusOK},
+		},
+		{
+			name:      "past the limit",
+			config:    core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: clientKey},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+		{
+			name: "challenge",
+			config: core.RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        clientKey,
+				CHALLENGE_HANDLER: func(w http.ResponseWriter, r *http.Request, key string) bool {
+					w.WriteHeader(http.StatusForbidden)
+					return true
+				},
+			},
+			wantCodes: []int{http.StatusOK, http.StatusForbidden},
+		},
+		{
+			name: "challenge declined",
+			config: core.RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        clientKey,
+				CHALLENGE_HANDLER: func(w http.ResponseWriter, r *http.Request, key string) bool {
+					return false
+				},
+			},
+			wantCodes: []int{http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(test.config)
+			handler := RateLimitMiddleware(limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i, want := range test.wantCodes {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+				if w.Code != want {
+					t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+				}
+				if w.Header().Get("X-RateLimit-Remaining") == "" {
+					t.Fatalf("request %d: no X-RateLimit-Remaining header", i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package stdhttp
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// ServeMuxPatterns records the pattern mux routes each request to, e.g.
+// "GET /users/{id}", as its route template, so KEY_BY_PATH gives every
+// http.ServeMux route its own bucket. Since the limiter runs before the mux
+// matches, wrap the whole chain:
+//
+//	handler := stdhttp.ServeMuxPatterns(mux)(stdhttp.Middleware(rateLimiter)(mux))
+func ServeMuxPatterns(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return RouteTemplates(func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	})
+}
+
+// LimitPatterns serves mux, limiting each request with the limiter given
+// for the pattern it matches. Requests to other patterns are not limited.
+// Patterns are the exact strings the handlers were registered with:
+//
+//	mux.HandleFunc("POST /login", login)
+//	mux.HandleFunc("GET /users/{id}", getUser)
+//	http.ListenAndServe(addr, stdhttp.LimitPatterns(mux, map[string]core.RateLimiter{
+//		"POST /login":     loginLimiter,
+//		"GET /users/{id}": apiLimiter,
+//	}))
+func LimitPatterns(mux *http.ServeMux, limiters map[string]core.RateLimiter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		_, pattern := mux.Handler(request)
+		if pattern != "" {
+			request = core.WithRouteTemplate(request, pattern)
+		}
+
+		if limiter, ok := limiters[pattern]; ok && !Allow(limiter, w, request) {
+			return
+		}
+		mux.ServeHTTP(w, request)
+	})
+}
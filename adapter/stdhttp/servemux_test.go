@@ -0,0 +1,76 @@
+package stdhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func newMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	mux.HandleFunc("GET /users/{id}", noop)
+	mux.HandleFunc("POST /login", noop)
+	mux.HandleFunc("GET /health", noop)
+	return mux
+}
+
+func TestServeMuxPatterns(t *testing.T) {
+	mux := newMux()
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: clientKey, KEY_BY_PATH: true})
+	handler := ServeMuxPatterns(mux)(Middleware(limiter)(mux))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{name: "first user", method: http.MethodGet, path: "/users/1", want: http.StatusOK},
+		{name: "other user shares the pattern", method: http.MethodGet, path: "/users/2", want: http.StatusTooManyRequests},
+		{name: "other pattern", method: http.MethodPost, path: "/login", want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestLimitPatterns(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: clientKey})
+	handler := LimitPatterns(newMux(), map[string]core.RateLimiter{"POST /login": limiter})
+
+	tests := []struct {
+		name      string
+		method    string
+		path      string
+		wantCodes []int
+	}{
+		{name: "limited pattern", method: http.MethodPost, path: "/login", wantCodes: []int{http.StatusOK, http.StatusTooManyRequests}},
+		{name: "unlimited pattern", method: http.MethodGet, path: "/health", wantCodes: []int{http.StatusOK, http.StatusOK}},
+		{name: "no pattern", method: http.MethodGet, path: "/missing", wantCodes: []int{http.StatusNotFound, http.StatusNotFound}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i, want := range test.wantCodes {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+				if w.Code != want {
+					t.Fatalf("request %d: status %d, want %d", i, w.Code, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package stdhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// StreamBucketStatus sends a core.BucketStatusEvent as a Server-Sent Event
+// every STATUS_STREAM_INTERVAL until the client disconnects.
+func StreamBucketStatus(limiter core.RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		ticker := time.NewTicker(limiter.Config().STATUS_STREAM_INTERVAL)
+		defer ticker.Stop()
+
+		lastDenied := limiter.StatusEvent().DeniedTotal
+		lastTick := time.Now()
+		for {
+			event := limiter.StatusEvent()
+			now := time.Now()
+
+			if elapsed := now.Sub(lastTick).Seconds(); elapsed > 0 {
+				event.RejectionsPerSecond = float64(event.DeniedTotal-lastDenied) / elapsed
+			}
+			lastDenied, lastTick = event.DeniedTotal, now
+
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+
+			select {
+			case <-request.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
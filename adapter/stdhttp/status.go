@@ -0,0 +1,177 @@
+package stdhttp
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// maxKeysPage caps how many keys a page of GetBucketStatus lists.
+const maxKeysPage = 1000
+
+// keysPage is a page of the keys listed by GetBucketStatus.
+type keysPage struct {
+	Keys []core.KeyStatus
+	// Keys matching the filters, across all pages.
+	Total int
+	// Offset of the next page, zero on the last.
+	NextOffset int `json:",omitempty"`
+}
+
+// GetBucketStatus reports the limiter's status. With the "keys" query
+// parameter set it lists the in-memory bucket of each key as well, a page
+// at a time, under "Keys":
+//
+//	GET /bucket?keys=1&limit=100&offset=200   the third page of 100
+//	GET /bucket?keys=1&prefix=ip:             keys starting with ip:
+//	GET /bucket?keys=1&set=bot                the buckets of one set
+//	GET /bucket?keys=1&locked=1               keys blocked by ThrottleKey
+//
+// Pages hold 100 keys by default and at most 1000. Keys are listed in
+// order of set and key, and hashed unless DEBUG_RAW_KEYS is set; prefix
+// matches the keys before they are hashed.
+func GetBucketStatus(limiter core.RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		query := request.URL.Query()
+		if query.Get("keys") == "" {
+			writeJSON(w, http.StatusOK, limiter.Status())
+			return
+		}
+
+		offset, err := queryInt(query.Get("offset"), 0)
+		if err != nil || offset < 0 {
+			writeAdmin(w, http.StatusBadRequest, false, "offset must be a non-negative integer")
+			return
+		}
+		limit, err := queryInt(query.Get("limit"), 100)
+		if err != nil || limit <= 0 {
+			writeAdmin(w, http.StatusBadRequest, false, "limit must be a positive integer")
+			return
+		}
+		limit = min(limit, maxKeysPage)
+
+		prefix, set, locked := query.Get("prefix"), query.Get("set"), query.Get("locked") != ""
+		now := time.Now()
+		var matching []core.KeyStatus
+		for _, key := range limiter.Keys() {
+			if strings.HasPrefix(key.Key, prefix) && (set == "" || key.Set == set) && (!locked || key.LockedUntil.After(now)) {
+				matching = append(matching, key)
+			}
+		}
+
+		page := keysPage{Keys: []core.KeyStatus{}, Total: len(matching)}
+		if offset < len(matching) {
+			page.Keys = matching[offset:min(offset+limit, len(matching))]
+			if offset+limit < len(matching) {
+				page.NextOffset = offset + limit
+			}
+		}
+		if !limiter.Config().DEBUG_RAW_KEYS {
+			for i := range page.Keys {
+				page.Keys[i].Key = core.HashKey(page.Keys[i].Key)
+			}
+		}
+		writeJSON(w, http.StatusOK, struct {
+			core.BucketStatus
+			Keys keysPage
+		}{limiter.Status(), page})
+	}
+}
+
+// queryInt parses an integer query parameter, fallback if it is missing.
+func queryInt(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// maxTopKeys caps how many keys GetTopKeys lists.
+const maxTopKeys = 100
+
+// GetTopKeys lists the keys denied most over TOP_KEYS_WINDOW, to find
+// abuse sources without going through logs, e.g. mounted at /status/top.
+// The "n" query parameter sets how many, 10 by default and at most 100.
+// Keys are hashed unless DEBUG_RAW_KEYS is set.
+func GetTopKeys(limiter core.RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		n := 10
+		if value := request.URL.Query().Get("n"); value != "" {
+			var err error
+			if n, err = strconv.Atoi(value); err != nil || n <= 0 {
+				writeAdmin(w, http.StatusBadRequest, false, "n must be a positive integer")
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"window": limiter.Config().TOP_KEYS_WINDOW.String(),
+			"keys":   limiter.TopKeys(min(n, maxTopKeys)),
+		})
+	}
+}
+
+// ResetKey resets the bucket of the key given in the "key" query parameter.
+// It only answers POST and DELETE, so links and prefetches can't reset
+// buckets.
+func ResetKey(limiter core.RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		if !resetMethodAllowed(w, request) {
+			return
+		}
+		key := request.URL.Query().Get("key")
+
+		w.Header().Set("Content-Type", "application/json")
+		if key == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": "key is required",
+			})
+			return
+		}
+
+		limiter.ResetKey(key)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "Bucket reset",
+		})
+	}
+}
+
+// ResetAll resets every bucket. Like ResetKey, it only answers POST and
+// DELETE.
+func ResetAll(limiter core.RateLimiter) http.HandlerFunc {
+	return func(w http.ResponseWriter, request *http.Request) {
+		if !resetMethodAllowed(w, request) {
+			return
+		}
+		limiter.ResetAll()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"success": true,
+			"message": "All buckets reset",
+		})
+	}
+}
+
+// resetMethodAllowed answers requests to the reset handlers that are not
+// POST or DELETE with 405 Method Not Allowed.
+func resetMethodAllowed(w http.ResponseWriter, request *http.Request) bool {
+	if request.Method == http.MethodPost || request.Method == http.MethodDelete {
+		return true
+	}
+
+	w.Header().Set("Allow", "POST, DELETE")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusMethodNotAllowed)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"message": "use POST or DELETE",
+	})
+	return false
+}
@@ -0,0 +1,169 @@
+package stdhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestResetHandlersMethods(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		method  string
+		target  string
+		want    int
+	}{
+		{name: "reset key by GET", handler: ResetKey(limiter), method: http.MethodGet, target: "/?key=a", want: http.StatusMethodNotAllowed},
+		{name: "reset key by POST", handler: ResetKey(limiter), method: http.MethodPost, target: "/?key=a", want: http.StatusOK},
+		{name: "reset key by DELETE", handler: ResetKey(limiter), method: http.MethodDelete, target: "/?key=a", want: http.StatusOK},
+		{name: "reset key without key", handler: ResetKey(limiter), method: http.MethodPost, target: "/", want: http.StatusBadRequest},
+		{name: "reset all by GET", handler: ResetAll(limiter), method: http.MethodGet, target: "/", want: http.StatusMethodNotAllowed},
+		{name: "reset all by HEAD", handler: ResetAll(limiter), method: http.MethodHead, target: "/", want: http.StatusMethodNotAllowed},
+		{name: "reset all by POST", handler: ResetAll(limiter), method: http.MethodPost, target: "/", want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			test.handler(w, httptest.NewRequest(test.method, test.target, nil))
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d", w.Code, test.want)
+			}
+			if test.want == http.StatusMethodNotAllowed && w.Header().Get("Allow") != "POST, DELETE" {
+				t.Fatalf("Allow %q, want %q", w.Header().Get("Allow"), "POST, DELETE")
+			}
+		})
+	}
+}
+
+func TestGetTopKeys(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+		DEBUG_RAW_KEYS:  true,
+	})
+	for client, requests := range map[string]int{"alice": 2, "bob": 4, "carol": 3} {
+		for i := 0; i < requests; i++ {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("X-Client", client)
+			limiter.Decide(r)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		want     int
+		wantKeys []core.KeyCount
+	}{
+		{name: "default", target: "/status/top", want: http.StatusOK, wantKeys: []core.KeyCount{{Key: "bob", Count: 3}, {Key: "carol", Count: 2}, {Key: "alice", Count: 1}}},
+		{name: "top one", target: "/status/top?n=1", want: http.StatusOK, wantKeys: []core.KeyCount{{Key: "bob", Count: 3}}},
+		{name: "bad n", target: "/status/top?n=-1", want: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			GetTopKeys(limiter)(w, httptest.NewRequest(http.MethodGet, test.target, nil))
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d", w.Code, test.want)
+			}
+			if test.want != http.StatusOK {
+				return
+			}
+			var body struct {
+				Window string
+				Keys   []core.KeyCount
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Window != "5m0s" || fmt.Sprint(body.Keys) != fmt.Sprint(test.wantKeys) {
+				t.Fatalf("window %s, keys %v, want %v", body.Window, body.Keys, test.wantKeys)
+			}
+		})
+	}
+}
+
+func TestGetBucketStatusKeys(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      5,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+		DEBUG_RAW_KEYS:  true,
+	})
+	for _, client := range []string{"ip:203.0.113.7", "ip:203.0.113.8", "ip:203.0.113.9", "user:alice"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		limiter.Decide(r)
+	}
+	limiter.ThrottleKey("user:alice", 0, time.Minute)
+
+	tests := []struct {
+		name           string
+		target         string
+		want           int
+		wantKeys       []string
+		wantTotal      int
+		wantNextOffset int
+	}{
+		{name: "no keys", target: "/bucket", want: http.StatusOK},
+		{name: "first page", target: "/bucket?keys=1&limit=2&set=default", want: http.StatusOK, wantKeys: []string{"ip:203.0.113.7", "ip:203.0.113.8"}, wantTotal: 4, wantNextOffset: 2},
+		{name: "last page", target: "/bucket?keys=1&limit=2&offset=2&set=default", want: http.StatusOK, wantKeys: []string{"ip:203.0.113.9", "user:alice"}, wantTotal: 4},
+		{name: "past the end", target: "/bucket?keys=1&offset=10&set=default", want: http.StatusOK, wantKeys: []string{}, wantTotal: 4},
+		{name: "prefix", target: "/bucket?keys=1&prefix=user:&set=default", want: http.StatusOK, wantKeys: []string{"user:alice"}, wantTotal: 1},
+		{name: "locked", target: "/bucket?keys=1&locked=1&set=default", want: http.StatusOK, wantKeys: []string{"user:alice"}, wantTotal: 1},
+		{name: "bad limit", target: "/bucket?keys=1&limit=0", want: http.StatusBadRequest},
+		{name: "bad offset", target: "/bucket?keys=1&offset=-1", want: http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			GetBucketStatus(limiter)(w, httptest.NewRequest(http.MethodGet, test.target, nil))
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d", w.Code, test.want)
+			}
+			if test.want != http.StatusOK {
+				return
+			}
+			var body struct {
+				BucketLimit int64
+				Keys        *struct {
+					Keys       []core.KeyStatus
+					Total      int
+					NextOffset int
+				}
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.BucketLimit != 5 {
+				t.Fatalf("bucket limit %d, want 5", body.BucketLimit)
+			}
+			if test.wantKeys == nil {
+				if body.Keys != nil {
+					t.Fatalf("keys listed unasked: %+v", body.Keys)
+				}
+				return
+			}
+			keys := []string{}
+			for _, key := range body.Keys.Keys {
+				keys = append(keys, key.Key)
+			}
+			if fmt.Sprint(keys) != fmt.Sprint(test.wantKeys) || body.Keys.Total != test.wantTotal || body.Keys.NextOffset != test.wantNextOffset {
+				t.Fatalf("keys %v, total %d, next %d; want %v, %d, %d", keys, body.Keys.Total, body.Keys.NextOffset, test.wantKeys, test.wantTotal, test.wantNextOffset)
+			}
+		})
+	}
+}
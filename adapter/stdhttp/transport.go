@@ -0,0 +1,152 @@
+package stdhttp
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// Transport is an http.RoundTripper that throttles outbound requests, so a
+// client can stay under a third-party API's limit with the same limiter
+// the server side uses. The limiter's KEY_FUNC sees the outbound request;
+// HostKey limits each destination host separately.
+type Transport struct {
+	// Sends the requests the limiter lets through. Defaults to
+	// http.DefaultTransport.
+	Base    http.RoundTripper
+	Limiter core.RateLimiter
+	// Fails requests with a *RateLimitError instead of waiting for a
+	// token. MAX_WAIT still applies.
+	FailFast bool
+	// Tunes the request's bucket to the upstream's RateLimit-*,
+	// X-RateLimit-* and Retry-After headers, and pauses it after a 429.
+	// Needs a limiter with KEY_FUNC.
+	Adaptive bool
+}
+
+// NewTransport returns a Transport that waits for a token before sending
+// each request.
+func NewTransport(base http.RoundTripper, limiter core.RateLimiter) *Transport {
+	return &Transport{Base: base, Limiter: limiter}
+}
+
+// RateLimitError is returned by a FailFast Transport for requests the
+// limiter rejects.
+type RateLimitError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %f second", e.RetryAfter.Seconds())
+}
+
+// NewAdaptiveTransport returns a Transport that waits for a token before
+// sending each request and follows the upstream's rate limit headers.
+func NewAdaptiveTransport(base http.RoundTripper, limiter core.RateLimiter) *Transport {
+	return &Transport{Base: base, Limiter: limiter, Adaptive: true}
+}
+
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	var d core.Decision
+	if t.FailFast {
+		if d = t.Limiter.Decide(request); !d.Allowed {
+			return nil, &RateLimitError{Key: d.Key, RetryAfter: d.RetryAfter}
+		}
+	} else {
+		var err error
+		if d, err = t.Limiter.Wait(request); err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := t.base().RoundTrip(request)
+	if err == nil && t.Adaptive && !d.Exempt {
+		remaining, pause := upstreamLimit(response, time.Now())
+		t.Limiter.ThrottleKey(d.Key, remaining, pause)
+	}
+	return response, err
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+// HostKey is a KEY_FUNC that limits each destination host separately.
+func HostKey(r *http.Request) string {
+	return "host:" + r.URL.Host
+}
+
+// upstreamLimit reads what an upstream says about its limit: the tokens it
+// has left, -1 if it doesn't say, and how long to hold off. A 429 or 503
+// pauses until Retry-After, or the reset time, or for a second; an
+// exhausted limit pauses until the reset time.
+func upstreamLimit(response *http.Response, now time.Time) (remaining int64, pause time.Duration) {
+	remaining = -1
+	if value := limitHeader(response.Header, "Remaining"); value != "" {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= 0 {
+			remaining = n
+		}
+	}
+	reset := resetDelay(limitHeader(response.Header, "Reset"), now)
+
+	switch {
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable:
+		remaining = 0
+		pause = retryAfterDelay(response.Header.Get("Retry-After"), now)
+		if pause <= 0 {
+			pause = reset
+		}
+		if pause <= 0 && response.StatusCode == http.StatusTooManyRequests {
+			pause = time.Second
+		}
+	case remaining == 0:
+		pause = reset
+	}
+	return remaining, pause
+}
+
+// limitHeader returns the RateLimit-<field> header, falling back to
+// X-RateLimit-<field>.
+func limitHeader(h http.Header, field string) string {
+	if value := h.Get("RateLimit-" + field); value != "" {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(h.Get("X-RateLimit-" + field))
+}
+
+// resetDelay parses a reset header, given either in seconds from now or,
+// as some APIs do, as a Unix timestamp.
+func resetDelay(value string, now time.Time) time.Duration {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n <= 0 {
+		return 0
+	}
+	if n > 1e9 {
+		return time.Unix(int64(n), 0).Sub(now)
+	}
+	return time.Duration(n * float64(time.Second))
+}
+
+// retryAfterDelay parses Retry-After, given in seconds, optionally followed
+// by a unit as this package writes it, or as an HTTP date.
+func retryAfterDelay(value string, now time.Time) time.Duration {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,131 @@
+package stdhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// roundTripFunc is an http.RoundTripper answering with a canned response.
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func respond(header http.Header, status int) roundTripFunc {
+	return func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Header: header, Body: http.NoBody, Request: r}, nil
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		failFast bool
+		urls     []string
+		wantErrs []bool
+	}{
+		{name: "fail fast", failFast: true, urls: []string{"http://a.example/", "http://a.example/"}, wantErrs: []bool{false, true}},
+		{name: "per host", failFast: true, urls: []string{"http://a.example/", "http://b.example/"}, wantErrs: []bool{false, false}},
+		{name: "waits", urls: []string{"http://a.example/", "http://a.example/"}, wantErrs: []bool{false, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.New()
+			limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: HostKey})
+			transport := &Transport{Base: respond(http.Header{}, http.StatusOK), Limiter: limiter, FailFast: test.failFast}
+
+			for i, url := range test.urls {
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				_, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx))
+				cancel()
+				if (err != nil) != test.wantErrs[i] {
+					t.Fatalf("request %d to %s: error %v, want error %v", i, url, err, test.wantErrs[i])
+				}
+				var rateLimitErr *RateLimitError
+				if err != nil && test.failFast && !errors.As(err, &rateLimitErr) {
+					t.Fatalf("request %d: error %T, want *RateLimitError", i, err)
+				}
+			}
+		})
+	}
+}
+
+func TestUpstreamLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name          string
+		status        int
+		header        http.Header
+		wantRemaining int64
+		wantPause     time.Duration
+	}{
+		{name: "silent upstream", status: http.StatusOK, header: http.Header{}, wantRemaining: -1},
+		{name: "remaining", status: http.StatusOK, header: http.Header{"Ratelimit-Remaining": {"7"}}, wantRemaining: 7},
+		{name: "X- headers", status: http.StatusOK, header: http.Header{"X-Ratelimit-Remaining": {"3"}}, wantRemaining: 3},
+		{
+			name:          "exhausted until reset",
+			status:        http.StatusOK,
+			header:        http.Header{"Ratelimit-Remaining": {"0"}, "Ratelimit-Reset": {"30"}},
+			wantRemaining: 0,
+			wantPause:     30 * time.Second,
+		},
+		{
+			name:          "reset as a timestamp",
+			status:        http.StatusOK,
+			header:        http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"1700000060"}},
+			wantRemaining: 0,
+			wantPause:     time.Minute,
+		},
+		{name: "429 with Retry-After", status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"5"}}, wantPause: 5 * time.Second},
+		{name: "429 with our Retry-After", status: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"1.500000 second"}}, wantPause: 1500 * time.Millisecond},
+		{
+			name:      "429 with a date",
+			status:    http.StatusTooManyRequests,
+			header:    http.Header{"Retry-After": {now.Add(10 * time.Second).UTC().Format(http.TimeFormat)}},
+			wantPause: 10 * time.Second,
+		},
+		{name: "bare 429", status: http.StatusTooManyRequests, header: http.Header{}, wantPause: time.Second},
+		{name: "bare 503", status: http.StatusServiceUnavailable, header: http.Header{}, wantPause: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			remaining, pause := upstreamLimit(&http.Response{StatusCode: test.status, Header: test.header}, now)
+			if remaining != test.wantRemaining || pause != test.wantPause {
+				t.Fatalf("upstreamLimit = %d, %v, want %d, %v", remaining, pause, test.wantRemaining, test.wantPause)
+			}
+		})
+	}
+}
+
+func TestAdaptiveTransport(t *testing.T) {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour, KEY_FUNC: HostKey})
+	transport := &Transport{
+		Base:     respond(http.Header{"Retry-After": {"3600"}}, http.StatusTooManyRequests),
+		Limiter:  limiter,
+		FailFast: true,
+		Adaptive: true,
+	}
+
+	if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://a.example/", nil)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://a.example/", nil))
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) || rateLimitErr.RetryAfter < 59*time.Minute {
+		t.Fatalf("request after a 429 returned %v, want a *RateLimitError for about an hour", err)
+	}
+	if _, err := transport.RoundTrip(httptest.NewRequest(http.MethodGet, "http://b.example/", nil)); err != nil {
+		t.Fatalf("request to another host failed: %v", err)
+	}
+}
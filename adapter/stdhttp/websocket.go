@@ -0,0 +1,13 @@
+package stdhttp
+
+import (
+	"net/http"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// AllowUpgrade charges a WebSocket upgrade request and writes the usual 429
+// response when it is rejected. Call it before upgrading.
+func AllowUpgrade(limiter core.WebSocketLimiter, w http.ResponseWriter, request *http.Request) bool {
+	return Allow(limiter.UpgradeLimiter(), w, request)
+}
@@ -0,0 +1,98 @@
+package wslimiter
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gorilla/websocket"
+)
+
+// ErrUpgradeRateLimited is returned by Upgrade when the client opened too
+// many connections. The 429 response has already been written.
+var ErrUpgradeRateLimited = errors.New("wslimiter: upgrade rate limit exceeded")
+
+// ErrMessageRateLimited is returned from reads once a client sends messages
+// faster than its connection allows. The connection has been closed with a
+// policy violation.
+var ErrMessageRateLimited = errors.New("wslimiter: message rate limit exceeded")
+
+// closeTimeout bounds how long sending the close frame may take.
+const closeTimeout = time.Second
+
+// Upgrade checks the request against limiter's upgrade limit, upgrades it
+// with upgrader and returns the connection with its own message bucket,
+// covering a gorilla/websocket connection's whole life:
+//
+//	conn, err := wslimiter.Upgrade(wsLimiter, &upgrader, w, r, nil)
+//	if err != nil {
+//		return
+//	}
+//	defer conn.Close()
+//	for {
+//		_, message, err := conn.ReadMessage()
+//		...
+//	}
+func Upgrade(limiter core.WebSocketLimiter, upgrader *websocket.Upgrader, w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Conn, error) {
+	if !stdhttp.AllowUpgrade(limiter, w, r) {
+		return nil, ErrUpgradeRateLimited
+	}
+
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, limiter.NewConnLimiter()), nil
+}
+
+// Conn is a websocket.Conn whose incoming messages are charged to a
+// ConnLimiter. A message over the limit closes the connection.
+type Conn struct {
+	*websocket.Conn
+	messages core.ConnLimiter
+}
+
+func NewConn(conn *websocket.Conn, messages core.ConnLimiter) *Conn {
+	return &Conn{Conn: conn, messages: messages}
+}
+
+func (c *Conn) NextReader() (messageType int, r io.Reader, err error) {
+	messageType, r, err = c.Conn.NextReader()
+	if err != nil {
+		return messageType, r, err
+	}
+	if !c.messages.Allow() {
+		c.reject()
+		return messageType, nil, ErrMessageRateLimited
+	}
+	return messageType, r, nil
+}
+
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	messageType, r, err := c.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	p, err = io.ReadAll(r)
+	return messageType, p, err
+}
+
+func (c *Conn) ReadJSON(v interface{}) error {
+	_, r, err := c.NextReader()
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(r).Decode(v)
+}
+
+// reject tells the client why it is being disconnected and closes the
+// connection.
+func (c *Conn) reject() {
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "rate limit exceeded")
+	c.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(closeTimeout))
+	c.Conn.Close()
+}
@@ -0,0 +1,96 @@
+package wslimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gorilla/websocket"
+)
+
+// newServer serves WebSocket connections limited by limiter, reporting
+// each connection's read error on errs.
+func newServer(t *testing.T, limiter core.WebSocketLimiter, errs chan<- error) string {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(limiter, &upgrader, w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestMessageLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages int
+		wantErr  error
+	}{
+		{name: "within the limit", messages: 2},
+		{name: "past the limit", messages: 3, wantErr: ErrMessageRateLimited},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := core.NewWebSocketLimiter()
+			limiter.SetConfig(core.WebSocketLimiterConfig{
+				RATE_LIMIT:              10,
+				REFILL_INTERVAL:         time.Hour,
+				MESSAGE_RATE_LIMIT:      2,
+				MESSAGE_REFILL_INTERVAL: time.Hour,
+			})
+			errs := make(chan error, 1)
+			client, _, err := websocket.DefaultDialer.Dial(newServer(t, limiter, errs), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < test.messages; i++ {
+				client.WriteMessage(websocket.TextMessage, []byte("hello"))
+			}
+
+			if test.wantErr == nil {
+				client.Close()
+				<-errs
+				return
+			}
+			if err := <-errs; err != test.wantErr {
+				t.Fatalf("server read error %v, want %v", err, test.wantErr)
+			}
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			if _, _, err := client.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Fatalf("client read error %v, want a policy violation close", err)
+			}
+			client.Close()
+		})
+	}
+}
+
+func TestUpgradeLimit(t *testing.T) {
+	limiter := core.NewWebSocketLimiter()
+	limiter.SetConfig(core.WebSocketLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, MESSAGE_RATE_LIMIT: 1, MESSAGE_REFILL_INTERVAL: time.Hour})
+	url := newServer(t, limiter, make(chan error, 2))
+
+	first, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	_, response, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || response == nil || response.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("second upgrade: error %v, want a 429 response", err)
+	}
+}
@@ -0,0 +1,259 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+type WebhookConfig struct {
+	// Where alerts are POSTed, e.g. a Slack or PagerDuty webhook.
+	URL string
+	// Names the limiter in alerts. Defaults to "default".
+	NAME string
+	// Length of the windows rejection rates are measured over. Defaults to
+	// one minute.
+	WINDOW time.Duration
+	// Rejections per second over a window from which it counts as a spike.
+	THRESHOLD float64
+	// Rejections per second of a single key from which its window counts
+	// as a spike. Zero only watches the limiter as a whole. Keys are
+	// counted from the limiter's events, which are dropped rather than
+	// delay requests, so a key may be undercounted under heavy load.
+	KEY_THRESHOLD float64
+	// Spiking windows in a row before an alert is sent. Defaults to three.
+	WINDOWS int
+	// Shortest time between two alerts for the limiter, or for one key.
+	// A spike is only alerted on once however long it lasts; one starting
+	// within COOLDOWN of the last alert waits for it to pass. Defaults to
+	// fifteen minutes.
+	COOLDOWN time.Duration
+	// Most keys counted per window, so a flood of distinct keys can't
+	// exhaust memory. Defaults to 10000.
+	MAX_KEYS int
+	// Sends keys as they are instead of hashed by core.HashKey.
+	RAW_KEYS bool
+	// Added to every request, e.g. an Authorization header.
+	HEADERS map[string]string
+	// Defaults to a client with a ten second timeout.
+	CLIENT *http.Client
+	// Called when an alert can't be sent.
+	ON_ERROR func(err error)
+}
+
+// Payload is the JSON body of an alert.
+type Payload struct {
+	Limiter string `json:"limiter"`
+	// Hashed unless RAW_KEYS is set; empty for the limiter as a whole.
+	Key                 string    `json:"key,omitempty"`
+	RejectionsPerSecond float64   `json:"rejections_per_second"`
+	Threshold           float64   `json:"threshold"`
+	Windows             int       `json:"windows"`
+	Since               time.Time `json:"since"`
+	Time                time.Time `json:"time"`
+}
+
+// Webhook POSTs an alert when a limiter, or a single key, keeps rejecting
+// more than its threshold for WINDOWS windows in a row, so abuse pages
+// someone instead of only showing up as 429s.
+type Webhook struct {
+	WebhookConfig
+	limiter      core.RateLimiter
+	subscription *core.Subscription
+	// Rejections per key in the current window.
+	keys map[string]int64
+	// The limiter's DeniedTotal when the window started.
+	denied int64
+	// Streaks by key, "" for the limiter.
+	streaks map[string]*streak
+	mx      sync.Mutex
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// streak tracks the spiking windows in a row of the limiter or a key.
+type streak struct {
+	windows   int
+	since     time.Time
+	alerted   bool
+	lastAlert time.Time
+}
+
+// NewWebhook starts watching the limiter's rejections until closed.
+func NewWebhook(limiter core.RateLimiter, config WebhookConfig) *Webhook {
+	if config.NAME == "" {
+		config.NAME = "default"
+	}
+	if config.WINDOW == 0 {
+		config.WINDOW = time.Minute
+	}
+	if config.WINDOWS == 0 {
+		config.WINDOWS = 3
+	}
+	if config.COOLDOWN == 0 {
+		config.COOLDOWN = 15 * time.Minute
+	}
+	if config.MAX_KEYS == 0 {
+		config.MAX_KEYS = 10000
+	}
+	if config.CLIENT == nil {
+		config.CLIENT = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	w := &Webhook{
+		WebhookConfig: config,
+		limiter:       limiter,
+		keys:          map[string]int64{},
+		denied:        limiter.StatusEvent().DeniedTotal,
+		streaks:       map[string]*streak{},
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	if config.KEY_THRESHOLD > 0 {
+		w.subscription = limiter.Subscribe(core.SubscriberConfig{ON_DENY: w.countKey, BUFFER: 8192})
+	}
+	go w.run()
+	return w
+}
+
+// Close stops watching.
+func (w *Webhook) Close() {
+	close(w.done)
+	<-w.stopped
+	if w.subscription != nil {
+		w.subscription.Close()
+	}
+}
+
+func (w *Webhook) countKey(e core.Event) {
+	if e.Key == "" {
+		return
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if _, ok := w.keys[e.Key]; ok || len(w.keys) < w.MAX_KEYS {
+		w.keys[e.Key]++
+	}
+}
+
+func (w *Webhook) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.WINDOW)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			for _, payload := range w.check(now) {
+				if err := w.send(payload); err != nil && w.ON_ERROR != nil {
+					w.ON_ERROR(err)
+				}
+			}
+		}
+	}
+}
+
+// check closes the window ending at now and returns the alerts due.
+func (w *Webhook) check(now time.Time) []Payload {
+	denied := w.limiter.StatusEvent().DeniedTotal
+
+	w.mx.Lock()
+	rates := map[string]float64{"": float64(denied-w.denied) / w.WINDOW.Seconds()}
+	w.denied = denied
+	for key, count := range w.keys {
+		rates[key] = float64(count) / w.WINDOW.Seconds()
+	}
+	w.keys = map[string]int64{}
+	w.mx.Unlock()
+
+	var alerts []Payload
+	for subject, rate := range rates {
+		threshold := w.THRESHOLD
+		if subject != "" {
+			threshold = w.KEY_THRESHOLD
+		}
+		if threshold <= 0 || rate <= threshold {
+			delete(rates, subject)
+		}
+	}
+	// Streaks of subjects that calmed down end, and are forgotten once an
+	// alert for them can be sent again.
+	for subject, s := range w.streaks {
+		if _, ok := rates[subject]; ok {
+			continue
+		}
+		s.windows = 0
+		s.alerted = false
+		if now.Sub(s.lastAlert) >= w.COOLDOWN {
+			delete(w.streaks, subject)
+		}
+	}
+	for subject, rate := range rates {
+		threshold := w.THRESHOLD
+		if subject != "" {
+			threshold = w.KEY_THRESHOLD
+		}
+		s, ok := w.streaks[subject]
+		if !ok {
+			s = &streak{}
+			w.streaks[subject] = s
+		}
+		if s.windows == 0 {
+			s.since = now.Add(-w.WINDOW)
+		}
+		s.windows++
+		if s.windows < w.WINDOWS || s.alerted || now.Sub(s.lastAlert) < w.COOLDOWN {
+			continue
+		}
+		s.alerted = true
+		s.lastAlert = now
+
+		key := subject
+		if key != "" && !w.RAW_KEYS {
+			key = core.HashKey(key)
+		}
+		alerts = append(alerts, Payload{
+			Limiter:             w.NAME,
+			Key:                 key,
+			RejectionsPerSecond: rate,
+			Threshold:           threshold,
+			Windows:             s.windows,
+			Since:               s.since,
+			Time:                now,
+		})
+	}
+	return alerts
+}
+
+func (w *Webhook) send(payload Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range w.HEADERS {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := w.CLIENT.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert: webhook answered %s", resp.Status)
+	}
+	return nil
+}
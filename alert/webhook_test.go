@@ -0,0 +1,114 @@
+package alert
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func newLimiter() core.RateLimiter {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	return limiter
+}
+
+func deny(limiter core.RateLimiter, client string, n int) {
+	for i := 0; i < n; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		limiter.Decide(r)
+	}
+}
+
+func TestWebhookCheck(t *testing.T) {
+	limiter := newLimiter()
+	// The first request of each client is allowed.
+	deny(limiter, "a", 1)
+	deny(limiter, "b", 1)
+	// Windows are an hour, so 360 rejections in one are 0.1 a second.
+	w := NewWebhook(limiter, WebhookConfig{
+		WINDOW:        time.Hour,
+		THRESHOLD:     0.2,
+		KEY_THRESHOLD: 0.1,
+		WINDOWS:       2,
+		COOLDOWN:      5 * time.Hour,
+		RAW_KEYS:      true,
+	})
+	defer w.Close()
+
+	steps := []struct {
+		name   string
+		a, b   int
+		alerts []string
+	}{
+		{name: "first spiking window", a: 1000, b: 100},
+		{name: "second spiking window", a: 1000, b: 100, alerts: []string{"", "a"}},
+		{name: "spike goes on", a: 1000, b: 100},
+		{name: "quiet", a: 0, b: 0},
+		{name: "new spike", a: 1000, b: 0},
+		{name: "new spike within the cooldown", a: 1000, b: 0},
+		{name: "new spike past the cooldown", a: 1000, b: 0, alerts: []string{"", "a"}},
+	}
+	start := time.Now()
+	for i, step := range steps {
+		deny(limiter, "a", step.a)
+		deny(limiter, "b", step.b)
+		// Let the subscription catch up.
+		time.Sleep(20 * time.Millisecond)
+
+		var got []string
+		for _, payload := range w.check(start.Add(time.Duration(i+1) * time.Hour)) {
+			got = append(got, payload.Key)
+		}
+		sort.Strings(got)
+		if len(got) != len(step.alerts) || (len(got) > 0 && (got[0] != step.alerts[0] || got[1] != step.alerts[1])) {
+			t.Fatalf("%s: alerts for %q, want %q", step.name, got, step.alerts)
+		}
+	}
+}
+
+func TestWebhookSends(t *testing.T) {
+	received := make(chan Payload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("Authorization header %q", r.Header.Get("Authorization"))
+		}
+		var payload Payload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Error(err)
+		}
+		received <- payload
+	}))
+	defer server.Close()
+
+	limiter := newLimiter()
+	w := NewWebhook(limiter, WebhookConfig{
+		URL:           server.URL,
+		NAME:          "api",
+		WINDOW:        20 * time.Millisecond,
+		KEY_THRESHOLD: 1,
+		WINDOWS:       1,
+		HEADERS:       map[string]string{"Authorization": "Bearer secret"},
+		ON_ERROR:      func(err error) { t.Error(err) },
+	})
+	defer w.Close()
+	deny(limiter, "a", 100)
+
+	select {
+	case payload := <-received:
+		if payload.Limiter != "api" || payload.Key != core.HashKey("a") || payload.Windows != 1 {
+			t.Fatalf("got %+v, want an alert for the hashed key of the api limiter", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no alert sent")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// limiterInfo is what the admin API shows of a limiter.
+type limiterInfo struct {
+	Name           string            `json:"name"`
+	RateLimit      int64             `json:"rate_limit"`
+	RefillInterval string            `json:"refill_interval"`
+	Status         core.BucketStatus `json:"status"`
+}
+
+// adminResult is the answer of the admin API to changes and errors.
+type adminResult struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// client calls the admin API.
+type client struct {
+	url   string
+	token string
+	http  *http.Client
+}
+
+func newClient(baseURL, token string, timeout time.Duration) *client {
+	return &client{url: strings.TrimSuffix(baseURL, "/"), token: token, http: &http.Client{Timeout: timeout}}
+}
+
+// get decodes the answer to a GET of path into v.
+func (c *client) get(path string, v interface{}) error {
+	response, err := c.send(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// do sends a change and prints the API's message.
+func (c *client) do(method, path string, body interface{}, stdout io.Writer) error {
+	response, err := c.send(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var result adminResult
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, result.Message)
+	return nil
+}
+
+// send makes a request, failing with the API's message if it refuses it.
+func (c *client) send(method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, c.url+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		var result adminResult
+		if json.NewDecoder(response.Body).Decode(&result) != nil || result.Message == "" {
+			result.Message = http.StatusText(response.StatusCode)
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, result.Message)
+	}
+	return response, nil
+}
+
+// limiterName returns name, or the name of the only limiter if it is
+// empty.
+func (c *client) limiterName(name string) (string, error) {
+	if name != "" {
+		return url.PathEscape(name), nil
+	}
+	var limiters []limiterInfo
+	if err := c.get("/limiters", &limiters); err != nil {
+		return "", err
+	}
+	if len(limiters) != 1 {
+		names := make([]string, len(limiters))
+		for i, limiter := range limiters {
+			names[i] = limiter.Name
+		}
+		return "", fmt.Errorf("pick a limiter with -limiter, one of %s", strings.Join(names, ", "))
+	}
+	return url.PathEscape(limiters[0].Name), nil
+}
@@ -0,0 +1,224 @@
+// Command ratelimit-cli manages the limiters of a running service through
+// the admin API of stdhttp.NewAdmin, for acting fast during incidents:
+//
+//	ratelimit-cli limiters
+//	ratelimit-cli keys top
+//	ratelimit-cli reset <key>
+//	ratelimit-cli set-limit <limiter> 200/s
+//	ratelimit-cli brake 30m
+//	ratelimit-cli release
+//
+// The API is found at -url, or $RATELIMIT_ADMIN_URL, and sent -token, or
+// $RATELIMIT_ADMIN_TOKEN, as a bearer token. Commands about keys act on the
+// limiter named by -limiter, which may be left out if the service has
+// only one.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+const usage = `usage: ratelimit-cli [flags] <command>
+
+commands:
+  limiters                     list the limiters and their limits
+  keys top [-n 10]             the keys with the fewest tokens left
+  reset <key>                  reset a key's buckets
+  set-limit <limiter> <rate>   set a limit, e.g. 200/s, 1000/m or 50/10s
+  brake [duration]             engage every limiter's emergency brake
+  release                      release every emergency brake
+
+flags:
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "ratelimit-cli:", err)
+		os.Exit(1)
+	}
+}
+
+// run runs the command in args, writing its output to stdout.
+func run(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("ratelimit-cli", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+	adminURL := flags.String("url", envOr("RATELIMIT_ADMIN_URL", "http://localhost:8080/admin/ratelimit"), "URL the admin API is served under")
+	token := flags.String("token", os.Getenv("RATELIMIT_ADMIN_TOKEN"), "bearer token for the admin API")
+	limiter := flags.String("limiter", "", "limiter the key commands act on")
+	timeout := flags.Duration("timeout", 10*time.Second, "how long to wait for the admin API")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return fmt.Errorf("no command")
+	}
+
+	c := newClient(*adminURL, *token, *timeout)
+	switch args[0] {
+	case "limiters":
+		return listLimiters(c, stdout)
+	case "keys":
+		if len(args) < 2 || args[1] != "top" {
+			return fmt.Errorf("usage: ratelimit-cli keys top [-n 10]")
+		}
+		return topKeys(c, *limiter, args[2:], stdout, stderr)
+	case "reset":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: ratelimit-cli reset <key>")
+		}
+		name, err := c.limiterName(*limiter)
+		if err != nil {
+			return err
+		}
+		return c.do("DELETE", "/limiters/"+name+"/keys/"+url.PathEscape(args[1]), nil, stdout)
+	case "set-limit":
+		if len(args) != 3 {
+			return fmt.Errorf("usage: ratelimit-cli set-limit <limiter> <rate>")
+		}
+		limit, interval, err := parseRate(args[2])
+		if err != nil {
+			return err
+		}
+		return c.do("PUT", "/limiters/"+url.PathEscape(args[1])+"/limit", map[string]interface{}{
+			"rate_limit":      limit,
+			"refill_interval": interval.String(),
+		}, stdout)
+	case "brake":
+		if len(args) > 2 {
+			return fmt.Errorf("usage: ratelimit-cli brake [duration]")
+		}
+		path := "/brake"
+		if len(args) == 2 {
+			path += "?for=" + url.QueryEscape(args[1])
+		}
+		return c.do("PUT", path, nil, stdout)
+	case "release":
+		return c.do("DELETE", "/brake", nil, stdout)
+	}
+	flags.Usage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+func listLimiters(c *client, stdout io.Writer) error {
+	var limiters []limiterInfo
+	if err := c.get("/limiters", &limiters); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tRATE\tTOKENS\tKEYS")
+	for _, limiter := range limiters {
+		interval, _ := time.ParseDuration(limiter.RefillInterval)
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d\n", limiter.Name, formatRate(limiter.RateLimit, interval),
+			limiter.Status.CurrentBucketSize, limiter.Status.BucketLimit, limiter.Status.TrackedKeys)
+	}
+	return w.Flush()
+}
+
+// topKeys lists the keys closest to their limit, locked keys first.
+func topKeys(c *client, limiter string, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("keys top", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	n := flags.Int("n", 10, "how many keys to list")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	name, err := c.limiterName(limiter)
+	if err != nil {
+		return err
+	}
+	var keys []core.KeyStatus
+	if err := c.get("/limiters/"+name+"/keys", &keys); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sort.SliceStable(keys, func(i, j int) bool {
+		iLocked, jLocked := keys[i].LockedUntil.After(now), keys[j].LockedUntil.After(now)
+		if iLocked != jLocked {
+			return iLocked
+		}
+		return keys[i].Tokens < keys[j].Tokens
+	})
+	if len(keys) > *n {
+		keys = keys[:*n]
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tSET\tTOKENS\tLAST SEEN\tLOCKED")
+	for _, key := range keys {
+		locked := "-"
+		if key.LockedUntil.After(now) {
+			locked = "for " + key.LockedUntil.Sub(now).Round(time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.1f/%d\t%s ago\t%s\n", key.Key, key.Set, key.Tokens, key.Limit,
+			now.Sub(key.LastSeen).Round(time.Second), locked)
+	}
+	return w.Flush()
+}
+
+// rateUnits are the units a rate may be given per.
+var rateUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+}
+
+// parseRate parses a rate such as "200/s" or "50/10s" into a limit and
+// the interval one token takes to refill, so the bucket holds a period's
+// worth of tokens.
+func parseRate(rate string) (limit int64, interval time.Duration, err error) {
+	count, per, ok := strings.Cut(rate, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("rate %q: want <count>/<period>, e.g. 200/s", rate)
+	}
+	limit, err = strconv.ParseInt(count, 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, 0, fmt.Errorf("rate %q: count must be a positive integer", rate)
+	}
+	period, ok := rateUnits[per]
+	if !ok {
+		if period, err = time.ParseDuration(per); err != nil || period <= 0 {
+			return 0, 0, fmt.Errorf("rate %q: period must be s, m, h or a positive duration", rate)
+		}
+	}
+	interval = period / time.Duration(limit)
+	if interval <= 0 {
+		return 0, 0, fmt.Errorf("rate %q is too high", rate)
+	}
+	return limit, interval, nil
+}
+
+// formatRate shows a limit the way parseRate reads it.
+func formatRate(limit int64, interval time.Duration) string {
+	period := interval * time.Duration(limit)
+	for _, unit := range []string{"s", "m", "h"} {
+		if period == rateUnits[unit] {
+			return fmt.Sprintf("%d/%s", limit, unit)
+		}
+	}
+	return fmt.Sprintf("%d/%s", limit, period)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
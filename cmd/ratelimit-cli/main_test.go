@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate         string
+		wantLimit    int64
+		wantInterval time.Duration
+		wantErr      bool
+	}{
+		{rate: "200/s", wantLimit: 200, wantInterval: 5 * time.Millisecond},
+		{rate: "60/m", wantLimit: 60, wantInterval: time.Second},
+		{rate: "50/10s", wantLimit: 50, wantInterval: 200 * time.Millisecond},
+		{rate: "200", wantErr: true},
+		{rate: "0/s", wantErr: true},
+		{rate: "5/day", wantErr: true},
+		{rate: "2000000000/s", wantErr: true},
+	}
+	for _, test := range tests {
+		limit, interval, err := parseRate(test.rate)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseRate(%q) error %v, want error %v", test.rate, err, test.wantErr)
+			continue
+		}
+		if limit != test.wantLimit || interval != test.wantInterval {
+			t.Errorf("parseRate(%q) = %d, %v, want %d, %v", test.rate, limit, interval, test.wantLimit, test.wantInterval)
+		}
+		if err == nil && formatRate(limit, interval) != test.rate {
+			t.Errorf("formatRate(%d, %v) = %q, want %q", limit, interval, formatRate(limit, interval), test.rate)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	api := core.New()
+	api.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      3,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	decide := func(client string) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		api.Decide(r)
+	}
+	decide("alice")
+	decide("bob")
+	decide("bob")
+	login := core.New()
+	login.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 5, REFILL_INTERVAL: time.Second})
+
+	server := httptest.NewServer(stdhttp.NewAdmin(stdhttp.AdminConfig{
+		LIMITERS: map[string]core.RateLimiter{"api": api, "login": login},
+		AUTH:     stdhttp.BearerAuth("t0ken"),
+	}))
+	defer server.Close()
+	base := []string{"-url", server.URL + "/admin/ratelimit/", "-token", "t0ken"}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+		wantErr string
+		check   func() bool
+	}{
+		{
+			name:    "unauthorized",
+			args:    []string{"-url", server.URL + "/admin/ratelimit", "limiters"},
+			wantErr: "unauthorized",
+		},
+		{
+			name: "limiters",
+			args: append(base, "limiters"),
+			want: []string{"api", "3/3h0m0s", "login", "5/5s"},
+		},
+		{
+			name:    "limiter needed",
+			args:    append(base, "keys", "top"),
+			wantErr: "one of api, login",
+		},
+		{
+			name:    "keys top",
+			args:    append(base, "-limiter", "api", "keys", "top", "-n", "1"),
+			want:    []string{"bob", "1.0/3"},
+			notWant: []string{"alice"},
+		},
+		{
+			name:  "reset",
+			args:  append(base, "-limiter", "api", "reset", "bob"),
+			want:  []string{"Bucket reset"},
+			check: func() bool { return len(api.InspectKey("bob")) == 0 },
+		},
+		{
+			name: "set limit",
+			args: append(base, "set-limit", "login", "200/s"),
+			want: []string{"Limit updated"},
+			check: func() bool {
+				config := login.Config()
+				return config.RATE_LIMIT == 200 && config.REFILL_INTERVAL == 5*time.Millisecond
+			},
+		},
+		{
+			name:    "unknown limiter",
+			args:    append(base, "set-limit", "web", "200/s"),
+			wantErr: "no such limiter",
+		},
+		{
+			name:  "brake",
+			args:  append(base, "brake", "30m"),
+			want:  []string{"Brakes engaged"},
+			check: func() bool { return api.BrakeStatus().Engaged && login.BrakeStatus().Engaged },
+		},
+		{
+			name:  "release",
+			args:  append(base, "release"),
+			want:  []string{"Brakes released"},
+			check: func() bool { return !api.BrakeStatus().Engaged && !login.BrakeStatus().Engaged },
+		},
+		{
+			name:    "bad brake duration",
+			args:    append(base, "brake", "soon"),
+			wantErr: "positive duration",
+		},
+		{
+			name:    "unknown command",
+			args:    append(base, "ban"),
+			wantErr: `unknown command "ban"`,
+		},
+	}
+	for _, test := range tests {
+		var stdout bytes.Buffer
+		err := run(test.args, &stdout, io.Discard)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: error %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(stdout.String(), want) {
+				t.Errorf("%s: output %q lacks %q", test.name, stdout.String(), want)
+			}
+		}
+		for _, notWant := range test.notWant {
+			if strings.Contains(stdout.String(), notWant) {
+				t.Errorf("%s: output %q has %q", test.name, stdout.String(), notWant)
+			}
+		}
+		if test.check != nil && !test.check() {
+			t.Errorf("%s: limiter unchanged", test.name)
+		}
+	}
+}
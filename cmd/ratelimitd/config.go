@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// Config is the ratelimitd config file.
+type Config struct {
+	// Address to listen on, e.g. ":8080". Changing it takes a restart.
+	Listen string `json:"listen"`
+	// Address the status, metrics and reload endpoints are served on, e.g.
+	// "127.0.0.1:9091", apart from the proxied traffic. Changing it takes
+	// a restart.
+	AdminListen string `json:"admin_listen"`
+	// Bearer token the admin endpoints require. With it set, they are
+	// served on Listen as well; without it or AdminListen they are not
+	// served at all.
+	AdminToken string `json:"admin_token"`
+	// URL of the service requests are proxied to.
+	Upstream string `json:"upstream"`
+	// Proxies whose X-Forwarded-For is trusted, as CIDRs.
+	TrustedProxies []string `json:"trusted_proxies"`
+	// Path prefix of the status, metrics and reload endpoints.
+	AdminPrefix string `json:"admin_prefix"`
+	// Rules are matched by longest path prefix; requests matching none
+	// are proxied unlimited.
+	Rules []Rule `json:"rules"`
+	// File contents the config was parsed from.
+	data []byte
+}
+
+// Rule limits the requests under a path prefix.
+type Rule struct {
+	Name           string   `json:"name"`
+	Path           string   `json:"path"`
+	RateLimit      int64    `json:"rate_limit"`
+	RefillInterval Duration `json:"refill_interval"`
+	// "ip" (the default), "header:<name>" or "global" for one bucket
+	// shared by every client.
+	Key       string   `json:"key"`
+	KeyByPath bool     `json:"key_by_path"`
+	MaxWait   Duration `json:"max_wait"`
+}
+
+// Duration is a time.Duration written as a string such as "1s" in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// parseConfig parses and validates the config read from path.
+func parseConfig(path string, data []byte) (*Config, error) {
+	config := &Config{Listen: ":8080", AdminPrefix: "/_ratelimit"}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	config.data = data
+	if config.Upstream == "" {
+		return nil, fmt.Errorf("%s: upstream is required", path)
+	}
+	names := map[string]bool{}
+	for i, rule := range config.Rules {
+		if rule.RateLimit <= 0 || rule.RefillInterval <= 0 {
+			return nil, fmt.Errorf("%s: rule %d needs a positive rate_limit and refill_interval", path, i)
+		}
+		if rule.Name == "" {
+			config.Rules[i].Name = rule.Path
+		}
+		// Status and metrics are reported by name.
+		if names[config.Rules[i].Name] {
+			return nil, fmt.Errorf("%s: rule %d: duplicate name %q", path, i, config.Rules[i].Name)
+		}
+		names[config.Rules[i].Name] = true
+	}
+	return config, nil
+}
+
+// newLimiter builds the limiter for a rule, running until ctx is done.
+func (r Rule) newLimiter(ctx context.Context, trustedProxies []string) (core.RateLimiter, error) {
+	limiter := core.New()
+	config := core.RateLimiterConfig{
+		RATE_LIMIT:      r.RateLimit,
+		REFILL_INTERVAL: time.Duration(r.RefillInterval),
+		KEY_BY_PATH:     r.KeyByPath,
+		MAX_WAIT:        time.Duration(r.MaxWait),
+		TRUSTED_PROXIES: trustedProxies,
+	}
+
+	switch {
+	case r.Key == "" || r.Key == "ip":
+		config.KEY_FUNC = func(r *http.Request) string { return "ip:" + limiter.ClientIP(r) }
+	case r.Key == "global":
+		config.KEY_FUNC = func(r *http.Request) string { return "global" }
+	case strings.HasPrefix(r.Key, "header:"):
+		name := strings.TrimPrefix(r.Key, "header:")
+		config.KEY_FUNC = func(r *http.Request) string {
+			if value := r.Header.Get(name); value != "" {
+				return name + ":" + value
+			}
+			return "ip:" + limiter.ClientIP(r)
+		}
+	default:
+		return nil, fmt.Errorf("rule %s: unknown key %q", r.Name, r.Key)
+	}
+
+	limiter.SetConfig(config)
+	limiter.RunContext(ctx)
+	return limiter, nil
+}
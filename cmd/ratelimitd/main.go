@@ -0,0 +1,57 @@
+// Command ratelimitd is a rate limiting reverse proxy. It fronts an upstream
+// service with the rules from a JSON config file, serves status and metrics
+// endpoints on a separate admin listener or behind a bearer token, and
+// reloads the config on SIGHUP or a POST to the admin prefix's /reload,
+// keeping the previous config if the new one is invalid:
+//
+//	ratelimitd -config ratelimitd.json
+//
+// With -watch it also reloads whenever the config file changes, e.g. a
+// mounted Kubernetes ConfigMap, and with -last-good it keeps a copy of the
+// config applied last to start from if the file is broken at startup.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	configPath := flag.String("config", "ratelimitd.json", "path to the config file")
+	watch := flag.Bool("watch", false, "reload the config when its file changes")
+	lastGood := flag.String("last-good", "", "path to keep a copy of the config applied last at")
+	flag.Parse()
+
+	s := &server{path: *configPath, lastGood: *lastGood}
+	if err := s.start(); err != nil {
+		log.Fatal(err)
+	}
+	config := s.ruleSet().config
+	if *watch {
+		if err := s.watch(context.Background()); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			s.Reload()
+		}
+	}()
+
+	if config.AdminListen != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(config.AdminListen, adminHandler{s}))
+		}()
+		log.Println("admin endpoints on", config.AdminListen)
+	}
+	log.Println("ratelimitd listening on", config.Listen, "proxying to", config.Upstream)
+	log.Fatal(http.ListenAndServe(config.Listen, s))
+}
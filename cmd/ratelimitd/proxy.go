@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// ruleSet is a loaded config: the proxy and a limiter per rule, each
+// running until its context is cancelled.
+type ruleSet struct {
+	config   *Config
+	proxy    *httputil.ReverseProxy
+	rules    []Rule
+	limiters []core.RateLimiter
+	runs     []context.Context
+	stops    []context.CancelFunc
+}
+
+// server proxies requests through the current rule set, which reload
+// swaps out without dropping requests in flight.
+type server struct {
+	// Config file Reload reads.
+	path string
+	// File the last config applied is copied to, if set, to start from
+	// when path is broken.
+	lastGood string
+	current  *ruleSet
+	mx       sync.RWMutex
+	// Held by reload, so reloads from a signal and the admin endpoint
+	// don't build on the same previous set.
+	reloading sync.Mutex
+}
+
+// Reload reads the config file again and applies it, keeping the previous
+// config if the file can't be read, is invalid or any of its rules can't
+// be built.
+func (s *server) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		err = s.apply(s.path, data)
+	}
+	if err != nil {
+		log.Println("reload failed, keeping the previous config:", err)
+		return err
+	}
+	log.Println("config reloaded")
+	return nil
+}
+
+// start applies the config file, falling back to the last good copy if
+// the file can't be read, is invalid or any of its rules can't be built.
+func (s *server) start() error {
+	data, err := os.ReadFile(s.path)
+	if err == nil {
+		err = s.apply(s.path, data)
+	}
+	if err == nil || s.lastGood == "" {
+		return err
+	}
+	good, readErr := os.ReadFile(s.lastGood)
+	if readErr != nil {
+		return err
+	}
+	log.Printf("%v; starting from the last good config %s", err, s.lastGood)
+	return s.apply(s.lastGood, good)
+}
+
+// apply validates the config data read from path and applies it, copying
+// it to lastGood if set.
+func (s *server) apply(path string, data []byte) error {
+	config, err := parseConfig(path, data)
+	if err != nil {
+		return err
+	}
+	if err := s.reload(config); err != nil {
+		return err
+	}
+	if s.lastGood != "" && path != s.lastGood {
+		if err := os.WriteFile(s.lastGood, data, 0o600); err != nil {
+			log.Println("saving the last good config:", err)
+		}
+	}
+	return nil
+}
+
+// reload builds a rule set from config. Rules that did not change keep
+// their limiter, and with it their buckets; the limiters of the others are
+// stopped once the new set is in place. Listen addresses are only read at
+// startup, so changing them is logged and otherwise ignored.
+func (s *server) reload(config *Config) error {
+	upstream, err := url.Parse(config.Upstream)
+	if err != nil {
+		return fmt.Errorf("upstream: %w", err)
+	}
+
+	s.reloading.Lock()
+	defer s.reloading.Unlock()
+
+	s.mx.RLock()
+	previous := s.current
+	s.mx.RUnlock()
+
+	next := &ruleSet{config: config, proxy: httputil.NewSingleHostReverseProxy(upstream)}
+	for _, rule := range config.Rules {
+		i := previous.indexOf(rule, config.TrustedProxies)
+		if i >= 0 {
+			next.add(rule, previous.limiters[i], previous.runs[i], previous.stops[i])
+			continue
+		}
+
+		ctx, stop := context.WithCancel(context.Background())
+		limiter, err := rule.newLimiter(ctx, config.TrustedProxies)
+		if err != nil {
+			stop()
+			next.stopUnless(previous)
+			return err
+		}
+		next.add(rule, limiter, ctx, stop)
+	}
+
+	if previous != nil && (config.Listen != previous.config.Listen || config.AdminListen != previous.config.AdminListen) {
+		log.Printf("listen addresses changed to %q and %q; restart ratelimitd to apply them", config.Listen, config.AdminListen)
+		config.Listen, config.AdminListen = previous.config.Listen, previous.config.AdminListen
+	}
+
+	s.mx.Lock()
+	s.current = next
+	s.mx.Unlock()
+
+	if previous != nil {
+		previous.stopUnless(next)
+	}
+	return nil
+}
+
+func (rs *ruleSet) add(rule Rule, limiter core.RateLimiter, run context.Context, stop context.CancelFunc) {
+	rs.rules = append(rs.rules, rule)
+	rs.limiters = append(rs.limiters, limiter)
+	rs.runs = append(rs.runs, run)
+	rs.stops = append(rs.stops, stop)
+}
+
+// indexOf returns the index of an identical rule, or -1 if the set has
+// none.
+func (rs *ruleSet) indexOf(rule Rule, trustedProxies []string) int {
+	if rs == nil || !reflect.DeepEqual(rs.config.TrustedProxies, trustedProxies) {
+		return -1
+	}
+	for i, existing := range rs.rules {
+		if existing == rule {
+			return i
+		}
+	}
+	return -1
+}
+
+// stopUnless stops the limiters of rs that other doesn't share.
+func (rs *ruleSet) stopUnless(other *ruleSet) {
+	kept := map[core.RateLimiter]bool{}
+	if other != nil {
+		for _, limiter := range other.limiters {
+			kept[limiter] = true
+		}
+	}
+	for i, limiter := range rs.limiters {
+		if !kept[limiter] {
+			rs.stops[i]()
+		}
+	}
+}
+
+// match returns the limiter of the rule with the longest path prefix
+// matching path, or nil.
+func (rs *ruleSet) match(path string) core.RateLimiter {
+	best := -1
+	for i, rule := range rs.rules {
+		if strings.HasPrefix(path, rule.Path) && (best < 0 || len(rule.Path) > len(rs.rules[best].Path)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	return rs.limiters[best]
+}
+
+func (s *server) ruleSet() *ruleSet {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return s.current
+}
+
+// ServeHTTP proxies requests, also serving the admin endpoints if an
+// AdminToken guards them.
+func (s *server) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	rs := s.ruleSet()
+	if rs.config.AdminToken != "" && s.serveAdmin(rs, w, request) {
+		return
+	}
+
+	if limiter := rs.match(request.URL.Path); limiter != nil && !stdhttp.Allow(limiter, w, request) {
+		return
+	}
+	rs.proxy.ServeHTTP(w, request)
+}
+
+// adminHandler serves the admin endpoints on AdminListen.
+type adminHandler struct {
+	*server
+}
+
+func (a adminHandler) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	if !a.serveAdmin(a.ruleSet(), w, request) {
+		http.NotFound(w, request)
+	}
+}
+
+// serveAdmin serves request if it is for the status, top keys, metrics or
+// reload endpoint, reporting whether it was. With an AdminToken set, the
+// request must carry it as a bearer token.
+func (s *server) serveAdmin(rs *ruleSet, w http.ResponseWriter, request *http.Request) bool {
+	var serve func(w http.ResponseWriter)
+	switch request.URL.Path {
+	case rs.config.AdminPrefix + "/status":
+		serve = rs.serveStatus
+	case rs.config.AdminPrefix + "/status/top":
+		serve = rs.serveTopKeys
+	case rs.config.AdminPrefix + "/metrics":
+		serve = rs.serveMetrics
+	case rs.config.AdminPrefix + "/reload":
+		serve = func(w http.ResponseWriter) {
+			if request.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if err := s.Reload(); err != nil {
+				http.Error(w, "reload failed, keeping the previous config: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintln(w, "config reloaded")
+		}
+	default:
+		return false
+	}
+
+	token := rs.config.AdminToken
+	if token != "" && subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return true
+	}
+	serve(w)
+	return true
+}
+
+// serveTopKeys writes the keys each rule denied most lately, hashed.
+func (rs *ruleSet) serveTopKeys(w http.ResponseWriter) {
+	top := map[string][]core.KeyCount{}
+	for i, rule := range rs.rules {
+		top[rule.Name] = rs.limiters[i].TopKeys(10)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(top)
+}
+
+// serveStatus writes each rule's status event as JSON, with the top keys
+// hashed.
+func (rs *ruleSet) serveStatus(w http.ResponseWriter) {
+	status := map[string]core.BucketStatusEvent{}
+	for i, rule := range rs.rules {
+		status[rule.Name] = rs.limiters[i].StatusEvent()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// serveMetrics writes the decision counters in the Prometheus text format.
+func (rs *ruleSet) serveMetrics(w http.ResponseWriter) {
+	names := make([]string, len(rs.rules))
+	events := map[string]core.BucketStatusEvent{}
+	for i, rule := range rs.rules {
+		names[i] = rule.Name
+		events[rule.Name] = rs.limiters[i].StatusEvent()
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# TYPE ratelimitd_requests_total counter")
+	for _, name := range names {
+		fmt.Fprintf(w, "ratelimitd_requests_total{rule=%q,decision=\"allowed\"} %d\n", name, events[name].AllowedTotal)
+		fmt.Fprintf(w, "ratelimitd_requests_total{rule=%q,decision=\"denied\"} %d\n", name, events[name].DeniedTotal)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ratelimitd.json")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			data: `{"upstream": "http://localhost:9000", "rules": [
+				{"name": "api", "path": "/api/", "rate_limit": 10, "refill_interval": "1s"},
+				{"path": "/login", "rate_limit": 1, "refill_interval": "1m"}]}`,
+		},
+		{
+			name:    "no upstream",
+			data:    `{"rules": []}`,
+			wantErr: "upstream is required",
+		},
+		{
+			name: "duplicate names",
+			data: `{"upstream": "http://localhost:9000", "rules": [
+				{"name": "api", "path": "/a/", "rate_limit": 10, "refill_interval": "1s"},
+				{"name": "api", "path": "/b/", "rate_limit": 10, "refill_interval": "1s"}]}`,
+			wantErr: `duplicate name "api"`,
+		},
+		{
+			name: "duplicate default names",
+			data: `{"upstream": "http://localhost:9000", "rules": [
+				{"path": "/a/", "rate_limit": 10, "refill_interval": "1s"},
+				{"path": "/a/", "rate_limit": 5, "refill_interval": "1s"}]}`,
+			wantErr: `duplicate name "/a/"`,
+		},
+		{
+			name: "zero rate",
+			data: `{"upstream": "http://localhost:9000", "rules": [
+				{"name": "api", "path": "/a/", "rate_limit": 0, "refill_interval": "1s"}]}`,
+			wantErr: "positive rate_limit",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := parseConfig("ratelimitd.json", []byte(test.data))
+			switch {
+			case test.wantErr == "" && err != nil:
+				t.Fatalf("parseConfig: %v", err)
+			case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+				t.Fatalf("parseConfig error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func testConfig(listen string, rules ...Rule) *Config {
+	return &Config{Listen: listen, Upstream: "http://localhost:9000", AdminPrefix: "/_ratelimit", Rules: rules}
+}
+
+func TestReload(t *testing.T) {
+	api := Rule{Name: "api", Path: "/api/", RateLimit: 10, RefillInterval: Duration(time.Second)}
+	login := Rule{Name: "login", Path: "/login", RateLimit: 1, RefillInterval: Duration(time.Minute)}
+
+	s := &server{}
+	if err := s.reload(testConfig(":8080", api, login)); err != nil {
+		t.Fatal(err)
+	}
+	first := s.ruleSet()
+
+	changed := login
+	changed.RateLimit = 2
+	if err := s.reload(testConfig(":9090", api, changed)); err != nil {
+		t.Fatal(err)
+	}
+	second := s.ruleSet()
+
+	tests := []struct {
+		name  string
+		check bool
+	}{
+		{name: "unchanged rule keeps its limiter", check: second.limiters[0] == first.limiters[0]},
+		{name: "unchanged rule keeps running", check: second.runs[0].Err() == nil},
+		{name: "changed rule gets a new limiter", check: second.limiters[1] != first.limiters[1]},
+		{name: "replaced limiter is stopped", check: first.runs[1].Err() != nil},
+		{name: "new limiter runs", check: second.runs[1].Err() == nil},
+		{name: "listen change is not applied", check: second.config.Listen == ":8080"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !test.check {
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestReloadFailureKeepsLimiters(t *testing.T) {
+	api := Rule{Name: "api", Path: "/api/", RateLimit: 10, RefillInterval: Duration(time.Second)}
+	s := &server{}
+	if err := s.reload(testConfig(":8080", api)); err != nil {
+		t.Fatal(err)
+	}
+	first := s.ruleSet()
+
+	fresh := Rule{Name: "fresh", Path: "/fresh/", RateLimit: 1, RefillInterval: Duration(time.Second)}
+	broken := Rule{Name: "broken", Path: "/b/", RateLimit: 1, RefillInterval: Duration(time.Second), Key: "cookie"}
+	if err := s.reload(testConfig(":8080", api, fresh, broken)); err == nil {
+		t.Fatal("reload with an unknown key succeeded")
+	}
+
+	if s.ruleSet() != first || first.runs[0].Err() != nil {
+		t.Fatal("failed reload replaced or stopped the running rules")
+	}
+}
+
+func TestReloadEndpoint(t *testing.T) {
+	const valid = `{"upstream": "http://127.0.0.1:1", "rules": [
+		{"name": "api", "path": "/api/", "rate_limit": 10, "refill_interval": "1s"}]}`
+	const grown = `{"upstream": "http://127.0.0.1:1", "rules": [
+		{"name": "api", "path": "/api/", "rate_limit": 10, "refill_interval": "1s"},
+		{"name": "login", "path": "/login", "rate_limit": 1, "refill_interval": "1m"}]}`
+
+	tests := []struct {
+		name      string
+		method    string
+		data      string
+		want      int
+		wantRules int
+	}{
+		{name: "applies the file", method: http.MethodPost, data: grown, want: http.StatusOK, wantRules: 2},
+		{name: "keeps the previous config", method: http.MethodPost, data: `{"rules": []}`, want: http.StatusInternalServerError, wantRules: 1},
+		{name: "only on POST", method: http.MethodGet, data: grown, want: http.StatusMethodNotAllowed, wantRules: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := writeConfig(t, valid)
+			s := &server{path: path}
+			if err := s.Reload(); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte(test.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			adminHandler{s}.ServeHTTP(w, httptest.NewRequest(test.method, "/_ratelimit/reload", nil))
+			if w.Code != test.want || len(s.ruleSet().rules) != test.wantRules {
+				t.Fatalf("status %d with %d rules, want %d with %d", w.Code, len(s.ruleSet().rules), test.want, test.wantRules)
+			}
+		})
+	}
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	api := Rule{Name: "api", Path: "/api/", RateLimit: 10, RefillInterval: Duration(time.Second)}
+
+	tests := []struct {
+		name          string
+		token         string
+		handler       func(s *server) http.Handler
+		authorization string
+		want          int
+	}{
+		{name: "admin listener", handler: func(s *server) http.Handler { return adminHandler{s} }, want: http.StatusOK},
+		{name: "admin listener with token", token: "t0ken", handler: func(s *server) http.Handler { return adminHandler{s} }, want: http.StatusUnauthorized},
+		{name: "public listener without token", handler: func(s *server) http.Handler { return s }, want: http.StatusBadGateway},
+		{name: "public listener, no credentials", token: "t0ken", handler: func(s *server) http.Handler { return s }, want: http.StatusUnauthorized},
+		{name: "public listener, wrong token", token: "t0ken", handler: func(s *server) http.Handler { return s }, authorization: "Bearer nope", want: http.StatusUnauthorized},
+		{name: "public listener, token", token: "t0ken", handler: func(s *server) http.Handler { return s }, authorization: "Bearer t0ken", want: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig(":8080", api)
+			// Nothing listens there, so proxied requests fail with 502.
+			config.Upstream = "http://127.0.0.1:1"
+			config.AdminToken = test.token
+			s := &server{}
+			if err := s.reload(config); err != nil {
+				t.Fatal(err)
+			}
+
+			request := httptest.NewRequest(http.MethodGet, "/_ratelimit/status", nil)
+			if test.authorization != "" {
+				request.Header.Set("Authorization", test.authorization)
+			}
+			w := httptest.NewRecorder()
+			test.handler(s).ServeHTTP(w, request)
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestStatusHashesKeys(t *testing.T) {
+	config := testConfig(":8080", Rule{Name: "api", Path: "/api/", RateLimit: 1, RefillInterval: Duration(time.Hour)})
+	config.Upstream = "http://127.0.0.1:1"
+	s := &server{}
+	if err := s.reload(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		request.RemoteAddr = "203.0.113.7:1234"
+		s.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	for _, path := range []string{"/_ratelimit/status", "/_ratelimit/status/top"} {
+		w := httptest.NewRecorder()
+		adminHandler{s}.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		body := w.Body.String()
+		if strings.Contains(body, "203.0.113.7") || !strings.Contains(body, core.HashKey("ip:203.0.113.7")) {
+			t.Fatalf("%s doesn't hash the denied key: %s", path, body)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long the config file must be left alone before it is
+// reloaded, so a change written in several steps is read once, complete.
+const watchSettle = 100 * time.Millisecond
+
+// watch reloads the config whenever its file changes, until ctx is done.
+// The file's directory is watched rather than the file, since editors and
+// Kubernetes ConfigMap updates replace the file, or the symlink it is
+// reached through, instead of writing to it. Changes that leave the
+// contents as applied are ignored, and invalid ones keep the current
+// config as Reload does.
+func (s *server) watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := watcher.Add(filepath.Dir(s.path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+		settle := time.NewTimer(0)
+		<-settle.C
+		for {
+			select {
+			case event := <-watcher.Events:
+				// ConfigMap updates swap the ..data symlink the file is
+				// reached through.
+				if filepath.Clean(event.Name) == filepath.Clean(s.path) || filepath.Base(event.Name) == "..data" {
+					settle.Reset(watchSettle)
+				}
+			case err := <-watcher.Errors:
+				log.Println("watching the config:", err)
+			case <-settle.C:
+				data, err := os.ReadFile(s.path)
+				if err == nil && bytes.Equal(data, s.ruleSet().config.data) {
+					continue
+				}
+				s.Reload()
+			case <-ctx.Done():
+				settle.Stop()
+				return
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	oneRule = `{"upstream": "http://127.0.0.1:1", "rules": [
+		{"name": "api", "path": "/api/", "rate_limit": 10, "refill_interval": "1s"}]}`
+	twoRules = `{"upstream": "http://127.0.0.1:1", "rules": [
+		{"name": "api", "path": "/api/", "rate_limit": 10, "refill_interval": "1s"},
+		{"name": "login", "path": "/login", "rate_limit": 1, "refill_interval": "1m"}]}`
+)
+
+func TestWatch(t *testing.T) {
+	path := writeConfig(t, oneRule)
+	s := &server{path: path}
+	if err := s.start(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := s.watch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		data string
+		// Replaces the file with a new one, as editors do, instead of
+		// writing to it.
+		replace   bool
+		wantRules int
+	}{
+		{name: "written", data: twoRules, wantRules: 2},
+		{name: "invalid keeps the config", data: `{"rules": [`, wantRules: 2},
+		{name: "replaced", data: oneRule, replace: true, wantRules: 1},
+	}
+	for _, step := range steps {
+		target := path
+		if step.replace {
+			target = path + ".tmp"
+		}
+		if err := os.WriteFile(target, []byte(step.data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if step.replace {
+			if err := os.Rename(target, path); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for len(s.ruleSet().rules) != step.wantRules && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		// Leave the watcher time to apply a wrong config too.
+		time.Sleep(3 * watchSettle)
+		if got := len(s.ruleSet().rules); got != step.wantRules {
+			t.Fatalf("%s: %d rules, want %d", step.name, got, step.wantRules)
+		}
+	}
+}
+
+func TestStartLastGood(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		lastGood  string
+		wantErr   bool
+		wantRules int
+		wantSaved string
+	}{
+		{name: "saves the config", data: twoRules, wantRules: 2, wantSaved: twoRules},
+		{name: "falls back", data: `{"rules": [`, lastGood: oneRule, wantRules: 1, wantSaved: oneRule},
+		{name: "nothing to fall back to", data: `{"rules": [`, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lastGood := filepath.Join(t.TempDir(), "last-good.json")
+			if test.lastGood != "" {
+				if err := os.WriteFile(lastGood, []byte(test.lastGood), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s := &server{path: writeConfig(t, test.data), lastGood: lastGood}
+			err := s.start()
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("started from a broken config")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			saved, _ := os.ReadFile(lastGood)
+			if len(s.ruleSet().rules) != test.wantRules || string(saved) != test.wantSaved {
+				t.Fatalf("%d rules, last good %q", len(s.ruleSet().rules), saved)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// anomalyWarmup is how many intervals a key's baseline must cover before
+// the key can be flagged, so new keys aren't compared against nothing.
+const anomalyWarmup = 3
+
+// maxAnomalyKeys bounds how many keys have a baseline.
+const maxAnomalyKeys = 100000
+
+// anomalyDetector keeps a baseline of the requests per ANOMALY_INTERVAL of
+// each key, an EWMA of its past intervals, and flags keys whose current
+// interval exceeds it ANOMALY_FACTOR times over.
+type anomalyDetector struct {
+	interval  time.Duration
+	factor    float64
+	smoothing float64
+	minimum   int64
+	duration  time.Duration
+	keys      map[string]*keyRate
+	mx        sync.Mutex
+}
+
+type keyRate struct {
+	// Requests per interval, averaged over the intervals before this one.
+	baseline float64
+	// Intervals the baseline covers.
+	intervals int
+	// Number of the current interval since the zero time, and its requests.
+	epoch int64
+	count int64
+	// Whether the current interval went past the baseline; such intervals
+	// are left out of it, so abuse doesn't become the norm.
+	spiked  bool
+	flagged time.Time
+}
+
+// spike is a key's rate jumping past its baseline.
+type spike struct {
+	rate     float64
+	baseline float64
+}
+
+// configure takes the ANOMALY_ settings, starting the baselines over if
+// the interval changed.
+func (d *anomalyDetector) configure(config RateLimiterConfig) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if config.ANOMALY_INTERVAL != d.interval || config.ANOMALY_FACTOR <= 0 {
+		d.keys = nil
+	}
+	d.interval = config.ANOMALY_INTERVAL
+	d.factor = config.ANOMALY_FACTOR
+	d.smoothing = config.ANOMALY_SMOOTHING
+	d.minimum = config.ANOMALY_MIN_REQUESTS
+	d.duration = config.ANOMALY_DURATION
+}
+
+// observe counts a request of key and reports whether the key is flagged,
+// and the spike if the request got it flagged.
+func (d *anomalyDetector) observe(key string, now time.Time) (bool, *spike) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	if d.factor <= 0 {
+		return false, nil
+	}
+	epoch := now.UnixNano() / int64(d.interval)
+	k, ok := d.keys[key]
+	if !ok {
+		k = &keyRate{epoch: epoch}
+		d.add(key, k, epoch)
+	}
+	if epoch != k.epoch {
+		d.roll(k, epoch)
+	}
+	k.count++
+
+	if k.intervals < anomalyWarmup || k.count < d.minimum || float64(k.count) <= d.factor*k.baseline {
+		return now.Before(k.flagged), nil
+	}
+	k.spiked = true
+	if now.Before(k.flagged) {
+		return true, nil
+	}
+	k.flagged = now.Add(d.duration)
+	return true, &spike{rate: float64(k.count), baseline: k.baseline}
+}
+
+// roll folds the key's finished interval, and the idle ones since, into its
+// baseline and starts the interval epoch.
+func (d *anomalyDetector) roll(k *keyRate, epoch int64) {
+	if !k.spiked {
+		if k.intervals == 0 {
+			k.baseline = float64(k.count)
+		} else {
+			k.baseline = d.smoothing*float64(k.count) + (1-d.smoothing)*k.baseline
+		}
+		k.intervals++
+	}
+	idle := min(epoch-k.epoch-1, 1000)
+	k.baseline *= math.Pow(1-d.smoothing, float64(idle))
+	k.intervals += int(idle)
+	k.epoch, k.count, k.spiked = epoch, 0, false
+}
+
+// add tracks key. A full detector first drops the keys idle since before
+// the last interval, then a tenth of the others, but never flagged keys, so
+// flooding it with new keys doesn't clear a flag. If every key is flagged,
+// key isn't tracked. The caller must hold d.mx.
+func (d *anomalyDetector) add(key string, k *keyRate, epoch int64) {
+	if d.keys == nil {
+		d.keys = map[string]*keyRate{}
+	}
+	now := time.Now()
+	if len(d.keys) >= maxAnomalyKeys {
+		for key, old := range d.keys {
+			if old.epoch < epoch-1 && !now.Before(old.flagged) {
+				delete(d.keys, key)
+			}
+		}
+	}
+	if len(d.keys) >= maxAnomalyKeys {
+		evict := maxAnomalyKeys / 10
+		for key, old := range d.keys {
+			if evict == 0 {
+				break
+			}
+			if !now.Before(old.flagged) {
+				delete(d.keys, key)
+				evict--
+			}
+		}
+	}
+	if len(d.keys) < maxAnomalyKeys {
+		d.keys[key] = k
+	}
+}
+
+// forget drops the key's baseline and flag.
+func (d *anomalyDetector) forget(key string) {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	delete(d.keys, key)
+}
+
+// validateAnomaly reports smoothing outside zero to one.
+func (c RateLimiterConfig) validateAnomaly() error {
+	if c.ANOMALY_SMOOTHING < 0 || c.ANOMALY_SMOOTHING > 1 {
+		return fmt.Errorf("ratelimiter: ANOMALY_SMOOTHING %v isn't between 0 and 1", c.ANOMALY_SMOOTHING)
+	}
+	return nil
+}
+
+// anomalous counts a request of key towards its rate and reports whether
+// the key is flagged, sending an EventAnomaly when it gets flagged.
+func (r *rateLimiter) anomalous(key string) bool {
+	c := r.config()
+	if c.ANOMALY_FACTOR <= 0 {
+		return false
+	}
+	now := time.Now()
+	flagged, s := r.stats.anomalies.observe(key, now)
+	if s == nil {
+		return flagged
+	}
+	if r.stats.events.active() {
+		r.stats.events.emit(Event{
+			Kind:     EventAnomaly,
+			Time:     now,
+			Key:      key,
+			Rule:     "anomaly",
+			Rate:     s.rate,
+			Baseline: s.baseline,
+		})
+	}
+	if c.LOGGER != nil {
+		r.logAnomaly(key, s)
+	}
+	return flagged
+}
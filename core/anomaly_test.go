@@ -0,0 +1,129 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAnomalyDetector(t *testing.T) {
+	tests := []struct {
+		name string
+		// Requests in each interval, the last one checked.
+		counts      []int64
+		wantFlagged bool
+		// Requests into the last interval at which the key gets flagged.
+		wantAt int64
+	}{
+		{name: "steady", counts: []int64{20, 20, 20, 20, 60}},
+		{name: "spike", counts: []int64{20, 20, 20, 20, 200}, wantFlagged: true, wantAt: 101},
+		{name: "growing baseline", counts: []int64{20, 60, 100, 140, 180}},
+		{name: "too few requests", counts: []int64{1, 1, 1, 1, 9}},
+		{name: "quiet key waking up", counts: []int64{1, 0, 0, 0, 10}, wantFlagged: true, wantAt: 10},
+		{name: "new key", counts: []int64{500}},
+		{name: "warming up", counts: []int64{10, 10, 500}},
+		{name: "spike left out of baseline", counts: []int64{20, 20, 20, 500, 0, 0, 0, 200}, wantFlagged: true, wantAt: 52},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var d anomalyDetector
+			d.configure(RateLimiterConfig{
+				ANOMALY_FACTOR:       5,
+				ANOMALY_INTERVAL:     time.Minute,
+				ANOMALY_SMOOTHING:    0.2,
+				ANOMALY_MIN_REQUESTS: 10,
+				ANOMALY_DURATION:     2 * time.Minute,
+			})
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			var flagged bool
+			var at int64
+			for i, count := range test.counts {
+				now := start.Add(time.Duration(i) * time.Minute)
+				flagged = false
+				for n := int64(1); n <= count; n++ {
+					var s *spike
+					flagged, s = d.observe("k", now)
+					if s != nil && i == len(test.counts)-1 {
+						at = n
+					}
+				}
+			}
+			if flagged != test.wantFlagged || at != test.wantAt {
+				t.Fatalf("flagged %v at %d", flagged, at)
+			}
+		})
+	}
+}
+
+func TestAnomalyProfile(t *testing.T) {
+	var events eventLog
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:       100,
+		REFILL_INTERVAL:  time.Second,
+		KEY_FUNC:         remoteIP,
+		ANOMALY_FACTOR:   5,
+		ANOMALY_INTERVAL: time.Hour,
+		ANOMALY_PROFILE:  &LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour},
+	})
+	s := limiter.Subscribe(SubscriberConfig{ON_ANOMALY: events.add})
+	r := limiter.(*rateLimiter)
+
+	// Three quiet hours of history for the key.
+	for hour := 3; hour > 0; hour-- {
+		for i := 0; i < 2; i++ {
+			r.stats.anomalies.observe("203.0.113.1", time.Now().Add(-time.Duration(hour)*time.Hour))
+		}
+	}
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.RemoteAddr = "203.0.113.1:1234"
+	var rules []string
+	var allowed int
+	for i := 0; i < 13; i++ {
+		d := limiter.Decide(request)
+		rules = append(rules, d.Rule)
+		if d.Allowed {
+			allowed++
+		}
+	}
+	s.Close()
+
+	if rules[9] != "default" || rules[10] != "anomaly" || rules[12] != "anomaly" {
+		t.Fatalf("rules %q", rules)
+	}
+	// Ten requests of the default limit, then two of the anomaly one.
+	if allowed != 12 {
+		t.Fatalf("%d allowed", allowed)
+	}
+	if len(events.events) != 1 || events.events[0].Key != "203.0.113.1" || events.events[0].Rate != 11 {
+		t.Fatalf("events %+v", events.events)
+	}
+
+	limiter.ResetKey("203.0.113.1")
+	if d := limiter.Decide(request); d.Rule != "default" {
+		t.Fatalf("rule after reset %q", d.Rule)
+	}
+}
+
+func TestAnomalyDetectorFull(t *testing.T) {
+	d := &anomalyDetector{}
+	d.configure(RateLimiterConfig{ANOMALY_FACTOR: 3, ANOMALY_INTERVAL: time.Minute, ANOMALY_DURATION: time.Hour})
+	now := time.Now()
+	epoch := now.UnixNano() / int64(time.Minute)
+
+	d.keys = map[string]*keyRate{"mallory": {epoch: epoch, flagged: now.Add(time.Hour)}}
+	for i := 1; i < maxAnomalyKeys; i++ {
+		d.keys[fmt.Sprint("busy", i)] = &keyRate{epoch: epoch}
+	}
+	for i := 0; i < maxAnomalyKeys; i++ {
+		d.observe(fmt.Sprint("flood", i), now)
+	}
+	if flagged, _ := d.observe("mallory", now); !flagged {
+		t.Fatal("flag cleared by a flood of new keys")
+	}
+	if len(d.keys) > maxAnomalyKeys {
+		t.Fatalf("%d keys tracked", len(d.keys))
+	}
+}
@@ -0,0 +1,126 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type AuditLogConfig struct {
+	// Where the log is written, one JSON object per line.
+	WRITER io.Writer
+	// Rotation hook, called before each line with how many bytes were
+	// written to the current writer and when it was started. Returning a
+	// writer switches to it, closing the previous one if it is an
+	// io.Closer; returning nil keeps the current one. E.g. daily files:
+	//
+	//	ROTATE: func(written int64, started time.Time) io.Writer {
+	//		if time.Now().YearDay() == started.YearDay() {
+	//			return nil
+	//		}
+	//		f, _ := os.Create(time.Now().Format("denied-2006-01-02.jsonl"))
+	//		return f
+	//	}
+	ROTATE func(written int64, started time.Time) io.Writer
+	// Records one in SAMPLE rejections, to bound the log under attack.
+	// Zero or one records them all.
+	SAMPLE int64
+	// Records keys as they are instead of hashed with HashKey. Keys are
+	// hashed by default; support can still find a customer's rejections by
+	// hashing their key.
+	RAW_KEYS bool
+	// Called when a line can't be written.
+	ON_ERROR func(err error)
+}
+
+// AuditRecord is a line of the audit log.
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Key        string    `json:"key"`
+	Rule       string    `json:"rule"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	UserAgent  string    `json:"user_agent"`
+	RetryAfter string    `json:"retry_after"`
+}
+
+// AuditLog records rejected requests as JSON lines, for security review
+// and customer support. It is set as a limiter's AUDIT_LOG, and may be
+// shared by several limiters and outlives SetConfig. Lines are written on
+// the request path, so WRITER should be quick, e.g. a file rather than a
+// network connection.
+type AuditLog struct {
+	AuditLogConfig
+	rejections atomic.Int64
+	written    int64
+	started    time.Time
+	mx         sync.Mutex
+}
+
+func NewAuditLog(config AuditLogConfig) *AuditLog {
+	return &AuditLog{AuditLogConfig: config, started: time.Now()}
+}
+
+// record writes the line of a rejected request, if it is sampled.
+func (a *AuditLog) record(request *http.Request, d Decision) {
+	if a.SAMPLE > 1 && (a.rejections.Add(1)-1)%a.SAMPLE != 0 {
+		return
+	}
+	key := d.Key
+	if key != "" && !a.RAW_KEYS {
+		key = HashKey(key)
+	}
+	line, err := json.Marshal(AuditRecord{
+		Time:       time.Now().UTC(),
+		Key:        key,
+		Rule:       d.Rule,
+		Method:     request.Method,
+		Path:       request.URL.Path,
+		UserAgent:  request.UserAgent(),
+		RetryAfter: d.RetryAfter.String(),
+	})
+	if err != nil {
+		a.fail(err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if a.ROTATE != nil {
+		if next := a.ROTATE(a.written, a.started); next != nil {
+			if closer, ok := a.WRITER.(io.Closer); ok {
+				if err := closer.Close(); err != nil {
+					a.fail(err)
+				}
+			}
+			a.WRITER, a.written, a.started = next, 0, time.Now()
+		}
+	}
+	n, err := a.WRITER.Write(line)
+	a.written += int64(n)
+	if err != nil {
+		a.fail(err)
+	}
+}
+
+func (a *AuditLog) fail(err error) {
+	if a.ON_ERROR != nil {
+		a.ON_ERROR(err)
+	}
+}
+
+// Close closes the writer, if it is an io.Closer.
+func (a *AuditLog) Close() error {
+	a.mx.Lock()
+	defer a.mx.Unlock()
+
+	if closer, ok := a.WRITER.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		sample    int64
+		rawKeys   bool
+		rejected  int
+		wantLines int
+		wantKey   string
+	}{
+		{name: "every rejection", rejected: 3, wantLines: 3, wantKey: HashKey("203.0.113.7")},
+		{name: "raw keys", rejected: 1, rawKeys: true, wantLines: 1, wantKey: "203.0.113.7"},
+		{name: "sampled", sample: 2, rejected: 5, wantLines: 3, wantKey: HashKey("203.0.113.7")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        func(r *http.Request) string { return "203.0.113.7" },
+				AUDIT_LOG:       NewAuditLog(AuditLogConfig{WRITER: &out, SAMPLE: test.sample, RAW_KEYS: test.rawKeys}),
+			})
+			for i := 0; i <= test.rejected; i++ {
+				r := httptest.NewRequest(http.MethodPost, "/api/orders", nil)
+				r.Header.Set("User-Agent", "curl/8.0")
+				limiter.Decide(r)
+			}
+
+			lines := 0
+			scanner := bufio.NewScanner(&out)
+			for scanner.Scan() {
+				lines++
+				var record AuditRecord
+				if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+					t.Fatal(err)
+				}
+				if record.Key != test.wantKey || record.Rule != "default" || record.Method != http.MethodPost ||
+					record.Path != "/api/orders" || record.UserAgent != "curl/8.0" || record.RetryAfter == "" || record.Time.IsZero() {
+					t.Fatalf("record %+v", record)
+				}
+			}
+			if lines != test.wantLines {
+				t.Fatalf("%d lines, want %d", lines, test.wantLines)
+			}
+		})
+	}
+}
+
+func TestAuditLogRotate(t *testing.T) {
+	first, second := &closingBuffer{}, &closingBuffer{}
+	var sizes []int64
+	log := NewAuditLog(AuditLogConfig{
+		WRITER: first,
+		ROTATE: func(written int64, started time.Time) io.Writer {
+			sizes = append(sizes, written)
+			if written > 0 && first.Len() > 0 && !first.closed {
+				return second
+			}
+			return nil
+		},
+	})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for i := 0; i < 3; i++ {
+		log.record(r, Decision{Key: "a", Rule: "default"})
+	}
+
+	if !first.closed || bytes.Count(first.Bytes(), []byte("\n")) != 1 || bytes.Count(second.Bytes(), []byte("\n")) != 2 {
+		t.Fatalf("first closed %v with %q, second %q", first.closed, first.String(), second.String())
+	}
+	// Timestamps drop trailing zeros, so records differ in length.
+	if sizes[0] != 0 || sizes[1] != int64(first.Len()) || sizes[2] != int64(bytes.IndexByte(second.Bytes(), '\n')+1) {
+		t.Fatalf("rotate saw sizes %v", sizes)
+	}
+}
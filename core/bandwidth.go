@@ -0,0 +1,174 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// maxPacedWrite caps how many bytes are charged at once so large writes are
+// spread out instead of sent in bursts.
+const maxPacedWrite = 32 * 1024
+
+// ErrUploadRateLimited is returned from request body reads when the client
+// has used up its upload budget and REJECT_OVER_LIMIT is set.
+var ErrUploadRateLimited = errors.New("ratelimiter: upload rate limit exceeded")
+
+// BandwidthLimiter paces the bytes each client downloads or uploads, for
+// endpoints such as file transfers where counting requests is meaningless.
+// Use separate limiters for separate download and upload budgets.
+type BandwidthLimiter interface {
+	SetConfig(BandwidthLimiterConfig)
+	// PaceWriter returns a writer that passes writes on to w no faster than
+	// the request's key allows.
+	PaceWriter(r *http.Request, w io.Writer) io.Writer
+	// PaceBody returns the request body wrapped so that reading it is
+	// charged to the request's key. Empty bodies are returned unchanged.
+	PaceBody(r *http.Request) io.ReadCloser
+}
+
+type BandwidthLimiterConfig struct {
+	// Sustained response bytes per second per key. Zero or less leaves
+	// transfers unlimited.
+	BYTES_PER_SECOND int64
+	// Bytes that may be written at full speed before pacing starts.
+	// Defaults to BYTES_PER_SECOND.
+	BURST int64
+	// Groups requests that share a bandwidth budget. Defaults to the
+	// client IP.
+	KEY_FUNC func(r *http.Request) string
+	// Makes request body reads fail with ErrUploadRateLimited once the
+	// budget is used up instead of pacing them.
+	REJECT_OVER_LIMIT bool
+}
+
+type bandwidthLimiter struct {
+	BandwidthLimiterConfig
+	bytes *keyedBuckets
+}
+
+func NewBandwidthLimiter() BandwidthLimiter {
+	return &bandwidthLimiter{}
+}
+
+func (b *bandwidthLimiter) SetConfig(config BandwidthLimiterConfig) {
+	if config.BURST == 0 {
+		config.BURST = config.BYTES_PER_SECOND
+	}
+	if config.KEY_FUNC == nil {
+		config.KEY_FUNC = clientIP
+	}
+
+	b.BandwidthLimiterConfig = config
+	b.bytes = nil
+	if config.BYTES_PER_SECOND > 0 {
+		b.bytes = newRateBuckets(max(config.BURST, 1), config.BYTES_PER_SECOND)
+	}
+}
+
+func (b *bandwidthLimiter) PaceWriter(r *http.Request, w io.Writer) io.Writer {
+	if b.bytes == nil {
+		return w
+	}
+	return &pacedWriter{
+		Writer: w,
+		pacer:  newBytePacer(r.Context(), b.bytes, b.KEY_FUNC(r)),
+	}
+}
+
+func (b *bandwidthLimiter) PaceBody(r *http.Request) io.ReadCloser {
+	if b.bytes == nil || r.Body == nil || r.Body == http.NoBody {
+		return r.Body
+	}
+	return &pacedBody{
+		ReadCloser: r.Body,
+		pacer:      newBytePacer(r.Context(), b.bytes, b.KEY_FUNC(r)),
+		reject:     b.REJECT_OVER_LIMIT,
+	}
+}
+
+// bytePacer charges bytes against a key's bucket, blocking until they fit.
+type bytePacer struct {
+	ctx   context.Context
+	bytes *keyedBuckets
+	key   string
+}
+
+func newBytePacer(ctx context.Context, bytes *keyedBuckets, key string) *bytePacer {
+	return &bytePacer{ctx: ctx, bytes: bytes, key: key}
+}
+
+// write passes data to write in chunks, waiting for each chunk's tokens first.
+func (p *bytePacer) write(data []byte, write func([]byte) (int, error)) (int, error) {
+	chunk := p.chunkSize()
+
+	written := 0
+	for len(data) > 0 {
+		n := int64(len(data))
+		if n > chunk {
+			n = chunk
+		}
+
+		if err := p.bytes.wait(p.ctx, p.key, n); err != nil {
+			return written, err
+		}
+
+		m, err := write(data[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		data = data[n:]
+	}
+	return written, nil
+}
+
+// chunkSize is the most bytes charged in one go, which never exceeds the
+// bucket size so every chunk can eventually be paid for.
+func (p *bytePacer) chunkSize() int64 {
+	if p.bytes.limit < maxPacedWrite {
+		return p.bytes.limit
+	}
+	return maxPacedWrite
+}
+
+// pacedBody charges the bytes read from a request body, either waiting for
+// them to be paid for or failing the read.
+type pacedBody struct {
+	io.ReadCloser
+	pacer  *bytePacer
+	reject bool
+}
+
+func (b *pacedBody) Read(data []byte) (int, error) {
+	if chunk := b.pacer.chunkSize(); int64(len(data)) > chunk {
+		data = data[:chunk]
+	}
+
+	n, err := b.ReadCloser.Read(data)
+	if n == 0 {
+		return n, err
+	}
+
+	if b.reject {
+		if allowed, _, _ := b.pacer.bytes.take(b.pacer.key, int64(n)); !allowed {
+			return 0, ErrUploadRateLimited
+		}
+		return n, err
+	}
+
+	if waitErr := b.pacer.bytes.wait(b.pacer.ctx, b.pacer.key, int64(n)); waitErr != nil {
+		return 0, waitErr
+	}
+	return n, err
+}
+
+type pacedWriter struct {
+	io.Writer
+	pacer *bytePacer
+}
+
+func (w *pacedWriter) Write(data []byte) (int, error) {
+	return w.pacer.write(data, w.Writer.Write)
+}
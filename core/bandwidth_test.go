@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiterUnlimited(t *testing.T) {
+	for _, rate := range []int64{0, -1} {
+		limiter := NewBandwidthLimiter()
+		limiter.SetConfig(BandwidthLimiterConfig{BYTES_PER_SECOND: rate})
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("upload"))
+		var out bytes.Buffer
+		if _, err := limiter.PaceWriter(r, &out).Write([]byte("download")); err != nil {
+			t.Fatalf("rate %d: write: %v", rate, err)
+		}
+		body, err := io.ReadAll(limiter.PaceBody(r))
+		if err != nil {
+			t.Fatalf("rate %d: read: %v", rate, err)
+		}
+		if out.String() != "download" || string(body) != "upload" {
+			t.Fatalf("rate %d: got %q and %q", rate, out.String(), body)
+		}
+	}
+}
+
+func TestRateBucketsRetryAfter(t *testing.T) {
+	tests := []struct {
+		perSecond int64
+		missing   int64
+		want      time.Duration
+	}{
+		{perSecond: 1000, missing: 1000, want: time.Second},
+		{perSecond: 300_000_000, missing: 300_000_000, want: time.Second},
+		{perSecond: 4_000_000_000, missing: 2_000_000_000, want: 500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		b := newRateBuckets(test.perSecond, test.perSecond)
+		bucket := &keyBucket{tokens: 0}
+		got := b.retryAfter(bucket, test.missing)
+		if diff := got - test.want; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("%d B/s: retry after %v for %d bytes, want %v", test.perSecond, got, test.missing, test.want)
+		}
+	}
+}
+
+func TestPaceBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		reject   bool
+		body     string
+		wantErr  error
+		wantWait time.Duration
+	}{
+		{name: "within the burst", body: strings.Repeat("x", 10)},
+		{name: "paced past the burst", body: strings.Repeat("x", 20), wantWait: 10 * time.Millisecond},
+		{name: "rejected past the burst", reject: true, body: strings.Repeat("x", 20), wantErr: ErrUploadRateLimited},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := NewBandwidthLimiter()
+			limiter.SetConfig(BandwidthLimiterConfig{BYTES_PER_SECOND: 1000, BURST: 10, REJECT_OVER_LIMIT: test.reject})
+
+			start := time.Now()
+			body, err := io.ReadAll(limiter.PaceBody(httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body))))
+			if err != test.wantErr {
+				t.Fatalf("read error = %v, want %v", err, test.wantErr)
+			}
+			if err == nil && string(body) != test.body {
+				t.Fatalf("read %q, want %q", body, test.body)
+			}
+			if elapsed := time.Since(start); elapsed < test.wantWait-2*time.Millisecond {
+				t.Fatalf("read took %v, want at least %v", elapsed, test.wantWait)
+			}
+		})
+	}
+}
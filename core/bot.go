@@ -0,0 +1,32 @@
+package core
+
+import (
+	"net/http"
+	"strings"
+)
+
+// botUserAgentMarkers are lowercase User-Agent fragments used by common
+// crawlers, scrapers and headless browsers.
+var botUserAgentMarkers = []string{
+	"bot",
+	"crawl",
+	"spider",
+	"slurp",
+	"scrape",
+	"facebookexternalhit",
+	"embedly",
+	"headlesschrome",
+	"phantomjs",
+}
+
+// IsBotUserAgent reports whether the request's User-Agent looks like that of
+// a crawler or other automated client.
+func IsBotUserAgent(r *http.Request) bool {
+	userAgent := strings.ToLower(r.UserAgent())
+	for _, marker := range botUserAgentMarkers {
+		if strings.Contains(userAgent, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsBotUserAgent(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      bool
+	}{
+		{userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", want: true},
+		{userAgent: "Mozilla/5.0 (compatible; Yahoo! Slurp)", want: true},
+		{userAgent: "facebookexternalhit/1.1", want: true},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64) HeadlessChrome/120.0.0.0", want: true},
+		{userAgent: "Mozilla/5.0 (X11; Linux x86_64) Chrome/120.0.0.0 Safari/537.36", want: false},
+		{userAgent: "", want: false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", test.userAgent)
+		if got := IsBotUserAgent(r); got != test.want {
+			t.Errorf("IsBotUserAgent(%q) = %v, want %v", test.userAgent, got, test.want)
+		}
+	}
+}
+
+func TestBotProfile(t *testing.T) {
+	tests := []struct {
+		name           string
+		userAgent      string
+		wantRule       string
+		wantAllowed    int
+		wantRetryAfter time.Duration
+	}{
+		{name: "human", userAgent: "Mozilla/5.0 Chrome/120.0", wantRule: "default", wantAllowed: 3, wantRetryAfter: 0},
+		{name: "bot", userAgent: "Googlebot/2.1", wantRule: "bot", wantAllowed: 1, wantRetryAfter: time.Hour},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      3,
+				REFILL_INTERVAL: time.Second,
+				KEY_FUNC:        remoteIP,
+				BOT_PROFILE:     &LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: time.Second},
+				BOT_RETRY_AFTER: time.Hour,
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("User-Agent", test.userAgent)
+
+			allowed := 0
+			var d Decision
+			for d = limiter.Decide(r); d.Allowed; d = limiter.Decide(r) {
+				if d.Rule != test.wantRule {
+					t.Fatalf("rule = %q, want %q", d.Rule, test.wantRule)
+				}
+				allowed++
+			}
+			if allowed != test.wantAllowed {
+				t.Fatalf("allowed %d requests, want %d", allowed, test.wantAllowed)
+			}
+			if d.RetryAfter < test.wantRetryAfter {
+				t.Fatalf("retry after %v, want at least %v", d.RetryAfter, test.wantRetryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// emergencyBrake is when the brake engaged with EngageBrake releases.
+type emergencyBrake struct {
+	// Unix nanoseconds, zero while released.
+	until atomic.Int64
+}
+
+// BrakeStatus tells whether the emergency brake is engaged, and what it
+// does.
+type BrakeStatus struct {
+	Engaged bool
+	// When the brake releases by itself, zero while released.
+	Until    time.Time
+	Fraction float64
+	Rules    map[string]float64 `json:",omitempty"`
+}
+
+// EngageBrake clamps every limit to BRAKE_FRACTION of itself, and the
+// rules of BRAKE_RULES to theirs, for d, or BRAKE_DURATION if d isn't
+// positive, e.g. while a downstream dependency is down. Engaging it again
+// sets when it releases anew. The brake outlives SetConfig.
+func (r *rateLimiter) EngageBrake(d time.Duration) {
+	c := r.config()
+	if d <= 0 {
+		d = c.BRAKE_DURATION
+	}
+	until := time.Now().Add(d)
+	r.brake.until.Store(until.UnixNano())
+	if c.LOGGER != nil {
+		c.LOGGER.LogAttrs(context.Background(), slog.LevelWarn, "rate limit brake engaged",
+			slog.Float64("fraction", c.BRAKE_FRACTION),
+			slog.Time("until", until),
+		)
+	}
+}
+
+// ReleaseBrake restores the limits before the brake would release by
+// itself.
+func (r *rateLimiter) ReleaseBrake() {
+	c := r.config()
+	if r.brake.until.Swap(0) != 0 && c.LOGGER != nil {
+		c.LOGGER.LogAttrs(context.Background(), slog.LevelWarn, "rate limit brake released")
+	}
+}
+
+func (r *rateLimiter) BrakeStatus() BrakeStatus {
+	c := r.config()
+	until, engaged := r.braking(time.Now())
+	if !engaged {
+		return BrakeStatus{}
+	}
+	return BrakeStatus{Engaged: true, Until: until, Fraction: c.BRAKE_FRACTION, Rules: c.BRAKE_RULES}
+}
+
+// braking reports whether the brake is engaged at now, and until when.
+func (r *rateLimiter) braking(now time.Time) (time.Time, bool) {
+	until := r.brake.until.Load()
+	if until == 0 || now.UnixNano() >= until {
+		return time.Time{}, false
+	}
+	return time.Unix(0, until), true
+}
+
+// brakeScale returns how many times over requests of rule are charged
+// while braking, so a bucket of limit tokens lasts for the clamped limit
+// and refills at its rate, at least one request per bucket. blocked is set
+// for rules braked to zero, rejected until the brake releases in
+// retryAfter.
+func (r *rateLimiter) brakeScale(rule string, limit int64) (scale int64, blocked bool, retryAfter time.Duration) {
+	c := r.config()
+	now := time.Now()
+	until, engaged := r.braking(now)
+	if !engaged {
+		return 1, false, 0
+	}
+	fraction, ok := c.BRAKE_RULES[rule]
+	if !ok {
+		fraction = c.BRAKE_FRACTION
+	}
+	if fraction <= 0 {
+		return 1, true, until.Sub(now)
+	}
+	scale = int64(math.Ceil(1 / fraction))
+	return max(min(scale, limit), 1), false, 0
+}
+
+// validateBrake reports fractions outside zero to one.
+func (c RateLimiterConfig) validateBrake() error {
+	if c.BRAKE_FRACTION < 0 || c.BRAKE_FRACTION > 1 {
+		return fmt.Errorf("ratelimiter: BRAKE_FRACTION %v isn't between 0 and 1", c.BRAKE_FRACTION)
+	}
+	for rule, fraction := range c.BRAKE_RULES {
+		if fraction < 0 || fraction > 1 {
+			return fmt.Errorf("ratelimiter: BRAKE_RULES fraction %v of %q isn't between 0 and 1", fraction, rule)
+		}
+	}
+	return nil
+}
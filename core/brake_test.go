@@ -0,0 +1,88 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBrake(t *testing.T) {
+	tests := []struct {
+		name      string
+		brake     time.Duration
+		userAgent string
+		// Requests made; the decision of the last one is checked.
+		times         int
+		wantAllowed   int
+		wantRule      string
+		wantLimit     int64
+		wantRemaining int64
+		// Rounded to the minute.
+		wantRetryAfter time.Duration
+	}{
+		{name: "released", times: 12, wantAllowed: 10, wantRule: "default", wantLimit: 10, wantRetryAfter: time.Hour},
+		{name: "clamped", brake: time.Hour, times: 1, wantAllowed: 1, wantRule: "default", wantLimit: 2, wantRemaining: 1},
+		{name: "clamped used up", brake: time.Hour, times: 3, wantAllowed: 2, wantRule: "default", wantLimit: 2, wantRetryAfter: 5 * time.Hour},
+		{name: "rule braked to zero", brake: 2 * time.Hour, userAgent: "Googlebot/2.1", times: 1, wantRule: "bot", wantLimit: 4, wantRetryAfter: 2 * time.Hour},
+		{name: "rule unbraked", userAgent: "Googlebot/2.1", times: 1, wantAllowed: 1, wantRule: "bot", wantLimit: 4, wantRemaining: 3},
+		{name: "expired", brake: time.Nanosecond, times: 3, wantAllowed: 3, wantRule: "default", wantLimit: 10, wantRemaining: 7},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      10,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        remoteIP,
+				BOT_PROFILE:     &LimitProfile{RATE_LIMIT: 4, REFILL_INTERVAL: time.Hour},
+				BRAKE_FRACTION:  0.2,
+				BRAKE_RULES:     map[string]float64{"bot": 0},
+			})
+			if test.brake > 0 {
+				limiter.EngageBrake(test.brake)
+			}
+
+			var d Decision
+			allowed := 0
+			for i := 0; i < test.times; i++ {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = "203.0.113.1:1234"
+				r.Header.Set("User-Agent", test.userAgent)
+				if d = limiter.Decide(r); d.Allowed {
+					allowed++
+				}
+			}
+			if allowed != test.wantAllowed || d.Rule != test.wantRule || d.Limit != test.wantLimit || d.Remaining != test.wantRemaining {
+				t.Fatalf("%d allowed, last decision %+v", allowed, d)
+			}
+			if d.RetryAfter.Round(time.Minute) != test.wantRetryAfter {
+				t.Fatalf("retry after %v", d.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestBrakeStatus(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 10, REFILL_INTERVAL: time.Second})
+	if limiter.BrakeStatus().Engaged {
+		t.Fatal("engaged before EngageBrake")
+	}
+
+	limiter.EngageBrake(0)
+	status := limiter.BrakeStatus()
+	if !status.Engaged || status.Fraction != 0.1 || time.Until(status.Until) < 14*time.Minute {
+		t.Fatalf("status %+v", status)
+	}
+	// The brake outlives SetConfig.
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 20, REFILL_INTERVAL: time.Second})
+	if !limiter.BrakeStatus().Engaged {
+		t.Fatal("released by SetConfig")
+	}
+
+	limiter.ReleaseBrake()
+	if limiter.BrakeStatus().Engaged {
+		t.Fatal("engaged after ReleaseBrake")
+	}
+}
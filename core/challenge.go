@@ -0,0 +1,68 @@
+package core
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ChallengeHandler is called for rejected requests in place of the default
+// 429 response, e.g. to serve a CAPTCHA or ask for step-up authentication.
+// It returns false to fall back to the default response without writing
+// anything. Once the client passes the challenge, call MarkVerified with key.
+type ChallengeHandler func(w http.ResponseWriter, r *http.Request, key string) bool
+
+// verifiedKeys tracks keys that passed a challenge and the separate buckets
+// they draw from while verified.
+type verifiedKeys struct {
+	buckets *storeBuckets
+	until   map[string]time.Time
+	mx      sync.Mutex
+}
+
+func newVerifiedKeys(buckets *storeBuckets) *verifiedKeys {
+	return &verifiedKeys{
+		buckets: buckets,
+		until:   map[string]time.Time{},
+	}
+}
+
+func (v *verifiedKeys) verify(key string, d time.Duration) {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+
+	v.until[key] = time.Now().Add(d)
+	v.buckets.reset(key)
+}
+
+func (v *verifiedKeys) isVerified(key string) bool {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+
+	until, ok := v.until[key]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(v.until, key)
+		v.buckets.reset(key)
+		return false
+	}
+	return true
+}
+
+// MarkVerified gives key a fresh bucket after it passed a challenge. With
+// VERIFIED_DURATION set the key draws from a VERIFIED_RATE_LIMIT sized bucket
+// until the verification expires.
+func (r *rateLimiter) MarkVerified(key string) {
+	c := r.config()
+	if c.keyBuckets == nil {
+		return
+	}
+
+	key = c.normalizeKey(key)
+	c.keyBuckets.reset(key)
+	if c.VERIFIED_DURATION > 0 {
+		c.verified.verify(key, c.VERIFIED_DURATION)
+	}
+}
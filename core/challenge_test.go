@@ -0,0 +1,70 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func remoteIP(r *http.Request) string {
+	return StripPort(r.RemoteAddr)
+}
+
+func TestMarkVerified(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      RateLimiterConfig
+		wantAllowed int
+		wantRule    string
+	}{
+		{
+			name:        "refills the regular bucket",
+			config:      RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: remoteIP},
+			wantAllowed: 1,
+			wantRule:    "default",
+		},
+		{
+			name: "verified bucket",
+			config: RateLimiterConfig{
+				RATE_LIMIT:          1,
+				REFILL_INTERVAL:     time.Hour,
+				KEY_FUNC:            remoteIP,
+				VERIFIED_RATE_LIMIT: 3,
+				VERIFIED_DURATION:   time.Hour,
+			},
+			wantAllowed: 3,
+			wantRule:    "verified",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(test.config)
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			limiter.Decide(request)
+			d := limiter.Decide(request)
+			if d.Allowed {
+				t.Fatal("request past the limit allowed")
+			}
+			limiter.MarkVerified(d.Key)
+
+			allowed := 0
+			for i := 0; i < 5; i++ {
+				d = limiter.Decide(request)
+				if !d.Allowed {
+					break
+				}
+				if d.Rule != test.wantRule {
+					t.Fatalf("rule = %q, want %q", d.Rule, test.wantRule)
+				}
+				allowed++
+			}
+			if allowed != test.wantAllowed {
+				t.Fatalf("allowed %d requests after verifying, want %d", allowed, test.wantAllowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseCIDRs parses CIDRs and bare IPs. Entries that are neither are skipped.
+func parseCIDRs(entries []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		}
+	}
+	return networks
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveClientIP returns the address of the client that sent the request.
+// Forwarding headers are only believed when the request came through one of
+// the trusted proxies, and X-Forwarded-For is read right to left so a client
+// cannot prepend a spoofed address. Its header lines are read as one list,
+// since a proxy may add its own line rather than extend the client's.
+func resolveClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	remote := clientIP(r)
+	if len(trustedProxies) == 0 {
+		return remote
+	}
+
+	ip := net.ParseIP(remote)
+	if ip == nil || !containsIP(trustedProxies, ip) {
+		return remote
+	}
+
+	if forwarded := strings.Join(r.Header.Values("X-Forwarded-For"), ","); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			hopIP := net.ParseIP(hop)
+			if hopIP == nil {
+				break
+			}
+			if !containsIP(trustedProxies, hopIP) || i == 0 {
+				return hop
+			}
+		}
+	}
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return remote
+}
+
+// isPrivateIP reports whether ip is an RFC 1918/4193, loopback or link-local
+// address.
+func isPrivateIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	return parsed.IsPrivate() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast()
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResolveClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		forwarded  string
+		// A second X-Forwarded-For line, as some proxies add one.
+		appended string
+		realIP   string
+		want     string
+	}{
+		{name: "no trusted proxies", remoteAddr: "10.0.0.1:1234", forwarded: "203.0.113.7", want: "10.0.0.1"},
+		{name: "untrusted proxy", trusted: []string{"10.0.0.0/8"}, remoteAddr: "192.0.2.1:1234", forwarded: "203.0.113.7", want: "192.0.2.1"},
+		{name: "trusted proxy", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:1234", forwarded: "203.0.113.7", want: "203.0.113.7"},
+		{
+			name:       "spoofed hop ignored",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "198.51.100.1, 203.0.113.7, 10.0.0.2",
+			want:       "203.0.113.7",
+		},
+		{name: "bare proxy IP", trusted: []string{"10.0.0.1"}, remoteAddr: "10.0.0.1:1234", forwarded: "203.0.113.7", want: "203.0.113.7"},
+		{name: "all hops trusted", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:1234", forwarded: "10.0.0.3, 10.0.0.2", want: "10.0.0.3"},
+		{name: "garbage hop", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:1234", forwarded: "nonsense", want: "10.0.0.1"},
+		{name: "X-Real-IP", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.1:1234", realIP: "203.0.113.7", want: "203.0.113.7"},
+		{
+			name:       "second header line",
+			trusted:    []string{"10.0.0.0/8"},
+			remoteAddr: "10.0.0.1:1234",
+			forwarded:  "198.51.100.1",
+			appended:   "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{name: "IPv6 proxy", trusted: []string{"2001:db8::/32"}, remoteAddr: "[2001:db8::1]:1234", forwarded: "203.0.113.7", want: "203.0.113.7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			if test.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", test.forwarded)
+			}
+			if test.appended != "" {
+				r.Header.Add("X-Forwarded-For", test.appended)
+			}
+			if test.realIP != "" {
+				r.Header.Set("X-Real-IP", test.realIP)
+			}
+			if got := resolveClientIP(r, parseCIDRs(test.trusted)); got != test.want {
+				t.Fatalf("client IP = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSkipPrivateNetworks(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		wantExempt bool
+	}{
+		{remoteAddr: "10.1.2.3:1234", wantExempt: true},
+		{remoteAddr: "127.0.0.1:1234", wantExempt: true},
+		{remoteAddr: "[fe80::1]:1234", wantExempt: true},
+		{remoteAddr: "[fd00::1]:1234", wantExempt: true},
+		{remoteAddr: "203.0.113.7:1234", wantExempt: false},
+	}
+
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: remoteIP, SKIP_PRIVATE_NETWORKS: true})
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		if d := limiter.Decide(r); d.Exempt != test.wantExempt {
+			t.Errorf("%s: exempt = %v, want %v", test.remoteAddr, d.Exempt, test.wantExempt)
+		}
+	}
+}
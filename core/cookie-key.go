@@ -0,0 +1,34 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+)
+
+// ErrCookieSecretRequired is returned by Validate for a config keying by
+// cookie without COOKIE_KEY_SECRET, whose keys anyone could compute.
+var ErrCookieSecretRequired = errors.New("ratelimiter: COOKIE_KEY_SECRET is required with COOKIE_KEY_NAME")
+
+// validateCookie reports keying by cookie with no secret.
+func (c RateLimiterConfig) validateCookie() error {
+	if c.COOKIE_KEY_NAME != "" && c.KEY_FUNC == nil && len(c.COOKIE_KEY_SECRET) == 0 {
+		return ErrCookieSecretRequired
+	}
+	return nil
+}
+
+// cookieKey keys the request by the HMAC of its COOKIE_KEY_NAME cookie,
+// falling back to the client IP.
+func (c *limiterState) cookieKey(request *http.Request) string {
+	cookie, err := request.Cookie(c.COOKIE_KEY_NAME)
+	if err != nil || cookie.Value == "" {
+		return "ip:" + c.clientIP(request)
+	}
+
+	mac := hmac.New(sha256.New, c.COOKIE_KEY_SECRET)
+	mac.Write([]byte(cookie.Value))
+	return "session:" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,51 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateCookieSecret(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RateLimiterConfig
+		want   error
+	}{
+		{name: "no cookie keying", config: RateLimiterConfig{}},
+		{name: "empty secret", config: RateLimiterConfig{COOKIE_KEY_NAME: "session"}, want: ErrCookieSecretRequired},
+		{name: "secret set", config: RateLimiterConfig{COOKIE_KEY_NAME: "session", COOKIE_KEY_SECRET: []byte("s3cret")}},
+		{
+			name:   "own key func",
+			config: RateLimiterConfig{COOKIE_KEY_NAME: "session", KEY_FUNC: func(r *http.Request) string { return "" }},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.config.Validate(); !errors.Is(err, test.want) {
+				t.Fatalf("Validate() = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCookieKeyHashesSession(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:        1,
+		REFILL_INTERVAL:   time.Hour,
+		COOKIE_KEY_NAME:   "session",
+		COOKIE_KEY_SECRET: []byte("s3cret"),
+		DEBUG_RAW_KEYS:    true,
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+	key := limiter.Decide(r).Key
+	if key == "" || key == "session:abc" {
+		t.Fatalf("key %q, want the hashed session", key)
+	}
+}
@@ -0,0 +1,23 @@
+package core
+
+import (
+	"context"
+	"net/http"
+)
+
+type costKey struct{}
+
+// WithCost makes the request cost n tokens instead of one, for adapters that
+// can tell how expensive a request is, e.g. by GraphQL query complexity.
+func WithCost(r *http.Request, n int64) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), costKey{}, n))
+}
+
+// requestCost returns the tokens the request costs, one unless WithCost
+// said otherwise.
+func requestCost(r *http.Request) int64 {
+	if n, ok := r.Context().Value(costKey{}).(int64); ok && n > 0 {
+		return n
+	}
+	return 1
+}
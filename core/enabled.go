@@ -0,0 +1,18 @@
+package core
+
+import (
+	"context"
+)
+
+// EnabledFunc reports whether limits are enforced for a request, given its
+// context, so enforcement can be switched per tenant or route by any
+// feature-flag system without a restart, e.g.
+//
+//	ENABLED: func(ctx context.Context) bool {
+//		route, _ := core.RouteTemplateFromContext(ctx)
+//		return flags.BoolVariation("rate-limit-enforced", tenant(ctx), route, true)
+//	}
+//
+// It runs on every request before anything else, so it must be quick;
+// flag clients that evaluate from a local cache are.
+type EnabledFunc func(ctx context.Context) bool
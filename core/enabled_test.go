@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type tenantKey struct{}
+
+func TestEnabled(t *testing.T) {
+	// Enforced for every tenant but "beta", and never on /internal/*.
+	flag := func(ctx context.Context) bool {
+		route, _ := RouteTemplateFromContext(ctx)
+		return ctx.Value(tenantKey{}) != "beta" && route != "/internal/*"
+	}
+
+	tests := []struct {
+		name        string
+		enabled     EnabledFunc
+		tenant      string
+		route       string
+		wantAllowed bool
+		wantExempt  bool
+	}{
+		{name: "no flag", tenant: "beta", wantAllowed: false},
+		{name: "enforced", enabled: flag, tenant: "acme", wantAllowed: false},
+		{name: "tenant off", enabled: flag, tenant: "beta", wantAllowed: true, wantExempt: true},
+		{name: "route off", enabled: flag, tenant: "acme", route: "/internal/*", wantAllowed: true, wantExempt: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        remoteIP,
+				ENABLED:         test.enabled,
+			})
+			request := func() Decision {
+				r := httptest.NewRequest(http.MethodGet, "/internal/jobs", nil)
+				r = r.WithContext(context.WithValue(r.Context(), tenantKey{}, test.tenant))
+				if test.route != "" {
+					r = WithRouteTemplate(r, test.route)
+				}
+				return limiter.Decide(r)
+			}
+			request()
+
+			d := request()
+			if d.Allowed != test.wantAllowed || d.Exempt != test.wantExempt {
+				t.Fatalf("second request allowed %v, exempt %v", d.Allowed, d.Exempt)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package core
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventKind uint8
+
+const (
+	// A request was allowed.
+	EventAllow EventKind = iota + 1
+	// A request was rejected.
+	EventDeny
+	// A token was added to the bucket shared by unkeyed requests. Keyed
+	// buckets are refilled as they are used and send no events.
+	EventRefill
+	// A key's in-memory bucket was dropped for having refilled, so the key
+	// starts over with a new one. Buckets kept in another STORE send none.
+	EventEvict
+	// A key's requests jumped past its baseline ANOMALY_FACTOR times over,
+	// and it was flagged for ANOMALY_DURATION.
+	EventAnomaly
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventAllow:
+		return "allow"
+	case EventDeny:
+		return "deny"
+	case EventRefill:
+		return "refill"
+	case EventEvict:
+		return "evict"
+	case EventAnomaly:
+		return "anomaly"
+	}
+	return "unknown"
+}
+
+// Event is something that happened to a limiter's buckets.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+	// Bucket key, empty for the shared bucket.
+	Key string
+	// Name of the rule whose bucket it was, e.g. "default" or "bot".
+	Rule       string
+	Remaining  int64
+	RetryAfter time.Duration
+	// Requests of the key in the ANOMALY_INTERVAL it was flagged in, so
+	// far, and its baseline, for EventAnomaly.
+	Rate     float64
+	Baseline float64
+}
+
+type SubscriberConfig struct {
+	// Called for the events of each kind. Kinds left nil aren't sent.
+	ON_ALLOW   func(Event)
+	ON_DENY    func(Event)
+	ON_REFILL  func(Event)
+	ON_EVICT   func(Event)
+	ON_ANOMALY func(Event)
+	// Events held for the subscriber while it is busy. Events arriving
+	// with the buffer full are dropped and counted. Defaults to 1024.
+	BUFFER int
+}
+
+// Subscription receives a limiter's events on a goroutine of its own, so a
+// slow subscriber, e.g. one calling a billing service, drops events rather
+// than delaying requests.
+type Subscription struct {
+	SubscriberConfig
+	// Never closed, as emit may still hold the subscription after Close;
+	// closing tells run to stop instead.
+	events  chan Event
+	closing chan struct{}
+	dropped atomic.Int64
+	bus     *eventBus
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Dropped returns how many events arrived with the buffer full.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close stops the subscription, once the events already buffered have
+// been handled.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.bus.remove(s)
+		close(s.closing)
+		<-s.done
+	})
+}
+
+func (s *Subscription) handler(kind EventKind) func(Event) {
+	switch kind {
+	case EventAllow:
+		return s.ON_ALLOW
+	case EventDeny:
+		return s.ON_DENY
+	case EventRefill:
+		return s.ON_REFILL
+	case EventEvict:
+		return s.ON_EVICT
+	case EventAnomaly:
+		return s.ON_ANOMALY
+	}
+	return nil
+}
+
+func (s *Subscription) run() {
+	defer close(s.done)
+	for {
+		select {
+		case e := <-s.events:
+			s.handler(e.Kind)(e)
+		case <-s.closing:
+			// Handle what was buffered before Close; events emitted
+			// after it are dropped with the subscription.
+			for {
+				select {
+				case e := <-s.events:
+					s.handler(e.Kind)(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// eventBus passes a limiter's events to its subscriptions.
+type eventBus struct {
+	// Copied on write, so emitting takes no lock.
+	subscriptions atomic.Pointer[[]*Subscription]
+	mx            sync.Mutex
+}
+
+func (b *eventBus) add(s *Subscription) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var subscriptions []*Subscription
+	if current := b.subscriptions.Load(); current != nil {
+		subscriptions = append(subscriptions, *current...)
+	}
+	subscriptions = append(subscriptions, s)
+	b.subscriptions.Store(&subscriptions)
+}
+
+func (b *eventBus) remove(s *Subscription) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	var subscriptions []*Subscription
+	for _, other := range *b.subscriptions.Load() {
+		if other != s {
+			subscriptions = append(subscriptions, other)
+		}
+	}
+	b.subscriptions.Store(&subscriptions)
+}
+
+// active reports whether anyone subscribed, so events aren't built for
+// nobody.
+func (b *eventBus) active() bool {
+	subscriptions := b.subscriptions.Load()
+	return subscriptions != nil && len(*subscriptions) > 0
+}
+
+// emit hands e to every subscription wanting its kind, without blocking.
+func (b *eventBus) emit(e Event) {
+	subscriptions := b.subscriptions.Load()
+	if subscriptions == nil {
+		return
+	}
+	for _, s := range *subscriptions {
+		if s.handler(e.Kind) == nil {
+			continue
+		}
+		select {
+		case <-s.closing:
+			continue
+		default:
+		}
+		select {
+		case s.events <- e:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe sends the limiter's events to the config's callbacks until
+// the subscription is closed. Subscriptions outlive SetConfig.
+func (r *rateLimiter) Subscribe(config SubscriberConfig) *Subscription {
+	if config.BUFFER <= 0 {
+		config.BUFFER = 1024
+	}
+	s := &Subscription{
+		SubscriberConfig: config,
+		events:           make(chan Event, config.BUFFER),
+		closing:          make(chan struct{}),
+		bus:              &r.stats.events,
+		done:             make(chan struct{}),
+	}
+	r.stats.events.add(s)
+	go s.run()
+	return s
+}
+
+// emitDecision sends the event for a decision that wasn't exempt.
+func (r *rateLimiter) emitDecision(d Decision) {
+	if !r.stats.events.active() {
+		return
+	}
+	kind := EventDeny
+	if d.Allowed {
+		kind = EventAllow
+	}
+	r.stats.events.emit(Event{
+		Kind:       kind,
+		Time:       time.Now(),
+		Key:        d.Key,
+		Rule:       d.Rule,
+		Remaining:  d.Remaining,
+		RetryAfter: d.RetryAfter,
+	})
+}
+
+// watchEvictions sends an event for every key dropped from the buckets'
+// store, if it is kept in memory.
+func (b *storeBuckets) watchEvictions(events *eventBus, name string) {
+	store, ok := b.store.(*memoryStore)
+	if !ok {
+		return
+	}
+	rule := strings.TrimPrefix(name, "geo ")
+	store.buckets.onEvict = func(key string) {
+		if events.active() {
+			events.emit(Event{Kind: EventEvict, Time: time.Now(), Key: key, Rule: rule})
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventLog collects events from a subscription.
+type eventLog struct {
+	events []Event
+	mx     sync.Mutex
+}
+
+func (l *eventLog) add(e Event) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *eventLog) kinds() []EventKind {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	var kinds []EventKind
+	for _, e := range l.events {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func TestSubscribe(t *testing.T) {
+	keyed := func(r *http.Request) string { return r.Header.Get("X-Client") }
+	request := func(client string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		config RateLimiterConfig
+		do     func(limiter RateLimiter)
+		want   []EventKind
+	}{
+		{
+			name:   "allow and deny",
+			config: RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: keyed},
+			do: func(limiter RateLimiter) {
+				limiter.Decide(request("a"))
+				limiter.Decide(request("a"))
+			},
+			want: []EventKind{EventAllow, EventDeny},
+		},
+		{
+			name:   "refill of the shared bucket",
+			config: RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour},
+			do: func(limiter RateLimiter) {
+				limiter.RefillBucket()
+				// Already full.
+				limiter.RefillBucket()
+			},
+			want: []EventKind{EventRefill},
+		},
+		{
+			name:   "eviction of a refilled key",
+			config: RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Millisecond, KEY_FUNC: keyed},
+			do: func(limiter RateLimiter) {
+				limiter.Decide(request("a"))
+				time.Sleep(5 * time.Millisecond)
+				limiter.Decide(request("b"))
+			},
+			want: []EventKind{EventAllow, EventEvict, EventAllow},
+		},
+	}
+	for _, test := range tests {
+		limiter := New()
+		limiter.SetConfig(test.config)
+		var log eventLog
+		subscription := limiter.Subscribe(SubscriberConfig{ON_ALLOW: log.add, ON_DENY: log.add, ON_REFILL: log.add, ON_EVICT: log.add})
+
+		test.do(limiter)
+		subscription.Close()
+		got := log.kinds()
+		if len(got) != len(test.want) {
+			t.Errorf("%s: got events %v, want %v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: got events %v, want %v", test.name, got, test.want)
+				break
+			}
+		}
+	}
+}
+
+func TestSubscribeOnlyWantedKinds(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return "a" }})
+	var log eventLog
+	subscription := limiter.Subscribe(SubscriberConfig{ON_DENY: log.add})
+
+	limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	subscription.Close()
+
+	if len(log.events) != 1 || log.events[0].Kind != EventDeny || log.events[0].Key != "a" || log.events[0].Rule != "default" {
+		t.Fatalf("got events %+v, want one denial of a", log.events)
+	}
+	if subscription.Dropped() != 0 {
+		t.Fatalf("dropped %d events of kinds not subscribed to", subscription.Dropped())
+	}
+}
+
+func TestSubscribeDropsWhenFull(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 100, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return "a" }})
+	release := make(chan struct{})
+	var handled int
+	subscription := limiter.Subscribe(SubscriberConfig{
+		ON_ALLOW: func(Event) {
+			<-release
+			handled++
+		},
+		BUFFER: 2,
+	})
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("a blocked subscriber held decisions up for %v", elapsed)
+	}
+	close(release)
+	subscription.Close()
+
+	if handled+int(subscription.Dropped()) != 10 || subscription.Dropped() < 7 {
+		t.Fatalf("handled %d and dropped %d of 10 events, want at most 3 handled and the rest dropped", handled, subscription.Dropped())
+	}
+}
+
+func TestSubscribeCloseUnderLoad(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 1000000, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return "a" }})
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+				}
+			}
+		}()
+	}
+	for i := 0; i < 2000; i++ {
+		limiter.Subscribe(SubscriberConfig{ON_ALLOW: func(Event) {}}).Close()
+	}
+	close(stop)
+	wg.Wait()
+}
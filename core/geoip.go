@@ -0,0 +1,76 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+type GeoLocation struct {
+	// ISO 3166-1 alpha-2 country code, e.g. "US".
+	Country string
+	// Autonomous system number of the network the IP belongs to.
+	ASN uint
+}
+
+// GeoLocator resolves an IP to its country and network. The geoip
+// subpackage provides one backed by MaxMind databases.
+type GeoLocator interface {
+	Locate(ip net.IP) (GeoLocation, error)
+}
+
+// LimitProfile is a bucket size and refill interval that replaces the
+// limiter's own for the requests it is selected for.
+type LimitProfile struct {
+	RATE_LIMIT      int64
+	REFILL_INTERVAL time.Duration
+}
+
+// GeoProfiles selects a limit profile by ASN or, failing that, by country.
+type GeoProfiles struct {
+	ASNs      map[uint]LimitProfile
+	Countries map[string]LimitProfile
+}
+
+func (p GeoProfiles) buckets(factory StoreFactory, failure *storeFailure) map[string]*storeBuckets {
+	buckets := map[string]*storeBuckets{}
+	for asn, profile := range p.ASNs {
+		name := fmt.Sprintf("asn:%d", asn)
+		buckets[name] = newStoreBuckets(factory, failure, "geo "+name, profile)
+	}
+	for country, profile := range p.Countries {
+		name := "country:" + country
+		buckets[name] = newStoreBuckets(factory, failure, "geo "+name, profile)
+	}
+	return buckets
+}
+
+// geoBucketsFor returns the buckets and name of the profile matching the
+// client's location, or nil when no profile applies or the lookup fails.
+func (c *limiterState) geoBucketsFor(request *http.Request) (*storeBuckets, string) {
+	if c.GEO_LOCATOR == nil || len(c.geoBuckets) == 0 {
+		return nil, ""
+	}
+
+	ip := net.ParseIP(c.clientIP(request))
+	if ip == nil {
+		return nil, ""
+	}
+	location, err := c.GEO_LOCATOR.Locate(ip)
+	if err != nil {
+		return nil, ""
+	}
+
+	if location.ASN != 0 {
+		profile := fmt.Sprintf("asn:%d", location.ASN)
+		if buckets, ok := c.geoBuckets[profile]; ok {
+			return buckets, profile
+		}
+	}
+	profile := "country:" + location.Country
+	if buckets, ok := c.geoBuckets[profile]; ok {
+		return buckets, profile
+	}
+	return nil, ""
+}
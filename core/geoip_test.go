@@ -0,0 +1,65 @@
+package core
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeLocator locates IPs from a fixed table.
+type fakeLocator map[string]GeoLocation
+
+func (l fakeLocator) Locate(ip net.IP) (GeoLocation, error) {
+	location, ok := l[ip.String()]
+	if !ok {
+		return GeoLocation{}, errors.New("not found")
+	}
+	return location, nil
+}
+
+func TestGeoProfiles(t *testing.T) {
+	locator := fakeLocator{
+		"203.0.113.1": {Country: "US", ASN: 64500},
+		"203.0.113.2": {Country: "US", ASN: 64501},
+		"203.0.113.3": {Country: "DE", ASN: 64502},
+	}
+	profiles := GeoProfiles{
+		ASNs:      map[uint]LimitProfile{64500: {RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour}},
+		Countries: map[string]LimitProfile{"US": {RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour}},
+	}
+
+	tests := []struct {
+		name      string
+		ip        string
+		wantRule  string
+		wantLimit int64
+	}{
+		{name: "ASN first", ip: "203.0.113.1", wantRule: "geo asn:64500", wantLimit: 1},
+		{name: "country", ip: "203.0.113.2", wantRule: "geo country:US", wantLimit: 2},
+		{name: "no profile", ip: "203.0.113.3", wantRule: "default", wantLimit: 5},
+		{name: "lookup fails", ip: "203.0.113.4", wantRule: "default", wantLimit: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      5,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        remoteIP,
+				GEO_LOCATOR:     locator,
+				GEO_PROFILES:    profiles,
+			})
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = test.ip + ":1234"
+
+			d := limiter.Decide(r)
+			if d.Rule != test.wantRule || d.Limit != test.wantLimit {
+				t.Fatalf("rule %q with limit %d, want %q with limit %d", d.Rule, d.Limit, test.wantRule, test.wantLimit)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// HeaderPolicy controls the rate limit headers written on responses. An
+// empty header name suppresses that header, e.g. for teams that must not
+// reveal their limits to clients.
+type HeaderPolicy struct {
+	// Bucket size, written on every limited response.
+	Limit string
+	// Tokens left, written on every limited response.
+	Remaining string
+	// Time until a token frees up, written on rejected responses.
+	RetryAfter string
+	// Written on allowed responses past SOFT_LIMIT_THRESHOLD.
+	Warning string
+	// Static headers added to every limited response, e.g. a link to the
+	// API's rate limit documentation.
+	Extra map[string]string
+}
+
+var DefaultHeaderPolicy = HeaderPolicy{
+	Remaining:  "X-RateLimit-Remaining",
+	RetryAfter: "Retry-After",
+	Warning:    "X-RateLimit-Warning",
+}
+
+// HeaderSetter receives each header VisitHeaders produces. value is only
+// valid for the duration of the call.
+type HeaderSetter func(name string, value []byte)
+
+// headerBufs holds the scratch buffers header values are formatted into,
+// so VisitHeaders doesn't allocate.
+var headerBufs = sync.Pool{
+	New: func() interface{} { return new([128]byte) },
+}
+
+func (p *HeaderPolicy) visit(d Decision, buf []byte, set HeaderSetter) {
+	if p.Limit != "" {
+		set(p.Limit, strconv.AppendInt(buf, d.Limit, 10))
+	}
+	if p.Remaining != "" {
+		set(p.Remaining, strconv.AppendInt(buf, d.Remaining, 10))
+	}
+	if !d.Allowed && p.RetryAfter != "" {
+		value := strconv.AppendFloat(buf, d.RetryAfter.Seconds(), 'f', 6, 64)
+		set(p.RetryAfter, append(value, " second"...))
+	}
+	if d.Warning && p.Warning != "" {
+		used := 100 * (d.Limit - d.Remaining) / d.Limit
+		value := strconv.AppendInt(buf, used, 10)
+		set(p.Warning, append(value, "% of rate limit used"...))
+	}
+	for name, value := range p.Extra {
+		set(name, append(buf, value...))
+	}
+}
+
+// WriteHeaders writes the HEADER_POLICY headers and, if enabled, the debug
+// headers.
+func (r *rateLimiter) WriteHeaders(h http.Header, d Decision) {
+	r.VisitHeaders(d, func(name string, value []byte) {
+		h.Set(name, string(value))
+	})
+}
+
+// HashKey returns the short hash shown instead of a raw key, such as a
+// client IP or session, in debug headers and status events.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// VisitHeaders passes the headers WriteHeaders would write to set, without
+// allocating, for adapters of servers that don't use http.Header.
+func (r *rateLimiter) VisitHeaders(d Decision, set HeaderSetter) {
+	c := r.config()
+	array := headerBufs.Get().(*[128]byte)
+	defer headerBufs.Put(array)
+	buf := array[:0]
+
+	c.HEADER_POLICY.visit(d, buf, set)
+	if !c.DEBUG_HEADERS {
+		return
+	}
+
+	key := append(buf, d.Key...)
+	if !c.DEBUG_RAW_KEYS {
+		sum := sha256.Sum256(key)
+		key = hex.AppendEncode(buf, sum[:8])
+	}
+	set("X-RateLimit-Key", key)
+	set("X-RateLimit-Rule", append(buf, d.Rule...))
+}
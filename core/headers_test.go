@@ -0,0 +1,92 @@
+package core
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestWriteHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   *HeaderPolicy
+		decision Decision
+		want     http.Header
+	}{
+		{
+			name:     "default allowed",
+			decision: Decision{Allowed: true, Limit: 10, Remaining: 4},
+			want:     http.Header{"X-Ratelimit-Remaining": {"4"}},
+		},
+		{
+			name:     "default rejected",
+			decision: Decision{Limit: 10, RetryAfter: 1500 * time.Millisecond},
+			want:     http.Header{"X-Ratelimit-Remaining": {"0"}, "Retry-After": {"1.500000 second"}},
+		},
+		{
+			name:     "default warning",
+			decision: Decision{Allowed: true, Warning: true, Limit: 10, Remaining: 1},
+			want:     http.Header{"X-Ratelimit-Remaining": {"1"}, "X-Ratelimit-Warning": {"90% of rate limit used"}},
+		},
+		{
+			name:     "renamed and extra",
+			policy:   &HeaderPolicy{Limit: "RateLimit-Limit", Remaining: "RateLimit-Remaining", Extra: map[string]string{"Link": "</docs/limits>"}},
+			decision: Decision{Allowed: true, Limit: 10, Remaining: 4},
+			want:     http.Header{"Ratelimit-Limit": {"10"}, "Ratelimit-Remaining": {"4"}, "Link": {"</docs/limits>"}},
+		},
+		{
+			name:     "suppressed",
+			policy:   &HeaderPolicy{},
+			decision: Decision{Limit: 10, RetryAfter: time.Second},
+			want:     http.Header{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 10, REFILL_INTERVAL: time.Second, HEADER_POLICY: test.policy})
+
+			got := http.Header{}
+			limiter.WriteHeaders(got, test.decision)
+			if len(got) != len(test.want) {
+				t.Fatalf("headers %v, want %v", got, test.want)
+			}
+			for name := range test.want {
+				if got.Get(name) != test.want.Get(name) {
+					t.Fatalf("%s = %q, want %q", name, got.Get(name), test.want.Get(name))
+				}
+			}
+		})
+	}
+}
+
+func TestDebugHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		debug    bool
+		raw      bool
+		wantKey  string
+		wantRule string
+	}{
+		{name: "off"},
+		{name: "hashed", debug: true, wantKey: HashKey("203.0.113.7"), wantRule: "default"},
+		{name: "raw", debug: true, raw: true, wantKey: "203.0.113.7", wantRule: "default"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 10, REFILL_INTERVAL: time.Second, DEBUG_HEADERS: test.debug, DEBUG_RAW_KEYS: test.raw})
+
+			h := http.Header{}
+			limiter.WriteHeaders(h, Decision{Key: "203.0.113.7", Rule: "default", Allowed: true, Limit: 10, Remaining: 9})
+			if got := h.Get("X-RateLimit-Key"); got != test.wantKey {
+				t.Fatalf("X-RateLimit-Key = %q, want %q", got, test.wantKey)
+			}
+			if got := h.Get("X-RateLimit-Rule"); got != test.wantRule {
+				t.Fatalf("X-RateLimit-Rule = %q, want %q", got, test.wantRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package core
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// heavyHitterSlots is how many parts TOP_KEYS_WINDOW is split into. The
+// oldest part is dropped as each new one starts, so the counts cover
+// between five sixths of the window and all of it.
+const heavyHitterSlots = 6
+
+const defaultTopKeysWindow = 5 * time.Minute
+
+// heavyHitters counts denials per key over a rolling window in bounded
+// memory, keeping maxTrackedKeys keys per part of the window.
+type heavyHitters struct {
+	window time.Duration
+	slots  [heavyHitterSlots]spaceSaving
+	// Number of the part of the window the current slot counts, since the
+	// zero time.
+	epoch int64
+	mx    sync.Mutex
+}
+
+// setWindow starts the counts over if the window changed.
+func (h *heavyHitters) setWindow(window time.Duration) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if window == h.window {
+		return
+	}
+	h.window = window
+	h.epoch = 0
+	for i := range h.slots {
+		h.slots[i] = spaceSaving{}
+	}
+}
+
+func (h *heavyHitters) add(key string, now time.Time) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.rotate(now)
+	h.slots[h.epoch%heavyHitterSlots].add(key)
+}
+
+// top returns up to n keys with the most denials in the window, most
+// first. Counts are estimates: a key may be counted up to the smallest
+// count of a part of the window it was missing from, never fewer than it
+// had.
+func (h *heavyHitters) top(n int, now time.Time) []KeyCount {
+	h.mx.Lock()
+	h.rotate(now)
+	counts := map[string]int64{}
+	for i := range h.slots {
+		for _, hitter := range h.slots[i].heap {
+			counts[hitter.key] += hitter.count
+		}
+	}
+	h.mx.Unlock()
+
+	top := make([]KeyCount, 0, len(counts))
+	for key, count := range counts {
+		top = append(top, KeyCount{Key: key, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// rotate clears the slots of the parts of the window that passed since
+// the last call.
+func (h *heavyHitters) rotate(now time.Time) {
+	epoch := now.UnixNano() / int64(max(h.window/heavyHitterSlots, 1))
+	for e := max(h.epoch+1, epoch-heavyHitterSlots+1); e <= epoch; e++ {
+		h.slots[e%heavyHitterSlots] = spaceSaving{}
+	}
+	h.epoch = max(h.epoch, epoch)
+}
+
+// spaceSaving is the Space-Saving summary of Metwally et al.: once full,
+// a new key takes the place of the key counted least, inheriting its
+// count, so frequent keys are never lost however many rare ones pass.
+type spaceSaving struct {
+	hitters map[string]*hitter
+	heap    hitterHeap
+}
+
+type hitter struct {
+	key   string
+	count int64
+	index int
+}
+
+func (s *spaceSaving) add(key string) {
+	if hitter, ok := s.hitters[key]; ok {
+		hitter.count++
+		heap.Fix(&s.heap, hitter.index)
+		return
+	}
+	if s.hitters == nil {
+		s.hitters = map[string]*hitter{}
+	}
+	if len(s.heap) < maxTrackedKeys {
+		h := &hitter{key: key, count: 1}
+		s.hitters[key] = h
+		heap.Push(&s.heap, h)
+		return
+	}
+
+	least := s.heap[0]
+	delete(s.hitters, least.key)
+	least.key = key
+	least.count++
+	s.hitters[key] = least
+	heap.Fix(&s.heap, 0)
+}
+
+// hitterHeap is a min-heap of hitters by count.
+type hitterHeap []*hitter
+
+func (h hitterHeap) Len() int           { return len(h) }
+func (h hitterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h hitterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hitterHeap) Push(x interface{}) {
+	hitter := x.(*hitter)
+	hitter.index = len(*h)
+	*h = append(*h, hitter)
+}
+
+func (h *hitterHeap) Pop() interface{} {
+	old := *h
+	hitter := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return hitter
+}
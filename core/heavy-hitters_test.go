@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHeavyHitters(t *testing.T) {
+	start := time.Unix(6000, 0)
+	tests := []struct {
+		name string
+		// Denials added, every key once per step, a step every ten seconds.
+		steps [][]string
+		// Extra one-off keys added with the first step.
+		flood int
+		at    time.Duration
+		want  []KeyCount
+	}{
+		{
+			// Overcounted by the five denials of the key it replaced.
+			name:  "frequent key survives a flood",
+			steps: [][]string{{"attacker"}, {"attacker"}, {"attacker"}},
+			flood: 5 * maxTrackedKeys,
+			at:    30 * time.Second,
+			want:  []KeyCount{{Key: "attacker", Count: 8}},
+		},
+		{
+			name:  "ranked by denials",
+			steps: [][]string{{"a", "b"}, {"b"}, {"b", "c"}, {"c"}},
+			at:    40 * time.Second,
+			want:  []KeyCount{{Key: "b", Count: 3}, {Key: "c", Count: 2}},
+		},
+		{
+			name:  "old denials roll off",
+			steps: [][]string{{"a", "b"}, {"b"}},
+			at:    time.Minute + 5*time.Second,
+			want:  []KeyCount{{Key: "b", Count: 1}},
+		},
+		{
+			name:  "window passed",
+			steps: [][]string{{"a"}},
+			at:    2 * time.Minute,
+			want:  []KeyCount{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var h heavyHitters
+			h.setWindow(time.Minute)
+			for i := 0; i < test.flood; i++ {
+				h.add(fmt.Sprint("spoofed-", i), start)
+			}
+			for i, keys := range test.steps {
+				for _, key := range keys {
+					h.add(key, start.Add(time.Duration(i)*10*time.Second))
+				}
+			}
+
+			got := h.top(len(test.want), start.Add(test.at))
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Fatalf("top %v, want %v", got, test.want)
+			}
+		})
+	}
+}
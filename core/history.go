@@ -0,0 +1,141 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// historyPoints is how many points each series of StatsHistory holds.
+const historyPoints = 60
+
+// StatsHistory is the decisions of the last minute by second and of the
+// last hour by minute, for sparklines without a metrics stack. Exempt
+// decisions aren't counted.
+type StatsHistory struct {
+	// Oldest first; the last point is the second or minute under way.
+	Seconds []HistoryPoint
+	Minutes []HistoryPoint
+	// The same by rule, e.g. "default" or "bot", with HISTORY_BY_RULE.
+	Rules map[string]RuleHistory `json:",omitempty"`
+}
+
+type RuleHistory struct {
+	Seconds []HistoryPoint
+	Minutes []HistoryPoint
+}
+
+type HistoryPoint struct {
+	// Start of the second or minute.
+	Time    time.Time
+	Allowed int64
+	Denied  int64
+}
+
+// history keeps a limiter's StatsHistory in ring buffers.
+type history struct {
+	seconds historyRing
+	minutes historyRing
+	byRule  bool
+	rules   map[string]*ruleRings
+	mx      sync.Mutex
+}
+
+type ruleRings struct {
+	seconds historyRing
+	minutes historyRing
+}
+
+// historyRing counts decisions by period, overwriting the oldest.
+type historyRing struct {
+	points [historyPoints]historySlot
+}
+
+type historySlot struct {
+	// Number of the period counted, since the zero time.
+	epoch   int64
+	allowed int64
+	denied  int64
+}
+
+func (h *history) setByRule(byRule bool) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.byRule = byRule
+	if !byRule {
+		h.rules = nil
+	}
+}
+
+func (h *history) record(d Decision, now time.Time) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.seconds.add(now, time.Second, d.Allowed)
+	h.minutes.add(now, time.Minute, d.Allowed)
+	if !h.byRule {
+		return
+	}
+	if h.rules == nil {
+		h.rules = map[string]*ruleRings{}
+	}
+	rule, ok := h.rules[d.Rule]
+	if !ok {
+		rule = &ruleRings{}
+		h.rules[d.Rule] = rule
+	}
+	rule.seconds.add(now, time.Second, d.Allowed)
+	rule.minutes.add(now, time.Minute, d.Allowed)
+}
+
+func (h *history) snapshot(now time.Time) *StatsHistory {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	s := &StatsHistory{
+		Seconds: h.seconds.series(now, time.Second),
+		Minutes: h.minutes.series(now, time.Minute),
+	}
+	if len(h.rules) > 0 {
+		s.Rules = make(map[string]RuleHistory, len(h.rules))
+		for name, rule := range h.rules {
+			s.Rules[name] = RuleHistory{
+				Seconds: rule.seconds.series(now, time.Second),
+				Minutes: rule.minutes.series(now, time.Minute),
+			}
+		}
+	}
+	return s
+}
+
+func (r *historyRing) add(now time.Time, period time.Duration, allowed bool) {
+	epoch := now.UnixNano() / int64(period)
+	slot := &r.points[epoch%historyPoints]
+	if slot.epoch > epoch {
+		// Older than the series.
+		return
+	}
+	if slot.epoch != epoch {
+		*slot = historySlot{epoch: epoch}
+	}
+	if allowed {
+		slot.allowed++
+	} else {
+		slot.denied++
+	}
+}
+
+// series returns the points of the periods up to now, zero for those
+// nothing was counted in.
+func (r *historyRing) series(now time.Time, period time.Duration) []HistoryPoint {
+	current := now.UnixNano() / int64(period)
+	points := make([]HistoryPoint, historyPoints)
+	for i := range points {
+		epoch := current - historyPoints + 1 + int64(i)
+		points[i].Time = time.Unix(0, epoch*int64(period))
+		if slot := r.points[epoch%historyPoints]; slot.epoch == epoch {
+			points[i].Allowed, points[i].Denied = slot.allowed, slot.denied
+		}
+	}
+	return points
+}
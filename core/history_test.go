@@ -0,0 +1,84 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+type agoDecision struct {
+	ago time.Duration
+	Decision
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Unix(36030, 0)
+	tests := []struct {
+		name   string
+		byRule bool
+		// Decisions made before now, oldest first.
+		decisions []agoDecision
+		// Point of the series, counted from the end, and its counts.
+		wantSecond  map[int][2]int64
+		wantMinute  map[int][2]int64
+		wantBotRule bool
+	}{
+		{
+			name: "by second and minute",
+			decisions: []agoDecision{
+				{2 * time.Minute, Decision{Allowed: true, Rule: "default"}},
+				{59 * time.Second, Decision{Allowed: true, Rule: "default"}},
+				{time.Second, Decision{Rule: "default"}},
+				{0, Decision{Allowed: true, Rule: "default"}},
+			},
+			wantSecond: map[int][2]int64{0: {1, 0}, 1: {0, 1}, 59: {1, 0}},
+			wantMinute: map[int][2]int64{0: {1, 1}, 1: {1, 0}, 2: {1, 0}},
+		},
+		{
+			name:       "older than the series",
+			decisions:  []agoDecision{{2 * time.Hour, Decision{Rule: "default"}}},
+			wantSecond: map[int][2]int64{},
+			wantMinute: map[int][2]int64{},
+		},
+		{
+			name:        "by rule",
+			byRule:      true,
+			decisions:   []agoDecision{{0, Decision{Rule: "bot"}}},
+			wantSecond:  map[int][2]int64{0: {0, 1}},
+			wantMinute:  map[int][2]int64{0: {0, 1}},
+			wantBotRule: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var h history
+			h.setByRule(test.byRule)
+			for _, d := range test.decisions {
+				h.record(d.Decision, now.Add(-d.ago))
+			}
+			got := h.snapshot(now)
+
+			for name, series := range map[string]struct {
+				points []HistoryPoint
+				want   map[int][2]int64
+				period time.Duration
+			}{
+				"seconds": {got.Seconds, test.wantSecond, time.Second},
+				"minutes": {got.Minutes, test.wantMinute, time.Minute},
+			} {
+				if len(series.points) != historyPoints || !series.points[len(series.points)-1].Time.Equal(now.Truncate(series.period)) {
+					t.Fatalf("%s: %d points ending %v", name, len(series.points), series.points[len(series.points)-1].Time)
+				}
+				for i, point := range series.points {
+					want := series.want[len(series.points)-1-i]
+					if point.Allowed != want[0] || point.Denied != want[1] {
+						t.Errorf("%s: point %d counts %d allowed, %d denied, want %v", name, i, point.Allowed, point.Denied, want)
+					}
+				}
+			}
+			if _, ok := got.Rules["bot"]; ok != test.wantBotRule {
+				t.Errorf("rules %v, want bot %v", got.Rules, test.wantBotRule)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyLists are the keys let through or turned away regardless of their
+// buckets.
+type KeyLists struct {
+	Allowed []string
+	// Denied keys by when they are let back in; the zero time means never.
+	Denied map[string]time.Time
+}
+
+// keyLists holds the allow and deny lists. They outlive SetConfig.
+type keyLists struct {
+	allowed map[string]struct{}
+	denied  map[string]time.Time
+	mx      sync.RWMutex
+}
+
+func newKeyLists() *keyLists {
+	return &keyLists{allowed: map[string]struct{}{}, denied: map[string]time.Time{}}
+}
+
+// check reports whether key is allowed or denied by the lists, and until
+// when a denied key stays denied.
+func (l *keyLists) check(key string, now time.Time) (allowed, denied bool, until time.Time) {
+	l.mx.RLock()
+	defer l.mx.RUnlock()
+
+	if len(l.allowed) == 0 && len(l.denied) == 0 {
+		return false, false, time.Time{}
+	}
+	if _, ok := l.allowed[key]; ok {
+		return true, false, time.Time{}
+	}
+	until, denied = l.denied[key]
+	if denied && !until.IsZero() && !now.Before(until) {
+		return false, false, time.Time{}
+	}
+	return false, denied, until
+}
+
+// AllowKey lets every request of key through without charging it, e.g.
+// for a partner's integration, until UnlistKey.
+func (r *rateLimiter) AllowKey(key string) {
+	c := r.config()
+	key = c.normalizeKey(key)
+	r.lists.mx.Lock()
+	defer r.lists.mx.Unlock()
+
+	delete(r.lists.denied, key)
+	r.lists.allowed[key] = struct{}{}
+}
+
+// DenyKey rejects every request of key for d, or until UnlistKey if d
+// isn't positive, with the rule "denylist".
+func (r *rateLimiter) DenyKey(key string, d time.Duration) {
+	c := r.config()
+	key = c.normalizeKey(key)
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
+	}
+	r.lists.mx.Lock()
+	defer r.lists.mx.Unlock()
+
+	delete(r.lists.allowed, key)
+	r.lists.denied[key] = until
+}
+
+// UnlistKey takes key off the allow and deny lists.
+func (r *rateLimiter) UnlistKey(key string) {
+	c := r.config()
+	key = c.normalizeKey(key)
+	r.lists.mx.Lock()
+	defer r.lists.mx.Unlock()
+
+	delete(r.lists.allowed, key)
+	delete(r.lists.denied, key)
+}
+
+// KeyLists returns the allowed and denied keys, expired denials left out.
+func (r *rateLimiter) KeyLists() KeyLists {
+	r.lists.mx.Lock()
+	defer r.lists.mx.Unlock()
+
+	now := time.Now()
+	lists := KeyLists{Allowed: []string{}, Denied: map[string]time.Time{}}
+	for key := range r.lists.allowed {
+		lists.Allowed = append(lists.Allowed, key)
+	}
+	sort.Strings(lists.Allowed)
+	for key, until := range r.lists.denied {
+		if !until.IsZero() && !now.Before(until) {
+			delete(r.lists.denied, key)
+			continue
+		}
+		lists.Denied[key] = until
+	}
+	return lists
+}
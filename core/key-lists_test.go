@@ -0,0 +1,74 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeyLists(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	decide := func(client string) Decision {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		return limiter.Decide(r)
+	}
+
+	steps := []struct {
+		name        string
+		do          func()
+		client      string
+		wantAllowed bool
+		wantRule    string
+	}{
+		{name: "first request", client: "a", wantAllowed: true, wantRule: "default"},
+		{name: "empty bucket", client: "a", wantAllowed: false, wantRule: "default"},
+		{name: "allowed key", do: func() { limiter.AllowKey("a") }, client: "a", wantAllowed: true, wantRule: "allowlist"},
+		{name: "denied key", do: func() { limiter.DenyKey("a", 0) }, client: "a", wantAllowed: false, wantRule: "denylist"},
+		{name: "unlisted key", do: func() { limiter.UnlistKey("a") }, client: "a", wantAllowed: false, wantRule: "default"},
+		{name: "expired denial", do: func() { limiter.DenyKey("b", time.Nanosecond); time.Sleep(time.Millisecond) }, client: "b", wantAllowed: true, wantRule: "default"},
+	}
+	for _, step := range steps {
+		if step.do != nil {
+			step.do()
+		}
+		d := decide(step.client)
+		if d.Allowed != step.wantAllowed || d.Rule != step.wantRule {
+			t.Fatalf("%s: allowed %v by %q, want %v by %q", step.name, d.Allowed, d.Rule, step.wantAllowed, step.wantRule)
+		}
+	}
+
+	limiter.DenyKey("c", time.Minute)
+	lists := limiter.KeyLists()
+	if _, ok := lists.Denied["c"]; !ok || len(lists.Denied) != 1 || len(lists.Allowed) != 0 {
+		t.Fatalf("lists %+v, want only c denied", lists)
+	}
+}
+
+func TestKeys(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:      3,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	})
+	for _, client := range []string{"b", "a", "a"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		limiter.Decide(r)
+	}
+
+	keys := limiter.Keys()
+	if len(keys) != 2 || keys[0].Key != "a" || keys[1].Key != "b" {
+		t.Fatalf("keys %+v, want a then b", keys)
+	}
+	if got := limiter.InspectKey("a"); len(got) != 1 || got[0].Set != "default" || int(got[0].Tokens) != 1 || got[0].Limit != 3 {
+		t.Fatalf("InspectKey(a) = %+v, want one token of three in the default set", got)
+	}
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// KeyNormalizer rewrites a key so that requests from the same caller end up
+// in the same bucket.
+type KeyNormalizer func(key string) string
+
+// StripPort removes the port from keys of the form host:port.
+func StripPort(key string) string {
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		return host
+	}
+	return key
+}
+
+// LowercaseKey folds the key to lower case, e.g. for case-insensitive API
+// keys or usernames.
+func LowercaseKey(key string) string {
+	return strings.ToLower(key)
+}
+
+// IPv6Prefix groups IPv6 addresses by their first bits, since a single
+// client usually controls a whole /64 and could otherwise switch addresses
+// to get a fresh bucket. Other keys are left alone. It panics on bits
+// outside 0 to 128, which would put every IPv6 client in one bucket.
+func IPv6Prefix(bits int) KeyNormalizer {
+	mask := net.CIDRMask(bits, 8*net.IPv6len)
+	if mask == nil {
+		panic(fmt.Sprintf("ratelimiter: IPv6Prefix: %d bits isn't between 0 and 128", bits))
+	}
+
+	return func(key string) string {
+		ip := net.ParseIP(strings.Trim(key, "[]"))
+		if ip == nil || ip.To4() != nil {
+			return key
+		}
+		return fmt.Sprintf("%s/%d", ip.Mask(mask), bits)
+	}
+}
+
+// key returns the normalized key for the request.
+func (c *limiterState) key(request *http.Request) string {
+	return c.normalizeKey(c.keyFunc(request))
+}
+
+// normalizeKey applies KEY_NORMALIZERS, so keys passed in by hand, e.g. to
+// ResetKey, match the buckets of the requests they came from.
+func (c *limiterState) normalizeKey(key string) string {
+	for _, normalize := range c.KEY_NORMALIZERS {
+		key = normalize(key)
+	}
+	return key
+}
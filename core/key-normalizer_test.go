@@ -0,0 +1,82 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestKeyNormalizers(t *testing.T) {
+	tests := []struct {
+		name      string
+		normalize KeyNormalizer
+		key       string
+		want      string
+	}{
+		{name: "strip IPv4 port", normalize: StripPort, key: "203.0.113.7:1234", want: "203.0.113.7"},
+		{name: "strip IPv6 port", normalize: StripPort, key: "[2001:db8::1]:1234", want: "2001:db8::1"},
+		{name: "no port", normalize: StripPort, key: "203.0.113.7", want: "203.0.113.7"},
+		{name: "lowercase", normalize: LowercaseKey, key: "Alice@Example.COM", want: "alice@example.com"},
+		{name: "IPv6 /64", normalize: IPv6Prefix(64), key: "2001:db8:1:2:3:4:5:6", want: "2001:db8:1:2::/64"},
+		{name: "bracketed IPv6", normalize: IPv6Prefix(48), key: "[2001:db8:1:2::9]", want: "2001:db8:1::/48"},
+		{name: "full IPv6", normalize: IPv6Prefix(128), key: "2001:db8::9", want: "2001:db8::9/128"},
+		{name: "IPv4 left alone", normalize: IPv6Prefix(64), key: "203.0.113.7", want: "203.0.113.7"},
+		{name: "non-IP left alone", normalize: IPv6Prefix(64), key: "alice", want: "alice"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.normalize(test.key); got != test.want {
+				t.Fatalf("normalized %q to %q, want %q", test.key, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIPv6PrefixBadBits(t *testing.T) {
+	for _, bits := range []int{-1, 129} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("IPv6Prefix(%d) didn't panic", bits)
+				}
+			}()
+			IPv6Prefix(bits)
+		}()
+	}
+}
+
+func TestKeyNormalizersReset(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.RemoteAddr },
+		KEY_NORMALIZERS: []KeyNormalizer{StripPort, IPv6Prefix(64)},
+	})
+	decide := func(remoteAddr string) Decision {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remoteAddr
+		return limiter.Decide(r)
+	}
+
+	steps := []struct {
+		name        string
+		do          func()
+		remoteAddr  string
+		wantAllowed bool
+	}{
+		{name: "first request", remoteAddr: "[2001:db8::1]:1234", wantAllowed: true},
+		{name: "same /64, other address and port", remoteAddr: "[2001:db8::2]:5678", wantAllowed: false},
+		{name: "other /64", remoteAddr: "[2001:db8:0:1::1]:1234", wantAllowed: true},
+		{name: "reset by raw key", do: func() { limiter.ResetKey("[2001:db8::3]:80") }, remoteAddr: "[2001:db8::1]:1234", wantAllowed: true},
+	}
+	for _, step := range steps {
+		if step.do != nil {
+			step.do()
+		}
+		if d := decide(step.remoteAddr); d.Allowed != step.wantAllowed {
+			t.Fatalf("%s: allowed %v with key %q, want %v", step.name, d.Allowed, d.Key, step.wantAllowed)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package core
+
+import (
+	"sort"
+	"time"
+)
+
+// KeyStatus is the state of one key's in-memory bucket.
+type KeyStatus struct {
+	Key string
+	// Name of the set of buckets it is in, e.g. "default" or "bot".
+	Set string
+	// Tokens as of now, refill included.
+	Tokens float64
+	Limit  int64
+	// When the key last drew on its bucket.
+	LastSeen    time.Time
+	LockedUntil time.Time `json:",omitempty"`
+}
+
+// Keys returns the state of every key with an in-memory bucket, sorted by
+// set and key. Buckets kept in another STORE aren't listed.
+func (r *rateLimiter) Keys() []KeyStatus {
+	c := r.config()
+	if c.keyBuckets == nil {
+		return nil
+	}
+	var keys []KeyStatus
+	now := time.Now()
+	for name, buckets := range c.namedBuckets() {
+		if store, ok := buckets.store.(*memoryStore); ok {
+			keys = append(keys, store.buckets.statuses(name, now)...)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Set != keys[j].Set {
+			return keys[i].Set < keys[j].Set
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	return keys
+}
+
+// InspectKey returns the state of key's in-memory buckets, one per set it
+// has drawn on.
+func (r *rateLimiter) InspectKey(key string) []KeyStatus {
+	c := r.config()
+	key = c.normalizeKey(key)
+	var statuses []KeyStatus
+	for _, status := range r.Keys() {
+		if status.Key == key {
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// statuses returns the state of every bucket as of now, without
+// refilling them.
+func (b *keyedBuckets) statuses(set string, now time.Time) []KeyStatus {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	statuses := make([]KeyStatus, 0, len(b.buckets))
+	for key, bucket := range b.buckets {
+		tokens := bucket.tokens
+		if b.interval > 0 {
+			tokens = min(tokens+float64(now.Sub(bucket.lastRefill))/b.perToken, float64(b.limit))
+		}
+		statuses = append(statuses, KeyStatus{
+			Key:         key,
+			Set:         set,
+			Tokens:      tokens,
+			Limit:       b.limit,
+			LastSeen:    bucket.lastRefill,
+			LockedUntil: bucket.lockedUntil,
+		})
+	}
+	return statuses
+}
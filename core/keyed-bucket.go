@@ -0,0 +1,231 @@
+package core
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// keyBucket is a lazily refilled token bucket for a single key.
+type keyBucket struct {
+	tokens      float64
+	lastRefill  time.Time
+	lockedUntil time.Time
+}
+
+// keyedBuckets holds one bucket per key. Tokens are added at a rate of one per
+// interval up to limit, computed on access instead of by a ticker per key.
+type keyedBuckets struct {
+	limit    int64
+	interval time.Duration
+	// interval in nanoseconds, kept exact for rates finer than 1ns.
+	perToken  float64
+	buckets   map[string]*keyBucket
+	lastSweep time.Time
+	// Called with every key sweep drops, under b.mx.
+	onEvict func(key string)
+	mx      sync.Mutex
+}
+
+func newKeyedBuckets(limit int64, interval time.Duration) *keyedBuckets {
+	return &keyedBuckets{
+		limit:     limit,
+		interval:  interval,
+		perToken:  float64(interval),
+		buckets:   map[string]*keyBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// newRateBuckets returns keyed buckets gaining perSecond tokens a second,
+// exactly even for rates above one token per nanosecond.
+func newRateBuckets(limit, perSecond int64) *keyedBuckets {
+	perToken := float64(time.Second) / float64(perSecond)
+	b := newKeyedBuckets(limit, max(time.Duration(perToken), 1))
+	b.perToken = perToken
+	return b
+}
+
+// get returns the refilled bucket for key, creating a full one if needed.
+// The caller must hold b.mx.
+func (b *keyedBuckets) get(key string, now time.Time) *keyBucket {
+	b.sweep(now)
+
+	bucket, ok := b.buckets[key]
+	if !ok {
+		bucket = &keyBucket{tokens: float64(b.limit), lastRefill: now}
+		b.buckets[key] = bucket
+		return bucket
+	}
+
+	if b.interval > 0 {
+		bucket.tokens += float64(now.Sub(bucket.lastRefill)) / b.perToken
+		if bucket.tokens > float64(b.limit) {
+			bucket.tokens = float64(b.limit)
+		}
+	}
+	bucket.lastRefill = now
+	return bucket
+}
+
+// sweep drops buckets that are full and unlocked, since they are
+// indistinguishable from new ones. The caller must hold b.mx.
+func (b *keyedBuckets) sweep(now time.Time) {
+	if b.interval <= 0 || now.Sub(b.lastSweep) < b.interval*time.Duration(b.limit+1) {
+		return
+	}
+	b.lastSweep = now
+
+	for key, bucket := range b.buckets {
+		elapsed := float64(now.Sub(bucket.lastRefill)) / b.perToken
+		if bucket.tokens+elapsed >= float64(b.limit) && now.After(bucket.lockedUntil) {
+			delete(b.buckets, key)
+			if b.onEvict != nil {
+				b.onEvict(key)
+			}
+		}
+	}
+}
+
+// retryAfter returns how long until the bucket holds n tokens.
+func (b *keyedBuckets) retryAfter(bucket *keyBucket, n int64) time.Duration {
+	missing := float64(n) - bucket.tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing * b.perToken)
+}
+
+// take removes n tokens from the bucket for key if they are available.
+func (b *keyedBuckets) take(key string, n int64) (allowed bool, remaining int64, retryAfter time.Duration) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	bucket := b.get(key, now)
+
+	if now.Before(bucket.lockedUntil) {
+		return false, 0, bucket.lockedUntil.Sub(now)
+	}
+	if bucket.tokens < float64(n) {
+		return false, int64(bucket.tokens), b.retryAfter(bucket, n)
+	}
+
+	bucket.tokens -= float64(n)
+	return true, int64(bucket.tokens), 0
+}
+
+// refund hands back n tokens taken for key that ended up unused.
+func (b *keyedBuckets) refund(key string, n int64) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	bucket := b.get(key, time.Now())
+	bucket.tokens += float64(n)
+	if bucket.tokens > float64(b.limit) {
+		bucket.tokens = float64(b.limit)
+	}
+}
+
+// peek reports whether n tokens are available for key without taking them.
+func (b *keyedBuckets) peek(key string, n int64) (allowed bool, remaining int64, retryAfter time.Duration) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	bucket := b.get(key, now)
+
+	if now.Before(bucket.lockedUntil) {
+		return false, 0, bucket.lockedUntil.Sub(now)
+	}
+	if bucket.tokens < float64(n) {
+		return false, int64(bucket.tokens), b.retryAfter(bucket, n)
+	}
+	return true, int64(bucket.tokens), 0
+}
+
+// wait blocks until n tokens could be taken for key or ctx is done.
+func (b *keyedBuckets) wait(ctx context.Context, key string, n int64) error {
+	for {
+		allowed, _, retryAfter := b.take(key, n)
+		if allowed {
+			return nil
+		}
+
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// throttle caps the tokens for key at remaining, unless it is negative, and
+// rejects every request for key until pause has passed.
+func (b *keyedBuckets) throttle(key string, remaining int64, pause time.Duration) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	bucket := b.get(key, now)
+	if remaining >= 0 && bucket.tokens > float64(remaining) {
+		bucket.tokens = float64(remaining)
+	}
+	if until := now.Add(pause); until.After(bucket.lockedUntil) {
+		bucket.lockedUntil = until
+	}
+}
+
+// lock rejects every request for key until d has passed.
+func (b *keyedBuckets) lock(key string, d time.Duration) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	b.get(key, now).lockedUntil = now.Add(d)
+}
+
+func (b *keyedBuckets) reset(key string) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	delete(b.buckets, key)
+}
+
+func (b *keyedBuckets) resetAll() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.buckets = map[string]*keyBucket{}
+}
+
+// count returns how many buckets there are and how many of them aren't
+// full as of now or are locked.
+func (b *keyedBuckets) count(now time.Time) (all, drawn int) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for _, bucket := range b.buckets {
+		tokens := bucket.tokens
+		if b.interval > 0 {
+			tokens += float64(now.Sub(bucket.lastRefill)) / b.perToken
+		}
+		if tokens < float64(b.limit) || bucket.lockedUntil.After(now) {
+			drawn++
+		}
+	}
+	return len(b.buckets), drawn
+}
+
+// clientIP returns the host part of the request's remote address.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// KeyLimit is the limit of one key, e.g. of a customer's plan.
+type KeyLimit struct {
+	// RATE_LIMIT is the burst, and a token is gained every REFILL_INTERVAL.
+	LimitProfile
+	// Names the limit in decisions, as the rule "tier " + TIER, e.g. for
+	// metrics by plan. Without one the rule is "limit".
+	TIER string
+}
+
+// LimitProvider looks up the limits of keys, e.g. in a billing database,
+// for LIMIT_PROVIDER. ok is false for keys without a limit of their own,
+// which get the limiter's.
+type LimitProvider interface {
+	Limit(ctx context.Context, key string) (limit KeyLimit, ok bool, err error)
+}
+
+// LimitProviderFunc is a LimitProvider calling itself.
+type LimitProviderFunc func(ctx context.Context, key string) (KeyLimit, bool, error)
+
+func (f LimitProviderFunc) Limit(ctx context.Context, key string) (KeyLimit, bool, error) {
+	return f(ctx, key)
+}
+
+// limitCache caches the limits LIMIT_PROVIDER looks up, and holds a set of
+// buckets for each distinct limit. Concurrent lookups of a key are made
+// once, and limits past LIMIT_CACHE_TTL are used while a lookup in the
+// background refreshes them.
+type limitCache struct {
+	provider LimitProvider
+	ttl      time.Duration
+	stale    time.Duration
+	size     int
+	onError  func(key string, err error)
+	factory  StoreFactory
+	failure  *storeFailure
+	entries  map[string]*limitEntry
+	buckets  map[LimitProfile]*storeBuckets
+	mx       sync.Mutex
+}
+
+type limitEntry struct {
+	limit KeyLimit
+	ok    bool
+	// When the limit was looked up, zero before the first lookup succeeds.
+	fetched time.Time
+	// When the last lookup failed, zero once one succeeds. Lookups aren't
+	// retried for LIMIT_CACHE_TTL after a failure, so a provider that is
+	// down isn't asked on every request.
+	failed time.Time
+	// Closed once the lookup in flight, if any, is done.
+	loading chan struct{}
+}
+
+func newLimitCache(config RateLimiterConfig, failure *storeFailure) *limitCache {
+	if config.LIMIT_PROVIDER == nil {
+		return nil
+	}
+	return &limitCache{
+		provider: config.LIMIT_PROVIDER,
+		ttl:      config.LIMIT_CACHE_TTL,
+		stale:    config.LIMIT_STALE_TTL,
+		size:     config.LIMIT_CACHE_SIZE,
+		onError:  config.ON_LIMIT_ERROR,
+		factory:  config.STORE,
+		failure:  failure,
+		entries:  map[string]*limitEntry{},
+		buckets:  map[LimitProfile]*storeBuckets{},
+	}
+}
+
+// get returns key's limit, looking it up if it isn't cached or has gone
+// stale. A key whose lookup fails keeps the limit it last had, if any.
+func (c *limitCache) get(ctx context.Context, key string) (KeyLimit, bool) {
+	c.mx.Lock()
+	e, found := c.entries[key]
+	if found && e.loading == nil && time.Since(e.failed) < c.ttl {
+		defer c.mx.Unlock()
+		return e.limit, e.ok && !e.fetched.IsZero()
+	}
+	if found && !e.fetched.IsZero() {
+		age := time.Since(e.fetched)
+		if age < c.ttl {
+			defer c.mx.Unlock()
+			return e.limit, e.ok
+		}
+		if age < c.ttl+c.stale {
+			if e.loading == nil {
+				e.loading = make(chan struct{})
+				go c.load(context.Background(), key, e)
+			}
+			defer c.mx.Unlock()
+			return e.limit, e.ok
+		}
+	}
+	if !found {
+		e = &limitEntry{}
+		c.add(key, e)
+	}
+	if loading := e.loading; loading != nil {
+		c.mx.Unlock()
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return KeyLimit{}, false
+		}
+	} else {
+		e.loading = make(chan struct{})
+		c.mx.Unlock()
+		c.load(ctx, key, e)
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return e.limit, e.ok && !e.fetched.IsZero()
+}
+
+// load looks key's limit up into e.
+func (c *limitCache) load(ctx context.Context, key string, e *limitEntry) {
+	limit, ok, err := c.provider.Limit(ctx, key)
+	if err == nil && ok && (limit.RATE_LIMIT <= 0 || limit.REFILL_INTERVAL <= 0) {
+		err = fmt.Errorf("ratelimiter: LIMIT_PROVIDER returned the invalid limit %d per %v", limit.RATE_LIMIT, limit.REFILL_INTERVAL)
+	}
+	if err != nil && c.onError != nil {
+		c.onError(key, err)
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if err == nil {
+		e.limit, e.ok, e.fetched, e.failed = limit, ok, time.Now(), time.Time{}
+	} else {
+		e.failed = time.Now()
+	}
+	close(e.loading)
+	e.loading = nil
+}
+
+// add caches e for key. A full cache first drops the limits too stale to
+// be used, or every limit if none are, lookups in flight aside. The caller
+// must hold c.mx.
+func (c *limitCache) add(key string, e *limitEntry) {
+	if len(c.entries) >= c.size {
+		for key, old := range c.entries {
+			if old.loading == nil && time.Since(old.fetched) >= c.ttl+c.stale {
+				delete(c.entries, key)
+			}
+		}
+	}
+	if len(c.entries) >= c.size {
+		for key, old := range c.entries {
+			if old.loading == nil {
+				delete(c.entries, key)
+			}
+		}
+	}
+	c.entries[key] = e
+}
+
+// bucketsFor returns the buckets of a limit, creating them the first time
+// it is seen.
+func (c *limitCache) bucketsFor(profile LimitProfile) *storeBuckets {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	buckets, ok := c.buckets[profile]
+	if !ok {
+		buckets = newStoreBuckets(c.factory, c.failure, limitSetName(profile), profile)
+		c.buckets[profile] = buckets
+	}
+	return buckets
+}
+
+// named returns the buckets of every limit seen, by set name.
+func (c *limitCache) named() map[string]*storeBuckets {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	sets := make(map[string]*storeBuckets, len(c.buckets))
+	for profile, buckets := range c.buckets {
+		sets[limitSetName(profile)] = buckets
+	}
+	return sets
+}
+
+// limitSetName names the buckets of a limit, e.g. "limit 100/1s".
+func limitSetName(profile LimitProfile) string {
+	return fmt.Sprintf("limit %d/%v", profile.RATE_LIMIT, profile.REFILL_INTERVAL)
+}
+
+// providedBucketsFor returns the buckets of the limit LIMIT_PROVIDER has
+// for key and the name of its rule, or nil if it has none.
+func (c *limiterState) providedBucketsFor(request *http.Request, key string) (*storeBuckets, string) {
+	if c.limits == nil {
+		return nil, ""
+	}
+	limit, ok := c.limits.get(request.Context(), key)
+	if !ok {
+		return nil, ""
+	}
+	rule := "limit"
+	if limit.TIER != "" {
+		rule = "tier " + limit.TIER
+	}
+	return c.limits.bucketsFor(limit.LimitProfile), rule
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimitProvider(t *testing.T) {
+	var lookups atomic.Int64
+	var failed []string
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:      2,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        remoteIP,
+		LIMIT_PROVIDER: LimitProviderFunc(func(ctx context.Context, key string) (KeyLimit, bool, error) {
+			lookups.Add(1)
+			switch key {
+			case "203.0.113.1":
+				return KeyLimit{LimitProfile: LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour}, TIER: "pro"}, true, nil
+			case "203.0.113.2":
+				return KeyLimit{LimitProfile: LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour}}, true, nil
+			case "203.0.113.3":
+				return KeyLimit{}, false, errors.New("billing is down")
+			case "203.0.113.4":
+				return KeyLimit{LimitProfile: LimitProfile{RATE_LIMIT: 0, REFILL_INTERVAL: time.Hour}}, true, nil
+			}
+			return KeyLimit{}, false, nil
+		}),
+		ON_LIMIT_ERROR: func(key string, err error) { failed = append(failed, key) },
+	})
+
+	tests := []struct {
+		name          string
+		ip            string
+		times         int
+		wantRule      string
+		wantAllowed   bool
+		wantRemaining int64
+		wantFailed    bool
+	}{
+		{name: "tier", ip: "203.0.113.1", times: 3, wantRule: "tier pro", wantAllowed: true, wantRemaining: 2},
+		{name: "limit", ip: "203.0.113.2", times: 3, wantRule: "limit", wantAllowed: true, wantRemaining: 0},
+		{name: "no limit", ip: "203.0.113.5", times: 3, wantRule: "default"},
+		{name: "lookup failed", ip: "203.0.113.3", times: 1, wantRule: "default", wantAllowed: true, wantRemaining: 1, wantFailed: true},
+		{name: "invalid limit", ip: "203.0.113.4", times: 1, wantRule: "default", wantAllowed: true, wantRemaining: 1, wantFailed: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failed, lookups = nil, atomic.Int64{}
+			var d Decision
+			for i := 0; i < test.times; i++ {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = test.ip + ":1234"
+				d = limiter.Decide(r)
+			}
+			if d.Rule != test.wantRule || d.Allowed != test.wantAllowed || d.Remaining != test.wantRemaining {
+				t.Fatalf("decision %+v", d)
+			}
+			if (len(failed) > 0) != test.wantFailed {
+				t.Fatalf("failed lookups %q", failed)
+			}
+			// Limits are looked up once; failed lookups on every request.
+			if want := int64(1); !test.wantFailed && lookups.Load() != want {
+				t.Fatalf("%d lookups, want %d", lookups.Load(), want)
+			}
+		})
+	}
+}
+
+func TestLimitCacheSingleflight(t *testing.T) {
+	var lookups atomic.Int64
+	release := make(chan struct{})
+	cache := newLimitCache(RateLimiterConfig{
+		LIMIT_PROVIDER: LimitProviderFunc(func(ctx context.Context, key string) (KeyLimit, bool, error) {
+			lookups.Add(1)
+			<-release
+			return KeyLimit{LimitProfile: LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Second}}, true, nil
+		}),
+		LIMIT_CACHE_TTL:  time.Hour,
+		LIMIT_CACHE_SIZE: 10,
+	}, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if limit, ok := cache.get(context.Background(), "k"); !ok || limit.RATE_LIMIT != 5 {
+				t.Errorf("limit %+v, %v", limit, ok)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if lookups.Load() != 1 {
+		t.Fatalf("%d lookups", lookups.Load())
+	}
+}
+
+func TestLimitCacheStale(t *testing.T) {
+	var limit atomic.Int64
+	limit.Store(5)
+	refreshed := make(chan struct{}, 1)
+	var failing atomic.Bool
+	cache := newLimitCache(RateLimiterConfig{
+		LIMIT_PROVIDER: LimitProviderFunc(func(ctx context.Context, key string) (KeyLimit, bool, error) {
+			defer func() { refreshed <- struct{}{} }()
+			if failing.Load() {
+				return KeyLimit{}, false, errors.New("billing is down")
+			}
+			return KeyLimit{LimitProfile: LimitProfile{RATE_LIMIT: limit.Load(), REFILL_INTERVAL: time.Second}}, true, nil
+		}),
+		LIMIT_CACHE_TTL:  10 * time.Millisecond,
+		LIMIT_STALE_TTL:  time.Hour,
+		LIMIT_CACHE_SIZE: 10,
+	}, nil)
+	get := func() int64 {
+		got, ok := cache.get(context.Background(), "k")
+		if !ok {
+			t.Fatal("no limit")
+		}
+		return got.RATE_LIMIT
+	}
+
+	if got := get(); got != 5 {
+		t.Fatalf("limit %d", got)
+	}
+	<-refreshed
+
+	// A stale limit is served while it is refreshed in the background.
+	limit.Store(7)
+	time.Sleep(20 * time.Millisecond)
+	if got := get(); got != 5 {
+		t.Fatalf("stale limit %d", got)
+	}
+	<-refreshed
+	if got := get(); got != 7 {
+		t.Fatalf("refreshed limit %d", got)
+	}
+
+	// A failed refresh keeps the last limit.
+	failing.Store(true)
+	time.Sleep(20 * time.Millisecond)
+	get()
+	<-refreshed
+	if got := get(); got != 7 {
+		t.Fatalf("limit after failed refresh %d", got)
+	}
+}
+
+func TestLimitCacheFailing(t *testing.T) {
+	var lookups atomic.Int64
+	cache := newLimitCache(RateLimiterConfig{
+		LIMIT_PROVIDER: LimitProviderFunc(func(ctx context.Context, key string) (KeyLimit, bool, error) {
+			lookups.Add(1)
+			return KeyLimit{}, false, errors.New("billing is down")
+		}),
+		LIMIT_CACHE_TTL:  50 * time.Millisecond,
+		LIMIT_STALE_TTL:  time.Hour,
+		LIMIT_CACHE_SIZE: 10,
+	}, nil)
+
+	for i := 0; i < 20; i++ {
+		if _, ok := cache.get(context.Background(), "k"); ok {
+			t.Fatal("limit of a failed lookup")
+		}
+	}
+	if got := lookups.Load(); got != 1 {
+		t.Fatalf("%d lookups within the TTL, want 1", got)
+	}
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 20; i++ {
+		cache.get(context.Background(), "k")
+	}
+	if got := lookups.Load(); got != 2 {
+		t.Fatalf("%d lookups after the TTL, want 2", got)
+	}
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// logSummaryTopKeys is how many keys a sampling summary names.
+const logSummaryTopKeys = 5
+
+// logKey returns the key as logged: hashed unless DEBUG_RAW_KEYS is set,
+// since logs are often kept longer and shared wider than the keys they
+// would expose.
+func (c *limiterState) logKey(key string) string {
+	if key == "" || c.DEBUG_RAW_KEYS {
+		return key
+	}
+	return HashKey(key)
+}
+
+// logRejection logs a denied decision at REJECT_LOG_LEVEL, or counts it
+// for the summary if REJECT_LOG_SAMPLE leaves it out.
+func (r *rateLimiter) logRejection(request *http.Request, d Decision) {
+	c := r.config()
+	ctx := request.Context()
+	level := c.REJECT_LOG_LEVEL.Level()
+	if !c.LOGGER.Enabled(ctx, level) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("key", c.logKey(d.Key)),
+		slog.String("rule", d.Rule),
+		slog.Int64("limit", d.Limit),
+		slog.Int64("remaining", d.Remaining),
+		slog.Duration("retry_after", d.RetryAfter),
+		slog.String("method", request.Method),
+		slog.String("path", request.URL.Path),
+	}
+	if c.REJECT_LOG_SAMPLE > 1 {
+		logged, rejections := r.stats.rejectLog.sample(d.Key, c.REJECT_LOG_SAMPLE)
+		if !logged {
+			return
+		}
+		attrs = append(attrs, slog.Int64("rejections", rejections))
+	}
+	c.LOGGER.LogAttrs(ctx, level, "rate limit exceeded", attrs...)
+}
+
+// logSampler picks the rejections logged under REJECT_LOG_SAMPLE and
+// counts the others for the summary.
+type logSampler struct {
+	// Rejections of each key since the last summary.
+	counts     map[string]int64
+	rejected   int64
+	suppressed int64
+	mx         sync.Mutex
+}
+
+// sample counts a rejection of key, reporting whether it is logged and
+// how many rejections of the key there were since the last summary. Keys
+// past maxTrackedKeys are never logged, so a flood of new keys can't
+// flood the log either.
+func (s *logSampler) sample(key string, every int64) (logged bool, rejections int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.rejected++
+	if s.counts == nil {
+		s.counts = map[string]int64{}
+	}
+	rejections, ok := s.counts[key]
+	if !ok && len(s.counts) >= maxTrackedKeys {
+		s.suppressed++
+		return false, 0
+	}
+	rejections++
+	s.counts[key] = rejections
+	if (rejections-1)%every != 0 {
+		s.suppressed++
+		return false, rejections
+	}
+	return true, rejections
+}
+
+// flush returns the counts since the last summary and starts over.
+func (s *logSampler) flush() (counts map[string]int64, rejected, suppressed int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	counts, rejected, suppressed = s.counts, s.rejected, s.suppressed
+	s.counts, s.rejected, s.suppressed = nil, 0, 0
+	return counts, rejected, suppressed
+}
+
+// runLogSummaries logs what REJECT_LOG_SAMPLE left out every
+// REJECT_LOG_SUMMARY_INTERVAL until ctx is done.
+func (r *rateLimiter) runLogSummaries(ctx context.Context) {
+	c := r.config()
+	ticker := time.NewTicker(c.REJECT_LOG_SUMMARY_INTERVAL)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.logSummary()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// logSummary logs how many rejections there were since the last summary,
+// how many weren't logged and the keys rejected most. Nothing is logged
+// if nothing was left out.
+func (r *rateLimiter) logSummary() {
+	c := r.config()
+	counts, rejected, suppressed := r.stats.rejectLog.flush()
+	ctx := context.Background()
+	level := c.REJECT_LOG_LEVEL.Level()
+	if suppressed == 0 || !c.LOGGER.Enabled(ctx, level) {
+		return
+	}
+
+	top := make([]KeyCount, 0, len(counts))
+	for key, count := range counts {
+		top = append(top, KeyCount{Key: key, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Key < top[j].Key
+	})
+	top = top[:min(len(top), logSummaryTopKeys)]
+	topAttrs := make([]any, len(top))
+	for i, key := range top {
+		topAttrs[i] = slog.Int64(c.logKey(key.Key), key.Count)
+	}
+
+	c.LOGGER.LogAttrs(ctx, level, "rate limit rejections sampled",
+		slog.Int64("rejected", rejected),
+		slog.Int64("suppressed", suppressed),
+		slog.Int("keys", len(counts)),
+		slog.Group("top_keys", topAttrs...),
+	)
+}
+
+// logAnomaly logs a key flagged for a spike at BAN_LOG_LEVEL.
+func (r *rateLimiter) logAnomaly(key string, s *spike) {
+	c := r.config()
+	ctx := context.Background()
+	level := c.BAN_LOG_LEVEL.Level()
+	if !c.LOGGER.Enabled(ctx, level) {
+		return
+	}
+	c.LOGGER.LogAttrs(ctx, level, "rate limit anomaly",
+		slog.String("key", c.logKey(key)),
+		slog.Float64("rate", s.rate),
+		slog.Float64("baseline", s.baseline),
+		slog.Duration("flagged_for", c.ANOMALY_DURATION),
+	)
+}
+
+// logBan logs a key being blocked for pause at BAN_LOG_LEVEL.
+func (r *rateLimiter) logBan(key string, remaining int64, pause time.Duration) {
+	c := r.config()
+	ctx := context.Background()
+	level := c.BAN_LOG_LEVEL.Level()
+	if !c.LOGGER.Enabled(ctx, level) {
+		return
+	}
+	c.LOGGER.LogAttrs(ctx, level, "rate limit key blocked",
+		slog.String("key", c.logKey(key)),
+		slog.Int64("remaining", remaining),
+		slog.Duration("retry_after", pause),
+	)
+}
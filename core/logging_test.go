@@ -0,0 +1,158 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// logLines returns the JSON records written to buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, record)
+	}
+	return lines
+}
+
+func TestLogging(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    RateLimiterConfig
+		do        func(limiter RateLimiter)
+		wantLevel string
+		wantMsg   string
+		wantKey   string
+	}{
+		{
+			name: "rejection",
+			do: func(limiter RateLimiter) {
+				limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+				limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+			},
+			wantLevel: "INFO",
+			wantMsg:   "rate limit exceeded",
+			wantKey:   HashKey("client"),
+		},
+		{
+			name:   "rejection at a chosen level with the raw key",
+			config: RateLimiterConfig{REJECT_LOG_LEVEL: slog.LevelDebug, DEBUG_RAW_KEYS: true},
+			do: func(limiter RateLimiter) {
+				limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+				limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+			},
+			wantLevel: "DEBUG",
+			wantMsg:   "rate limit exceeded",
+			wantKey:   "client",
+		},
+		{
+			name:      "ban",
+			do:        func(limiter RateLimiter) { limiter.ThrottleKey("client", 0, time.Minute) },
+			wantLevel: "WARN",
+			wantMsg:   "rate limit key blocked",
+			wantKey:   HashKey("client"),
+		},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		config := test.config
+		config.RATE_LIMIT = 1
+		config.REFILL_INTERVAL = time.Hour
+		config.KEY_FUNC = func(r *http.Request) string { return "client" }
+		config.LOGGER = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		limiter := New()
+		limiter.SetConfig(config)
+
+		test.do(limiter)
+		lines := logLines(t, &buf)
+		if len(lines) != 1 {
+			t.Fatalf("%s: logged %v, want one record", test.name, lines)
+		}
+		got := lines[0]
+		if got["level"] != test.wantLevel || got["msg"] != test.wantMsg || got["key"] != test.wantKey {
+			t.Errorf("%s: logged %v, want %s %q for key %s", test.name, got, test.wantLevel, test.wantMsg, test.wantKey)
+		}
+		if got["msg"] == "rate limit exceeded" && (got["rule"] != "default" || got["remaining"] != 0.0 || got["retry_after"] == nil) {
+			t.Errorf("%s: logged %v, want the rule, remaining tokens and retry delay", test.name, got)
+		}
+	}
+}
+
+func TestLoginProtectorLogsLockouts(t *testing.T) {
+	var buf bytes.Buffer
+	protector := NewLoginProtector()
+	protector.SetConfig(LoginProtectionConfig{
+		RATE_LIMIT:       1,
+		REFILL_INTERVAL:  time.Hour,
+		LOCKOUT_DURATION: time.Minute,
+		LOGGER:           slog.New(slog.NewJSONHandler(&buf, nil)),
+	})
+
+	key, _, _ := protector.Allow(loginRequest("alice"))
+	protector.Record(key, loginRequest("alice"), http.StatusUnauthorized)
+
+	lines := logLines(t, &buf)
+	if len(lines) != 1 || lines[0]["level"] != "WARN" || lines[0]["key"] != HashKey(key) {
+		t.Fatalf("logged %v, want a warning for the hashed key", lines)
+	}
+}
+
+func TestSampledRejectionLogging(t *testing.T) {
+	var buf bytes.Buffer
+	client := "alice"
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:        1,
+		REFILL_INTERVAL:   time.Hour,
+		KEY_FUNC:          func(r *http.Request) string { return client },
+		LOGGER:            slog.New(slog.NewJSONHandler(&buf, nil)),
+		REJECT_LOG_SAMPLE: 3,
+		DEBUG_RAW_KEYS:    true,
+	})
+	decide := func(times int) {
+		for i := 0; i < times; i++ {
+			limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+		}
+	}
+	decide(8)
+	client = "bob"
+	decide(3)
+
+	lines := logLines(t, &buf)
+	var logged []string
+	for _, line := range lines {
+		logged = append(logged, fmt.Sprint(line["key"], "#", line["rejections"]))
+	}
+	if want := []string{"alice#1", "alice#4", "alice#7", "bob#1"}; fmt.Sprint(logged) != fmt.Sprint(want) {
+		t.Fatalf("logged %v, want %v", logged, want)
+	}
+
+	buf.Reset()
+	limiter.(*rateLimiter).logSummary()
+	lines = logLines(t, &buf)
+	if len(lines) != 1 || lines[0]["msg"] != "rate limit rejections sampled" || lines[0]["rejected"] != 9.0 ||
+		lines[0]["suppressed"] != 5.0 || lines[0]["keys"] != 2.0 || fmt.Sprint(lines[0]["top_keys"]) != "map[alice:7 bob:2]" {
+		t.Fatalf("summary %v", lines)
+	}
+
+	buf.Reset()
+	decide(1)
+	limiter.(*rateLimiter).logSummary()
+	if lines := logLines(t, &buf); len(lines) != 1 || lines[0]["rejections"] != 1.0 {
+		t.Fatalf("after the summary logged %v, want bob's count started over and no summary", lines)
+	}
+}
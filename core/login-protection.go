@@ -0,0 +1,97 @@
+package core
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// LoginProtector limits failed login attempts per (client IP, username) pair.
+// Successful attempts are never charged, so legitimate users are only
+// affected after repeated failures.
+type LoginProtector interface {
+	SetConfig(LoginProtectionConfig)
+	// Allow charges the request an attempt and reports whether it may try
+	// to log in right now, so parallel attempts can't all slip through. The
+	// returned key is passed to Record once the attempt has been handled.
+	Allow(r *http.Request) (key string, allowed bool, retryAfter time.Duration)
+	// Record locks the key out once a failed attempt has used up its
+	// attempts, or hands the attempt back, or clears the key, after a
+	// success.
+	Record(key string, r *http.Request, statusCode int)
+}
+
+type LoginProtectionConfig struct {
+	// Failed attempts allowed before the key is locked out.
+	RATE_LIMIT int64
+	// One failed attempt is forgiven every REFILL_INTERVAL.
+	REFILL_INTERVAL time.Duration
+	// How long a key stays locked after using up its attempts. Zero means
+	// the key is only blocked until the next attempt is forgiven.
+	LOCKOUT_DURATION time.Duration
+	// Extracts the username from the request. Defaults to the "username"
+	// form value.
+	USERNAME_FUNC func(r *http.Request) string
+	// Decides whether the handler's response was a failed attempt. Defaults
+	// to 401 and 403 responses.
+	FAILURE_FUNC func(r *http.Request, statusCode int) bool
+	// Clears the key's failures after a successful login.
+	RESET_ON_SUCCESS bool
+	// Logs lockouts at slog.LevelWarn, with the hashed key. Nil logs
+	// nothing.
+	LOGGER *slog.Logger
+}
+
+type loginProtector struct {
+	LoginProtectionConfig
+	attempts *keyedBuckets
+}
+
+func NewLoginProtector() LoginProtector {
+	return &loginProtector{}
+}
+
+func (l *loginProtector) SetConfig(config LoginProtectionConfig) {
+	if config.USERNAME_FUNC == nil {
+		config.USERNAME_FUNC = func(r *http.Request) string {
+			return r.FormValue("username")
+		}
+	}
+	if config.FAILURE_FUNC == nil {
+		config.FAILURE_FUNC = func(r *http.Request, statusCode int) bool {
+			return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+		}
+	}
+
+	l.LoginProtectionConfig = config
+	l.attempts = newKeyedBuckets(config.RATE_LIMIT, config.REFILL_INTERVAL)
+}
+
+func (l *loginProtector) Allow(r *http.Request) (string, bool, time.Duration) {
+	key := clientIP(r) + "|" + strings.ToLower(l.USERNAME_FUNC(r))
+	allowed, _, retryAfter := l.attempts.take(key, 1)
+	return key, allowed, retryAfter
+}
+
+func (l *loginProtector) Record(key string, r *http.Request, statusCode int) {
+	if !l.FAILURE_FUNC(r, statusCode) {
+		if l.RESET_ON_SUCCESS {
+			l.attempts.reset(key)
+		} else {
+			l.attempts.refund(key, 1)
+		}
+		return
+	}
+
+	_, remaining, _ := l.attempts.peek(key, 0)
+	if remaining == 0 && l.LOCKOUT_DURATION > 0 {
+		l.attempts.lock(key, l.LOCKOUT_DURATION)
+		if l.LOGGER != nil {
+			l.LOGGER.LogAttrs(r.Context(), slog.LevelWarn, "login attempts locked out",
+				slog.String("key", HashKey(key)),
+				slog.Duration("retry_after", l.LOCKOUT_DURATION),
+			)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func loginRequest(username string) *http.Request {
+	form := url.Values{"username": {username}}
+	r := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = "203.0.113.7:1234"
+	return r
+}
+
+func TestLoginProtectorParallelAttempts(t *testing.T) {
+	protector := NewLoginProtector()
+	protector.SetConfig(LoginProtectionConfig{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour})
+
+	var allowed int
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, ok, _ := protector.Allow(loginRequest("alice")); ok {
+				mx.Lock()
+				allowed++
+				mx.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if allowed != 3 {
+		t.Fatalf("allowed %d parallel attempts, want 3", allowed)
+	}
+}
+
+func TestLoginProtectorRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      LoginProtectionConfig
+		statuses    []int
+		wait        time.Duration
+		wantAllowed bool
+	}{
+		{
+			name:        "successes are handed back",
+			config:      LoginProtectionConfig{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour},
+			statuses:    []int{http.StatusOK, http.StatusOK, http.StatusOK},
+			wantAllowed: true,
+		},
+		{
+			name:        "failures use up attempts",
+			config:      LoginProtectionConfig{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour},
+			statuses:    []int{http.StatusUnauthorized, http.StatusUnauthorized},
+			wantAllowed: false,
+		},
+		{
+			name:        "success resets failures",
+			config:      LoginProtectionConfig{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour, RESET_ON_SUCCESS: true},
+			statuses:    []int{http.StatusUnauthorized, http.StatusOK},
+			wantAllowed: true,
+		},
+		{
+			name:        "lockout outlasts refill",
+			config:      LoginProtectionConfig{RATE_LIMIT: 1, REFILL_INTERVAL: 20 * time.Millisecond, LOCKOUT_DURATION: time.Hour},
+			statuses:    []int{http.StatusForbidden},
+			wait:        50 * time.Millisecond,
+			wantAllowed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			protector := NewLoginProtector()
+			protector.SetConfig(test.config)
+
+			for _, status := range test.statuses {
+				r := loginRequest("bob")
+				key, ok, _ := protector.Allow(r)
+				if !ok {
+					t.Fatalf("attempt rejected before status %d", status)
+				}
+				protector.Record(key, r, status)
+			}
+			time.Sleep(test.wait)
+
+			if _, ok, _ := protector.Allow(loginRequest("bob")); ok != test.wantAllowed {
+				t.Fatalf("next attempt allowed = %v, want %v", ok, test.wantAllowed)
+			}
+		})
+	}
+}
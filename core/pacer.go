@@ -0,0 +1,59 @@
+package core
+
+import (
+	"context"
+)
+
+// Pacer runs background jobs under a rate limit and a concurrency bound, so
+// workers can reuse the limits that already guard a service's HTTP routes.
+type Pacer interface {
+	SetConfig(PacerConfig)
+	// Do runs fn once a worker slot and a token are free, and returns its
+	// error. If ctx is done first, fn is not run and ctx's error is
+	// returned.
+	Do(ctx context.Context, fn func() error) error
+}
+
+type PacerConfig struct {
+	// Charged one token per job, under the key its KEY_FUNC gives a request
+	// without a client address. Nil runs jobs without a rate limit.
+	LIMITER RateLimiter
+	// Jobs allowed to run at once. Zero means no bound.
+	MAX_CONCURRENCY int
+}
+
+type pacer struct {
+	PacerConfig
+	slots chan struct{}
+}
+
+func NewPacer() Pacer {
+	return &pacer{}
+}
+
+func (p *pacer) SetConfig(config PacerConfig) {
+	p.PacerConfig = config
+	p.slots = nil
+	if config.MAX_CONCURRENCY > 0 {
+		p.slots = make(chan struct{}, config.MAX_CONCURRENCY)
+	}
+}
+
+func (p *pacer) Do(ctx context.Context, fn func() error) error {
+	// Take the slot first so tokens aren't spent on jobs that can't start.
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-p.slots }()
+	}
+
+	if p.LIMITER != nil {
+		if _, err := p.LIMITER.Wait(streamRequest(ctx)); err != nil {
+			return err
+		}
+	}
+	return fn()
+}
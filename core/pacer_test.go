@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPacerConcurrency(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxConcurrency int
+		jobs           int
+		wantMax        int64
+	}{
+		{name: "bounded", maxConcurrency: 2, jobs: 8, wantMax: 2},
+		{name: "single worker", maxConcurrency: 1, jobs: 4, wantMax: 1},
+		{name: "unbounded", maxConcurrency: 0, jobs: 4, wantMax: 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pacer := NewPacer()
+			pacer.SetConfig(PacerConfig{MAX_CONCURRENCY: test.maxConcurrency})
+
+			var running, most int64
+			var mx sync.Mutex
+			var wg sync.WaitGroup
+			for i := 0; i < test.jobs; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					pacer.Do(context.Background(), func() error {
+						mx.Lock()
+						running++
+						most = max(most, running)
+						mx.Unlock()
+
+						time.Sleep(20 * time.Millisecond)
+
+						mx.Lock()
+						running--
+						mx.Unlock()
+						return nil
+					})
+				}()
+			}
+			wg.Wait()
+
+			if most != test.wantMax {
+				t.Fatalf("%d jobs ran at once, want %d", most, test.wantMax)
+			}
+		})
+	}
+}
+
+func TestPacerRateLimit(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: func(r *http.Request) string { return "jobs" }})
+	pacer := NewPacer()
+	pacer.SetConfig(PacerConfig{LIMITER: limiter})
+
+	jobErr := errors.New("job failed")
+	if err := pacer.Do(context.Background(), func() error { return jobErr }); err != jobErr {
+		t.Fatalf("first job returned %v, want its own error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	ran := false
+	if err := pacer.Do(ctx, func() error { ran = true; return nil }); err != context.DeadlineExceeded || ran {
+		t.Fatalf("job over the limit returned %v and ran %v, want context.DeadlineExceeded without running", err, ran)
+	}
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Policy is an ordered list of rules, each matching requests and saying
+// what happens to them. The first rule matching a request decides it, and
+// requests no rule matches are limited as usual. It takes the place of
+// SKIP funcs, allow lists and ad hoc profiles combined by hand:
+//
+//	POLICY: core.Policy{
+//		{NAME: "health", MATCH: []core.Matcher{core.MatchPath("/healthz")}, ACTION: core.PolicyAllow},
+//		{NAME: "office", MATCH: []core.Matcher{core.MatchCIDR("198.51.100.0/24")}, ACTION: core.PolicyAllow},
+//		{NAME: "scrapers", MATCH: []core.Matcher{core.MatchHeader("X-Scraper")}, ACTION: core.PolicyDeny},
+//		{NAME: "login", MATCH: []core.Matcher{core.MatchMethod("POST"), core.MatchPath("/login")},
+//			ACTION: core.PolicyLimit, PROFILE: core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Minute}},
+//	},
+//
+// Decisions carry the name of the rule that matched as their Rule, so the
+// metrics packages and HISTORY_BY_RULE break them down by rule; those of
+// PolicyAllow rules are exempt but still passed to ON_DECISION. The allow
+// and deny lists of AllowKey and DenyKey are checked first.
+type Policy []PolicyRule
+
+type PolicyRule struct {
+	// Names the rule in decisions. Must be unique within the policy.
+	NAME string
+	// Every matcher must match for the rule to apply. None matches every
+	// request.
+	MATCH  []Matcher
+	ACTION PolicyAction
+	// Limit of PolicyLimit rules, whose requests draw from buckets of
+	// their own, keyed by KEY_FUNC as usual.
+	PROFILE LimitProfile
+}
+
+// PolicyAction is what a policy rule does with the requests it matches.
+type PolicyAction int
+
+const (
+	// PolicyLimit charges the rule's own buckets, of its PROFILE.
+	PolicyLimit PolicyAction = iota
+	// PolicyAllow lets requests through uncharged.
+	PolicyAllow
+	// PolicyDeny rejects requests.
+	PolicyDeny
+	// PolicyChallenge rejects requests, so the CHALLENGE_HANDLER serves
+	// them its challenge, until their key is passed to MarkVerified. From
+	// then on they are limited as usual.
+	PolicyChallenge
+)
+
+// Matcher decides whether a policy rule applies to a request. clientIP is
+// the client's IP, with TRUSTED_PROXIES honored.
+type Matcher func(r *http.Request, clientIP string) bool
+
+// MatchCIDR matches clients in any of the networks, given as CIDRs or
+// single IPs. It panics on entries that are neither, as the policy would
+// otherwise silently fail to match.
+func MatchCIDR(cidrs ...string) Matcher {
+	networks := parseCIDRs(cidrs)
+	if len(networks) != len(cidrs) {
+		panic(fmt.Sprintf("ratelimiter: MatchCIDR: bad entry in %q", cidrs))
+	}
+	return func(r *http.Request, clientIP string) bool {
+		ip := net.ParseIP(clientIP)
+		return ip != nil && containsIP(networks, ip)
+	}
+}
+
+// MatchHeader matches requests whose header name has one of values, or
+// any value if none are given.
+func MatchHeader(name string, values ...string) Matcher {
+	return func(r *http.Request, clientIP string) bool {
+		value := r.Header.Get(name)
+		if len(values) == 0 {
+			return value != ""
+		}
+		return slices.Contains(values, value)
+	}
+}
+
+// MatchPath matches requests whose URL path starts with one of prefixes.
+func MatchPath(prefixes ...string) Matcher {
+	return func(r *http.Request, clientIP string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchMethod matches requests with one of methods.
+func MatchMethod(methods ...string) Matcher {
+	return func(r *http.Request, clientIP string) bool {
+		return slices.Contains(methods, r.Method)
+	}
+}
+
+// MatchTenant matches requests of one of tenants, as tenant tells them,
+// e.g. from a claim of the request's token.
+func MatchTenant(tenant func(r *http.Request) string, tenants ...string) Matcher {
+	return func(r *http.Request, clientIP string) bool {
+		return slices.Contains(tenants, tenant(r))
+	}
+}
+
+// Validate reports rules without a name or with a name taken, unknown
+// actions and PolicyLimit rules without a limit.
+func (p Policy) Validate() error {
+	names := map[string]bool{}
+	for i, rule := range p {
+		switch {
+		case rule.NAME == "":
+			return fmt.Errorf("ratelimiter: policy rule %d has no NAME", i)
+		case names[rule.NAME]:
+			return fmt.Errorf("ratelimiter: policy rule %q is named twice", rule.NAME)
+		case rule.ACTION < PolicyLimit || rule.ACTION > PolicyChallenge:
+			return fmt.Errorf("ratelimiter: policy rule %q has unknown ACTION %d", rule.NAME, rule.ACTION)
+		case rule.ACTION == PolicyLimit && (rule.PROFILE.RATE_LIMIT <= 0 || rule.PROFILE.REFILL_INTERVAL <= 0):
+			return fmt.Errorf("ratelimiter: policy rule %q needs a PROFILE to limit by", rule.NAME)
+		}
+		names[rule.NAME] = true
+	}
+	return nil
+}
+
+// match returns the first rule matching the request, or nil.
+func (p Policy) match(request *http.Request, clientIP string) *PolicyRule {
+	for i := range p {
+		if matchAll(p[i].MATCH, request, clientIP) {
+			return &p[i]
+		}
+	}
+	return nil
+}
+
+func matchAll(matchers []Matcher, request *http.Request, clientIP string) bool {
+	for _, match := range matchers {
+		if !match(request, clientIP) {
+			return false
+		}
+	}
+	return true
+}
+
+// buckets creates the buckets of the PolicyLimit rules, by rule name.
+func (p Policy) buckets(factory StoreFactory, failure *storeFailure) map[string]*storeBuckets {
+	buckets := map[string]*storeBuckets{}
+	for _, rule := range p {
+		if rule.ACTION == PolicyLimit {
+			buckets[rule.NAME] = newStoreBuckets(factory, failure, "policy "+rule.NAME, rule.PROFILE)
+		}
+	}
+	return buckets
+}
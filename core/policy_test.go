@@ -0,0 +1,99 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	tenant := func(r *http.Request) string { return r.Header.Get("X-Tenant") }
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:        2,
+		REFILL_INTERVAL:   time.Hour,
+		KEY_FUNC:          remoteIP,
+		VERIFIED_DURATION: time.Hour,
+		POLICY: Policy{
+			{NAME: "health", MATCH: []Matcher{MatchPath("/healthz")}, ACTION: PolicyAllow},
+			{NAME: "office", MATCH: []Matcher{MatchCIDR("198.51.100.0/24", "192.0.2.9")}, ACTION: PolicyAllow},
+			{NAME: "scrapers", MATCH: []Matcher{MatchHeader("X-Scraper")}, ACTION: PolicyDeny},
+			{NAME: "suspicious", MATCH: []Matcher{MatchHeader("User-Agent", "curl/8.0")}, ACTION: PolicyChallenge},
+			{NAME: "login", MATCH: []Matcher{MatchMethod(http.MethodPost), MatchPath("/login")},
+				ACTION: PolicyLimit, PROFILE: LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour}},
+			{NAME: "trial", MATCH: []Matcher{MatchTenant(tenant, "trial")},
+				ACTION: PolicyLimit, PROFILE: LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour}},
+		},
+	})
+	limiter.MarkVerified("203.0.113.9")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		ip     string
+		header [2]string
+		// Decisions asked for; the last one is checked.
+		times         int
+		wantRule      string
+		wantAllowed   bool
+		wantExempt    bool
+		wantRemaining int64
+	}{
+		{name: "allowed path", path: "/healthz", ip: "203.0.113.1", times: 3, wantRule: "health", wantAllowed: true, wantExempt: true},
+		{name: "allowed network", path: "/", ip: "198.51.100.7", times: 3, wantRule: "office", wantAllowed: true, wantExempt: true},
+		{name: "allowed ip", path: "/", ip: "192.0.2.9", times: 3, wantRule: "office", wantAllowed: true, wantExempt: true},
+		{name: "denied header", path: "/", ip: "203.0.113.2", header: [2]string{"X-Scraper", "1"}, times: 1, wantRule: "scrapers"},
+		{name: "first match wins", path: "/healthz", ip: "203.0.113.2", header: [2]string{"X-Scraper", "1"}, times: 1, wantRule: "health", wantAllowed: true, wantExempt: true},
+		{name: "challenged", path: "/", ip: "203.0.113.3", header: [2]string{"User-Agent", "curl/8.0"}, times: 1, wantRule: "suspicious"},
+		{name: "challenge passed", path: "/", ip: "203.0.113.9", header: [2]string{"User-Agent", "curl/8.0"}, times: 1, wantRule: "verified", wantAllowed: true, wantRemaining: 1},
+		{name: "own limit", method: http.MethodPost, path: "/login", ip: "203.0.113.4", times: 2, wantRule: "login"},
+		{name: "other method", method: http.MethodGet, path: "/login", ip: "203.0.113.4", times: 1, wantRule: "default", wantAllowed: true, wantRemaining: 1},
+		{name: "tenant", path: "/", ip: "203.0.113.5", header: [2]string{"X-Tenant", "trial"}, times: 3, wantRule: "trial", wantAllowed: true, wantRemaining: 2},
+		{name: "no match", path: "/", ip: "203.0.113.6", times: 3, wantRule: "default"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var d Decision
+			for i := 0; i < test.times; i++ {
+				method := test.method
+				if method == "" {
+					method = http.MethodGet
+				}
+				r := httptest.NewRequest(method, test.path, nil)
+				r.RemoteAddr = test.ip + ":1234"
+				if test.header[0] != "" {
+					r.Header.Set(test.header[0], test.header[1])
+				}
+				d = limiter.Decide(r)
+			}
+			if d.Rule != test.wantRule || d.Allowed != test.wantAllowed || d.Exempt != test.wantExempt || d.Remaining != test.wantRemaining {
+				t.Fatalf("decision %+v", d)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	limit := LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: time.Second}
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{name: "valid", policy: Policy{{NAME: "a", ACTION: PolicyAllow}, {NAME: "b", PROFILE: limit}}},
+		{name: "no name", policy: Policy{{ACTION: PolicyAllow}}, wantErr: true},
+		{name: "name taken", policy: Policy{{NAME: "a", ACTION: PolicyAllow}, {NAME: "a", ACTION: PolicyDeny}}, wantErr: true},
+		{name: "unknown action", policy: Policy{{NAME: "a", ACTION: 9}}, wantErr: true},
+		{name: "limit without profile", policy: Policy{{NAME: "a", ACTION: PolicyLimit}}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Second, POLICY: test.policy}
+			if err := config.Validate(); (err != nil) != test.wantErr {
+				t.Fatalf("error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"net/http"
+)
+
+// PreflightMode decides how CORS preflight requests are limited. Browsers
+// send them on their own before many cross-origin calls, so charging them
+// can halve the throughput a single-page app actually gets.
+type PreflightMode int
+
+const (
+	// PreflightCharge limits preflight requests like any other request.
+	PreflightCharge PreflightMode = iota
+	// PreflightSkip never limits preflight requests.
+	PreflightSkip
+	// PreflightFree rejects preflight requests while the bucket is empty
+	// but never takes a token for them.
+	PreflightFree
+)
+
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
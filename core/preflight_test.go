@@ -0,0 +1,55 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func preflightRequest() *http.Request {
+	r := httptest.NewRequest(http.MethodOptions, "/", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	return r
+}
+
+func TestPreflight(t *testing.T) {
+	tests := []struct {
+		name string
+		mode PreflightMode
+		// Whether a preflight request before the first GET is exempt and
+		// whether the second GET is allowed after it.
+		wantExempt  bool
+		wantAllowed bool
+	}{
+		{name: "charge", mode: PreflightCharge, wantAllowed: false},
+		{name: "skip", mode: PreflightSkip, wantExempt: true, wantAllowed: true},
+		{name: "free", mode: PreflightFree, wantAllowed: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour, KEY_FUNC: remoteIP, PREFLIGHT: test.mode})
+
+			if d := limiter.Decide(preflightRequest()); !d.Allowed || d.Exempt != test.wantExempt {
+				t.Fatalf("preflight allowed %v, exempt %v, want allowed, exempt %v", d.Allowed, d.Exempt, test.wantExempt)
+			}
+			limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+			if d := limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil)); d.Allowed != test.wantAllowed {
+				t.Fatalf("second request allowed = %v, want %v", d.Allowed, test.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestFreePreflightRejectedWhenEmpty(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: remoteIP, PREFLIGHT: PreflightFree})
+
+	limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	if limiter.Decide(preflightRequest()).Allowed {
+		t.Fatal("preflight allowed with an empty bucket")
+	}
+}
@@ -0,0 +1,30 @@
+package core
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// NewRateLimitedReader paces reads from r to the limiter's budget, for byte
+// streams outside HTTP such as file copies, uploads to object storage or
+// backups. Readers sharing a limiter share its budget. Waiting for tokens
+// stops with ctx's error once ctx is done.
+func NewRateLimitedReader(ctx context.Context, r io.Reader, limiter BandwidthLimiter) io.Reader {
+	request := streamRequest(ctx)
+	request.Body = io.NopCloser(r)
+	return limiter.PaceBody(request)
+}
+
+// NewRateLimitedWriter paces writes to w to the limiter's budget, like
+// NewRateLimitedReader.
+func NewRateLimitedWriter(ctx context.Context, w io.Writer, limiter BandwidthLimiter) io.Writer {
+	return limiter.PaceWriter(streamRequest(ctx), w)
+}
+
+// streamRequest is the request a stream is charged as. It has no client
+// address, so the default KEY_FUNC puts every stream in one bucket.
+func streamRequest(ctx context.Context) *http.Request {
+	return (&http.Request{URL: &url.URL{}, Header: http.Header{}}).WithContext(ctx)
+}
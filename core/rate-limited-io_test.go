@@ -0,0 +1,54 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedIO(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		timeout  time.Duration
+		wantErr  error
+		wantWait time.Duration
+	}{
+		{name: "within the burst", size: 10, timeout: time.Second},
+		{name: "paced", size: 20, timeout: time.Second, wantWait: 10 * time.Millisecond},
+		{name: "context done", size: 1000, timeout: 20 * time.Millisecond, wantErr: context.DeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			payload := strings.Repeat("x", test.size)
+			for _, stream := range []string{"reader", "writer"} {
+				limiter := NewBandwidthLimiter()
+				limiter.SetConfig(BandwidthLimiterConfig{BYTES_PER_SECOND: 1000, BURST: 10})
+				ctx, cancel := context.WithTimeout(context.Background(), test.timeout)
+				defer cancel()
+
+				start := time.Now()
+				var out bytes.Buffer
+				var err error
+				if stream == "reader" {
+					_, err = io.Copy(&out, NewRateLimitedReader(ctx, strings.NewReader(payload), limiter))
+				} else {
+					_, err = NewRateLimitedWriter(ctx, &out, limiter).Write([]byte(payload))
+				}
+				if err != test.wantErr {
+					t.Fatalf("%s: error %v, want %v", stream, err, test.wantErr)
+				}
+				if err == nil && out.String() != payload {
+					t.Fatalf("%s: copied %d bytes, want %d", stream, out.Len(), test.size)
+				}
+				if elapsed := time.Since(start); elapsed < test.wantWait-2*time.Millisecond {
+					t.Fatalf("%s: took %v, want at least %v", stream, elapsed, test.wantWait)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,788 @@
+package core
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RateLimiter is the framework-independent token bucket limiter. The
+// adapter packages turn it into middleware for net/http, gin and others.
+type RateLimiter interface {
+	Run()
+	// RunContext is Run stopping once ctx is done, for limiters that are
+	// replaced at runtime.
+	RunContext(ctx context.Context)
+	// Config returns the config in effect, with its defaults filled in.
+	Config() *limiterState
+	SetConfig(RateLimiterConfig)
+	// SetLimit changes RATE_LIMIT and REFILL_INTERVAL, keeping the rest of
+	// the config. Zero keeps either as it is.
+	SetLimit(limit int64, interval time.Duration) error
+	RefillBucket()
+	// Decide charges the request and reports whether it may proceed.
+	Decide(r *http.Request) Decision
+	// Wait blocks until the request may proceed or its context is done.
+	Wait(r *http.Request) (Decision, error)
+	// ClientIP returns the client IP, honoring TRUSTED_PROXIES.
+	ClientIP(r *http.Request) string
+	// WriteHeaders writes the rate limit headers for a decision.
+	WriteHeaders(h http.Header, d Decision)
+	// VisitHeaders passes the rate limit headers for a decision to set.
+	VisitHeaders(d Decision, set HeaderSetter)
+	Status() BucketStatus
+	StatusEvent() BucketStatusEvent
+	// TopKeys returns the keys denied most recently and often.
+	TopKeys(n int) []KeyCount
+	StoreStats() StoreStats
+	MarkVerified(key string)
+	ResetKey(key string)
+	ThrottleKey(key string, remaining int64, pause time.Duration)
+	ResetAll()
+	// Subscribe sends the limiter's events to callbacks, e.g. for alerting
+	// or billing, until the subscription is closed.
+	Subscribe(SubscriberConfig) *Subscription
+	// Keys and InspectKey report the state of in-memory buckets.
+	Keys() []KeyStatus
+	InspectKey(key string) []KeyStatus
+	AllowKey(key string)
+	DenyKey(key string, d time.Duration)
+	UnlistKey(key string)
+	KeyLists() KeyLists
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+	ExportState() (State, error)
+	ImportState(s State) error
+	// EngageBrake clamps every limit for incident response until it
+	// releases by itself or ReleaseBrake is called.
+	EngageBrake(d time.Duration)
+	ReleaseBrake()
+	BrakeStatus() BrakeStatus
+}
+
+type rateLimiter struct {
+	// The config SetConfig was last called with and what is derived from
+	// it, swapped whole so requests never see half of a new config.
+	state atomic.Pointer[limiterState]
+	// Serializes SetConfig and SetLimit.
+	configMx    sync.Mutex
+	tokenBucket []int64
+	lastRefill  time.Time
+	waiting     int64
+	stats       *limiterStats
+	lists       *keyLists
+	brake       emergencyBrake
+	mx          sync.Mutex
+}
+
+// limiterState is a config, with its defaults filled in, and the buckets
+// and settings derived from it. It is never changed once stored.
+type limiterState struct {
+	RateLimiterConfig
+	// The config as SetConfig was given it, for SetLimit to change.
+	given RateLimiterConfig
+	// KEY_FUNC with COOKIE_KEY_NAME and KEY_BY_PATH applied, nil when all
+	// requests share a bucket.
+	keyFunc    func(r *http.Request) string
+	keyBuckets *storeBuckets
+	global     *storeBuckets
+	trusted    []*net.IPNet
+	geoBuckets map[string]*storeBuckets
+	botBuckets *storeBuckets
+	// Buckets of keys flagged by anomaly detection, nil without an
+	// ANOMALY_PROFILE.
+	anomalyBuckets *storeBuckets
+	// Buckets of the POLICY's PolicyLimit rules, by rule name.
+	policyBuckets map[string]*storeBuckets
+	// Limits of LIMIT_PROVIDER, nil without one.
+	limits   *limitCache
+	verified *verifiedKeys
+	failure  *storeFailure
+}
+
+type RateLimiterConfig struct {
+	RATE_LIMIT      int64
+	REFILL_INTERVAL time.Duration
+	// Gives every key its own bucket, e.g. one per client IP. When nil all
+	// requests share a single bucket.
+	KEY_FUNC func(r *http.Request) string
+	// Adds the request path to the key, giving every route its own bucket.
+	// Works without KEY_FUNC too, for one shared bucket per route.
+	KEY_BY_PATH bool
+	// Whether KEY_BY_PATH uses the route template, e.g. /users/:id, or the
+	// raw URL path. Defaults to PathTemplate.
+	PATH_KEY_MODE PathKeyMode
+	// Applied in order to every key before its bucket is looked up, e.g.
+	// []KeyNormalizer{StripPort, IPv6Prefix(64)}.
+	KEY_NORMALIZERS []KeyNormalizer
+	// Called instead of the default 429 response when a request is rejected.
+	CHALLENGE_HANDLER ChallengeHandler
+	// Bucket size for keys passed to MarkVerified. Defaults to RATE_LIMIT.
+	VERIFIED_RATE_LIMIT int64
+	// How long a verified key keeps its own bucket. Zero means verifying
+	// only refills the key's regular bucket.
+	VERIFIED_DURATION time.Duration
+	// Keys requests by the named cookie, typically a session ID, for users
+	// that share an IP but not a session. Requests without the cookie are
+	// keyed by client IP. Only used when KEY_FUNC is nil.
+	COOKIE_KEY_NAME string
+	// HMAC secret the cookie value is hashed with before it is used as a
+	// key, so raw session IDs never end up in memory, logs or stores.
+	// Required with COOKIE_KEY_NAME.
+	COOKIE_KEY_SECRET []byte
+	// Looks up the client's country and ASN so GEO_PROFILES can give them
+	// a different limit. Only used with KEY_FUNC.
+	GEO_LOCATOR  GeoLocator
+	GEO_PROFILES GeoProfiles
+	// Gives requests classified as bots or crawlers their own, usually
+	// stricter, limit. Only used with KEY_FUNC.
+	BOT_PROFILE *LimitProfile
+	// Decides whether a request comes from a bot. Defaults to
+	// IsBotUserAgent.
+	BOT_CLASSIFIER func(r *http.Request) bool
+	// Minimum Retry-After served to rejected bots, to push crawlers to back
+	// off for longer than humans.
+	BOT_RETRY_AFTER time.Duration
+	// Looks up the limits of keys that have their own, e.g. per customer in
+	// a billing database. Only used with KEY_FUNC.
+	LIMIT_PROVIDER LimitProvider
+	// How long a limit looked up is used as is, and how long a failed lookup
+	// waits to be retried. Defaults to one minute.
+	LIMIT_CACHE_TTL time.Duration
+	// How long past LIMIT_CACHE_TTL a limit is still used while a lookup in
+	// the background refreshes it, so requests never wait on the provider
+	// for keys seen recently. Defaults to ten minutes.
+	LIMIT_STALE_TTL time.Duration
+	// Most keys whose limit is cached. Defaults to 100000.
+	LIMIT_CACHE_SIZE int
+	// Called when LIMIT_PROVIDER fails. The key keeps the limit it last
+	// had, or gets the limiter's.
+	ON_LIMIT_ERROR func(key string, err error)
+	// A process-wide bucket checked together with each key's bucket, so
+	// one middleware gives both server protection and per-client fairness.
+	// Only used with KEY_FUNC.
+	GLOBAL_RATE_LIMIT      int64
+	GLOBAL_REFILL_INTERVAL time.Duration
+	// Parks rejected requests for up to MAX_WAIT until a token frees up
+	// instead of rejecting them straight away.
+	MAX_WAIT time.Duration
+	// Maximum number of parked requests. Defaults to RATE_LIMIT.
+	MAX_QUEUE int64
+	// Proxies (CIDRs or IPs) whose X-Forwarded-For and X-Real-IP headers
+	// are believed when working out the client IP.
+	TRUSTED_PROXIES []string
+	// Exempts private, loopback and link-local client IPs, such as internal
+	// service-to-service calls and health probes, from limiting.
+	SKIP_PRIVATE_NETWORKS bool
+	// Decides per request whether limits are enforced, e.g. from a feature
+	// flag. Requests it turns away from enforcement are exempt. Nil always
+	// enforces.
+	ENABLED EnabledFunc
+	// Ordered rules matching requests to what happens to them, the first
+	// match winning. Only used with KEY_FUNC.
+	POLICY Policy
+	// Flags keys whose requests in an ANOMALY_INTERVAL exceed their
+	// baseline, an EWMA of their past intervals, this many times over,
+	// e.g. 5, and sends an EventAnomaly, so abuse is caught even when it
+	// stays under the limits. Zero disables it. Only used with KEY_FUNC.
+	ANOMALY_FACTOR float64
+	// Defaults to one minute.
+	ANOMALY_INTERVAL time.Duration
+	// Weight of the latest interval in the baseline, above zero and at
+	// most one. Defaults to 0.2.
+	ANOMALY_SMOOTHING float64
+	// Fewest requests in an interval for a key to be flagged, so quiet
+	// keys aren't flagged for a handful of requests. Defaults to 10.
+	ANOMALY_MIN_REQUESTS int64
+	// How long a key stays flagged. Defaults to ten minutes.
+	ANOMALY_DURATION time.Duration
+	// Limit of flagged keys, whose requests draw from buckets of their own
+	// under the rule "anomaly" unless a POLICY rule matches them. Nil only
+	// flags them.
+	ANOMALY_PROFILE *LimitProfile
+	// Fraction of every limit left to requests while the emergency brake
+	// of EngageBrake is engaged, e.g. 0.1 for a tenth of the burst and the
+	// refill rate. Defaults to 0.1.
+	BRAKE_FRACTION float64
+	// Fractions of the limits of rules, e.g. "bot" or a POLICY rule name,
+	// taking the place of BRAKE_FRACTION for them. Zero rejects every
+	// request of the rule while braking. The rules "shared" and "global"
+	// stand for the shared and GLOBAL_RATE_LIMIT buckets.
+	BRAKE_RULES map[string]float64
+	// How long the brake stays engaged when EngageBrake isn't given how
+	// long. Defaults to fifteen minutes.
+	BRAKE_DURATION time.Duration
+	// Fraction of the bucket used, e.g. 0.8, from which allowed requests
+	// get a warning header and ON_SOFT_LIMIT is called, so clients and
+	// alerting can react before requests start failing. Zero disables it.
+	SOFT_LIMIT_THRESHOLD float64
+	// Called for every allowed request past SOFT_LIMIT_THRESHOLD. It runs
+	// on the request path, so it must be quick.
+	ON_SOFT_LIMIT func(r *http.Request, key string, remaining int64)
+	// Called with every decision, exempt ones included, and how long it
+	// took, waiting for a token under MAX_WAIT included, e.g. to export
+	// metrics. It runs on the request path, so it must be quick.
+	ON_DECISION func(r *http.Request, d Decision, elapsed time.Duration)
+	// Logs rejected requests and blocked keys with their key, rule,
+	// remaining tokens and retry delay. Keys are hashed unless
+	// DEBUG_RAW_KEYS is set. Nil logs nothing.
+	LOGGER *slog.Logger
+	// Level rejections are logged at. Defaults to slog.LevelInfo.
+	REJECT_LOG_LEVEL slog.Leveler
+	// Logs the first and then every REJECT_LOG_SAMPLE-th rejection of each
+	// key, so logging stays cheap under attack. The rest are counted in a
+	// summary RunContext logs every REJECT_LOG_SUMMARY_INTERVAL, which
+	// also starts the count of each key over. Zero or one logs every
+	// rejection.
+	REJECT_LOG_SAMPLE int64
+	// Defaults to one minute.
+	REJECT_LOG_SUMMARY_INTERVAL time.Duration
+	// Level keys blocked by ThrottleKey or flagged by anomaly detection
+	// are logged at. Defaults to slog.LevelWarn.
+	BAN_LOG_LEVEL slog.Leveler
+	// Records every rejected request, or a sample, as a JSON line.
+	AUDIT_LOG *AuditLog
+	// Controls which rate limit headers are written and under which names.
+	// Defaults to DefaultHeaderPolicy.
+	HEADER_POLICY *HeaderPolicy
+	// How CORS preflight requests are treated. Defaults to PreflightCharge.
+	PREFLIGHT PreflightMode
+	// Adds X-RateLimit-Key and X-RateLimit-Rule headers naming the bucket
+	// key and the rule that applied, to check policies during rollout. The
+	// key is hashed unless DEBUG_RAW_KEYS is set, which also shows raw
+	// keys in status events.
+	DEBUG_HEADERS  bool
+	DEBUG_RAW_KEYS bool
+	// How often the status stream sends an update. Defaults to one second.
+	STATUS_STREAM_INTERVAL time.Duration
+	// Keeps the StatsHistory of each rule as well as the limiter's.
+	HISTORY_BY_RULE bool
+	// Rolling window TopKeys counts denials over. Defaults to five
+	// minutes.
+	TOP_KEYS_WINDOW time.Duration
+	// Creates the stores keyed buckets are kept in, e.g. to share them
+	// between replicas. Defaults to NewMemoryStore. Only used with
+	// KEY_FUNC; return "" from it for one bucket shared by every request.
+	STORE StoreFactory
+	// What happens to requests while STORE fails. Defaults to
+	// StoreFailOpen. Decisions made without the store are counted in
+	// DegradedTotal of StatusEvent.
+	STORE_FAILURE_POLICY StoreFailurePolicy
+	// Longest a store call may take before the request is decided by
+	// STORE_FAILURE_POLICY instead, so a slow store adds at most this much
+	// latency. Zero waits for the store's own timeout.
+	STORE_LATENCY_BUDGET time.Duration
+	// Store failures in a row, timeouts included, after which the store is
+	// skipped for STORE_BREAKER_COOLDOWN and requests are decided by
+	// STORE_FAILURE_POLICY. After the cooldown a single call probes
+	// whether the store has recovered. Zero disables the breaker.
+	STORE_BREAKER_THRESHOLD int
+	// Defaults to five seconds.
+	STORE_BREAKER_COOLDOWN time.Duration
+	// File the in-memory buckets are saved to, so quotas and locked keys
+	// survive restarts. RunContext restores it if it exists, then saves it
+	// every SNAPSHOT_INTERVAL and once more when its context is done.
+	SNAPSHOT_FILE string
+	// Defaults to one minute.
+	SNAPSHOT_INTERVAL time.Duration
+	// Called when SNAPSHOT_FILE can't be read, restored or saved.
+	ON_SNAPSHOT_ERROR func(err error)
+}
+
+// Validate reports settings SetConfig can't work with. SetConfig panics on
+// them, so configs loaded at runtime should be validated first.
+func (c RateLimiterConfig) Validate() error {
+	if err := c.validateCookie(); err != nil {
+		return err
+	}
+	if err := c.validateAnomaly(); err != nil {
+		return err
+	}
+	if err := c.validateBrake(); err != nil {
+		return err
+	}
+	return c.POLICY.Validate()
+}
+
+type BucketStatus struct {
+	// The burst: most tokens the bucket holds.
+	BucketLimit       int64
+	CurrentBucketSize int64
+	// Tokens gained a second, one every RefillInterval.
+	RefillRate     float64
+	RefillInterval time.Duration
+	// Until the shared bucket gains its next token, zero while it is full.
+	NextTokenIn time.Duration
+	// Since the limiter was created.
+	Uptime       time.Duration
+	AllowedTotal int64
+	DeniedTotal  int64
+	// Keys with an in-memory bucket, across every set. Buckets kept in
+	// another STORE aren't counted.
+	TrackedKeys int
+	// Tracked keys whose bucket isn't full or that are locked, i.e. keys
+	// that drew on their bucket within the time it takes to refill.
+	ActiveKeys int
+	History    *StatsHistory `json:",omitempty"`
+}
+
+// Decision is the outcome of charging a single request.
+type Decision struct {
+	// Bucket key, empty when all requests share a bucket.
+	Key     string
+	Allowed bool
+	// Set for requests that bypass limiting; no headers are written.
+	Exempt bool
+	// Set for rejections waiting can't lift, by the denylist or a POLICY
+	// deny or challenge; MAX_WAIT and Wait return them at once.
+	Final bool
+	// Name of the rule that picked the bucket, e.g. "default" or "bot".
+	Rule string
+	// Set once the bucket is past SOFT_LIMIT_THRESHOLD.
+	Warning    bool
+	Limit      int64
+	Remaining  int64
+	RetryAfter time.Duration
+}
+
+func New() RateLimiter {
+	r := &rateLimiter{stats: newLimiterStats(), lists: newKeyLists()}
+	r.state.Store(&limiterState{})
+	return r
+}
+
+// config returns the config in effect. Methods load it once, so a
+// concurrent SetConfig doesn't change it under them.
+func (r *rateLimiter) config() *limiterState {
+	return r.state.Load()
+}
+
+func (r *rateLimiter) Config() *limiterState {
+	return r.config()
+}
+
+// Keyed reports whether requests are keyed, by KEY_FUNC or
+// COOKIE_KEY_NAME, rather than sharing a bucket.
+func (c *limiterState) Keyed() bool {
+	return c.keyFunc != nil
+}
+
+// SetConfig puts a config in effect, giving in-memory buckets a fresh start
+// under it. It panics on configs that don't validate.
+func (r *rateLimiter) SetConfig(rateLimiter RateLimiterConfig) {
+	if err := rateLimiter.Validate(); err != nil {
+		panic(err)
+	}
+	r.configMx.Lock()
+	defer r.configMx.Unlock()
+
+	r.state.Store(r.newState(rateLimiter))
+}
+
+// SetLimit changes the limit of the config last set, e.g. from the admin
+// API. In-memory buckets start over under the new limit, as with
+// SetConfig, and defaults derived from the limit, such as MAX_QUEUE, follow
+// it unless they were set.
+func (r *rateLimiter) SetLimit(limit int64, interval time.Duration) error {
+	r.configMx.Lock()
+	defer r.configMx.Unlock()
+
+	config := r.config().given
+	if limit > 0 {
+		config.RATE_LIMIT = limit
+	}
+	if interval > 0 {
+		config.REFILL_INTERVAL = interval
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	r.state.Store(r.newState(config))
+	return nil
+}
+
+// newState fills in the config's defaults and derives the buckets from it.
+// The caller must hold r.configMx.
+func (r *rateLimiter) newState(rateLimiter RateLimiterConfig) *limiterState {
+	given := rateLimiter
+	if rateLimiter.VERIFIED_RATE_LIMIT == 0 {
+		rateLimiter.VERIFIED_RATE_LIMIT = rateLimiter.RATE_LIMIT
+	}
+	if rateLimiter.MAX_QUEUE == 0 {
+		rateLimiter.MAX_QUEUE = rateLimiter.RATE_LIMIT
+	}
+	if rateLimiter.BOT_CLASSIFIER == nil {
+		rateLimiter.BOT_CLASSIFIER = IsBotUserAgent
+	}
+	if rateLimiter.HEADER_POLICY == nil {
+		policy := DefaultHeaderPolicy
+		rateLimiter.HEADER_POLICY = &policy
+	}
+	if rateLimiter.STATUS_STREAM_INTERVAL == 0 {
+		rateLimiter.STATUS_STREAM_INTERVAL = time.Second
+	}
+	if rateLimiter.TOP_KEYS_WINDOW <= 0 {
+		rateLimiter.TOP_KEYS_WINDOW = defaultTopKeysWindow
+	}
+	if rateLimiter.STORE_BREAKER_COOLDOWN == 0 {
+		rateLimiter.STORE_BREAKER_COOLDOWN = 5 * time.Second
+	}
+	if rateLimiter.LIMIT_CACHE_TTL <= 0 {
+		rateLimiter.LIMIT_CACHE_TTL = time.Minute
+	}
+	if rateLimiter.LIMIT_STALE_TTL == 0 {
+		rateLimiter.LIMIT_STALE_TTL = 10 * time.Minute
+	}
+	if rateLimiter.LIMIT_CACHE_SIZE <= 0 {
+		rateLimiter.LIMIT_CACHE_SIZE = 100000
+	}
+	if rateLimiter.ANOMALY_INTERVAL <= 0 {
+		rateLimiter.ANOMALY_INTERVAL = time.Minute
+	}
+	if rateLimiter.ANOMALY_SMOOTHING == 0 {
+		rateLimiter.ANOMALY_SMOOTHING = 0.2
+	}
+	if rateLimiter.ANOMALY_MIN_REQUESTS == 0 {
+		rateLimiter.ANOMALY_MIN_REQUESTS = 10
+	}
+	if rateLimiter.ANOMALY_DURATION <= 0 {
+		rateLimiter.ANOMALY_DURATION = 10 * time.Minute
+	}
+	if rateLimiter.BRAKE_FRACTION == 0 {
+		rateLimiter.BRAKE_FRACTION = 0.1
+	}
+	if rateLimiter.BRAKE_DURATION <= 0 {
+		rateLimiter.BRAKE_DURATION = 15 * time.Minute
+	}
+	if rateLimiter.SNAPSHOT_INTERVAL == 0 {
+		rateLimiter.SNAPSHOT_INTERVAL = time.Minute
+	}
+	if rateLimiter.REJECT_LOG_LEVEL == nil {
+		rateLimiter.REJECT_LOG_LEVEL = slog.LevelInfo
+	}
+	if rateLimiter.BAN_LOG_LEVEL == nil {
+		rateLimiter.BAN_LOG_LEVEL = slog.LevelWarn
+	}
+	if rateLimiter.REJECT_LOG_SUMMARY_INTERVAL == 0 {
+		rateLimiter.REJECT_LOG_SUMMARY_INTERVAL = time.Minute
+	}
+
+	c := &limiterState{RateLimiterConfig: rateLimiter, given: given, keyFunc: rateLimiter.KEY_FUNC}
+	if c.keyFunc == nil && rateLimiter.COOKIE_KEY_NAME != "" {
+		c.keyFunc = c.cookieKey
+	}
+	if rateLimiter.KEY_BY_PATH {
+		c.keyFunc = pathKey(c.keyFunc, rateLimiter.PATH_KEY_MODE)
+	}
+
+	failure := r.stats.storeFailure(rateLimiter)
+	c.failure = failure
+	r.stats.topKeys.setWindow(rateLimiter.TOP_KEYS_WINDOW)
+	r.stats.history.setByRule(rateLimiter.HISTORY_BY_RULE)
+	r.stats.anomalies.configure(rateLimiter)
+	c.keyBuckets = newStoreBuckets(rateLimiter.STORE, failure, "default", LimitProfile{
+		RATE_LIMIT:      rateLimiter.RATE_LIMIT,
+		REFILL_INTERVAL: rateLimiter.REFILL_INTERVAL,
+	})
+	c.trusted = parseCIDRs(rateLimiter.TRUSTED_PROXIES)
+	c.geoBuckets = rateLimiter.GEO_PROFILES.buckets(rateLimiter.STORE, failure)
+	c.policyBuckets = rateLimiter.POLICY.buckets(rateLimiter.STORE, failure)
+	c.limits = newLimitCache(rateLimiter, failure)
+	if rateLimiter.BOT_PROFILE != nil {
+		c.botBuckets = newStoreBuckets(rateLimiter.STORE, failure, "bot", *rateLimiter.BOT_PROFILE)
+	}
+	if rateLimiter.ANOMALY_PROFILE != nil {
+		c.anomalyBuckets = newStoreBuckets(rateLimiter.STORE, failure, "anomaly", *rateLimiter.ANOMALY_PROFILE)
+	}
+	if rateLimiter.GLOBAL_RATE_LIMIT > 0 {
+		c.global = newStoreBuckets(rateLimiter.STORE, failure, "global", LimitProfile{
+			RATE_LIMIT:      rateLimiter.GLOBAL_RATE_LIMIT,
+			REFILL_INTERVAL: rateLimiter.GLOBAL_REFILL_INTERVAL,
+		})
+	}
+	c.verified = newVerifiedKeys(newStoreBuckets(rateLimiter.STORE, failure, "verified", LimitProfile{
+		RATE_LIMIT:      rateLimiter.VERIFIED_RATE_LIMIT,
+		REFILL_INTERVAL: rateLimiter.REFILL_INTERVAL,
+	}))
+	return c
+}
+
+func (r *rateLimiter) RefillBucket() {
+	c := r.config()
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	r.lastRefill = time.Now()
+	if int64(len(r.tokenBucket)) < c.RATE_LIMIT {
+		r.tokenBucket = append(r.tokenBucket, r.lastRefill.UnixNano())
+		if r.stats.events.active() {
+			r.stats.events.emit(Event{Kind: EventRefill, Time: r.lastRefill, Rule: "shared", Remaining: int64(len(r.tokenBucket))})
+		}
+	}
+}
+
+// exempt reports whether the request bypasses limiting altogether.
+func (c *limiterState) exempt(request *http.Request) bool {
+	if c.ENABLED != nil && !c.ENABLED(request.Context()) {
+		return true
+	}
+	if c.PREFLIGHT == PreflightSkip && isPreflight(request) {
+		return true
+	}
+	return c.SKIP_PRIVATE_NETWORKS && isPrivateIP(c.clientIP(request))
+}
+
+// clientIP returns the client IP, honoring TRUSTED_PROXIES.
+func (c *limiterState) clientIP(request *http.Request) string {
+	return resolveClientIP(request, c.trusted)
+}
+
+// ClientIP returns the client IP, honoring TRUSTED_PROXIES, for KEY_FUNCs
+// keying by IP behind a proxy.
+func (r *rateLimiter) ClientIP(request *http.Request) string {
+	c := r.config()
+	return c.clientIP(request)
+}
+
+// allow charges the request against its bucket.
+func (r *rateLimiter) allow(request *http.Request) Decision {
+	c := r.config()
+	if c.exempt(request) {
+		return Decision{Allowed: true, Exempt: true}
+	}
+
+	// Free requests are rejected when the bucket is empty but never use up
+	// a token themselves.
+	free := c.PREFLIGHT == PreflightFree && isPreflight(request)
+	cost := requestCost(request)
+	// Requests are charged scale times over while the brake is engaged,
+	// and the tokens reported in as many times fewer requests.
+	take := func(buckets *storeBuckets, key string, scale int64) (bool, int64, time.Duration) {
+		if free {
+			return buckets.peek(key, cost*scale)
+		}
+		return buckets.take(key, cost*scale)
+	}
+
+	if c.keyFunc == nil {
+		scale, blocked, until := r.brakeScale("shared", c.RATE_LIMIT)
+		if blocked {
+			return Decision{Rule: "shared", Limit: c.RATE_LIMIT, RetryAfter: until}
+		}
+		charge := cost * scale
+
+		r.mx.Lock()
+		defer r.mx.Unlock()
+
+		if int64(len(r.tokenBucket)) >= charge {
+			if !free {
+				r.tokenBucket = r.tokenBucket[charge:]
+			}
+			return Decision{Allowed: true, Rule: "shared", Limit: c.RATE_LIMIT / scale, Remaining: int64(len(r.tokenBucket)) / scale}
+		}
+		retryAfter := time.Duration(charge-int64(len(r.tokenBucket))) * c.REFILL_INTERVAL
+		if !r.lastRefill.IsZero() {
+			retryAfter -= time.Since(r.lastRefill)
+		}
+		return Decision{Rule: "shared", Limit: c.RATE_LIMIT / scale, RetryAfter: retryAfter}
+	}
+
+	key := c.key(request)
+	if listed, denied, until := r.lists.check(key, time.Now()); listed {
+		return Decision{Key: key, Rule: "allowlist", Allowed: true, Exempt: true}
+	} else if denied {
+		// Denied keys aren't queued; ones that expire learn when.
+		var retryAfter time.Duration
+		if !until.IsZero() {
+			retryAfter = time.Until(until)
+		}
+		return Decision{Key: key, Rule: "denylist", Final: true, RetryAfter: retryAfter}
+	}
+
+	anomalous := r.anomalous(key)
+	var buckets *storeBuckets
+	var rule string
+	if match := c.POLICY.match(request, c.clientIP(request)); match != nil {
+		switch match.ACTION {
+		case PolicyAllow:
+			return Decision{Key: key, Rule: match.NAME, Allowed: true, Exempt: true}
+		case PolicyDeny:
+			return Decision{Key: key, Rule: match.NAME, Final: true}
+		case PolicyChallenge:
+			if !c.verified.isVerified(key) {
+				return Decision{Key: key, Rule: match.NAME, Final: true}
+			}
+		case PolicyLimit:
+			buckets, rule = c.policyBuckets[match.NAME], match.NAME
+		}
+	}
+	if buckets == nil && anomalous && c.anomalyBuckets != nil {
+		buckets, rule = c.anomalyBuckets, "anomaly"
+	}
+	bot := buckets == nil && c.botBuckets != nil && c.BOT_CLASSIFIER(request)
+	if buckets == nil {
+		buckets, rule = c.bucketsFor(request, key, bot)
+	}
+
+	scale, blocked, until := r.brakeScale(rule, buckets.limit)
+	if blocked {
+		return Decision{Key: key, Rule: rule, Limit: buckets.limit, RetryAfter: until}
+	}
+	allowed, remaining, retryAfter := take(buckets, key, scale)
+	limit, remaining := buckets.limit/scale, remaining/scale
+	if !allowed && bot && retryAfter < c.BOT_RETRY_AFTER {
+		retryAfter = c.BOT_RETRY_AFTER
+	}
+	if !allowed || c.global == nil {
+		return Decision{Key: key, Rule: rule, Allowed: allowed, Limit: limit, Remaining: remaining, RetryAfter: retryAfter}
+	}
+
+	// The key's token is handed back when the global bucket is empty, and
+	// the headers report whichever bucket is closer to running out.
+	globalScale, globalBlocked, globalUntil := r.brakeScale("global", c.global.limit)
+	globalAllowed, globalRemaining, globalRetryAfter := false, int64(0), globalUntil
+	if !globalBlocked {
+		globalAllowed, globalRemaining, globalRetryAfter = take(c.global, "", globalScale)
+	}
+	globalLimit, globalRemaining := c.global.limit/globalScale, globalRemaining/globalScale
+	if !globalAllowed {
+		if !free {
+			buckets.refund(key, cost*scale)
+		}
+		return Decision{Key: key, Rule: "global", Limit: globalLimit, Remaining: globalRemaining, RetryAfter: globalRetryAfter}
+	}
+	if globalRemaining < remaining {
+		return Decision{Key: key, Rule: "global", Allowed: true, Limit: globalLimit, Remaining: globalRemaining}
+	}
+	return Decision{Key: key, Rule: rule, Allowed: true, Limit: limit, Remaining: remaining}
+}
+
+// bucketsFor picks the buckets the key draws from, and the name of the rule
+// that chose them: those for verified keys, then those for bots, then those
+// of the key's LIMIT_PROVIDER limit, then those of a matching geo profile,
+// then the default ones.
+func (c *limiterState) bucketsFor(request *http.Request, key string, bot bool) (*storeBuckets, string) {
+	if c.verified.isVerified(key) {
+		return c.verified.buckets, "verified"
+	}
+	if bot {
+		return c.botBuckets, "bot"
+	}
+	if buckets, rule := c.providedBucketsFor(request, key); buckets != nil {
+		return buckets, rule
+	}
+	if buckets, profile := c.geoBucketsFor(request); buckets != nil {
+		return buckets, "geo " + profile
+	}
+	return c.keyBuckets, "default"
+}
+
+// Decide charges the request, waiting for a token if MAX_WAIT allows it,
+// and records the outcome.
+func (r *rateLimiter) Decide(request *http.Request) Decision {
+	start := time.Now()
+	return r.settle(request, start, r.wait(request, r.allow(request)))
+}
+
+// settle records the final decision for a request started at start and
+// flags the soft limit.
+func (r *rateLimiter) settle(request *http.Request, start time.Time, d Decision) Decision {
+	c := r.config()
+	if c.ON_DECISION != nil {
+		defer func() { c.ON_DECISION(request, d, time.Since(start)) }()
+	}
+	if d.Exempt {
+		return d
+	}
+
+	r.stats.record(d)
+	r.emitDecision(d)
+	if !d.Allowed && c.LOGGER != nil {
+		r.logRejection(request, d)
+	}
+	if !d.Allowed && c.AUDIT_LOG != nil {
+		c.AUDIT_LOG.record(request, d)
+	}
+	if d.Allowed && c.SOFT_LIMIT_THRESHOLD > 0 && d.Limit > 0 &&
+		float64(d.Limit-d.Remaining)/float64(d.Limit) >= c.SOFT_LIMIT_THRESHOLD {
+		d.Warning = true
+		if c.ON_SOFT_LIMIT != nil {
+			c.ON_SOFT_LIMIT(request, d.Key, d.Remaining)
+		}
+	}
+	return d
+}
+
+func (r *rateLimiter) Status() BucketStatus {
+	c := r.config()
+	now := time.Now()
+	tracked, active := 0, 0
+	if c.keyBuckets != nil {
+		for _, buckets := range c.namedBuckets() {
+			if store, ok := buckets.store.(*memoryStore); ok {
+				all, drawn := store.buckets.count(now)
+				tracked += all
+				active += drawn
+			}
+		}
+	}
+	allowed, denied := r.stats.totals()
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	status := BucketStatus{
+		BucketLimit:       c.RATE_LIMIT,
+		CurrentBucketSize: int64(len(r.tokenBucket)),
+		RefillInterval:    c.REFILL_INTERVAL,
+		Uptime:            now.Sub(r.stats.started),
+		AllowedTotal:      allowed,
+		DeniedTotal:       denied,
+		TrackedKeys:       tracked,
+		ActiveKeys:        active,
+		History:           r.stats.history.snapshot(now),
+	}
+	if c.REFILL_INTERVAL > 0 {
+		status.RefillRate = float64(time.Second) / float64(c.REFILL_INTERVAL)
+	}
+	if status.CurrentBucketSize < c.RATE_LIMIT {
+		// Before Run's first refill the interval counts from creation.
+		last := r.lastRefill
+		if last.IsZero() {
+			last = r.stats.started
+		}
+		status.NextTokenIn = max(last.Add(c.REFILL_INTERVAL).Sub(now), 0)
+	}
+	return status
+}
+
+func (r *rateLimiter) Run() {
+	r.RunContext(context.Background())
+}
+
+func (r *rateLimiter) RunContext(ctx context.Context) {
+	c := r.config()
+	if c.SNAPSHOT_FILE != "" {
+		r.runSnapshots(ctx)
+	}
+	if c.LOGGER != nil && c.REJECT_LOG_SAMPLE > 1 {
+		r.runLogSummaries(ctx)
+	}
+	ticker := time.NewTicker(c.REFILL_INTERVAL)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.RefillBucket()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGlobalBucket(t *testing.T) {
+	tests := []struct {
+		name        string
+		globalLimit int64
+		clients     []string
+		wantAllowed []bool
+		wantRules   []string
+	}{
+		{
+			name:        "no global bucket",
+			clients:     []string{"a", "b", "c"},
+			wantAllowed: []bool{true, true, true},
+			wantRules:   []string{"default", "default", "default"},
+		},
+		{
+			name:        "global bucket runs out",
+			globalLimit: 2,
+			clients:     []string{"a", "b", "c"},
+			wantAllowed: []bool{true, true, false},
+			wantRules:   []string{"default", "global", "global"},
+		},
+		{
+			name:        "key bucket runs out first",
+			globalLimit: 5,
+			clients:     []string{"a", "a", "a"},
+			wantAllowed: []bool{true, true, false},
+			wantRules:   []string{"default", "default", "default"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:             2,
+				REFILL_INTERVAL:        time.Hour,
+				KEY_FUNC:               func(r *http.Request) string { return r.Header.Get("X-Client") },
+				GLOBAL_RATE_LIMIT:      test.globalLimit,
+				GLOBAL_REFILL_INTERVAL: time.Hour,
+			})
+
+			for i, client := range test.clients {
+				request := httptest.NewRequest(http.MethodGet, "/", nil)
+				request.Header.Set("X-Client", client)
+				d := limiter.Decide(request)
+				if d.Allowed != test.wantAllowed[i] || d.Rule != test.wantRules[i] {
+					t.Fatalf("request %d from %s: allowed %v by %q, want %v by %q",
+						i, client, d.Allowed, d.Rule, test.wantAllowed[i], test.wantRules[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGlobalRejectionRefundsKey(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:             2,
+		REFILL_INTERVAL:        time.Hour,
+		KEY_FUNC:               remoteIP,
+		GLOBAL_RATE_LIMIT:      1,
+		GLOBAL_REFILL_INTERVAL: time.Hour,
+	})
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	limiter.Decide(request)
+	limiter.Decide(request)
+	limiter.Config().global = newStoreBuckets(nil, nil, "global", LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour})
+	if d := limiter.Decide(request); !d.Allowed || d.Remaining != 0 {
+		t.Fatalf("decision after a global rejection = %+v, want the key's token handed back", d)
+	}
+}
+
+func TestSoftLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		threshold   float64
+		wantWarning []bool
+	}{
+		{name: "disabled", threshold: 0, wantWarning: []bool{false, false, false, false}},
+		{name: "half", threshold: 0.5, wantWarning: []bool{false, true, true, true}},
+		{name: "last token", threshold: 1, wantWarning: []bool{false, false, false, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var warned []int64
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:           4,
+				REFILL_INTERVAL:      time.Hour,
+				KEY_FUNC:             remoteIP,
+				SOFT_LIMIT_THRESHOLD: test.threshold,
+				ON_SOFT_LIMIT: func(r *http.Request, key string, remaining int64) {
+					warned = append(warned, remaining)
+				},
+			})
+
+			calls := 0
+			for i, want := range test.wantWarning {
+				d := limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+				if d.Warning != want {
+					t.Fatalf("request %d: warning = %v, want %v", i, d.Warning, want)
+				}
+				if want {
+					calls++
+				}
+			}
+			if len(warned) != calls {
+				t.Fatalf("ON_SOFT_LIMIT called %d times, want %d", len(warned), calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import (
+	"time"
+)
+
+// allKeyedBuckets returns every bucket set a key may draw from.
+func (c *limiterState) allKeyedBuckets() []*storeBuckets {
+	buckets := []*storeBuckets{c.keyBuckets, c.verified.buckets}
+	if c.botBuckets != nil {
+		buckets = append(buckets, c.botBuckets)
+	}
+	if c.anomalyBuckets != nil {
+		buckets = append(buckets, c.anomalyBuckets)
+	}
+	for _, geo := range c.geoBuckets {
+		buckets = append(buckets, geo)
+	}
+	return buckets
+}
+
+// ResetKey gives key a full bucket again, e.g. to unblock a customer who was
+// throttled by mistake.
+func (r *rateLimiter) ResetKey(key string) {
+	c := r.config()
+	if c.keyBuckets == nil {
+		return
+	}
+
+	key = c.normalizeKey(key)
+	for _, buckets := range c.allKeyedBuckets() {
+		buckets.reset(key)
+	}
+	r.stats.anomalies.forget(key)
+}
+
+// ThrottleKey brings key's bucket in line with what an upstream reports:
+// at most remaining tokens, unless remaining is negative, and none at all
+// until pause has passed. Clients use it to follow an upstream's own rate
+// limit headers.
+func (r *rateLimiter) ThrottleKey(key string, remaining int64, pause time.Duration) {
+	c := r.config()
+	if c.keyBuckets == nil {
+		return
+	}
+
+	key = c.normalizeKey(key)
+	for _, buckets := range c.allKeyedBuckets() {
+		buckets.throttle(key, remaining, pause)
+	}
+	if pause > 0 && c.LOGGER != nil {
+		r.logBan(key, remaining, pause)
+	}
+}
+
+// ResetAll gives every key, and the shared bucket, a full bucket again.
+func (r *rateLimiter) ResetAll() {
+	c := r.config()
+	if c.keyBuckets != nil {
+		for _, buckets := range c.allKeyedBuckets() {
+			buckets.resetAll()
+		}
+	}
+	if c.global != nil {
+		c.global.resetAll()
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	now := time.Now().UnixNano()
+	for int64(len(r.tokenBucket)) < c.RATE_LIMIT {
+		r.tokenBucket = append(r.tokenBucket, now)
+	}
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"context"
+	"net/http"
+)
+
+// PathKeyMode chooses which path KEY_BY_PATH adds to the key.
+type PathKeyMode int
+
+const (
+	// PathTemplate keys by the matched route template, so /users/1 and
+	// /users/2 share the /users/:id bucket. Falls back to the raw path
+	// when no template is known.
+	PathTemplate PathKeyMode = iota
+	// PathRaw keys by the concrete URL path.
+	PathRaw
+)
+
+type routeTemplateKey struct{}
+
+// WithRouteTemplate records the route template the router matched, for
+// adapters of routers that know it.
+func WithRouteTemplate(r *http.Request, template string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), routeTemplateKey{}, template))
+}
+
+// RouteTemplate returns the route template matched for the request, e.g.
+// /users/:id, or the raw URL path when the router did not record one.
+func RouteTemplate(r *http.Request) string {
+	if template, ok := RouteTemplateFromContext(r.Context()); ok {
+		return template
+	}
+	return r.URL.Path
+}
+
+// RouteTemplateFromContext returns the route template recorded in a
+// request's context, e.g. for an EnabledFunc.
+func RouteTemplateFromContext(ctx context.Context) (string, bool) {
+	template, ok := ctx.Value(routeTemplateKey{}).(string)
+	return template, ok
+}
+
+// pathKey wraps keyFunc to add the request's path to its key.
+func pathKey(keyFunc func(r *http.Request) string, mode PathKeyMode) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		path := r.URL.Path
+		if mode == PathTemplate {
+			path = RouteTemplate(r)
+		}
+
+		if keyFunc == nil {
+			return path
+		}
+		return keyFunc(r) + "|" + path
+	}
+}
@@ -0,0 +1,34 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPathKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyFunc  func(r *http.Request) string
+		mode     PathKeyMode
+		template string
+		want     string
+	}{
+		{name: "template", mode: PathTemplate, template: "/users/:id", want: "/users/:id"},
+		{name: "no template recorded", mode: PathTemplate, want: "/users/1"},
+		{name: "raw", mode: PathRaw, template: "/users/:id", want: "/users/1"},
+		{name: "with key", keyFunc: func(r *http.Request) string { return "client" }, mode: PathTemplate, template: "/users/:id", want: "client|/users/:id"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			if test.template != "" {
+				r = WithRouteTemplate(r, test.template)
+			}
+			if got := pathKey(test.keyFunc, test.mode)(r); got != test.want {
+				t.Fatalf("key = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
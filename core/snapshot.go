@@ -0,0 +1,215 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the snapshot format changes.
+const snapshotVersion = 1
+
+type snapshot struct {
+	Version int
+	Taken   time.Time
+	// Keyed buckets by set, e.g. "default", "bot" or "geo country:DE".
+	Sets     map[string][]BucketState
+	Verified map[string]time.Time
+	// Token timestamps of the bucket shared by unkeyed requests.
+	Shared []int64
+}
+
+// namedBuckets returns the limiter's bucket sets by the name their store
+// was created with.
+func (c *limiterState) namedBuckets() map[string]*storeBuckets {
+	sets := map[string]*storeBuckets{"default": c.keyBuckets, "verified": c.verified.buckets}
+	if c.botBuckets != nil {
+		sets["bot"] = c.botBuckets
+	}
+	if c.anomalyBuckets != nil {
+		sets["anomaly"] = c.anomalyBuckets
+	}
+	if c.global != nil {
+		sets["global"] = c.global
+	}
+	for name, geo := range c.geoBuckets {
+		sets["geo "+name] = geo
+	}
+	for name, policy := range c.policyBuckets {
+		sets["policy "+name] = policy
+	}
+	if c.limits != nil {
+		for name, limit := range c.limits.named() {
+			sets[name] = limit
+		}
+	}
+	return sets
+}
+
+// Snapshot returns the state of the limiter's in-memory buckets, throttled
+// and locked keys and verified keys included, for Restore after a restart.
+// Buckets kept in a shared STORE outlive the process anyway and are left
+// out.
+func (r *rateLimiter) Snapshot() ([]byte, error) {
+	c := r.config()
+	s := snapshot{
+		Version:  snapshotVersion,
+		Taken:    time.Now(),
+		Sets:     map[string][]BucketState{},
+		Verified: c.verified.snapshot(),
+	}
+	for name, buckets := range c.namedBuckets() {
+		if store, ok := buckets.store.(*memoryStore); ok {
+			s.Sets[name] = store.buckets.snapshot()
+		}
+	}
+
+	r.mx.Lock()
+	s.Shared = append([]int64(nil), r.tokenBucket...)
+	r.mx.Unlock()
+
+	return json.Marshal(s)
+}
+
+// Restore replaces the limiter's in-memory buckets with those of a
+// Snapshot. Buckets have refilled for the time since it was taken. Sets
+// the limiter no longer has are skipped, and tokens beyond a lowered limit
+// are dropped.
+func (r *rateLimiter) Restore(data []byte) error {
+	c := r.config()
+	var s snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("ratelimiter: malformed snapshot: %w", err)
+	}
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("ratelimiter: unsupported snapshot version %d", s.Version)
+	}
+
+	for name, buckets := range c.namedBuckets() {
+		if store, ok := buckets.store.(*memoryStore); ok {
+			store.buckets.restore(s.Sets[name])
+		}
+	}
+	c.verified.restore(s.Verified)
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if int64(len(s.Shared)) > c.RATE_LIMIT {
+		s.Shared = s.Shared[:c.RATE_LIMIT]
+	}
+	r.tokenBucket = s.Shared
+	return nil
+}
+
+// runSnapshots restores SNAPSHOT_FILE if it exists, then saves it every
+// SNAPSHOT_INTERVAL and once more when ctx is done.
+func (r *rateLimiter) runSnapshots(ctx context.Context) {
+	c := r.config()
+	path := c.SNAPSHOT_FILE
+	if data, err := os.ReadFile(path); err == nil {
+		r.snapshotError(r.Restore(data))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		r.snapshotError(err)
+	}
+
+	ticker := time.NewTicker(c.SNAPSHOT_INTERVAL)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.snapshotError(r.saveSnapshot(path))
+			case <-ctx.Done():
+				r.snapshotError(r.saveSnapshot(path))
+				return
+			}
+		}
+	}()
+}
+
+// saveSnapshot writes a Snapshot to path through a temporary file, so a
+// crash never leaves a partial one behind.
+func (r *rateLimiter) saveSnapshot(path string) error {
+	data, err := r.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (r *rateLimiter) snapshotError(err error) {
+	c := r.config()
+	if err != nil && c.ON_SNAPSHOT_ERROR != nil {
+		c.ON_SNAPSHOT_ERROR(err)
+	}
+}
+
+func (b *keyedBuckets) snapshot() []BucketState {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	buckets := make([]BucketState, 0, len(b.buckets))
+	for key, bucket := range b.buckets {
+		buckets = append(buckets, BucketState{
+			Key:         key,
+			Tokens:      bucket.tokens,
+			Refilled:    bucket.lastRefill,
+			LockedUntil: bucket.lockedUntil,
+		})
+	}
+	return buckets
+}
+
+func (b *keyedBuckets) restore(buckets []BucketState) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.buckets = make(map[string]*keyBucket, len(buckets))
+	for _, bucket := range buckets {
+		b.buckets[bucket.Key] = &keyBucket{
+			tokens:      min(bucket.Tokens, float64(b.limit)),
+			lastRefill:  bucket.Refilled,
+			lockedUntil: bucket.LockedUntil,
+		}
+	}
+}
+
+func (v *verifiedKeys) snapshot() map[string]time.Time {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+
+	until := make(map[string]time.Time, len(v.until))
+	for key, t := range v.until {
+		until[key] = t
+	}
+	return until
+}
+
+func (v *verifiedKeys) restore(until map[string]time.Time) {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+
+	v.until = make(map[string]time.Time, len(until))
+	for key, t := range until {
+		v.until[key] = t
+	}
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func snapshotConfig() RateLimiterConfig {
+	return RateLimiterConfig{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour, KEY_FUNC: remoteIP}
+}
+
+func requestFrom(ip string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = ip + ":1234"
+	return r
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	before := New()
+	before.SetConfig(snapshotConfig())
+	before.Decide(requestFrom("203.0.113.1"))
+	before.Decide(requestFrom("203.0.113.1"))
+	before.ThrottleKey("203.0.113.2", -1, time.Hour)
+
+	data, err := before.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := New()
+	after.SetConfig(snapshotConfig())
+	if err := after.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		ip            string
+		wantAllowed   bool
+		wantRemaining int64
+	}{
+		{name: "quota carried over", ip: "203.0.113.1", wantAllowed: true, wantRemaining: 0},
+		{name: "lock carried over", ip: "203.0.113.2", wantAllowed: false, wantRemaining: 0},
+		{name: "unknown key starts full", ip: "203.0.113.3", wantAllowed: true, wantRemaining: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := after.Decide(requestFrom(test.ip))
+			if d.Allowed != test.wantAllowed || d.Remaining != test.wantRemaining {
+				t.Fatalf("allowed = %v, remaining %d, want %v, %d", d.Allowed, d.Remaining, test.wantAllowed, test.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "malformed", data: `{"Version":`},
+		{name: "unknown version", data: `{"Version":99}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(snapshotConfig())
+			if err := limiter.Restore([]byte(test.data)); err == nil {
+				t.Fatal("snapshot restored")
+			}
+		})
+	}
+}
+
+func TestSnapshotFile(t *testing.T) {
+	errs := make(chan error, 10)
+	config := snapshotConfig()
+	config.SNAPSHOT_FILE = filepath.Join(t.TempDir(), "limits.json")
+	config.SNAPSHOT_INTERVAL = time.Hour
+	config.ON_SNAPSHOT_ERROR = func(err error) { errs <- err }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	before := New()
+	before.SetConfig(config)
+	before.RunContext(ctx)
+	before.Decide(requestFrom("203.0.113.1"))
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for _, err := os.Stat(config.SNAPSHOT_FILE); err != nil; _, err = os.Stat(config.SNAPSHOT_FILE) {
+		if time.Now().After(deadline) {
+			t.Fatal("no snapshot saved when the context was done")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The next save is an hour away, after the test is over.
+	after := New()
+	after.SetConfig(config)
+	after.RunContext(context.Background())
+	if d := after.Decide(requestFrom("203.0.113.1")); d.Remaining != 1 {
+		t.Fatalf("remaining %d after restoring the file, want 1", d.Remaining)
+	}
+	select {
+	case err := <-errs:
+		t.Fatal(err)
+	default:
+	}
+}
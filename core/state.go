@@ -0,0 +1,178 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// stateVersion is bumped whenever the State format changes.
+const stateVersion = 1
+
+// State is what a limiter enforces beyond its config: the buckets of every
+// set, locked keys included, the verified keys and the allow and deny
+// lists. ExportState and ImportState move it between instances, e.g. for a
+// blue/green deploy or to move to another STORE, without handing every
+// client a fresh quota.
+type State struct {
+	Version  int
+	Exported time.Time
+	// Buckets by set, e.g. "default", "bot" or "geo country:DE".
+	Sets     map[string][]BucketState
+	Verified map[string]time.Time
+	Lists    KeyLists
+	// Token timestamps of the bucket shared by unkeyed requests.
+	Shared []int64 `json:",omitempty"`
+}
+
+// BucketState is a key's bucket: the tokens it held when last refilled,
+// and when it is locked until, if it is.
+type BucketState struct {
+	Key         string
+	Tokens      float64
+	Refilled    time.Time
+	LockedUntil time.Time `json:",omitempty"`
+}
+
+// ExportableStore is a Store that can list its buckets, which ExportState
+// needs to include them.
+type ExportableStore interface {
+	Store
+	Export() ([]BucketState, error)
+}
+
+// ExportState returns the limiter's State. Sets whose STORE isn't an
+// ExportableStore are left out. Sets that fail to export are left out
+// too, and their errors returned with the rest of the State.
+func (r *rateLimiter) ExportState() (State, error) {
+	c := r.config()
+	s := State{
+		Version:  stateVersion,
+		Exported: time.Now(),
+		Sets:     map[string][]BucketState{},
+		Verified: c.verified.snapshot(),
+		Lists:    r.KeyLists(),
+	}
+	var errs []error
+	for name, buckets := range c.namedBuckets() {
+		store, ok := buckets.store.(ExportableStore)
+		if !ok {
+			continue
+		}
+		exported, err := store.Export()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ratelimiter: exporting %q buckets: %w", name, err))
+			continue
+		}
+		s.Sets[name] = exported
+	}
+
+	r.mx.Lock()
+	s.Shared = append([]int64(nil), r.tokenBucket...)
+	r.mx.Unlock()
+
+	return s, errors.Join(errs...)
+}
+
+// ImportState adds an exported State to the limiter's. Imported buckets
+// replace those of the same key, refilled for the time since they were
+// exported, and need a STORE that is a ThrottlingStore. Sets the limiter
+// doesn't have are skipped, and tokens beyond a lower limit dropped.
+func (r *rateLimiter) ImportState(s State) error {
+	c := r.config()
+	if s.Version != stateVersion {
+		return fmt.Errorf("ratelimiter: unsupported state version %d", s.Version)
+	}
+
+	now := time.Now()
+	var errs []error
+	for name, buckets := range c.namedBuckets() {
+		if len(s.Sets[name]) == 0 {
+			continue
+		}
+		if err := buckets.importBuckets(s.Sets[name], now); err != nil {
+			errs = append(errs, fmt.Errorf("ratelimiter: importing %q buckets: %w", name, err))
+		}
+	}
+	c.verified.merge(s.Verified, now)
+	r.lists.merge(s.Lists, now)
+
+	if s.Shared != nil {
+		r.mx.Lock()
+		if int64(len(s.Shared)) > c.RATE_LIMIT {
+			s.Shared = s.Shared[:c.RATE_LIMIT]
+		}
+		r.tokenBucket = s.Shared
+		r.mx.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// importBuckets sets the buckets of the store to those exported. Full,
+// unlocked buckets are no different from new ones and are skipped. It
+// stops at the first error.
+func (b *storeBuckets) importBuckets(buckets []BucketState, now time.Time) error {
+	store, ok := b.store.(ThrottlingStore)
+	if !ok {
+		return errors.New("the store can't set buckets")
+	}
+	resettable, _ := store.(ResettableStore)
+
+	for _, bucket := range buckets {
+		tokens := bucket.Tokens
+		if b.interval > 0 {
+			tokens += float64(now.Sub(bucket.Refilled)) / float64(b.interval)
+		}
+		tokens = min(tokens, float64(b.limit))
+		locked := now.Before(bucket.LockedUntil)
+		if tokens >= float64(b.limit) && !locked {
+			continue
+		}
+
+		if resettable != nil {
+			if err := resettable.Reset(bucket.Key); err != nil {
+				return err
+			}
+		}
+		until := now
+		if locked {
+			until = bucket.LockedUntil
+		}
+		if err := store.Throttle(bucket.Key, max(int64(tokens), 0), until); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// merge adds verified keys, keeping the later expiry of keys verified in
+// both.
+func (v *verifiedKeys) merge(until map[string]time.Time, now time.Time) {
+	v.mx.Lock()
+	defer v.mx.Unlock()
+
+	for key, t := range until {
+		if t.After(now) && t.After(v.until[key]) {
+			v.until[key] = t
+		}
+	}
+}
+
+// merge adds the keys of lists, expired denials left out. A key on both
+// takes its place on lists.
+func (l *keyLists) merge(lists KeyLists, now time.Time) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	for _, key := range lists.Allowed {
+		delete(l.denied, key)
+		l.allowed[key] = struct{}{}
+	}
+	for key, until := range lists.Denied {
+		if !until.IsZero() && !now.Before(until) {
+			continue
+		}
+		delete(l.allowed, key)
+		l.denied[key] = until
+	}
+}
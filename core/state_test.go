@@ -0,0 +1,105 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// otherStore stands for another backend than the in-memory store.
+type otherStore struct {
+	*memoryStore
+}
+
+// takeOnlyStore can't have buckets set.
+type takeOnlyStore struct {
+	store Store
+}
+
+func (s takeOnlyStore) Take(key string, n int64) (bool, int64, time.Time, error) {
+	return s.store.Take(key, n)
+}
+
+func TestExportImportState(t *testing.T) {
+	before := New()
+	before.SetConfig(snapshotConfig())
+	before.Decide(requestFrom("203.0.113.1"))
+	before.Decide(requestFrom("203.0.113.1"))
+	before.ThrottleKey("203.0.113.2", -1, time.Hour)
+	before.DenyKey("203.0.113.3", time.Hour)
+	before.AllowKey("203.0.113.4")
+
+	state, err := before.ExportState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var imported State
+	if err := json.Unmarshal(data, &imported); err != nil {
+		t.Fatal(err)
+	}
+
+	config := snapshotConfig()
+	config.STORE = func(name string, profile LimitProfile) Store {
+		return otherStore{NewMemoryStore(profile).(*memoryStore)}
+	}
+	after := New()
+	after.SetConfig(config)
+	if err := after.ImportState(imported); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		ip            string
+		wantAllowed   bool
+		wantRemaining int64
+	}{
+		{name: "quota carried over", ip: "203.0.113.1", wantAllowed: true, wantRemaining: 0},
+		{name: "lock carried over", ip: "203.0.113.2", wantAllowed: false, wantRemaining: 0},
+		{name: "denial carried over", ip: "203.0.113.3", wantAllowed: false, wantRemaining: 0},
+		{name: "allowance carried over", ip: "203.0.113.4", wantAllowed: true, wantRemaining: 0},
+		{name: "unknown key starts full", ip: "203.0.113.5", wantAllowed: true, wantRemaining: 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := after.Decide(requestFrom(test.ip))
+			if d.Allowed != test.wantAllowed || d.Remaining != test.wantRemaining {
+				t.Fatalf("allowed = %v, remaining %d, want %v, %d", d.Allowed, d.Remaining, test.wantAllowed, test.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestImportStateRejects(t *testing.T) {
+	exported := State{
+		Version: stateVersion,
+		Sets:    map[string][]BucketState{"default": {{Key: "203.0.113.1", Refilled: time.Now()}}},
+	}
+
+	tests := []struct {
+		name  string
+		state State
+		store StoreFactory
+	}{
+		{name: "unknown version", state: State{Version: 99}},
+		{name: "store can't set buckets", state: exported, store: func(name string, profile LimitProfile) Store {
+			return takeOnlyStore{NewMemoryStore(profile)}
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := snapshotConfig()
+			config.STORE = test.store
+			limiter := New()
+			limiter.SetConfig(config)
+			if err := limiter.ImportState(test.state); err == nil {
+				t.Fatal("state imported")
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// maxTrackedKeys bounds how many distinct keys have their denials counted
+// in each part of TOP_KEYS_WINDOW.
+const maxTrackedKeys = 1024
+
+// statusTopKeys is how many of the most rejected keys a status event carries.
+const statusTopKeys = 10
+
+type KeyCount struct {
+	Key   string
+	Count int64
+}
+
+// BucketStatusEvent is a BucketStatus with the decision counters, as sent by
+// the live status streams. RejectionsPerSecond is filled in by the stream
+// from the change in DeniedTotal between events.
+type BucketStatusEvent struct {
+	BucketStatus
+	// Store calls that failed, each decided by STORE_FAILURE_POLICY.
+	DegradedTotal int64
+	// Set while the store circuit breaker skips the store.
+	StoreBreakerOpen    bool
+	Store               StoreStats
+	RejectionsPerSecond float64
+	// Keys denied most over TOP_KEYS_WINDOW.
+	TopKeys []KeyCount
+}
+
+// limiterStats counts decisions for the status endpoints.
+type limiterStats struct {
+	allowed  int64
+	denied   int64
+	degraded int64
+	store    storeStats
+	events   eventBus
+	// Denials per key, for TopKeys.
+	topKeys heavyHitters
+	// Request rates per key, for ANOMALY_FACTOR.
+	anomalies anomalyDetector
+	history   history
+	rejectLog logSampler
+	started   time.Time
+}
+
+func newLimiterStats() *limiterStats {
+	s := &limiterStats{started: time.Now()}
+	s.topKeys.setWindow(defaultTopKeysWindow)
+	return s
+}
+
+func (s *limiterStats) record(d Decision) {
+	s.history.record(d, time.Now())
+	if d.Allowed {
+		atomic.AddInt64(&s.allowed, 1)
+		return
+	}
+	atomic.AddInt64(&s.denied, 1)
+
+	if d.Key != "" {
+		s.topKeys.add(d.Key, time.Now())
+	}
+}
+
+func (s *limiterStats) totals() (allowed, denied int64) {
+	return atomic.LoadInt64(&s.allowed), atomic.LoadInt64(&s.denied)
+}
+
+// TopKeys returns up to n keys with the most denials over
+// TOP_KEYS_WINDOW, most first. They are hashed with HashKey unless
+// DEBUG_RAW_KEYS is set, since status endpoints are often less protected
+// than the keys they would expose. Counts are estimates once more keys
+// are denied than can be tracked: a key may be overcounted, by at most the
+// denials of the keys it took the place of, but is never undercounted.
+func (r *rateLimiter) TopKeys(n int) []KeyCount {
+	c := r.config()
+	top := r.stats.topKeys.top(n, time.Now())
+	if !c.DEBUG_RAW_KEYS {
+		for i := range top {
+			top[i].Key = HashKey(top[i].Key)
+		}
+	}
+	return top
+}
+
+// StatusEvent reports the decision counters.
+func (r *rateLimiter) StatusEvent() BucketStatusEvent {
+	c := r.config()
+	top := r.TopKeys(statusTopKeys)
+	status := r.Status()
+	// Sent every STATUS_STREAM_INTERVAL, events leave the history out.
+	status.History = nil
+	return BucketStatusEvent{
+		BucketStatus:     status,
+		DegradedTotal:    atomic.LoadInt64(&r.stats.degraded),
+		StoreBreakerOpen: c.failure != nil && c.failure.open(),
+		Store:            r.StoreStats(),
+		TopKeys:          top,
+	}
+}
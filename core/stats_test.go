@@ -0,0 +1,145 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStatusEventTopKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawKeys bool
+		want    string
+	}{
+		{name: "hashed by default", want: HashKey("203.0.113.7")},
+		{name: "raw when asked", rawKeys: true, want: "203.0.113.7"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        func(r *http.Request) string { return "203.0.113.7" },
+				DEBUG_RAW_KEYS:  test.rawKeys,
+			})
+			for i := 0; i < 3; i++ {
+				limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+
+			top := limiter.StatusEvent().TopKeys
+			if len(top) != 1 || top[0].Key != test.want || top[0].Count != 2 {
+				t.Fatalf("top keys %+v, want %q denied twice", top, test.want)
+			}
+		})
+	}
+}
+
+func TestOnDecision(t *testing.T) {
+	tests := []struct {
+		name        string
+		remoteAddr  string
+		wantAllowed []bool
+		wantExempt  bool
+	}{
+		{name: "limited", remoteAddr: "203.0.113.7:1234", wantAllowed: []bool{true, false}},
+		{name: "exempt", remoteAddr: "10.0.0.1:1234", wantAllowed: []bool{true, true}, wantExempt: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var decisions []Decision
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:            1,
+				REFILL_INTERVAL:       time.Hour,
+				KEY_FUNC:              remoteIP,
+				SKIP_PRIVATE_NETWORKS: true,
+				ON_DECISION: func(r *http.Request, d Decision, elapsed time.Duration) {
+					if elapsed < 0 {
+						t.Errorf("decision took %v", elapsed)
+					}
+					decisions = append(decisions, d)
+				},
+			})
+			for range test.wantAllowed {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = test.remoteAddr
+				limiter.Decide(r)
+			}
+
+			if len(decisions) != len(test.wantAllowed) {
+				t.Fatalf("%d decisions reported, want %d", len(decisions), len(test.wantAllowed))
+			}
+			for i, d := range decisions {
+				if d.Allowed != test.wantAllowed[i] || d.Exempt != test.wantExempt {
+					t.Fatalf("decision %d allowed %v, exempt %v; want %v, %v", i, d.Allowed, d.Exempt, test.wantAllowed[i], test.wantExempt)
+				}
+			}
+		})
+	}
+}
+
+func TestStatusTrackedKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		interval   time.Duration
+		idle       time.Duration
+		wantActive int
+	}{
+		{name: "refilling", interval: time.Hour, wantActive: 2},
+		{name: "refilled", interval: 50 * time.Millisecond, idle: 100 * time.Millisecond, wantActive: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      5,
+				REFILL_INTERVAL: test.interval,
+				KEY_FUNC:        remoteIP,
+			})
+			for _, addr := range []string{"203.0.113.7:1", "203.0.113.8:1", "203.0.113.7:2"} {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = addr
+				limiter.Decide(r)
+			}
+			time.Sleep(test.idle)
+
+			status := limiter.Status()
+			if status.TrackedKeys != 2 || status.ActiveKeys != test.wantActive {
+				t.Fatalf("%d tracked, %d active keys, want 2, %d", status.TrackedKeys, status.ActiveKeys, test.wantActive)
+			}
+		})
+	}
+}
+
+func TestStatusShared(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:      2,
+		REFILL_INTERVAL: 500 * time.Millisecond,
+	})
+	limiter.RefillBucket()
+	limiter.RefillBucket()
+	if next := limiter.Status().NextTokenIn; next != 0 {
+		t.Fatalf("full bucket gains its next token in %v, want 0", next)
+	}
+	for i := 0; i < 3; i++ {
+		limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	status := limiter.Status()
+	if status.BucketLimit != 2 || status.CurrentBucketSize != 0 || status.RefillRate != 2 || status.RefillInterval != 500*time.Millisecond {
+		t.Fatalf("status %+v", status)
+	}
+	if status.NextTokenIn <= 0 || status.NextTokenIn > 500*time.Millisecond || status.Uptime <= 0 {
+		t.Fatalf("next token in %v, uptime %v", status.NextTokenIn, status.Uptime)
+	}
+	if status.AllowedTotal != 2 || status.DeniedTotal != 1 {
+		t.Fatalf("%d allowed, %d denied, want 2, 1", status.AllowedTotal, status.DeniedTotal)
+	}
+}
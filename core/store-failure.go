@@ -0,0 +1,171 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StoreFailurePolicy decides what a limiter does with requests its store
+// fails to answer for, e.g. while Redis is down or slow.
+type StoreFailurePolicy int
+
+const (
+	// StoreFailOpen lets the requests through.
+	StoreFailOpen StoreFailurePolicy = iota
+	// StoreFailClosed rejects them, retrying after one refill interval.
+	StoreFailClosed
+	// StoreFailLocal limits them with in-memory buckets of this replica
+	// until the store answers again, so every replica enforces the full
+	// limit on its own meanwhile.
+	StoreFailLocal
+)
+
+var (
+	errStoreTimeout = errors.New("ratelimiter: store call exceeded STORE_LATENCY_BUDGET")
+	errBreakerOpen  = errors.New("ratelimiter: store circuit breaker open")
+)
+
+// storeFailure is how a limiter's buckets guard against a failing or slow
+// store: calls are cut short after the latency budget and skipped while
+// the breaker is open. Every decision made without the store is counted
+// in stats.
+type storeFailure struct {
+	policy        StoreFailurePolicy
+	stats         *limiterStats
+	latencyBudget time.Duration
+	threshold     int
+	cooldown      time.Duration
+	// Consecutive failed calls.
+	failures  int
+	openUntil time.Time
+	probing   bool
+	mx        sync.Mutex
+}
+
+func (s *limiterStats) storeFailure(config RateLimiterConfig) *storeFailure {
+	return &storeFailure{
+		policy:        config.STORE_FAILURE_POLICY,
+		stats:         s,
+		latencyBudget: config.STORE_LATENCY_BUDGET,
+		threshold:     config.STORE_BREAKER_THRESHOLD,
+		cooldown:      config.STORE_BREAKER_COOLDOWN,
+	}
+}
+
+type takeResult struct {
+	allowed   bool
+	remaining int64
+	resetAt   time.Time
+	err       error
+}
+
+// take takes n tokens for key from store unless the breaker is open,
+// giving up once the latency budget is spent.
+func (f *storeFailure) take(store Store, key string, n int64) takeResult {
+	if !f.closed() {
+		return takeResult{err: errBreakerOpen}
+	}
+
+	var result takeResult
+	if f.latencyBudget <= 0 {
+		result.allowed, result.remaining, result.resetAt, result.err = store.Take(key, n)
+	} else {
+		result = takeWithin(store, key, n, f.latencyBudget)
+	}
+	f.record(result.err)
+	return result
+}
+
+// takeWithin is store.Take returning errStoreTimeout after budget. The
+// call itself runs on, and whatever it takes is lost.
+func takeWithin(store Store, key string, n int64, budget time.Duration) takeResult {
+	done := make(chan takeResult, 1)
+	go func() {
+		var result takeResult
+		result.allowed, result.remaining, result.resetAt, result.err = store.Take(key, n)
+		done <- result
+	}()
+
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+	select {
+	case result := <-done:
+		return result
+	case <-timer.C:
+		return takeResult{err: errStoreTimeout}
+	}
+}
+
+// closed reports whether the store may be called: the breaker is closed,
+// or its cooldown is over and no other call is probing the store yet.
+func (f *storeFailure) closed() bool {
+	if f.threshold <= 0 {
+		return true
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.failures < f.threshold {
+		return true
+	}
+	if f.probing || time.Now().Before(f.openUntil) {
+		return false
+	}
+	f.probing = true
+	return true
+}
+
+// record counts a call's outcome, opening the breaker after threshold
+// failures in a row or a failed probe and closing it after a success.
+func (f *storeFailure) record(err error) {
+	if f.threshold <= 0 {
+		return
+	}
+
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.probing = false
+	if err == nil {
+		f.failures = 0
+		return
+	}
+	f.failures++
+	if f.failures >= f.threshold {
+		f.openUntil = time.Now().Add(f.cooldown)
+	}
+}
+
+// open reports whether the breaker is skipping the store.
+func (f *storeFailure) open() bool {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	return f.threshold > 0 && f.failures >= f.threshold
+}
+
+// failed decides a take of n tokens for key the store failed.
+func (b *storeBuckets) failed(key string, n int64) (allowed bool, remaining int64, retryAfter time.Duration) {
+	if b.failure == nil {
+		return true, b.limit, 0
+	}
+	atomic.AddInt64(&b.failure.stats.degraded, 1)
+
+	switch b.failure.policy {
+	case StoreFailClosed:
+		if n <= 0 {
+			return true, 0, 0
+		}
+		return false, 0, b.interval
+	case StoreFailLocal:
+		allowed, remaining, resetAt, _ := b.fallback.Take(key, n)
+		if !allowed {
+			return false, remaining, time.Until(resetAt)
+		}
+		return true, remaining, 0
+	}
+	return true, b.limit, 0
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// storeLatencyBuckets are the upper bounds of the store latency
+// histograms.
+var storeLatencyBuckets = [...]time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// StoreLatencyBuckets returns the upper bounds of the latency histograms
+// of StoreOpStats, shortest first.
+func StoreLatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), storeLatencyBuckets[:]...)
+}
+
+// CachingStore is a Store answering takes from tokens it holds locally,
+// e.g. borrowed from a shared bucket, which reports in StoreStats how
+// often it could.
+type CachingStore interface {
+	Store
+	// CacheStats reports how many takes were served from tokens held
+	// locally and how many found too few.
+	CacheStats() (hits, misses int64)
+}
+
+// StoreStats reports how a limiter's STORE performs across all its sets of
+// buckets, to tell when distributed limiting itself becomes the
+// bottleneck. Calls cut short by STORE_LATENCY_BUDGET are errors taking
+// the budget; calls skipped by the circuit breaker aren't counted.
+type StoreStats struct {
+	Take     StoreOpStats
+	Throttle StoreOpStats
+	Reset    StoreOpStats
+	ResetAll StoreOpStats
+	// Summed over the sets kept in a CachingStore; their ratio is its hit
+	// rate.
+	CacheHits   int64
+	CacheMisses int64
+}
+
+// StoreOpStats counts the calls of one Store method.
+type StoreOpStats struct {
+	Calls  int64
+	Errors int64
+	// Total time the calls took.
+	LatencySum time.Duration
+	// How many calls took at most each of StoreLatencyBuckets, cumulative
+	// like a Prometheus histogram. Calls slower than the last are only in
+	// Calls.
+	LatencyBuckets []int64
+}
+
+// storeStats counts a limiter's store calls.
+type storeStats struct {
+	take     opStats
+	throttle opStats
+	reset    opStats
+	resetAll opStats
+}
+
+type opStats struct {
+	calls   int64
+	errors  int64
+	latency int64
+	buckets [len(storeLatencyBuckets)]int64
+}
+
+// record counts a call that started at start.
+func (o *opStats) record(start time.Time, err error) {
+	elapsed := time.Since(start)
+	atomic.AddInt64(&o.calls, 1)
+	if err != nil {
+		atomic.AddInt64(&o.errors, 1)
+	}
+	atomic.AddInt64(&o.latency, int64(elapsed))
+	for i, bound := range storeLatencyBuckets {
+		if elapsed <= bound {
+			atomic.AddInt64(&o.buckets[i], 1)
+			break
+		}
+	}
+}
+
+func (o *opStats) snapshot() StoreOpStats {
+	s := StoreOpStats{
+		Calls:          atomic.LoadInt64(&o.calls),
+		Errors:         atomic.LoadInt64(&o.errors),
+		LatencySum:     time.Duration(atomic.LoadInt64(&o.latency)),
+		LatencyBuckets: make([]int64, len(o.buckets)),
+	}
+	var total int64
+	for i := range o.buckets {
+		total += atomic.LoadInt64(&o.buckets[i])
+		s.LatencyBuckets[i] = total
+	}
+	return s
+}
+
+// StoreStats reports the calls of the limiter's store.
+func (r *rateLimiter) StoreStats() StoreStats {
+	c := r.config()
+	s := StoreStats{
+		Take:     r.stats.store.take.snapshot(),
+		Throttle: r.stats.store.throttle.snapshot(),
+		Reset:    r.stats.store.reset.snapshot(),
+		ResetAll: r.stats.store.resetAll.snapshot(),
+	}
+	if c.keyBuckets == nil {
+		return s
+	}
+	for _, buckets := range c.namedBuckets() {
+		if store, ok := buckets.store.(CachingStore); ok {
+			hits, misses := store.CacheStats()
+			s.CacheHits += hits
+			s.CacheMisses += misses
+		}
+	}
+	return s
+}
+
+// record counts a call of the i-th of the buckets' stores, unless it is
+// the fallback.
+func (b *storeBuckets) record(i int, op *opStats, start time.Time, err error) {
+	if i == 0 {
+		op.record(start, err)
+	}
+}
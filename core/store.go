@@ -0,0 +1,202 @@
+package core
+
+import (
+	"time"
+)
+
+// Store keeps the state of a set of keyed token buckets, each holding up to
+// limit tokens and gaining one every interval, so the state can live
+// outside the process and be shared between replicas. A key the store has
+// not seen starts with a full bucket.
+type Store interface {
+	// Take removes n tokens from key's bucket if it holds that many, and
+	// reports how many are left. resetAt is when the bucket will be full
+	// again if the tokens were taken, and when they could be taken if not.
+	// A negative n hands tokens back, never beyond limit.
+	Take(key string, n int64) (allowed bool, remaining int64, resetAt time.Time, err error)
+}
+
+// ResettableStore is a Store that can drop bucket state, which ResetKey,
+// ResetAll and MarkVerified need.
+type ResettableStore interface {
+	Store
+	Reset(key string) error
+	ResetAll() error
+}
+
+// ThrottlingStore is a Store that can cap and pause a bucket, which
+// ThrottleKey needs: at most remaining tokens, unless remaining is
+// negative, and none at all before until.
+type ThrottlingStore interface {
+	Store
+	Throttle(key string, remaining int64, until time.Time) error
+}
+
+// StoreFactory returns the Store for one set of buckets. name tells the
+// sets of one limiter apart, e.g. "default", "bot", "global" or
+// "geo country:DE", so stores shared between them can namespace their
+// keys.
+type StoreFactory func(name string, profile LimitProfile) Store
+
+// NewMemoryStore returns the in-process store limiters use by default.
+func NewMemoryStore(profile LimitProfile) Store {
+	return &memoryStore{buckets: newKeyedBuckets(profile.RATE_LIMIT, profile.REFILL_INTERVAL)}
+}
+
+type memoryStore struct {
+	buckets *keyedBuckets
+}
+
+func (s *memoryStore) Take(key string, n int64) (bool, int64, time.Time, error) {
+	if n < 0 {
+		s.buckets.refund(key, -n)
+		_, remaining, _ := s.buckets.peek(key, 0)
+		return true, remaining, s.fullAt(remaining), nil
+	}
+
+	allowed, remaining, retryAfter := s.buckets.take(key, n)
+	if !allowed {
+		return false, remaining, time.Now().Add(retryAfter), nil
+	}
+	return true, remaining, s.fullAt(remaining), nil
+}
+
+// fullAt estimates when a bucket with remaining tokens will be full again.
+func (s *memoryStore) fullAt(remaining int64) time.Time {
+	return time.Now().Add(time.Duration(s.buckets.limit-remaining) * s.buckets.interval)
+}
+
+func (s *memoryStore) Reset(key string) error {
+	s.buckets.reset(key)
+	return nil
+}
+
+func (s *memoryStore) ResetAll() error {
+	s.buckets.resetAll()
+	return nil
+}
+
+func (s *memoryStore) Export() ([]BucketState, error) {
+	return s.buckets.snapshot(), nil
+}
+
+func (s *memoryStore) Throttle(key string, remaining int64, until time.Time) error {
+	s.buckets.throttle(key, remaining, time.Until(until))
+	return nil
+}
+
+// storeBuckets is one of a limiter's sets of keyed buckets, kept in a
+// Store. Store errors are handled as failure says, letting requests
+// through when it is nil.
+type storeBuckets struct {
+	limit    int64
+	interval time.Duration
+	store    Store
+	failure  *storeFailure
+	stats    *storeStats
+	// Buckets used while the store fails, for StoreFailLocal.
+	fallback Store
+}
+
+func newStoreBuckets(factory StoreFactory, failure *storeFailure, name string, profile LimitProfile) *storeBuckets {
+	if factory == nil {
+		factory = defaultStoreFactory
+	}
+	b := &storeBuckets{
+		limit:    profile.RATE_LIMIT,
+		interval: profile.REFILL_INTERVAL,
+		store:    factory(name, profile),
+		failure:  failure,
+		stats:    &storeStats{},
+	}
+	if failure != nil {
+		b.stats = &failure.stats.store
+	}
+	if failure != nil && failure.policy == StoreFailLocal {
+		b.fallback = NewMemoryStore(profile)
+	}
+	if failure != nil {
+		b.watchEvictions(&failure.stats.events, name)
+	}
+	return b
+}
+
+func defaultStoreFactory(name string, profile LimitProfile) Store {
+	return NewMemoryStore(profile)
+}
+
+// take removes n tokens from the bucket for key if they are available.
+func (b *storeBuckets) take(key string, n int64) (allowed bool, remaining int64, retryAfter time.Duration) {
+	allowed, remaining, resetAt, err := b.storeTake(key, n)
+	if err != nil {
+		return b.failed(key, n)
+	}
+	if !allowed {
+		return false, remaining, time.Until(resetAt)
+	}
+	return true, remaining, 0
+}
+
+// storeTake calls the store, guarded by failure if set.
+func (b *storeBuckets) storeTake(key string, n int64) (bool, int64, time.Time, error) {
+	if b.failure == nil {
+		return b.store.Take(key, n)
+	}
+	start := time.Now()
+	result := b.failure.take(b.store, key, n)
+	if result.err != errBreakerOpen {
+		b.stats.take.record(start, result.err)
+	}
+	return result.allowed, result.remaining, result.resetAt, result.err
+}
+
+// peek reports whether n tokens are available for key without taking them.
+func (b *storeBuckets) peek(key string, n int64) (allowed bool, remaining int64, retryAfter time.Duration) {
+	allowed, remaining, retryAfter = b.take(key, 0)
+	if allowed && remaining < n {
+		return false, remaining, time.Duration(n-remaining) * b.interval
+	}
+	return allowed, remaining, retryAfter
+}
+
+// refund hands back n tokens taken for key that ended up unused.
+func (b *storeBuckets) refund(key string, n int64) {
+	if _, _, _, err := b.storeTake(key, -n); err != nil && b.fallback != nil {
+		b.fallback.Take(key, -n)
+	}
+}
+
+func (b *storeBuckets) reset(key string) {
+	for i, store := range b.stores() {
+		if store, ok := store.(ResettableStore); ok {
+			start := time.Now()
+			b.record(i, &b.stats.reset, start, store.Reset(key))
+		}
+	}
+}
+
+func (b *storeBuckets) resetAll() {
+	for i, store := range b.stores() {
+		if store, ok := store.(ResettableStore); ok {
+			start := time.Now()
+			b.record(i, &b.stats.resetAll, start, store.ResetAll())
+		}
+	}
+}
+
+func (b *storeBuckets) throttle(key string, remaining int64, pause time.Duration) {
+	for i, store := range b.stores() {
+		if store, ok := store.(ThrottlingStore); ok {
+			start := time.Now()
+			b.record(i, &b.stats.throttle, start, store.Throttle(key, remaining, start.Add(pause)))
+		}
+	}
+}
+
+// stores returns the store and, if there is one, the fallback after it.
+func (b *storeBuckets) stores() []Store {
+	if b.fallback == nil {
+		return []Store{b.store}
+	}
+	return []Store{b.store, b.fallback}
+}
@@ -0,0 +1,288 @@
+package core
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	tests := []struct {
+		name          string
+		takes         []int64
+		wantAllowed   bool
+		wantRemaining int64
+	}{
+		{name: "new key starts full", takes: []int64{1}, wantAllowed: true, wantRemaining: 2},
+		{name: "takes several tokens", takes: []int64{2}, wantAllowed: true, wantRemaining: 1},
+		{name: "rejects more than held", takes: []int64{2, 2}, wantAllowed: false, wantRemaining: 1},
+		{name: "hands tokens back", takes: []int64{3, -2}, wantAllowed: true, wantRemaining: 2},
+		{name: "never beyond limit", takes: []int64{-5}, wantAllowed: true, wantRemaining: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewMemoryStore(LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour})
+
+			var allowed bool
+			var remaining int64
+			for _, n := range test.takes {
+				var err error
+				if allowed, remaining, _, err = store.Take("client", n); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if allowed != test.wantAllowed || remaining != test.wantRemaining {
+				t.Fatalf("allowed = %v, remaining %d, want %v, %d", allowed, remaining, test.wantAllowed, test.wantRemaining)
+			}
+		})
+	}
+}
+
+// fakeStore is a memory store failing every Take with err, if set, after
+// delay. It counts the calls it gets.
+type fakeStore struct {
+	Store
+	err   error
+	delay time.Duration
+	calls int64
+}
+
+func (s *fakeStore) Take(key string, n int64) (bool, int64, time.Time, error) {
+	atomic.AddInt64(&s.calls, 1)
+	time.Sleep(s.delay)
+	if s.err != nil {
+		return false, 0, time.Time{}, s.err
+	}
+	return s.Store.Take(key, n)
+}
+
+func TestStoreFactory(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantAllowed []bool
+	}{
+		{name: "limits through the store", wantAllowed: []bool{true, false}},
+		{name: "store errors fail open", err: errors.New("unavailable"), wantAllowed: []bool{true, true}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var names []string
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        remoteIP,
+				STORE: func(name string, profile LimitProfile) Store {
+					names = append(names, name)
+					return &fakeStore{Store: NewMemoryStore(profile), err: test.err}
+				},
+			})
+
+			for i, want := range test.wantAllowed {
+				if d := limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil)); d.Allowed != want {
+					t.Fatalf("request %d: allowed = %v, want %v", i, d.Allowed, want)
+				}
+			}
+			if !slices.Contains(names, "default") {
+				t.Fatalf("store names %v, want a default set", names)
+			}
+		})
+	}
+}
+
+func TestStoreFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      StoreFailurePolicy
+		wantAllowed []bool
+	}{
+		{name: "fail open", policy: StoreFailOpen, wantAllowed: []bool{true, true, true}},
+		{name: "fail closed", policy: StoreFailClosed, wantAllowed: []bool{false, false, false}},
+		{name: "local buckets", policy: StoreFailLocal, wantAllowed: []bool{true, true, false}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:           2,
+				REFILL_INTERVAL:      time.Hour,
+				KEY_FUNC:             remoteIP,
+				STORE_FAILURE_POLICY: test.policy,
+				STORE: func(name string, profile LimitProfile) Store {
+					return &fakeStore{Store: NewMemoryStore(profile), err: errors.New("unavailable")}
+				},
+			})
+
+			for i, want := range test.wantAllowed {
+				if d := limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil)); d.Allowed != want {
+					t.Fatalf("request %d: allowed = %v, want %v", i, d.Allowed, want)
+				}
+			}
+			if degraded := limiter.StatusEvent().DegradedTotal; degraded < int64(len(test.wantAllowed)) {
+				t.Fatalf("DegradedTotal %d, want at least %d", degraded, len(test.wantAllowed))
+			}
+		})
+	}
+}
+
+func TestStoreLatencyBudget(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:           2,
+		REFILL_INTERVAL:      time.Hour,
+		KEY_FUNC:             remoteIP,
+		STORE_FAILURE_POLICY: StoreFailClosed,
+		STORE_LATENCY_BUDGET: 10 * time.Millisecond,
+		STORE: func(name string, profile LimitProfile) Store {
+			return &fakeStore{Store: NewMemoryStore(profile), delay: time.Second}
+		},
+	})
+
+	start := time.Now()
+	d := limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("decision took %v with a 10ms budget", elapsed)
+	}
+	if d.Allowed {
+		t.Fatal("request allowed past a slow store with StoreFailClosed")
+	}
+	if degraded := limiter.StatusEvent().DegradedTotal; degraded == 0 {
+		t.Fatal("slow store call not counted as degraded")
+	}
+}
+
+func TestStoreCircuitBreaker(t *testing.T) {
+	store := &fakeStore{err: errors.New("unavailable")}
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:              10,
+		REFILL_INTERVAL:         time.Hour,
+		KEY_FUNC:                remoteIP,
+		STORE_BREAKER_THRESHOLD: 2,
+		STORE_BREAKER_COOLDOWN:  50 * time.Millisecond,
+		STORE: func(name string, profile LimitProfile) Store {
+			if name == "default" {
+				store.Store = NewMemoryStore(profile)
+				return store
+			}
+			return NewMemoryStore(profile)
+		},
+	})
+	decide := func() {
+		limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	steps := []struct {
+		name      string
+		healthy   bool
+		wait      time.Duration
+		wantCalls int64
+		wantOpen  bool
+	}{
+		{name: "first failure", wantCalls: 1},
+		{name: "opens at the threshold", wantCalls: 2, wantOpen: true},
+		{name: "skips the store while open", wantCalls: 2, wantOpen: true},
+		{name: "failed probe reopens", wait: 60 * time.Millisecond, wantCalls: 3, wantOpen: true},
+		{name: "successful probe closes", healthy: true, wait: 60 * time.Millisecond, wantCalls: 4},
+		{name: "closed", healthy: true, wantCalls: 5},
+	}
+	for _, step := range steps {
+		if step.healthy {
+			store.err = nil
+		}
+		time.Sleep(step.wait)
+		decide()
+
+		if calls := atomic.LoadInt64(&store.calls); calls != step.wantCalls {
+			t.Fatalf("%s: %d store calls, want %d", step.name, calls, step.wantCalls)
+		}
+		if open := limiter.StatusEvent().StoreBreakerOpen; open != step.wantOpen {
+			t.Fatalf("%s: breaker open = %v, want %v", step.name, open, step.wantOpen)
+		}
+	}
+}
+
+// cachingStore is a memory store reporting fixed cache stats.
+type cachingStore struct {
+	*memoryStore
+}
+
+func (s cachingStore) CacheStats() (hits, misses int64) {
+	return 3, 1
+}
+
+func TestStoreStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		delay      time.Duration
+		wantErrors int64
+	}{
+		{name: "healthy"},
+		{name: "failing", err: errors.New("unavailable"), wantErrors: 3},
+		{name: "slow", delay: 2 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(RateLimiterConfig{
+				RATE_LIMIT:      10,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        remoteIP,
+				STORE: func(name string, profile LimitProfile) Store {
+					return &fakeStore{Store: NewMemoryStore(profile), err: test.err, delay: test.delay}
+				},
+			})
+			for i := 0; i < 3; i++ {
+				limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+			}
+
+			take := limiter.StoreStats().Take
+			if take.Calls != 3 || take.Errors != test.wantErrors {
+				t.Fatalf("%d takes with %d errors, want 3 with %d", take.Calls, take.Errors, test.wantErrors)
+			}
+			if take.LatencySum < 3*test.delay {
+				t.Fatalf("takes took %v in all, want at least %v", take.LatencySum, 3*test.delay)
+			}
+			for i, bound := range StoreLatencyBuckets() {
+				if count := take.LatencyBuckets[i]; (bound < test.delay && count != 0) || count > take.Calls {
+					t.Fatalf("%d takes within %v, each took at least %v", count, bound, test.delay)
+				}
+			}
+		})
+	}
+}
+
+func TestStoreStatsCountEveryMethod(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:      10,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        remoteIP,
+		STORE: func(name string, profile LimitProfile) Store {
+			return cachingStore{NewMemoryStore(profile).(*memoryStore)}
+		},
+	})
+	limiter.ThrottleKey("192.0.2.1", 0, time.Minute)
+	limiter.ResetKey("192.0.2.1")
+	limiter.ResetAll()
+
+	stats := limiter.StatusEvent().Store
+	if stats.Throttle.Calls == 0 || stats.Reset.Calls == 0 || stats.ResetAll.Calls == 0 {
+		t.Fatalf("throttle, reset and reset all calls %d, %d and %d, want them counted",
+			stats.Throttle.Calls, stats.Reset.Calls, stats.ResetAll.Calls)
+	}
+	// Summed over the default and verified sets.
+	if stats.CacheHits != 6 || stats.CacheMisses != 2 {
+		t.Fatalf("cache hits %d and misses %d, want 6 and 2", stats.CacheHits, stats.CacheMisses)
+	}
+}
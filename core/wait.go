@@ -0,0 +1,65 @@
+package core
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// wait parks a rejected request until a token frees up, MAX_WAIT runs out or
+// the client goes away, and returns the final decision. Requests beyond
+// MAX_QUEUE, and Final rejections, are rejected straight away.
+func (r *rateLimiter) wait(request *http.Request, d Decision) Decision {
+	c := r.config()
+	if d.Allowed || d.Final || c.MAX_WAIT <= 0 {
+		return d
+	}
+
+	if atomic.AddInt64(&r.waiting, 1) > c.MAX_QUEUE {
+		atomic.AddInt64(&r.waiting, -1)
+		return d
+	}
+	defer atomic.AddInt64(&r.waiting, -1)
+
+	return r.waitUntil(request, d, time.Now().Add(c.MAX_WAIT))
+}
+
+// waitUntil retries a rejected request whenever a token should have freed
+// up, until it is allowed, the deadline would pass or the client goes away.
+// A zero deadline waits for as long as the client does. Final rejections
+// are returned as they are.
+func (r *rateLimiter) waitUntil(request *http.Request, d Decision, deadline time.Time) Decision {
+	for !d.Allowed && !d.Final {
+		delay := d.RetryAfter
+		if delay <= 0 {
+			delay = time.Millisecond
+		}
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return d
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-request.Context().Done():
+			timer.Stop()
+			return d
+		case <-timer.C:
+		}
+
+		d = r.allow(request)
+	}
+	return d
+}
+
+// Wait charges the request like Decide but, whatever MAX_WAIT says, blocks
+// until a token frees up or the request's context is done. Final rejections
+// return at once, with a nil error. Clients use it to pace their own
+// outbound calls.
+func (r *rateLimiter) Wait(request *http.Request) (Decision, error) {
+	start := time.Now()
+	d := r.settle(request, start, r.waitUntil(request, r.allow(request), time.Time{}))
+	if !d.Allowed && !d.Exempt {
+		return d, request.Context().Err()
+	}
+	return d, nil
+}
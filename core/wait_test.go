@@ -0,0 +1,148 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDecideWaits(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      RateLimiterConfig
+		cancel      bool
+		wantAllowed bool
+	}{
+		{
+			name:        "no MAX_WAIT",
+			config:      RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: 20 * time.Millisecond, KEY_FUNC: remoteIP},
+			wantAllowed: false,
+		},
+		{
+			name:        "token frees up in time",
+			config:      RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: 20 * time.Millisecond, KEY_FUNC: remoteIP, MAX_WAIT: time.Second},
+			wantAllowed: true,
+		},
+		{
+			name:        "token frees up too late",
+			config:      RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: remoteIP, MAX_WAIT: 20 * time.Millisecond},
+			wantAllowed: false,
+		},
+		{
+			name:        "client goes away",
+			config:      RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: 200 * time.Millisecond, KEY_FUNC: remoteIP, MAX_WAIT: time.Second},
+			cancel:      true,
+			wantAllowed: false,
+		},
+		{
+			name: "queue full",
+			config: RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: 20 * time.Millisecond,
+				KEY_FUNC:        remoteIP,
+				MAX_WAIT:        time.Second,
+				MAX_QUEUE:       -1,
+			},
+			wantAllowed: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			limiter := New()
+			limiter.SetConfig(test.config)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+
+			if !limiter.Decide(request).Allowed {
+				t.Fatal("first request rejected")
+			}
+			if test.cancel {
+				time.AfterFunc(10*time.Millisecond, cancel)
+			}
+			if d := limiter.Decide(request); d.Allowed != test.wantAllowed {
+				t.Fatalf("second request allowed = %v, want %v", d.Allowed, test.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	limiter := New()
+	limiter.SetConfig(RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, KEY_FUNC: remoteIP})
+	limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	d, err := limiter.Wait(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if d.Allowed || err != context.DeadlineExceeded {
+		t.Fatalf("Wait = %v, %v, want a rejection with context.DeadlineExceeded", d.Allowed, err)
+	}
+}
+
+func TestWaitFinal(t *testing.T) {
+	tests := []struct {
+		name   string
+		action PolicyAction
+		// Denylists the client for denyFor instead, forever if zero.
+		deny           bool
+		denyFor        time.Duration
+		wait           bool
+		wantRule       string
+		wantRetryAfter time.Duration
+	}{
+		{name: "deny under MAX_WAIT", action: PolicyDeny, wantRule: "blocked"},
+		{name: "challenge under MAX_WAIT", action: PolicyChallenge, wantRule: "blocked"},
+		{name: "deny with Wait", action: PolicyDeny, wait: true, wantRule: "blocked"},
+		{name: "denylist under MAX_WAIT", deny: true, wantRule: "denylist"},
+		{name: "denylist with Wait", deny: true, wait: true, wantRule: "denylist"},
+		{name: "expiring denylist", deny: true, denyFor: time.Hour, wantRule: "denylist", wantRetryAfter: time.Hour},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var matched int
+			config := RateLimiterConfig{
+				RATE_LIMIT:      1,
+				REFILL_INTERVAL: time.Hour,
+				KEY_FUNC:        remoteIP,
+				MAX_WAIT:        300 * time.Millisecond,
+			}
+			if !test.deny {
+				config.POLICY = Policy{{NAME: "blocked", ACTION: test.action, MATCH: []Matcher{
+					func(r *http.Request, clientIP string) bool { matched++; return true },
+				}}}
+			}
+			limiter := New()
+			limiter.SetConfig(config)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			if test.deny {
+				limiter.DenyKey(remoteIP(request), test.denyFor)
+			}
+			start := time.Now()
+			var d Decision
+			if test.wait {
+				var err error
+				if d, err = limiter.Wait(request); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				d = limiter.Decide(request)
+			}
+			if d.Allowed || !d.Final || d.Rule != test.wantRule || d.RetryAfter.Round(time.Minute) != test.wantRetryAfter {
+				t.Fatalf("decision %+v", d)
+			}
+			if !test.deny && matched != 1 {
+				t.Fatalf("policy evaluated %d times, want 1", matched)
+			}
+			if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+				t.Fatalf("returned after %v", elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// WebSocketLimiter covers the parts of a WebSocket's life the HTTP
+// middlewares never see: how often a client may open connections, and how
+// many messages may flow over each connection once it is upgraded.
+type WebSocketLimiter interface {
+	SetConfig(WebSocketLimiterConfig)
+	// UpgradeLimiter limits how often connections are opened. Check the
+	// upgrade request against it before upgrading.
+	UpgradeLimiter() RateLimiter
+	// NewConnLimiter returns a fresh message bucket for one connection.
+	NewConnLimiter() ConnLimiter
+}
+
+type WebSocketLimiterConfig struct {
+	// Connections a key may open, refilled one per REFILL_INTERVAL.
+	RATE_LIMIT      int64
+	REFILL_INTERVAL time.Duration
+	// Groups upgrade requests. Defaults to the client IP.
+	KEY_FUNC func(r *http.Request) string
+	// Messages allowed per connection, refilled one per
+	// MESSAGE_REFILL_INTERVAL.
+	MESSAGE_RATE_LIMIT      int64
+	MESSAGE_REFILL_INTERVAL time.Duration
+}
+
+// ConnLimiter limits the messages on a single connection.
+type ConnLimiter interface {
+	Allow() bool
+	AllowN(n int64) bool
+	Wait(ctx context.Context) error
+}
+
+type webSocketLimiter struct {
+	WebSocketLimiterConfig
+	upgrades RateLimiter
+}
+
+type connLimiter struct {
+	messages *keyedBuckets
+}
+
+func NewWebSocketLimiter() WebSocketLimiter {
+	return &webSocketLimiter{}
+}
+
+func (l *webSocketLimiter) SetConfig(config WebSocketLimiterConfig) {
+	if config.KEY_FUNC == nil {
+		config.KEY_FUNC = clientIP
+	}
+
+	l.WebSocketLimiterConfig = config
+	l.upgrades = New()
+	l.upgrades.SetConfig(RateLimiterConfig{
+		RATE_LIMIT:      config.RATE_LIMIT,
+		REFILL_INTERVAL: config.REFILL_INTERVAL,
+		KEY_FUNC:        config.KEY_FUNC,
+	})
+}
+
+func (l *webSocketLimiter) UpgradeLimiter() RateLimiter {
+	return l.upgrades
+}
+
+func (l *webSocketLimiter) NewConnLimiter() ConnLimiter {
+	return NewMessageLimiter(LimitProfile{
+		RATE_LIMIT:      l.MESSAGE_RATE_LIMIT,
+		REFILL_INTERVAL: l.MESSAGE_REFILL_INTERVAL,
+	})
+}
+
+// NewMessageLimiter returns a fresh message bucket for one connection or
+// stream, starting full.
+func NewMessageLimiter(profile LimitProfile) ConnLimiter {
+	return &connLimiter{
+		messages: newKeyedBuckets(profile.RATE_LIMIT, profile.REFILL_INTERVAL),
+	}
+}
+
+func (c *connLimiter) Allow() bool {
+	return c.AllowN(1)
+}
+
+func (c *connLimiter) AllowN(n int64) bool {
+	allowed, _, _ := c.messages.take("", n)
+	return allowed
+}
+
+func (c *connLimiter) Wait(ctx context.Context) error {
+	return c.messages.wait(ctx, "", 1)
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebSocketLimiter(t *testing.T) {
+	limiter := NewWebSocketLimiter()
+	limiter.SetConfig(WebSocketLimiterConfig{
+		RATE_LIMIT:              1,
+		REFILL_INTERVAL:         time.Hour,
+		MESSAGE_RATE_LIMIT:      2,
+		MESSAGE_REFILL_INTERVAL: time.Hour,
+	})
+
+	upgrade := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	if !limiter.UpgradeLimiter().Decide(upgrade).Allowed {
+		t.Fatal("first upgrade rejected")
+	}
+	if limiter.UpgradeLimiter().Decide(upgrade).Allowed {
+		t.Fatal("second upgrade from the same client allowed")
+	}
+
+	// Every connection gets a bucket of its own.
+	for i := 0; i < 2; i++ {
+		conn := limiter.NewConnLimiter()
+		if !conn.Allow() || !conn.Allow() {
+			t.Fatalf("connection %d: messages within the limit rejected", i)
+		}
+		if conn.Allow() {
+			t.Fatalf("connection %d: message past the limit allowed", i)
+		}
+	}
+}
+
+func TestMessageLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile LimitProfile
+		n       int64
+		want    bool
+	}{
+		{name: "within the limit", profile: LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour}, n: 3, want: true},
+		{name: "past the limit", profile: LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour}, n: 4, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NewMessageLimiter(test.profile).AllowN(test.n); got != test.want {
+				t.Fatalf("AllowN(%d) = %v, want %v", test.n, got, test.want)
+			}
+		})
+	}
+
+	conn := NewMessageLimiter(LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour})
+	conn.Allow()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := conn.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Wait on an empty bucket = %v, want context.DeadlineExceeded", err)
+	}
+}
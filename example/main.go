@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/ginlimiter"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/gin-gonic/gin"
+)
+
+// Sample endpoint for testing rate limiting
+func TestEndpointWtihHTTP(w http.ResponseWriter, r *http.Request) {
+	rockPaperScissors := []string{"rock 🪨", "paper 📃", "scissors ✂️"}
+	randomChoice := rockPaperScissors[time.Now().UnixNano()%3]
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("You got %s", randomChoice),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestEndpointWithGin(ctx *gin.Context) {
+	rockPaperScissors := []string{"rock 🪨", "paper 📃", "scissors ✂️"}
+	randomChoice := rockPaperScissors[time.Now().UnixNano()%3]
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("You got %s", randomChoice),
+	}
+
+	ctx.Writer.Header().Set("Content-Type", "application/json")
+	ctx.JSON(http.StatusOK, response)
+}
+
+// func main() {
+// 	// Initialize the rate limiter
+// 	rateLimiter := core.New()
+// 	rateLimiter.SetConfig(core.RateLimiterConfig{
+// 		RATE_LIMIT:      1000,
+// 		REFILL_INTERVAL: 2 * time.Second,
+// 	})
+// 	rateLimiter.Run()
+
+// 	// Setup HTTP server and routes
+// 	http.HandleFunc("/bucket", stdhttp.GetBucketStatus(rateLimiter))
+// 	http.Handle("/test", stdhttp.RateLimitMiddleware(rateLimiter, http.HandlerFunc(TestEndpointWtihHTTP)))
+
+// 	// Start the server
+// 	fmt.Println("Server running on port 5000")
+// 	if err := http.ListenAndServe(":5000", nil); err != nil {
+// 		fmt.Println("Error starting server:", err)
+// 	}
+// }
+
+func main() {
+	// Initialize the rate limiter
+	rateLimiter := core.New()
+	rateLimiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1000,
+		REFILL_INTERVAL: 2 * time.Second,
+	})
+	rateLimiter.Run()
+
+	// Setup HTTP server and routes
+	r := gin.Default()
+	r.Use(ginlimiter.RateLimitMiddleware(rateLimiter))
+
+	test := r.Group("/test")
+	{
+		test.GET("/bucket", ginlimiter.GetBucketStatus(rateLimiter))
+		test.GET("/bucket/stream", ginlimiter.StreamBucketStatus(rateLimiter))
+		test.POST("/", TestEndpointWithGin)
+	}
+
+	// Start the server
+	fmt.Println("Server running on port 5000")
+	if err := r.Run(":5000"); err != nil {
+		fmt.Println("Error starting server:", err)
+	}
+}
@@ -0,0 +1,75 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/oschwald/geoip2-golang"
+)
+
+// MaxMindLocator implements core.GeoLocator with MaxMind GeoIP2 or
+// GeoLite2 databases. Either database may be left out.
+type MaxMindLocator struct {
+	country *geoip2.Reader
+	asn     *geoip2.Reader
+}
+
+// NewMaxMindLocator opens a Country (or City) database and an ASN database.
+// Pass an empty path to skip one of them.
+func NewMaxMindLocator(countryPath, asnPath string) (*MaxMindLocator, error) {
+	if countryPath == "" && asnPath == "" {
+		return nil, errors.New("geoip: no database given")
+	}
+
+	locator := &MaxMindLocator{}
+	if countryPath != "" {
+		reader, err := geoip2.Open(countryPath)
+		if err != nil {
+			return nil, err
+		}
+		locator.country = reader
+	}
+	if asnPath != "" {
+		reader, err := geoip2.Open(asnPath)
+		if err != nil {
+			locator.Close()
+			return nil, err
+		}
+		locator.asn = reader
+	}
+	return locator, nil
+}
+
+func (l *MaxMindLocator) Locate(ip net.IP) (core.GeoLocation, error) {
+	var location core.GeoLocation
+
+	if l.country != nil {
+		country, err := l.country.Country(ip)
+		if err != nil {
+			return location, err
+		}
+		location.Country = country.Country.IsoCode
+	}
+	if l.asn != nil {
+		asn, err := l.asn.ASN(ip)
+		if err != nil {
+			return location, err
+		}
+		location.ASN = asn.AutonomousSystemNumber
+	}
+	return location, nil
+}
+
+func (l *MaxMindLocator) Close() error {
+	var err error
+	if l.country != nil {
+		err = l.country.Close()
+	}
+	if l.asn != nil {
+		if closeErr := l.asn.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
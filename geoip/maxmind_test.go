@@ -0,0 +1,28 @@
+package geoip
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNewMaxMindLocatorErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.mmdb")
+
+	tests := []struct {
+		name        string
+		countryPath string
+		asnPath     string
+	}{
+		{name: "no database"},
+		{name: "missing country database", countryPath: missing},
+		{name: "missing ASN database", asnPath: missing},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewMaxMindLocator(test.countryPath, test.asnPath); err == nil {
+				t.Fatal("NewMaxMindLocator returned no error")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Package expvarlimiter publishes a limiter's stats through expvar, for
+// teams reading /debug/vars rather than running Prometheus. Importing it
+// imports expvar, which serves /debug/vars on http.DefaultServeMux, so it
+// is a package of its own rather than part of core.
+package expvarlimiter
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// Stats is what Publish shows for a limiter.
+type Stats struct {
+	Allowed int64 `json:"allowed"`
+	Denied  int64 `json:"denied"`
+	// Tokens in the bucket shared by unkeyed requests.
+	Tokens int64 `json:"tokens"`
+	// Keys with an in-memory bucket.
+	Keys int `json:"keys"`
+}
+
+// published holds the limiter shown under each name. expvar has no way to
+// remove a name, so publishing one again shows the new limiter instead.
+var published = struct {
+	limiters map[string]core.RateLimiter
+	mx       sync.Mutex
+}{limiters: map[string]core.RateLimiter{}}
+
+// Publish shows the limiter's Stats under name in expvar, e.g.
+//
+//	expvarlimiter.Publish("ratelimit_api", limiter)
+//
+// gives {"ratelimit_api": {"allowed": 120, "denied": 3, "tokens": 0, "keys": 41}}
+// in /debug/vars. Publishing a name again, e.g. for a limiter replaced on
+// reload, shows the new limiter. Like expvar.Publish, it panics if
+// something other than a limiter already published name.
+func Publish(name string, limiter core.RateLimiter) {
+	published.mx.Lock()
+	defer published.mx.Unlock()
+
+	if _, ok := published.limiters[name]; !ok {
+		expvar.Publish(name, expvar.Func(func() any {
+			published.mx.Lock()
+			limiter := published.limiters[name]
+			published.mx.Unlock()
+			return stats(limiter)
+		}))
+	}
+	published.limiters[name] = limiter
+}
+
+func stats(limiter core.RateLimiter) Stats {
+	event := limiter.StatusEvent()
+	return Stats{
+		Allowed: event.AllowedTotal,
+		Denied:  event.DeniedTotal,
+		Tokens:  event.CurrentBucketSize,
+		Keys:    event.TrackedKeys,
+	}
+}
@@ -0,0 +1,66 @@
+package expvarlimiter
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// read returns the Stats published under name, as /debug/vars shows them.
+func read(t *testing.T, name string) Stats {
+	t.Helper()
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatalf("nothing published as %s", name)
+	}
+	var s Stats
+	if err := json.Unmarshal([]byte(v.String()), &s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newLimiter() core.RateLimiter {
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return core.StripPort(r.RemoteAddr) },
+	})
+	return limiter
+}
+
+func TestPublish(t *testing.T) {
+	limiter := newLimiter()
+	Publish("ratelimit_test", limiter)
+	for _, addr := range []string{"203.0.113.7:1", "203.0.113.7:2", "10.0.0.1:1"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		limiter.Decide(r)
+	}
+
+	if got, want := read(t, "ratelimit_test"), (Stats{Allowed: 2, Denied: 1, Keys: 2}); got != want {
+		t.Fatalf("published %+v, want %+v", got, want)
+	}
+
+	// A limiter replaced on reload takes the name over.
+	Publish("ratelimit_test", newLimiter())
+	if got := read(t, "ratelimit_test"); got != (Stats{}) {
+		t.Fatalf("published %+v after republishing, want the new limiter's empty stats", got)
+	}
+}
+
+func TestPublishTakenName(t *testing.T) {
+	expvar.NewInt("ratelimit_taken")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("publishing over another var didn't panic")
+		}
+	}()
+	Publish("ratelimit_taken", newLimiter())
+}
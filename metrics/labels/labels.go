@@ -0,0 +1,129 @@
+// Package labels adds labels of your choosing, such as a customer's tier
+// or the route template, to the decision metrics of promlimiter,
+// otellimiter and statsdlimiter, with a cap on how many values each label
+// reports so a label fed user IDs or raw paths can't explode the number
+// of time series:
+//
+//	collector := promlimiter.NewCollector(limiter, promlimiter.CollectorConfig{
+//		LABELS: []labels.Label{labels.Route(), labels.Tier(planOf)},
+//	})
+package labels
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// Other is reported for the values of a label past its MAX_VALUES, and
+// by Route for requests without a route template.
+const Other = "other"
+
+// DefaultMaxValues is the MAX_VALUES of labels that don't set one.
+const DefaultMaxValues = 100
+
+// Label is an extra label of the decision metrics.
+type Label struct {
+	NAME  string
+	VALUE func(r *http.Request, d core.Decision) string
+	// Most distinct values reported; values first seen once there are
+	// that many are reported as Other. Defaults to DefaultMaxValues.
+	MAX_VALUES int
+}
+
+// Route labels decisions "route" with the route template the router
+// recorded, e.g. /users/:id, or Other for requests without one, as raw
+// paths would make a series per ID.
+func Route() Label {
+	return Label{NAME: "route", VALUE: func(r *http.Request, d core.Decision) string {
+		if template, ok := core.RouteTemplateFromContext(r.Context()); ok {
+			return template
+		}
+		return Other
+	}}
+}
+
+// Tier labels decisions "tier" with the tier of their key, e.g. the
+// customer's plan.
+func Tier(tier func(key string) string) Label {
+	return Label{NAME: "tier", VALUE: func(r *http.Request, d core.Decision) string {
+		return tier(d.Key)
+	}}
+}
+
+// KeyClass labels decisions "key_class" with the class of their key, e.g.
+// "ip" or "user".
+func KeyClass(class func(key string) string) Label {
+	return Label{NAME: "key_class", VALUE: func(r *http.Request, d core.Decision) string {
+		return class(d.Key)
+	}}
+}
+
+// WithKeyClass returns extra preceded by KeyClass(class), or extra alone
+// if class is nil. It turns the metrics packages' KEY_CLASS into a label.
+func WithKeyClass(class func(key string) string, extra []Label) []Label {
+	if class == nil {
+		return extra
+	}
+	return append([]Label{KeyClass(class)}, extra...)
+}
+
+// Set extracts a fixed list of labels from decisions, capping the values
+// of each. A nil Set has no labels.
+type Set struct {
+	labels []Label
+	// Values reported so far, per label.
+	seen []map[string]bool
+	mx   sync.Mutex
+}
+
+func NewSet(labels ...Label) *Set {
+	s := &Set{labels: labels, seen: make([]map[string]bool, len(labels))}
+	for i := range labels {
+		if s.labels[i].MAX_VALUES <= 0 {
+			s.labels[i].MAX_VALUES = DefaultMaxValues
+		}
+		s.seen[i] = map[string]bool{}
+	}
+	return s
+}
+
+// Names returns the names of the labels, in order.
+func (s *Set) Names() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, len(s.labels))
+	for i, label := range s.labels {
+		names[i] = label.NAME
+	}
+	return names
+}
+
+// Values returns the values of the labels for a decision, in order.
+func (s *Set) Values(r *http.Request, d core.Decision) []string {
+	if s == nil || len(s.labels) == 0 {
+		return nil
+	}
+	values := make([]string, len(s.labels))
+	for i, label := range s.labels {
+		values[i] = label.VALUE(r, d)
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for i, value := range values {
+		seen := s.seen[i]
+		if seen[value] {
+			continue
+		}
+		if len(seen) >= s.labels[i].MAX_VALUES {
+			values[i] = Other
+			continue
+		}
+		seen[value] = true
+	}
+	return values
+}
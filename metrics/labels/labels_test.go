@@ -0,0 +1,78 @@
+package labels
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestSet(t *testing.T) {
+	plans := map[string]string{"alice": "pro", "bob": "free", "carol": "enterprise"}
+	set := NewSet(
+		Route(),
+		Tier(func(key string) string { return plans[key] }),
+		Label{NAME: "user", VALUE: func(r *http.Request, d core.Decision) string { return d.Key }, MAX_VALUES: 2},
+	)
+	if names := set.Names(); !reflect.DeepEqual(names, []string{"route", "tier", "user"}) {
+		t.Fatalf("names %v", names)
+	}
+
+	tests := []struct {
+		name  string
+		route string
+		key   string
+		want  []string
+	}{
+		{name: "first user", route: "/users/:id", key: "alice", want: []string{"/users/:id", "pro", "alice"}},
+		{name: "second user", route: "/users/:id", key: "bob", want: []string{"/users/:id", "free", "bob"}},
+		{name: "user past the cap", route: "/users/:id", key: "carol", want: []string{"/users/:id", "enterprise", "other"}},
+		{name: "user seen before the cap", key: "alice", want: []string{"other", "pro", "alice"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if test.route != "" {
+				r = core.WithRouteTemplate(r, test.route)
+			}
+			if got := set.Values(r, core.Decision{Key: test.key}); !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("values %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetConcurrent(t *testing.T) {
+	set := NewSet(Label{NAME: "user", VALUE: func(r *http.Request, d core.Decision) string { return d.Key }, MAX_VALUES: 10})
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	var mx sync.Mutex
+	distinct := map[string]bool{}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			value := set.Values(r, core.Decision{Key: strconv.Itoa(i)})[0]
+			mx.Lock()
+			distinct[value] = true
+			mx.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	// Ten users and "other".
+	if len(distinct) != 11 || !distinct[Other] {
+		t.Fatalf("%d distinct values", len(distinct))
+	}
+}
+
+func TestNilSet(t *testing.T) {
+	var set *Set
+	if set.Names() != nil || set.Values(httptest.NewRequest(http.MethodGet, "/", nil), core.Decision{}) != nil {
+		t.Fatal("nil set has labels")
+	}
+}
@@ -0,0 +1,193 @@
+package otellimiter
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/metrics/labels"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+type MeterConfig struct {
+	// Tells the limiters measured with one meter apart, as the "limiter"
+	// attribute. Defaults to "default".
+	NAME string
+	// Sorts keys into a few classes, e.g. "ip" or "user" or a customer's
+	// plan, as the "key_class" attribute of the decision counter. Nil leaves
+	// the attribute out. It must return few distinct values, as every one is
+	// a time series.
+	KEY_CLASS func(key string) string
+	// Further attributes of the decision counter, e.g. labels.Route().
+	// Values past each label's MAX_VALUES are counted as "other".
+	LABELS []labels.Label
+	// Upper bounds of the decision latency histogram, in seconds. Defaults
+	// to 10µs to about 2.6s in steps of four, as in promlimiter.
+	LATENCY_BUCKETS []float64
+}
+
+// Meter records a limiter's decisions and state with an OpenTelemetry
+// meter, for deployments sending metrics through the OTel collector rather
+// than having Prometheus scrape them. Its Observe is the limiter's
+// ON_DECISION:
+//
+//	limiter := core.New()
+//	meter, err := otellimiter.NewMeter(limiter, otel.Meter("myapp"), otellimiter.MeterConfig{NAME: "api"})
+//	limiter.SetConfig(core.RateLimiterConfig{
+//		...
+//		ON_DECISION: meter.Observe,
+//	})
+//
+// The measurements are those of promlimiter.Collector, named the OTel way,
+// e.g. ratelimit.decisions for ratelimit_decisions_total. OTel has no
+// asynchronous histogram, so the STORE's latency is measured as the total
+// time its calls took, ratelimit.store.duration, next to their count.
+type Meter struct {
+	limiter     core.RateLimiter
+	labels      *labels.Set
+	limiterAttr attribute.KeyValue
+
+	decisions metric.Int64Counter
+	latency   metric.Float64Histogram
+
+	registration metric.Registration
+}
+
+// NewMeter creates the instruments with meter and starts reporting the
+// limiter's state whenever the meter's readers collect.
+func NewMeter(limiter core.RateLimiter, meter metric.Meter, config MeterConfig) (*Meter, error) {
+	if config.NAME == "" {
+		config.NAME = "default"
+	}
+	if config.LATENCY_BUCKETS == nil {
+		config.LATENCY_BUCKETS = make([]float64, 10)
+		for i, bound := 0, 0.00001; i < len(config.LATENCY_BUCKETS); i, bound = i+1, bound*4 {
+			config.LATENCY_BUCKETS[i] = bound
+		}
+	}
+
+	m := &Meter{
+		limiter:     limiter,
+		labels:      labels.NewSet(labels.WithKeyClass(config.KEY_CLASS, config.LABELS)...),
+		limiterAttr: attribute.String("limiter", config.NAME),
+	}
+	var err error
+	if m.decisions, err = meter.Int64Counter("ratelimit.decisions",
+		metric.WithDescription("Rate limit decisions by rule and result."),
+		metric.WithUnit("{decision}")); err != nil {
+		return nil, err
+	}
+	if m.latency, err = meter.Float64Histogram("ratelimit.decision.duration",
+		metric.WithDescription("Time taken to decide requests, waiting for tokens included."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(config.LATENCY_BUCKETS...)); err != nil {
+		return nil, err
+	}
+
+	tokens, err := meter.Int64ObservableGauge("ratelimit.tokens",
+		metric.WithDescription("Tokens in the bucket shared by unkeyed requests."),
+		metric.WithUnit("{token}"))
+	if err != nil {
+		return nil, err
+	}
+	trackedKeys, err := meter.Int64ObservableGauge("ratelimit.tracked_keys",
+		metric.WithDescription("Keys with an in-memory bucket."),
+		metric.WithUnit("{key}"))
+	if err != nil {
+		return nil, err
+	}
+	degraded, err := meter.Int64ObservableCounter("ratelimit.store.degraded",
+		metric.WithDescription("Decisions made without the store as it failed."),
+		metric.WithUnit("{decision}"))
+	if err != nil {
+		return nil, err
+	}
+	breakerOpen, err := meter.Int64ObservableGauge("ratelimit.store.breaker_open",
+		metric.WithDescription("Whether the store circuit breaker is skipping the store."))
+	if err != nil {
+		return nil, err
+	}
+	storeCalls, err := meter.Int64ObservableCounter("ratelimit.store.calls",
+		metric.WithDescription("Store calls by operation."),
+		metric.WithUnit("{call}"))
+	if err != nil {
+		return nil, err
+	}
+	storeErrors, err := meter.Int64ObservableCounter("ratelimit.store.errors",
+		metric.WithDescription("Failed store calls by operation."),
+		metric.WithUnit("{call}"))
+	if err != nil {
+		return nil, err
+	}
+	storeDuration, err := meter.Float64ObservableCounter("ratelimit.store.duration",
+		metric.WithDescription("Total time taken by store calls by operation."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	storeCacheTakes, err := meter.Int64ObservableCounter("ratelimit.store.cache_takes",
+		metric.WithDescription("Takes served from tokens a caching store held, or not."),
+		metric.WithUnit("{take}"))
+	if err != nil {
+		return nil, err
+	}
+
+	m.registration, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		event := m.limiter.StatusEvent()
+		own := metric.WithAttributes(m.limiterAttr)
+		o.ObserveInt64(tokens, event.CurrentBucketSize, own)
+		o.ObserveInt64(trackedKeys, int64(event.TrackedKeys), own)
+		o.ObserveInt64(degraded, event.DegradedTotal, own)
+		var open int64
+		if event.StoreBreakerOpen {
+			open = 1
+		}
+		o.ObserveInt64(breakerOpen, open, own)
+
+		for op, stats := range map[string]core.StoreOpStats{
+			"take":      event.Store.Take,
+			"throttle":  event.Store.Throttle,
+			"reset":     event.Store.Reset,
+			"reset_all": event.Store.ResetAll,
+		} {
+			attrs := metric.WithAttributes(m.limiterAttr, attribute.String("op", op))
+			o.ObserveInt64(storeCalls, stats.Calls, attrs)
+			o.ObserveInt64(storeErrors, stats.Errors, attrs)
+			o.ObserveFloat64(storeDuration, stats.LatencySum.Seconds(), attrs)
+		}
+		o.ObserveInt64(storeCacheTakes, event.Store.CacheHits, metric.WithAttributes(m.limiterAttr, attribute.String("result", "hit")))
+		o.ObserveInt64(storeCacheTakes, event.Store.CacheMisses, metric.WithAttributes(m.limiterAttr, attribute.String("result", "miss")))
+		return nil
+	}, tokens, trackedKeys, degraded, breakerOpen, storeCalls, storeErrors, storeDuration, storeCacheTakes)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Observe counts and times a decision. It is meant to be the limiter's
+// ON_DECISION.
+func (m *Meter) Observe(r *http.Request, d core.Decision, elapsed time.Duration) {
+	result := "denied"
+	switch {
+	case d.Exempt:
+		result = "exempt"
+	case d.Allowed:
+		result = "allowed"
+	}
+	ctx := r.Context()
+	attrs := []attribute.KeyValue{m.limiterAttr, attribute.String("rule", d.Rule), attribute.String("result", result)}
+	names := m.labels.Names()
+	for i, value := range m.labels.Values(r, d) {
+		attrs = append(attrs, attribute.String(names[i], value))
+	}
+	m.decisions.Add(ctx, 1, metric.WithAttributes(attrs...))
+	m.latency.Record(ctx, elapsed.Seconds(), metric.WithAttributes(m.limiterAttr, attribute.String("rule", d.Rule)))
+}
+
+// Close stops reporting the limiter's state.
+func (m *Meter) Close() error {
+	return m.registration.Unregister()
+}
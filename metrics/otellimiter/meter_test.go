@@ -0,0 +1,136 @@
+package otellimiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// collect returns the value of every data point the reader collects by
+// name and attributes, e.g. `ratelimit.decisions{limiter="api",result="allowed",rule="default"}`.
+// Histograms count their samples.
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]float64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	points := map[string]float64{}
+	add := func(metric string, attrs attribute.Set, value float64) {
+		name := metric + "{"
+		for i, attr := range attrs.ToSlice() {
+			if i > 0 {
+				name += ","
+			}
+			name += string(attr.Key) + `="` + attr.Value.Emit() + `"`
+		}
+		points[name+"}"] = value
+	}
+	for _, scope := range rm.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, p := range data.DataPoints {
+					add(m.Name, p.Attributes, float64(p.Value))
+				}
+			case metricdata.Sum[float64]:
+				for _, p := range data.DataPoints {
+					add(m.Name, p.Attributes, p.Value)
+				}
+			case metricdata.Gauge[int64]:
+				for _, p := range data.DataPoints {
+					add(m.Name, p.Attributes, float64(p.Value))
+				}
+			case metricdata.Histogram[float64]:
+				for _, p := range data.DataPoints {
+					add(m.Name, p.Attributes, float64(p.Count))
+				}
+			}
+		}
+	}
+	return points
+}
+
+func TestMeter(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	limiter := core.New()
+	meter, err := NewMeter(limiter, provider.Meter("test"), MeterConfig{
+		NAME: "api",
+		KEY_CLASS: func(key string) string {
+			if key == "10.0.0.1" {
+				return "internal"
+			}
+			return "ip"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return core.StripPort(r.RemoteAddr) },
+		ON_DECISION:     meter.Observe,
+	})
+
+	for _, addr := range []string{"203.0.113.7:1", "203.0.113.7:2", "10.0.0.1:1"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		limiter.Decide(r)
+	}
+	points := collect(t, reader)
+
+	tests := []struct {
+		point string
+		want  float64
+	}{
+		{point: `ratelimit.decisions{key_class="ip",limiter="api",result="allowed",rule="default"}`, want: 1},
+		{point: `ratelimit.decisions{key_class="ip",limiter="api",result="denied",rule="default"}`, want: 1},
+		{point: `ratelimit.decisions{key_class="internal",limiter="api",result="allowed",rule="default"}`, want: 1},
+		{point: `ratelimit.decision.duration{limiter="api",rule="default"}`, want: 3},
+		{point: `ratelimit.tracked_keys{limiter="api"}`, want: 2},
+		{point: `ratelimit.store.calls{limiter="api",op="take"}`, want: 3},
+		{point: `ratelimit.store.errors{limiter="api",op="take"}`, want: 0},
+		{point: `ratelimit.store.breaker_open{limiter="api"}`, want: 0},
+		{point: `ratelimit.store.cache_takes{limiter="api",result="hit"}`, want: 0},
+	}
+	for _, test := range tests {
+		got, ok := points[test.point]
+		if !ok {
+			t.Errorf("no data point %s", test.point)
+		} else if got != test.want {
+			t.Errorf("%s = %v, want %v", test.point, got, test.want)
+		}
+	}
+}
+
+func TestMeterClose(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	meter, err := NewMeter(core.New(), provider.Meter("test"), MeterConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := collect(t, reader)[`ratelimit.tokens{limiter="default"}`]; !ok {
+		t.Fatal("no tokens reported before closing")
+	}
+	if err := meter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := collect(t, reader)[`ratelimit.tokens{limiter="default"}`]; ok {
+		t.Fatal("tokens still reported after closing")
+	}
+}
@@ -0,0 +1,45 @@
+package otellimiter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Annotate records a decision on the span of the request's context, if
+// one is recording, so throttling shows in traces instead of as
+// unexplained latency or errors. The span gets ratelimit.allowed,
+// ratelimit.remaining and ratelimit.rule, and a denial adds a
+// ratelimit.rejected event with the retry delay. It can be the limiter's
+// ON_DECISION, or be called from it next to Meter.Observe:
+//
+//	ON_DECISION: func(r *http.Request, d core.Decision, elapsed time.Duration) {
+//		meter.Observe(r, d, elapsed)
+//		otellimiter.Annotate(r, d, elapsed)
+//	},
+//
+// Exempt requests are left alone.
+func Annotate(r *http.Request, d core.Decision, elapsed time.Duration) {
+	if d.Exempt {
+		return
+	}
+	span := trace.SpanFromContext(r.Context())
+	if !span.IsRecording() {
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Bool("ratelimit.allowed", d.Allowed),
+		attribute.Int64("ratelimit.remaining", d.Remaining),
+		attribute.String("ratelimit.rule", d.Rule),
+	)
+	if !d.Allowed {
+		span.AddEvent("ratelimit.rejected", trace.WithAttributes(
+			attribute.Int64("ratelimit.limit", d.Limit),
+			attribute.Float64("ratelimit.retry_after", d.RetryAfter.Seconds()),
+		))
+	}
+}
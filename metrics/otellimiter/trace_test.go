@@ -0,0 +1,67 @@
+package otellimiter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestAnnotate(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	limiter := core.New()
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return "client" },
+		ON_DECISION:     Annotate,
+	})
+
+	tests := []struct {
+		name        string
+		wantAllowed bool
+		wantEvent   bool
+	}{
+		{name: "allowed", wantAllowed: true},
+		{name: "denied", wantAllowed: false, wantEvent: true},
+	}
+	for _, test := range tests {
+		ctx, span := tracer.Start(context.Background(), test.name)
+		limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+		span.End()
+
+		ended := recorder.Ended()
+		got := ended[len(ended)-1]
+		attrs := map[attribute.Key]attribute.Value{}
+		for _, attr := range got.Attributes() {
+			attrs[attr.Key] = attr.Value
+		}
+		if attrs["ratelimit.allowed"].AsBool() != test.wantAllowed || attrs["ratelimit.rule"].AsString() != "default" {
+			t.Errorf("%s: attributes %v", test.name, got.Attributes())
+		}
+		if _, ok := attrs["ratelimit.remaining"]; !ok {
+			t.Errorf("%s: no ratelimit.remaining", test.name)
+		}
+		events := got.Events()
+		if hasEvent := len(events) == 1 && events[0].Name == "ratelimit.rejected"; hasEvent != test.wantEvent {
+			t.Errorf("%s: events %v, want a rejection %v", test.name, events, test.wantEvent)
+		}
+	}
+}
+
+func TestAnnotateWithoutSpan(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if trace.SpanFromContext(r.Context()).IsRecording() {
+		t.Fatal("request has a recording span")
+	}
+	Annotate(r, core.Decision{Rule: "default"}, 0)
+}
@@ -0,0 +1,158 @@
+package promlimiter
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/metrics/labels"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type CollectorConfig struct {
+	// Tells the limiters registered with one registry apart, as the
+	// "limiter" label. Defaults to "default".
+	NAME string
+	// Sorts keys into a few classes, e.g. "ip" or "user" or a customer's
+	// plan, as the "key_class" label of the decision counter. Nil leaves
+	// the label out. It must return few distinct values, as every one is
+	// a time series.
+	KEY_CLASS func(key string) string
+	// Further labels of the decision counter, e.g. labels.Route(). Values
+	// past each label's MAX_VALUES are counted as "other".
+	LABELS []labels.Label
+	// Upper bounds of the decision latency histogram, in seconds. Defaults
+	// to 10µs to about 2.6s in steps of four.
+	LATENCY_BUCKETS []float64
+}
+
+// Collector exports a limiter's decisions and state to Prometheus. Its
+// Observe is the limiter's ON_DECISION:
+//
+//	limiter := core.New()
+//	collector := promlimiter.NewCollector(limiter, promlimiter.CollectorConfig{NAME: "api"})
+//	limiter.SetConfig(core.RateLimiterConfig{
+//		...
+//		ON_DECISION: collector.Observe,
+//	})
+//	prometheus.MustRegister(collector)
+//
+// Decisions are counted by rule and result, "allowed", "denied" or
+// "exempt", and timed by rule. Gauges and the STORE's counters and latency
+// are read from the limiter when scraped.
+type Collector struct {
+	limiter core.RateLimiter
+	labels  *labels.Set
+
+	decisions *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+
+	tokens        *prometheus.Desc
+	trackedKeys   *prometheus.Desc
+	degraded      *prometheus.Desc
+	breakerOpen   *prometheus.Desc
+	storeCalls    *prometheus.Desc
+	storeErrors   *prometheus.Desc
+	storeLatency  *prometheus.Desc
+	storeCacheHit *prometheus.Desc
+}
+
+func NewCollector(limiter core.RateLimiter, config CollectorConfig) *Collector {
+	if config.NAME == "" {
+		config.NAME = "default"
+	}
+	if config.LATENCY_BUCKETS == nil {
+		config.LATENCY_BUCKETS = prometheus.ExponentialBuckets(0.00001, 4, 10)
+	}
+
+	constLabels := prometheus.Labels{"limiter": config.NAME}
+	extra := labels.NewSet(labels.WithKeyClass(config.KEY_CLASS, config.LABELS)...)
+	desc := func(name, help string, variableLabels ...string) *prometheus.Desc {
+		return prometheus.NewDesc(name, help, variableLabels, constLabels)
+	}
+
+	return &Collector{
+		limiter: limiter,
+		labels:  extra,
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name:        "ratelimit_decisions_total",
+			Help:        "Rate limit decisions by rule and result.",
+			ConstLabels: constLabels,
+		}, append([]string{"rule", "result"}, extra.Names()...)),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "ratelimit_decision_duration_seconds",
+			Help:        "Time taken to decide requests, waiting for tokens included.",
+			ConstLabels: constLabels,
+			Buckets:     config.LATENCY_BUCKETS,
+		}, []string{"rule"}),
+		tokens:        desc("ratelimit_tokens", "Tokens in the bucket shared by unkeyed requests."),
+		trackedKeys:   desc("ratelimit_tracked_keys", "Keys with an in-memory bucket."),
+		degraded:      desc("ratelimit_store_degraded_total", "Decisions made without the store as it failed."),
+		breakerOpen:   desc("ratelimit_store_breaker_open", "Whether the store circuit breaker is skipping the store."),
+		storeCalls:    desc("ratelimit_store_calls_total", "Store calls by operation.", "op"),
+		storeErrors:   desc("ratelimit_store_errors_total", "Failed store calls by operation.", "op"),
+		storeLatency:  desc("ratelimit_store_duration_seconds", "Time taken by store calls by operation.", "op"),
+		storeCacheHit: desc("ratelimit_store_cache_takes_total", "Takes served from tokens a caching store held, or not.", "result"),
+	}
+}
+
+// Observe counts and times a decision. It is meant to be the limiter's
+// ON_DECISION.
+func (c *Collector) Observe(r *http.Request, d core.Decision, elapsed time.Duration) {
+	result := "denied"
+	switch {
+	case d.Exempt:
+		result = "exempt"
+	case d.Allowed:
+		result = "allowed"
+	}
+	values := append([]string{d.Rule, result}, c.labels.Values(r, d)...)
+	c.decisions.WithLabelValues(values...).Inc()
+	c.latency.WithLabelValues(d.Rule).Observe(elapsed.Seconds())
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.decisions.Describe(ch)
+	c.latency.Describe(ch)
+	for _, desc := range []*prometheus.Desc{
+		c.tokens, c.trackedKeys, c.degraded, c.breakerOpen,
+		c.storeCalls, c.storeErrors, c.storeLatency, c.storeCacheHit,
+	} {
+		ch <- desc
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.decisions.Collect(ch)
+	c.latency.Collect(ch)
+
+	event := c.limiter.StatusEvent()
+	ch <- prometheus.MustNewConstMetric(c.tokens, prometheus.GaugeValue, float64(event.CurrentBucketSize))
+	ch <- prometheus.MustNewConstMetric(c.trackedKeys, prometheus.GaugeValue, float64(event.TrackedKeys))
+	ch <- prometheus.MustNewConstMetric(c.degraded, prometheus.CounterValue, float64(event.DegradedTotal))
+	breakerOpen := 0.0
+	if event.StoreBreakerOpen {
+		breakerOpen = 1
+	}
+	ch <- prometheus.MustNewConstMetric(c.breakerOpen, prometheus.GaugeValue, breakerOpen)
+
+	bounds := core.StoreLatencyBuckets()
+	for op, stats := range map[string]core.StoreOpStats{
+		"take":      event.Store.Take,
+		"throttle":  event.Store.Throttle,
+		"reset":     event.Store.Reset,
+		"reset_all": event.Store.ResetAll,
+	} {
+		ch <- prometheus.MustNewConstMetric(c.storeCalls, prometheus.CounterValue, float64(stats.Calls), op)
+		ch <- prometheus.MustNewConstMetric(c.storeErrors, prometheus.CounterValue, float64(stats.Errors), op)
+		buckets := make(map[float64]uint64, len(bounds))
+		for i, bound := range bounds {
+			buckets[bound.Seconds()] = uint64(stats.LatencyBuckets[i])
+		}
+		ch <- prometheus.MustNewConstHistogram(c.storeLatency, uint64(stats.Calls), stats.LatencySum.Seconds(), buckets, op)
+	}
+	ch <- prometheus.MustNewConstMetric(c.storeCacheHit, prometheus.CounterValue, float64(event.Store.CacheHits), "hit")
+	ch <- prometheus.MustNewConstMetric(c.storeCacheHit, prometheus.CounterValue, float64(event.Store.CacheMisses), "miss")
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
@@ -0,0 +1,167 @@
+package promlimiter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/metrics/labels"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gather returns the value of every sample of the registry's metrics by
+// name and labels, e.g. `ratelimit_decisions_total{limiter="api",result="allowed",rule="default"}`.
+func gather(t *testing.T, registry *prometheus.Registry) map[string]float64 {
+	t.Helper()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	samples := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName() + "{"
+			for i, label := range metric.GetLabel() {
+				if i > 0 {
+					name += ","
+				}
+				name += label.GetName() + `="` + label.GetValue() + `"`
+			}
+			name += "}"
+			samples[name] = value(metric)
+		}
+	}
+	return samples
+}
+
+// value is a counter's or gauge's value, or a histogram's sample count.
+func value(metric *dto.Metric) float64 {
+	switch {
+	case metric.Counter != nil:
+		return metric.GetCounter().GetValue()
+	case metric.Gauge != nil:
+		return metric.GetGauge().GetValue()
+	case metric.Histogram != nil:
+		return float64(metric.GetHistogram().GetSampleCount())
+	}
+	return 0
+}
+
+func TestCollector(t *testing.T) {
+	limiter := core.New()
+	collector := NewCollector(limiter, CollectorConfig{
+		NAME: "api",
+		KEY_CLASS: func(key string) string {
+			if key == "10.0.0.1" {
+				return "internal"
+			}
+			return "ip"
+		},
+	})
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return core.StripPort(r.RemoteAddr) },
+		ON_DECISION:     collector.Observe,
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	for _, addr := range []string{"203.0.113.7:1", "203.0.113.7:2", "10.0.0.1:1"} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = addr
+		limiter.Decide(r)
+	}
+	samples := gather(t, registry)
+
+	tests := []struct {
+		sample string
+		want   float64
+	}{
+		{sample: `ratelimit_decisions_total{key_class="ip",limiter="api",result="allowed",rule="default"}`, want: 1},
+		{sample: `ratelimit_decisions_total{key_class="ip",limiter="api",result="denied",rule="default"}`, want: 1},
+		{sample: `ratelimit_decisions_total{key_class="internal",limiter="api",result="allowed",rule="default"}`, want: 1},
+		{sample: `ratelimit_decision_duration_seconds{limiter="api",rule="default"}`, want: 3},
+		{sample: `ratelimit_tracked_keys{limiter="api"}`, want: 2},
+		{sample: `ratelimit_store_calls_total{limiter="api",op="take"}`, want: 3},
+		{sample: `ratelimit_store_duration_seconds{limiter="api",op="take"}`, want: 3},
+		{sample: `ratelimit_store_breaker_open{limiter="api"}`, want: 0},
+	}
+	for _, test := range tests {
+		got, ok := samples[test.sample]
+		if !ok {
+			t.Errorf("no sample %s", test.sample)
+		} else if got != test.want {
+			t.Errorf("%s = %v, want %v", test.sample, got, test.want)
+		}
+	}
+}
+
+func TestCollectorLabels(t *testing.T) {
+	limiter := core.New()
+	collector := NewCollector(limiter, CollectorConfig{
+		NAME: "api",
+		LABELS: []labels.Label{
+			labels.Route(),
+			{NAME: "user", VALUE: func(r *http.Request, d core.Decision) string { return d.Key }, MAX_VALUES: 1},
+		},
+	})
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      10,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-User") },
+		ON_DECISION:     collector.Observe,
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+
+	for _, user := range []string{"alice", "bob", "alice"} {
+		r := httptest.NewRequest(http.MethodGet, "/users/"+user, nil)
+		r.Header.Set("X-User", user)
+		limiter.Decide(core.WithRouteTemplate(r, "/users/:id"))
+	}
+	limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	samples := gather(t, registry)
+
+	tests := []struct {
+		sample string
+		want   float64
+	}{
+		{sample: `ratelimit_decisions_total{limiter="api",result="allowed",route="/users/:id",rule="default",user="alice"}`, want: 2},
+		{sample: `ratelimit_decisions_total{limiter="api",result="allowed",route="/users/:id",rule="default",user="other"}`, want: 1},
+		{sample: `ratelimit_decisions_total{limiter="api",result="allowed",route="other",rule="default",user="other"}`, want: 1},
+	}
+	for _, test := range tests {
+		if got := samples[test.sample]; got != test.want {
+			t.Errorf("%s = %v, want %v", test.sample, got, test.want)
+		}
+	}
+}
+
+func TestCollectorsOfSeveralLimiters(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	for _, name := range []string{"api", "login"} {
+		limiter := core.New()
+		collector := NewCollector(limiter, CollectorConfig{NAME: name})
+		limiter.SetConfig(core.RateLimiterConfig{RATE_LIMIT: 1, REFILL_INTERVAL: time.Hour, ON_DECISION: collector.Observe})
+		if err := registry.Register(collector); err != nil {
+			t.Fatalf("registering the %s limiter: %v", name, err)
+		}
+		limiter.Decide(httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	// The shared bucket is empty until it is first refilled.
+	samples := gather(t, registry)
+	for _, sample := range []string{
+		`ratelimit_decisions_total{limiter="api",result="denied",rule="shared"}`,
+		`ratelimit_decisions_total{limiter="login",result="denied",rule="shared"}`,
+	} {
+		if samples[sample] != 1 {
+			t.Errorf("%s = %v, want 1", sample, samples[sample])
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package statsdlimiter
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/metrics/labels"
+)
+
+type ReporterConfig struct {
+	// Tells limiters reporting to one sink apart, as the "limiter" tag.
+	// Defaults to "default".
+	NAME string
+	// Sorts keys into a few classes, e.g. "ip" or "user" or a customer's
+	// plan, as the "key_class" tag of the decision counter. Nil leaves the
+	// tag out. It must return few distinct values, as every one is a time
+	// series.
+	KEY_CLASS func(key string) string
+	// Further tags of the decision counter, e.g. labels.Route(). Values
+	// past each label's MAX_VALUES are counted as "other".
+	LABELS []labels.Label
+	// How often Run reports the limiter's state. Defaults to ten seconds.
+	INTERVAL time.Duration
+}
+
+// Reporter sends a limiter's decisions and state to a StatsSink. Its
+// Observe is the limiter's ON_DECISION, and Run reports the state:
+//
+//	sink, err := statsdlimiter.NewStatsD(statsdlimiter.StatsDConfig{ADDR: "127.0.0.1:8125"})
+//	reporter := statsdlimiter.NewReporter(limiter, sink, statsdlimiter.ReporterConfig{NAME: "api"})
+//	limiter.SetConfig(core.RateLimiterConfig{
+//		...
+//		ON_DECISION: reporter.Observe,
+//	})
+//	go reporter.Run(ctx)
+//
+// Decisions are counted as ratelimit.decisions by rule and result,
+// "allowed", "denied" or "exempt". Every INTERVAL the ratelimit.tokens,
+// ratelimit.tracked_keys and ratelimit.store.breaker_open gauges are set,
+// and ratelimit.store.degraded, ratelimit.store.calls and
+// ratelimit.store.errors, the last two by op, and
+// ratelimit.store.cache_takes, by result, count what happened since the
+// previous report.
+type Reporter struct {
+	ReporterConfig
+	limiter core.RateLimiter
+	sink    StatsSink
+	labels  *labels.Set
+	// The totals at the previous report, to count what happened since.
+	last core.BucketStatusEvent
+	mx   sync.Mutex
+}
+
+func NewReporter(limiter core.RateLimiter, sink StatsSink, config ReporterConfig) *Reporter {
+	if config.NAME == "" {
+		config.NAME = "default"
+	}
+	if config.INTERVAL == 0 {
+		config.INTERVAL = 10 * time.Second
+	}
+	return &Reporter{
+		ReporterConfig: config,
+		limiter:        limiter,
+		sink:           sink,
+		labels:         labels.NewSet(labels.WithKeyClass(config.KEY_CLASS, config.LABELS)...),
+	}
+}
+
+// Observe counts a decision. It is meant to be the limiter's ON_DECISION.
+func (rp *Reporter) Observe(r *http.Request, d core.Decision, elapsed time.Duration) {
+	result := "denied"
+	switch {
+	case d.Exempt:
+		result = "exempt"
+	case d.Allowed:
+		result = "allowed"
+	}
+	tags := []string{"limiter:" + rp.NAME, "rule:" + d.Rule, "result:" + result}
+	names := rp.labels.Names()
+	for i, value := range rp.labels.Values(r, d) {
+		tags = append(tags, names[i]+":"+value)
+	}
+	rp.sink.Count("ratelimit.decisions", 1, tags)
+}
+
+// Run reports the limiter's state every INTERVAL until ctx is done.
+func (rp *Reporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(rp.INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rp.Report()
+		}
+	}
+}
+
+// Report sends the limiter's state once.
+func (rp *Reporter) Report() {
+	rp.mx.Lock()
+	defer rp.mx.Unlock()
+
+	event := rp.limiter.StatusEvent()
+	tags := []string{"limiter:" + rp.NAME}
+	rp.sink.Gauge("ratelimit.tokens", float64(event.CurrentBucketSize), tags)
+	rp.sink.Gauge("ratelimit.tracked_keys", float64(event.TrackedKeys), tags)
+	breakerOpen := 0.0
+	if event.StoreBreakerOpen {
+		breakerOpen = 1
+	}
+	rp.sink.Gauge("ratelimit.store.breaker_open", breakerOpen, tags)
+	rp.sink.Count("ratelimit.store.degraded", event.DegradedTotal-rp.last.DegradedTotal, tags)
+
+	for _, op := range []struct {
+		name       string
+		stats, was core.StoreOpStats
+	}{
+		{"take", event.Store.Take, rp.last.Store.Take},
+		{"throttle", event.Store.Throttle, rp.last.Store.Throttle},
+		{"reset", event.Store.Reset, rp.last.Store.Reset},
+		{"reset_all", event.Store.ResetAll, rp.last.Store.ResetAll},
+	} {
+		opTags := append(tags[:1:1], "op:"+op.name)
+		rp.sink.Count("ratelimit.store.calls", op.stats.Calls-op.was.Calls, opTags)
+		rp.sink.Count("ratelimit.store.errors", op.stats.Errors-op.was.Errors, opTags)
+	}
+	rp.sink.Count("ratelimit.store.cache_takes", event.Store.CacheHits-rp.last.Store.CacheHits, append(tags[:1:1], "result:hit"))
+	rp.sink.Count("ratelimit.store.cache_takes", event.Store.CacheMisses-rp.last.Store.CacheMisses, append(tags[:1:1], "result:miss"))
+	rp.last = event
+}
@@ -0,0 +1,77 @@
+package statsdlimiter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// recordingSink sums counters and keeps the last value of gauges by name
+// and tags, e.g. "ratelimit.decisions{limiter:api,rule:default,result:allowed}".
+type recordingSink struct {
+	values map[string]float64
+	mx     sync.Mutex
+}
+
+func (s *recordingSink) Count(name string, value int64, tags []string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.values[fmt.Sprintf("%s{%s}", name, strings.Join(tags, ","))] += float64(value)
+}
+
+func (s *recordingSink) Gauge(name string, value float64, tags []string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.values[fmt.Sprintf("%s{%s}", name, strings.Join(tags, ","))] = value
+}
+
+func TestReporter(t *testing.T) {
+	sink := &recordingSink{values: map[string]float64{}}
+	limiter := core.New()
+	reporter := NewReporter(limiter, sink, ReporterConfig{NAME: "api"})
+	limiter.SetConfig(core.RateLimiterConfig{
+		RATE_LIMIT:      1,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return core.StripPort(r.RemoteAddr) },
+		ON_DECISION:     reporter.Observe,
+	})
+
+	decide := func(addrs ...string) {
+		for _, addr := range addrs {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = addr
+			limiter.Decide(r)
+		}
+	}
+	decide("203.0.113.7:1", "203.0.113.7:2", "10.0.0.1:1")
+	reporter.Report()
+	// Counters only carry what happened since the last report.
+	decide("198.51.100.1:1")
+	reporter.Report()
+
+	tests := []struct {
+		metric string
+		want   float64
+	}{
+		{metric: "ratelimit.decisions{limiter:api,rule:default,result:allowed}", want: 3},
+		{metric: "ratelimit.decisions{limiter:api,rule:default,result:denied}", want: 1},
+		{metric: "ratelimit.tracked_keys{limiter:api}", want: 3},
+		{metric: "ratelimit.store.calls{limiter:api,op:take}", want: 4},
+		{metric: "ratelimit.store.errors{limiter:api,op:take}", want: 0},
+		{metric: "ratelimit.store.breaker_open{limiter:api}", want: 0},
+	}
+	for _, test := range tests {
+		got, ok := sink.values[test.metric]
+		if !ok {
+			t.Errorf("no metric %s", test.metric)
+		} else if got != test.want {
+			t.Errorf("%s = %v, want %v", test.metric, got, test.want)
+		}
+	}
+}
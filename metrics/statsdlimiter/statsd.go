@@ -0,0 +1,141 @@
+package statsdlimiter
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsSink receives a Reporter's measurements, so they can go to StatsD,
+// a Datadog client or anything else with counters and gauges. Tags are
+// "name:value" pairs.
+type StatsSink interface {
+	// Count adds value to the counter name.
+	Count(name string, value int64, tags []string)
+	// Gauge sets the gauge name to value.
+	Gauge(name string, value float64, tags []string)
+}
+
+type StatsDConfig struct {
+	// Address of the StatsD server or Datadog agent, e.g. "127.0.0.1:8125".
+	ADDR string
+	// Put in front of every metric name, e.g. "myapp.".
+	PREFIX string
+	// Tags added to every metric, e.g. "env:prod".
+	TAGS []string
+	// How long metrics are buffered before being sent, so a busy limiter
+	// sends a packet every so often rather than one per decision. Defaults
+	// to one second.
+	FLUSH_INTERVAL time.Duration
+	// Largest packet sent. Defaults to 1432 bytes, which fits the MTU of
+	// most networks; raise it for the loopback interface.
+	MAX_PACKET int
+}
+
+// StatsD is a StatsSink sending metrics over UDP in the DogStatsD format,
+// tags included, which the Datadog agent, Telegraf and statsd_exporter
+// read. Plain StatsD servers ignore the tags.
+type StatsD struct {
+	StatsDConfig
+	conn   net.Conn
+	buffer []byte
+	mx     sync.Mutex
+	done   chan struct{}
+	closed sync.WaitGroup
+}
+
+// NewStatsD starts sending the buffered metrics to ADDR every
+// FLUSH_INTERVAL until closed.
+func NewStatsD(config StatsDConfig) (*StatsD, error) {
+	if config.FLUSH_INTERVAL == 0 {
+		config.FLUSH_INTERVAL = time.Second
+	}
+	if config.MAX_PACKET == 0 {
+		config.MAX_PACKET = 1432
+	}
+	conn, err := net.Dial("udp", config.ADDR)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StatsD{StatsDConfig: config, conn: conn, done: make(chan struct{})}
+	s.closed.Add(1)
+	go s.run()
+	return s, nil
+}
+
+func (s *StatsD) Count(name string, value int64, tags []string) {
+	s.write(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (s *StatsD) Gauge(name string, value float64, tags []string) {
+	s.write(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+// Close sends what is buffered and stops.
+func (s *StatsD) Close() error {
+	close(s.done)
+	s.closed.Wait()
+	return s.conn.Close()
+}
+
+// write buffers a metric, sending the buffer first if it would outgrow
+// MAX_PACKET.
+func (s *StatsD) write(name, value, kind string, tags []string) {
+	var line strings.Builder
+	line.WriteString(s.PREFIX)
+	line.WriteString(name)
+	line.WriteByte(':')
+	line.WriteString(value)
+	line.WriteByte('|')
+	line.WriteString(kind)
+	if len(s.TAGS)+len(tags) > 0 {
+		line.WriteString("|#")
+		line.WriteString(strings.Join(append(append([]string(nil), s.TAGS...), tags...), ","))
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if len(s.buffer) > 0 && len(s.buffer)+1+line.Len() > s.MAX_PACKET {
+		s.flush()
+	}
+	if len(s.buffer) > 0 {
+		s.buffer = append(s.buffer, '\n')
+	}
+	s.buffer = append(s.buffer, line.String()...)
+}
+
+// flush sends the buffer. Errors are dropped, as StatsD is best effort.
+// The caller must hold s.mx.
+func (s *StatsD) flush() {
+	if len(s.buffer) == 0 {
+		return
+	}
+	s.conn.Write(s.buffer)
+	s.buffer = s.buffer[:0]
+}
+
+func (s *StatsD) run() {
+	defer s.closed.Done()
+	ticker := time.NewTicker(s.FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			s.mx.Lock()
+			s.flush()
+			s.mx.Unlock()
+			return
+		}
+		s.mx.Lock()
+		s.flush()
+		s.mx.Unlock()
+	}
+}
+
+var _ StatsSink = (*StatsD)(nil)
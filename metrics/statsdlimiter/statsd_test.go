@@ -0,0 +1,66 @@
+package statsdlimiter
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listen returns a UDP server and a function reading the next packet sent
+// to it.
+func listen(t *testing.T) (string, func() string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String(), func() string {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 65536)
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buffer[:n])
+	}
+}
+
+func TestStatsD(t *testing.T) {
+	addr, next := listen(t)
+	s, err := NewStatsD(StatsDConfig{ADDR: addr, PREFIX: "myapp.", TAGS: []string{"env:test"}, FLUSH_INTERVAL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Count("ratelimit.decisions", 1, []string{"rule:default", "result:allowed"})
+	s.Gauge("ratelimit.tokens", 2.5, nil)
+	s.Close()
+
+	want := "myapp.ratelimit.decisions:1|c|#env:test,rule:default,result:allowed\n" +
+		"myapp.ratelimit.tokens:2.5|g|#env:test"
+	if got := next(); got != want {
+		t.Fatalf("sent %q, want %q", got, want)
+	}
+}
+
+func TestStatsDSplitsPackets(t *testing.T) {
+	addr, next := listen(t)
+	s, err := NewStatsD(StatsDConfig{ADDR: addr, FLUSH_INTERVAL: time.Hour, MAX_PACKET: 40})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for i := 0; i < 3; i++ {
+		s.Count("ratelimit.decisions", 1, nil)
+	}
+	// Two lines of 23 bytes don't fit in 40, so each is sent as the next
+	// one is written.
+	for i := 0; i < 2; i++ {
+		if got := next(); got != "ratelimit.decisions:1|c" {
+			t.Fatalf("packet %d = %q, want a single line", i, got)
+		}
+	}
+}
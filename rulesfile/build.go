@@ -0,0 +1,253 @@
+package rulesfile
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// StoreType opens a store of its type with the options given in the file.
+type StoreType func(options map[string]string) (core.StoreFactory, error)
+
+type Options struct {
+	// Store types the file may use besides "memory", by name, e.g.
+	//
+	//	"redis": func(options map[string]string) (core.StoreFactory, error) {
+	//		client := redis.NewClient(&redis.Options{Addr: options["addr"]})
+	//		return redisstore.Factory(redisstore.StoreConfig{CLIENT: client}), nil
+	//	},
+	STORE_TYPES map[string]StoreType
+	// Settings every limiter starts from, e.g. TRUSTED_PROXIES or LOGGER.
+	// The file's limits, keys and stores replace those of BASE.
+	BASE core.RateLimiterConfig
+}
+
+// Set is a built rules file: a limiter per limit and the rules routing
+// requests to them.
+type Set struct {
+	file     *File
+	rules    []builtRule
+	limiters map[string]core.RateLimiter
+	stores   map[string]core.StoreFactory
+}
+
+type builtRule struct {
+	Rule
+	handler *stdhttp.NegroniHandler
+}
+
+// Build creates the limiters of the file, one per entry of Limiters and
+// one per rule with a limit of its own, named by the entry or rule.
+func (f *File) Build(options Options) (*Set, error) {
+	return f.build(options, nil)
+}
+
+// build is Build taking over the stores and limiters of previous whose
+// definition is unchanged, so their buckets carry over.
+func (f *File) build(options Options, previous *Set) (*Set, error) {
+	stores := map[string]core.StoreFactory{}
+	for name, store := range f.Stores {
+		if previous.sameStore(name, store) {
+			stores[name] = previous.stores[name]
+			continue
+		}
+		if store.Type == "memory" {
+			stores[name] = nil
+			continue
+		}
+		open, ok := options.STORE_TYPES[store.Type]
+		if !ok {
+			return nil, fmt.Errorf("stores.%s: unknown type %q", name, store.Type)
+		}
+		factory, err := open(store.Options)
+		if err != nil {
+			return nil, fmt.Errorf("stores.%s: %w", name, err)
+		}
+		stores[name] = factory
+	}
+
+	set := &Set{file: f, limiters: map[string]core.RateLimiter{}, stores: stores}
+	for name, limit := range f.Limiters {
+		limiter, err := set.limiter(name, limit, options.BASE, previous)
+		if err != nil {
+			return nil, fmt.Errorf("limiters.%s: %w", name, err)
+		}
+		set.limiters[name] = limiter
+	}
+	for i, rule := range f.Rules {
+		name, limit := rule.Limiter, rule.Limit
+		if name != "" {
+			limit = f.Limiters[name]
+		} else {
+			limiter, err := set.limiter(rule.Name, limit, options.BASE, previous)
+			if err != nil {
+				return nil, fmt.Errorf("rules[%d] (%s): %w", i, rule.Name, err)
+			}
+			name = rule.Name
+			set.limiters[name] = limiter
+		}
+
+		var config stdhttp.MiddlewareConfig
+		if limit.Response != "" {
+			config.REJECT_HANDLER = f.Responses[limit.Response]
+		}
+		set.rules = append(set.rules, builtRule{Rule: rule, handler: stdhttp.NewNegroniHandler(set.limiters[name], config)})
+	}
+	return set, nil
+}
+
+// limiter returns previous's limiter of the name if it has the same limit
+// and store, or a new one.
+func (s *Set) limiter(name string, limit Limit, base core.RateLimiterConfig, previous *Set) (core.RateLimiter, error) {
+	if previous != nil && previous.limits()[name] == limit && previous.limiters[name] != nil &&
+		(limit.Store == "" || previous.sameStore(limit.Store, s.file.Stores[limit.Store])) {
+		return previous.limiters[name], nil
+	}
+	return newLimiter(limit, s.stores, base)
+}
+
+// limits returns the limit of each of the set's limiters by name.
+func (s *Set) limits() map[string]Limit {
+	limits := map[string]Limit{}
+	for name, limit := range s.file.Limiters {
+		limits[name] = limit
+	}
+	for _, rule := range s.file.Rules {
+		if rule.Limiter == "" {
+			limits[rule.Name] = rule.Limit
+		}
+	}
+	return limits
+}
+
+// sameStore reports whether the set has a store of the name defined as
+// store.
+func (s *Set) sameStore(name string, store Store) bool {
+	if s == nil {
+		return false
+	}
+	existing, ok := s.file.Stores[name]
+	return ok && reflect.DeepEqual(existing, store)
+}
+
+func newLimiter(limit Limit, stores map[string]core.StoreFactory, base core.RateLimiterConfig) (core.RateLimiter, error) {
+	count, period, err := parseRate(limit.Rate)
+	if err != nil {
+		return nil, err
+	}
+	config := base
+	config.RATE_LIMIT = count
+	if limit.Burst > 0 {
+		config.RATE_LIMIT = limit.Burst
+	}
+	config.REFILL_INTERVAL = period / time.Duration(count)
+	config.KEY_BY_PATH = limit.KeyByPath
+	config.STORE = stores[limit.Store]
+
+	limiter := core.New()
+	ip := func(r *http.Request) string { return "ip:" + limiter.ClientIP(r) }
+	switch {
+	case limit.Key == "" || limit.Key == "ip":
+		config.KEY_FUNC = ip
+	case limit.Key == "global":
+		config.KEY_FUNC = func(r *http.Request) string { return "global" }
+	case strings.HasPrefix(limit.Key, "header:"):
+		name := strings.TrimPrefix(limit.Key, "header:")
+		config.KEY_FUNC = func(r *http.Request) string {
+			if value := r.Header.Get(name); value != "" {
+				return name + ":" + value
+			}
+			return ip(r)
+		}
+	case strings.HasPrefix(limit.Key, "query:"):
+		name := strings.TrimPrefix(limit.Key, "query:")
+		config.KEY_FUNC = func(r *http.Request) string {
+			if value := r.URL.Query().Get(name); value != "" {
+				return name + "=" + value
+			}
+			return ip(r)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	limiter.SetConfig(config)
+	return limiter, nil
+}
+
+// ServeHTTP writes the response to a rejected request.
+func (response Response) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	if response.ContentType != "" {
+		w.Header().Set("Content-Type", response.ContentType)
+	}
+	status := response.Status
+	if status == 0 {
+		status = http.StatusTooManyRequests
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(response.Body))
+}
+
+// Run refills the limiters' buckets.
+func (s *Set) Run() {
+	s.RunContext(context.Background())
+}
+
+// RunContext is Run stopping once ctx is done, for sets that are replaced
+// when the file changes.
+func (s *Set) RunContext(ctx context.Context) {
+	for _, limiter := range s.limiters {
+		limiter.RunContext(ctx)
+	}
+}
+
+// Limiters returns the limiters by name, e.g. for stdhttp.AdminConfig.
+func (s *Set) Limiters() map[string]core.RateLimiter {
+	limiters := make(map[string]core.RateLimiter, len(s.limiters))
+	for name, limiter := range s.limiters {
+		limiters[name] = limiter
+	}
+	return limiters
+}
+
+// Middleware limits the requests reaching next by the first rule they
+// match.
+func (s *Set) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		s.serve(w, request, next)
+	})
+}
+
+func (s *Set) serve(w http.ResponseWriter, request *http.Request, next http.Handler) {
+	for _, rule := range s.rules {
+		if rule.matches(request) {
+			rule.handler.ServeHTTP(w, request, next.ServeHTTP)
+			return
+		}
+	}
+	next.ServeHTTP(w, request)
+}
+
+func (rule builtRule) matches(request *http.Request) bool {
+	if !strings.HasPrefix(request.URL.Path, rule.Path) {
+		return false
+	}
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	for _, method := range rule.Methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package rulesfile
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+const testFile = `
+stores:
+  local: {type: memory}
+responses:
+  slow-down:
+    content_type: text/plain
+    body: slow down
+    headers: {X-Reason: quota}
+limiters:
+  per-key: {rate: 1/h, burst: 2, key: "header:X-API-Key", store: local}
+rules:
+  - {name: login, path: /login, methods: [POST], rate: 1/h, response: slow-down}
+  - {path: /api/, limiter: per-key}
+  - {path: /v2/api/, limiter: per-key}
+`
+
+func TestSetMiddleware(t *testing.T) {
+	file, err := Parse([]byte(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := file.Build(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := set.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		apiKey   string
+		want     int
+		wantBody string
+	}{
+		{name: "login", method: http.MethodPost, path: "/login", want: http.StatusOK},
+		{name: "login again", method: http.MethodPost, path: "/login", want: http.StatusTooManyRequests, wantBody: "slow down"},
+		{name: "other method", method: http.MethodGet, path: "/login", want: http.StatusOK},
+		{name: "no rule", method: http.MethodPost, path: "/signup", want: http.StatusOK},
+		{name: "api", method: http.MethodGet, path: "/api/orders", apiKey: "a", want: http.StatusOK},
+		{name: "shared limiter", method: http.MethodGet, path: "/v2/api/orders", apiKey: "a", want: http.StatusOK},
+		{name: "burst spent", method: http.MethodGet, path: "/api/orders", apiKey: "a", want: http.StatusTooManyRequests, wantBody: "Too many requests"},
+		{name: "own key", method: http.MethodGet, path: "/api/orders", apiKey: "b", want: http.StatusOK},
+	}
+	for _, step := range steps {
+		r := httptest.NewRequest(step.method, step.path, nil)
+		r.Header.Set("X-API-Key", step.apiKey)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != step.want || !strings.Contains(w.Body.String(), step.wantBody) {
+			t.Fatalf("%s: status %d, body %q", step.name, w.Code, w.Body)
+		}
+		if step.wantBody == "slow down" && (w.Header().Get("X-Reason") != "quota" || w.Header().Get("Content-Type") != "text/plain") {
+			t.Fatalf("%s: headers %v", step.name, w.Header())
+		}
+	}
+
+	limiters := set.Limiters()
+	if len(limiters) != 2 || limiters["login"] == nil || limiters["per-key"] == nil {
+		t.Fatalf("limiters %v", limiters)
+	}
+}
+
+func TestBuildStores(t *testing.T) {
+	tests := []struct {
+		name    string
+		types   map[string]StoreType
+		wantErr string
+	}{
+		{
+			name: "registered type",
+			types: map[string]StoreType{"redis": func(options map[string]string) (core.StoreFactory, error) {
+				if options["addr"] != "redis:6379" {
+					t.Errorf("options %v", options)
+				}
+				return func(name string, profile core.LimitProfile) core.Store { return core.NewMemoryStore(profile) }, nil
+			}},
+		},
+		{name: "unknown type", wantErr: `stores.shared: unknown type "redis"`},
+		{
+			name: "failing type",
+			types: map[string]StoreType{"redis": func(options map[string]string) (core.StoreFactory, error) {
+				return nil, errors.New("connection refused")
+			}},
+			wantErr: "stores.shared: connection refused",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := Parse([]byte(`
+stores:
+  shared: {type: redis, options: {addr: "redis:6379"}}
+rules:
+  - {path: /, rate: 10/s, store: shared}
+`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = file.Build(Options{STORE_TYPES: test.types})
+			if (err == nil) != (test.wantErr == "") || (err != nil && err.Error() != test.wantErr) {
+				t.Fatalf("error %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
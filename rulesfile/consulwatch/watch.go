@@ -0,0 +1,133 @@
+// Package consulwatch keeps a rulesfile.Live up to date with a rules file
+// stored in a Consul KV key, so a fleet of replicas picks up limit changes
+// as soon as the key is written:
+//
+//	live := rulesfile.NewLive(rulesfile.LiveConfig{})
+//	go consulwatch.Watch(ctx, live, consulwatch.WatchConfig{KEY: "ratelimit/rules.yaml"})
+//	http.ListenAndServe(":8080", live.Middleware(mux))
+//
+// Upload a new version with consul kv put ratelimit/rules.yaml @rules.yaml.
+// The key is watched with Consul's blocking queries over its HTTP API, so
+// the package doesn't depend on the Consul client.
+package consulwatch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/rulesfile"
+)
+
+type WatchConfig struct {
+	// Address of the Consul agent. Defaults to http://127.0.0.1:8500.
+	ADDRESS string
+	// Key the rules file is stored under.
+	KEY string
+	// ACL token, sent as X-Consul-Token, if set.
+	TOKEN string
+	// How long a blocking query waits for a change before it is made
+	// again. Defaults to five minutes.
+	WAIT time.Duration
+	// How long to wait before querying again after Consul fails. Defaults
+	// to one second.
+	RETRY time.Duration
+	// Defaults to a client whose timeout outlasts WAIT.
+	CLIENT *http.Client
+	// Called when Consul fails. Versions live refuses are reported to its
+	// ON_ERROR instead.
+	ON_ERROR func(err error)
+}
+
+// Watch applies the key's value to live, then every new value written to
+// it, until ctx is done. Deleting the key keeps the current version.
+func Watch(ctx context.Context, live *rulesfile.Live, config WatchConfig) {
+	if config.ADDRESS == "" {
+		config.ADDRESS = "http://127.0.0.1:8500"
+	}
+	if config.WAIT <= 0 {
+		config.WAIT = 5 * time.Minute
+	}
+	if config.RETRY <= 0 {
+		config.RETRY = time.Second
+	}
+	if config.CLIENT == nil {
+		// Consul adds up to a sixteenth of the wait to spread queries.
+		config.CLIENT = &http.Client{Timeout: config.WAIT + config.WAIT/16 + 10*time.Second}
+	}
+
+	var index uint64
+	for {
+		value, next, err := query(ctx, config, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if config.ON_ERROR != nil {
+				config.ON_ERROR(err)
+			}
+			select {
+			case <-time.After(config.RETRY):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		// An unchanged index means the query timed out.
+		if value != nil && next != index {
+			live.Update(value)
+		}
+		index = next
+	}
+}
+
+// query reads the key, blocking until its index passes index or WAIT is
+// up. value is nil if the key doesn't exist.
+func query(ctx context.Context, config WatchConfig, index uint64) (value []byte, next uint64, err error) {
+	query := url.Values{"wait": {strconv.Itoa(int(config.WAIT.Seconds())) + "s"}}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+	}
+	address := strings.TrimSuffix(config.ADDRESS, "/") + "/v1/kv/" + strings.TrimPrefix(config.KEY, "/") + "?raw&" + query.Encode()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if config.TOKEN != "" {
+		request.Header.Set("X-Consul-Token", config.TOKEN)
+	}
+
+	response, err := config.CLIENT.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return nil, 0, fmt.Errorf("consul: %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	next, err = strconv.ParseUint(response.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("consul: bad X-Consul-Index: %w", err)
+	}
+	// The index going backwards means Consul's state was reset, and
+	// queries start over.
+	if next < index {
+		next = 0
+	}
+	if response.StatusCode == http.StatusNotFound {
+		return nil, next, nil
+	}
+	value, err = io.ReadAll(response.Body)
+	if value == nil {
+		value = []byte{}
+	}
+	return value, next, err
+}
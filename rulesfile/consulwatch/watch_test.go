@@ -0,0 +1,134 @@
+package consulwatch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/rulesfile"
+)
+
+// fakeKV serves a single key the way Consul's KV endpoint does, blocking
+// queries included.
+type fakeKV struct {
+	index  uint64
+	value  string
+	exists bool
+	// Status of every response instead of the key, if set.
+	status int
+	tokens []string
+	mx     sync.Mutex
+}
+
+func (kv *fakeKV) put(value string) {
+	kv.mx.Lock()
+	defer kv.mx.Unlock()
+	kv.index++
+	kv.value, kv.exists = value, true
+}
+
+func (kv *fakeKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/kv/ratelimit/rules.yaml" || !r.URL.Query().Has("raw") {
+		http.NotFound(w, r)
+		return
+	}
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	wait, _ := time.ParseDuration(r.URL.Query().Get("wait"))
+	deadline := time.Now().Add(wait)
+
+	kv.mx.Lock()
+	defer kv.mx.Unlock()
+	kv.tokens = append(kv.tokens, r.Header.Get("X-Consul-Token"))
+	for index > 0 && kv.index == index && time.Now().Before(deadline) {
+		kv.mx.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		kv.mx.Lock()
+	}
+
+	if kv.status != 0 {
+		w.WriteHeader(kv.status)
+		return
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(max(kv.index, 1), 10))
+	if !kv.exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Write([]byte(kv.value))
+}
+
+func TestWatch(t *testing.T) {
+	kv := &fakeKV{}
+	server := httptest.NewServer(kv)
+	defer server.Close()
+
+	var mx sync.Mutex
+	var versions, refused, failures int
+	live := rulesfile.NewLive(rulesfile.LiveConfig{
+		ON_UPDATE: func(file *rulesfile.File) { mx.Lock(); versions++; mx.Unlock() },
+		ON_ERROR:  func(err error) { mx.Lock(); refused++; mx.Unlock() },
+	})
+	defer live.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go Watch(ctx, live, WatchConfig{
+		ADDRESS:  server.URL,
+		KEY:      "/ratelimit/rules.yaml",
+		TOKEN:    "s3cret",
+		WAIT:     time.Second,
+		RETRY:    10 * time.Millisecond,
+		ON_ERROR: func(err error) { mx.Lock(); failures++; mx.Unlock() },
+	})
+
+	steps := []struct {
+		name string
+		// Written to the key unless empty.
+		put string
+		// Status Consul answers with from then on.
+		status       int
+		wantVersions int
+		wantRefused  int
+		wantFailing  bool
+		wantLimiters int
+	}{
+		{name: "no key yet"},
+		{name: "first version", put: `rules: [{name: api, path: /api/, rate: 10/s}]`, wantVersions: 1, wantLimiters: 1},
+		{name: "refused version", put: `rules: [{name: api, rate: 10}]`, wantVersions: 1, wantRefused: 1, wantLimiters: 1},
+		{name: "second version", put: `rules: [{name: api, path: /api/, rate: 10/s}, {name: login, path: /login, rate: 1/m}]`, wantVersions: 2, wantRefused: 1, wantLimiters: 2},
+		{name: "consul down", status: http.StatusInternalServerError, wantVersions: 2, wantRefused: 1, wantFailing: true, wantLimiters: 2},
+	}
+	for _, step := range steps {
+		kv.mx.Lock()
+		kv.status = step.status
+		kv.mx.Unlock()
+		if step.put != "" {
+			kv.put(step.put)
+		}
+
+		var got [3]int
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			mx.Lock()
+			got = [3]int{versions, refused, failures}
+			mx.Unlock()
+			done := got[0] == step.wantVersions && got[1] == step.wantRefused && (got[2] > 0) == step.wantFailing
+			if done || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if got[0] != step.wantVersions || got[1] != step.wantRefused || (got[2] > 0) != step.wantFailing || len(live.Limiters()) != step.wantLimiters {
+			t.Fatalf("%s: %d versions, %d refused, %d failures, %d limiters", step.name, got[0], got[1], got[2], len(live.Limiters()))
+		}
+	}
+
+	kv.mx.Lock()
+	defer kv.mx.Unlock()
+	if kv.tokens[0] != "s3cret" {
+		t.Fatalf("token %q", kv.tokens[0])
+	}
+}
@@ -0,0 +1,88 @@
+// Package etcdwatch keeps a rulesfile.Live up to date with a rules file
+// stored in an etcd key, so a fleet of replicas picks up limit changes
+// as soon as the key is written:
+//
+//	live := rulesfile.NewLive(rulesfile.LiveConfig{})
+//	go etcdwatch.Watch(ctx, live, etcdwatch.WatchConfig{CLIENT: client, KEY: "/ratelimit/rules.yaml"})
+//	http.ListenAndServe(":8080", live.Middleware(mux))
+//
+// Upload a new version with etcdctl put /ratelimit/rules.yaml < rules.yaml.
+package etcdwatch
+
+import (
+	"context"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/rulesfile"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+type WatchConfig struct {
+	CLIENT *clientv3.Client
+	// Key the rules file is stored under.
+	KEY string
+	// How long to wait before reading the key again after etcd fails.
+	// Defaults to one second.
+	RETRY time.Duration
+	// Called when etcd fails. Versions live refuses are reported to its
+	// ON_ERROR instead.
+	ON_ERROR func(err error)
+}
+
+// Watch applies the key's value to live, then every new value written to
+// it, until ctx is done. Deleting the key keeps the current version. When
+// etcd fails, the key is read again once it is back, so no write is
+// missed.
+func Watch(ctx context.Context, live *rulesfile.Live, config WatchConfig) {
+	if config.RETRY <= 0 {
+		config.RETRY = time.Second
+	}
+	var applied int64
+	update := func(value []byte, revision int64) {
+		if revision != applied {
+			applied = revision
+			live.Update(value)
+		}
+	}
+
+	for {
+		response, err := config.CLIENT.Get(ctx, config.KEY)
+		if err == nil {
+			if len(response.Kvs) > 0 {
+				update(response.Kvs[0].Value, response.Kvs[0].ModRevision)
+			}
+			err = watch(ctx, config, response.Header.Revision+1, update)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && config.ON_ERROR != nil {
+			config.ON_ERROR(err)
+		}
+
+		select {
+		case <-time.After(config.RETRY):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// watch passes the values written to the key from revision on to update,
+// until the watch fails or ctx is done.
+func watch(ctx context.Context, config WatchConfig, revision int64, update func(value []byte, revision int64)) error {
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	defer cancel()
+
+	for response := range config.CLIENT.Watch(ctx, config.KEY, clientv3.WithRev(revision)) {
+		if err := response.Err(); err != nil {
+			return err
+		}
+		for _, event := range response.Events {
+			if event.Type == clientv3.EventTypePut {
+				update(event.Kv.Value, event.Kv.ModRevision)
+			}
+		}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,78 @@
+package etcdwatch
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/rulesfile"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// TestWatch runs against the etcd cluster at ETCD_ENDPOINTS, a comma
+// separated list, and is skipped without one.
+func TestWatch(t *testing.T) {
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_ENDPOINTS not set")
+	}
+	client, err := clientv3.New(clientv3.Config{Endpoints: strings.Split(endpoints, ","), DialTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	key := "/ratelimit-test/" + t.Name()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defer client.Delete(context.Background(), key)
+	if _, err := client.Put(ctx, key, `rules: [{name: api, path: /api/, rate: 10/s}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	var mx sync.Mutex
+	var versions, refused int
+	live := rulesfile.NewLive(rulesfile.LiveConfig{
+		ON_UPDATE: func(file *rulesfile.File) { mx.Lock(); versions++; mx.Unlock() },
+		ON_ERROR:  func(err error) { mx.Lock(); refused++; mx.Unlock() },
+	})
+	defer live.Close()
+	go Watch(ctx, live, WatchConfig{CLIENT: client, KEY: key})
+
+	steps := []struct {
+		name string
+		// Written to the key unless empty.
+		put          string
+		wantVersions int
+		wantRefused  int
+		wantLimiters int
+	}{
+		{name: "existing version", wantVersions: 1, wantLimiters: 1},
+		{name: "refused version", put: `rules: [{name: api, rate: 10}]`, wantVersions: 1, wantRefused: 1, wantLimiters: 1},
+		{name: "new version", put: `rules: [{name: api, path: /api/, rate: 10/s}, {name: login, path: /login, rate: 1/m}]`, wantVersions: 2, wantRefused: 1, wantLimiters: 2},
+	}
+	for _, step := range steps {
+		if step.put != "" {
+			if _, err := client.Put(ctx, key, step.put); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var gotVersions, gotRefused int
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mx.Lock()
+			gotVersions, gotRefused = versions, refused
+			mx.Unlock()
+			if gotVersions == step.wantVersions && gotRefused == step.wantRefused || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if gotVersions != step.wantVersions || gotRefused != step.wantRefused || len(live.Limiters()) != step.wantLimiters {
+			t.Fatalf("%s: %d versions, %d refused, %d limiters", step.name, gotVersions, gotRefused, len(live.Limiters()))
+		}
+	}
+}
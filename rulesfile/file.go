@@ -0,0 +1,267 @@
+// Package rulesfile loads a whole rate limiting policy, its limiters,
+// rules, stores and responses, from a YAML or JSON file, so it can live in
+// version control instead of Go code:
+//
+//	stores:
+//	  shared: {type: redis, options: {addr: "redis:6379"}}
+//	responses:
+//	  slow-down: {status: 429, content_type: text/plain, body: "slow down"}
+//	limiters:
+//	  per-ip: {rate: 10/s, burst: 20, store: shared}
+//	rules:
+//	  - {name: login, path: /login, methods: [POST], rate: 5/m, response: slow-down}
+//	  - {path: /api/, limiter: per-ip}
+//
+// Load reads and validates a file and Build turns it into middleware:
+//
+//	file, err := rulesfile.Load("ratelimit.yaml")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	set, err := file.Build(rulesfile.Options{})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	set.Run()
+//	http.ListenAndServe(":8080", set.Middleware(mux))
+//
+// For rules that change at runtime, Live serves the latest version pushed
+// to it, e.g. by etcdwatch or consulwatch.
+package rulesfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is a rules file.
+type File struct {
+	// Stores buckets are kept in, by name. Limits without one keep their
+	// buckets in memory.
+	Stores map[string]Store `yaml:"stores" json:"stores"`
+	// Responses to rejected requests, by name. Limits without one answer
+	// with the JSON 429 of stdhttp.
+	Responses map[string]Response `yaml:"responses" json:"responses"`
+	// Limits shared by several rules, by name; rules naming the same
+	// limiter draw on the same buckets.
+	Limiters map[string]Limit `yaml:"limiters" json:"limiters"`
+	// Matched in order, the first match applying. Requests matching none
+	// aren't limited.
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// Limit is a token bucket and how requests are keyed to theirs.
+type Limit struct {
+	// Tokens gained per second, minute, hour or other duration, e.g.
+	// "100/s", "5/m" or "20/10s".
+	Rate string `yaml:"rate" json:"rate"`
+	// Most tokens a bucket holds, i.e. how many requests get through at
+	// once after a quiet spell. Defaults to the count of Rate.
+	Burst int64 `yaml:"burst" json:"burst"`
+	// "ip" (the default), "global" for one bucket shared by every client,
+	// "header:<name>" or "query:<name>". Requests without the header or
+	// query parameter are keyed by IP.
+	Key string `yaml:"key" json:"key"`
+	// Gives every path its own bucket.
+	KeyByPath bool `yaml:"key_by_path" json:"key_by_path"`
+	// Name of one of the file's Stores.
+	Store string `yaml:"store" json:"store"`
+	// Name of one of the file's Responses.
+	Response string `yaml:"response" json:"response"`
+}
+
+// Rule routes requests to a limit.
+type Rule struct {
+	// Names the limiter of a rule with a limit of its own in status and
+	// metrics. Defaults to Path.
+	Name string `yaml:"name" json:"name"`
+	// Path prefix matched; empty matches every path.
+	Path string `yaml:"path" json:"path"`
+	// Methods matched; empty matches every method.
+	Methods []string `yaml:"methods" json:"methods"`
+	// Name of one of the file's Limiters, instead of a limit of the rule's
+	// own.
+	Limiter string `yaml:"limiter" json:"limiter"`
+	Limit   `yaml:",inline"`
+}
+
+// Store is a store buckets are kept in.
+type Store struct {
+	// "memory", or a type registered in Options.STORE_TYPES, e.g. "redis".
+	Type string `yaml:"type" json:"type"`
+	// Passed to the store type, e.g. an address.
+	Options map[string]string `yaml:"options" json:"options"`
+}
+
+// Response is the response to a rejected request. Rate limit headers are
+// set as usual.
+type Response struct {
+	// Defaults to 429 Too Many Requests.
+	Status      int               `yaml:"status" json:"status"`
+	ContentType string            `yaml:"content_type" json:"content_type"`
+	Body        string            `yaml:"body" json:"body"`
+	Headers     map[string]string `yaml:"headers" json:"headers"`
+}
+
+// Load reads and validates the rules file at path.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+// Parse parses and validates a rules file, YAML or JSON. Unknown fields
+// are refused, so typos don't silently leave a limit out.
+func Parse(data []byte) (*File, error) {
+	file := &File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	for i, rule := range file.Rules {
+		if rule.Name == "" && rule.Limiter == "" {
+			file.Rules[i].Name = rule.Path
+		}
+	}
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Validate reports every mistake in the file at once: malformed limits,
+// references to stores, responses or limiters it doesn't define, and
+// rules with no limit or two.
+func (f *File) Validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for name, store := range f.Stores {
+		if store.Type == "" {
+			fail("stores.%s: type is required", name)
+		}
+	}
+	for name, response := range f.Responses {
+		if response.Status != 0 && (response.Status < 400 || response.Status > 599) {
+			fail("responses.%s: status %d is not an error status", name, response.Status)
+		}
+	}
+	names := map[string]bool{}
+	for name, limit := range f.Limiters {
+		names[name] = true
+		for _, err := range f.validateLimit(limit) {
+			fail("limiters.%s: %w", name, err)
+		}
+	}
+
+	for i, rule := range f.Rules {
+		where := fmt.Sprintf("rules[%d]", i)
+		if rule.Name != "" {
+			where += " (" + rule.Name + ")"
+		}
+		for _, method := range rule.Methods {
+			if method == "" || strings.ToUpper(method) != method {
+				fail("%s: method %q is not an upper case HTTP method", where, method)
+			}
+		}
+
+		if rule.Limiter != "" {
+			if rule.Limit != (Limit{}) {
+				fail("%s: has both a limiter and a limit of its own", where)
+			}
+			if _, ok := f.Limiters[rule.Limiter]; !ok {
+				fail("%s: unknown limiter %q", where, rule.Limiter)
+			}
+			continue
+		}
+		if rule.Name == "" {
+			fail("%s: needs a name or path", where)
+		} else if names[rule.Name] {
+			fail("%s: name is already taken", where)
+		}
+		names[rule.Name] = true
+		for _, err := range f.validateLimit(rule.Limit) {
+			fail("%s: %w", where, err)
+		}
+	}
+	// Maps are walked in random order.
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errors.Join(errs...)
+}
+
+func (f *File) validateLimit(limit Limit) []error {
+	var errs []error
+	if _, _, err := parseRate(limit.Rate); err != nil {
+		errs = append(errs, err)
+	}
+	if limit.Burst < 0 {
+		errs = append(errs, fmt.Errorf("negative burst %d", limit.Burst))
+	}
+	if !validKey(limit.Key) {
+		errs = append(errs, fmt.Errorf("unknown key %q", limit.Key))
+	}
+	if _, ok := f.Stores[limit.Store]; limit.Store != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown store %q", limit.Store))
+	}
+	if _, ok := f.Responses[limit.Response]; limit.Response != "" && !ok {
+		errs = append(errs, fmt.Errorf("unknown response %q", limit.Response))
+	}
+	return errs
+}
+
+// parseRate parses a rate such as "100/s" into the tokens gained per
+// period.
+func parseRate(rate string) (int64, time.Duration, error) {
+	if rate == "" {
+		return 0, 0, errors.New("rate is required")
+	}
+	count, unit, ok := strings.Cut(rate, "/")
+	n, err := strconv.ParseInt(count, 10, 64)
+	if !ok || err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("rate %q is not a positive count per period, e.g. 100/s", rate)
+	}
+	period, err := time.ParseDuration(unit)
+	if err != nil {
+		period, err = time.ParseDuration("1" + unit)
+	}
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("rate %q has no valid period, e.g. s, m, h or 10s", rate)
+	}
+	if period/time.Duration(n) <= 0 {
+		return 0, 0, fmt.Errorf("rate %q is finer than a token per nanosecond", rate)
+	}
+	return n, period, nil
+}
+
+func validKey(key string) bool {
+	switch {
+	case key == "" || key == "ip" || key == "global":
+		return true
+	case strings.HasPrefix(key, "header:"):
+		return http.CanonicalHeaderKey(strings.TrimPrefix(key, "header:")) != ""
+	case strings.HasPrefix(key, "query:"):
+		return strings.TrimPrefix(key, "query:") != ""
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package rulesfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// Every error expected, empty for a valid file.
+		wantErrs []string
+	}{
+		{
+			name: "yaml",
+			data: `
+responses:
+  slow-down: {status: 429, body: slow down}
+limiters:
+  per-ip: {rate: 10/s, burst: 20}
+rules:
+  - {path: /login, methods: [POST], rate: 5/m, response: slow-down}
+  - {path: /api/, limiter: per-ip}
+`,
+		},
+		{
+			name: "json",
+			data: `{"rules": [{"name": "api", "path": "/api/", "rate": "100/10s", "key": "header:X-API-Key"}]}`,
+		},
+		{name: "empty", data: ""},
+		{
+			name:     "unknown field",
+			data:     `rules: [{path: /api/, rate: 10/s, brust: 20}]`,
+			wantErrs: []string{"field brust not found"},
+		},
+		{
+			name: "every mistake at once",
+			data: `
+stores:
+  shared: {options: {addr: "redis:6379"}}
+responses:
+  teapot: {status: 418}
+  ok: {status: 200}
+limiters:
+  per-ip: {rate: 10/s, store: missing}
+rules:
+  - {path: /a/, rate: 10}
+  - {path: /b/, rate: 0/s}
+  - {path: /c/, rate: 10/fortnight, key: cookie}
+  - {path: /d/, limiter: per-ip, rate: 1/s}
+  - {path: /e/, limiter: nope}
+  - {name: per-ip, path: /f/, rate: 1/s, methods: [get]}
+  - {rate: 1/s}
+  - {path: /g/, rate: 1/s, burst: -1, response: missing}
+`,
+			wantErrs: []string{
+				`limiters.per-ip: unknown store "missing"`,
+				"responses.ok: status 200 is not an error status",
+				`rules[0] (/a/): rate "10" is not a positive count per period`,
+				`rules[1] (/b/): rate "0/s" is not a positive count per period`,
+				`rules[2] (/c/): rate "10/fortnight" has no valid period`,
+				`rules[2] (/c/): unknown key "cookie"`,
+				"rules[3]: has both a limiter and a limit of its own",
+				`rules[4]: unknown limiter "nope"`,
+				`rules[5] (per-ip): method "get" is not an upper case HTTP method`,
+				"rules[5] (per-ip): name is already taken",
+				"rules[6]: needs a name or path",
+				"rules[7] (/g/): negative burst -1",
+				`rules[7] (/g/): unknown response "missing"`,
+				"stores.shared: type is required",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse([]byte(test.data))
+			if len(test.wantErrs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("invalid file parsed")
+			}
+			for _, want := range test.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q doesn't mention %q", err, want)
+				}
+			}
+			// Validation errors are one a line.
+			if lines := strings.Count(err.Error(), "\n") + 1; len(test.wantErrs) > 1 && lines != len(test.wantErrs) {
+				t.Errorf("%d errors, want %d:\n%v", lines, len(test.wantErrs), err)
+			}
+		})
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate       string
+		wantCount  int64
+		wantPeriod time.Duration
+	}{
+		{rate: "100/s", wantCount: 100, wantPeriod: time.Second},
+		{rate: "5/m", wantCount: 5, wantPeriod: time.Minute},
+		{rate: "1000/h", wantCount: 1000, wantPeriod: time.Hour},
+		{rate: "20/10s", wantCount: 20, wantPeriod: 10 * time.Second},
+		{rate: "2000000000/s"},
+		{rate: "/s"},
+		{rate: "10/-1s"},
+	}
+	for _, test := range tests {
+		t.Run(test.rate, func(t *testing.T) {
+			count, period, err := parseRate(test.rate)
+			if (err != nil) != (test.wantCount == 0) || count != test.wantCount || period != test.wantPeriod {
+				t.Fatalf("%d per %v, %v", count, period, err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.yaml")
+	if err := os.WriteFile(path, []byte("rules: [{path: /api/, rate: x}]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Fatalf("error %v doesn't name the file", err)
+	}
+}
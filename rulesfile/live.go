@@ -0,0 +1,128 @@
+package rulesfile
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+type LiveConfig struct {
+	// Used to build every version.
+	OPTIONS Options
+	// Called with every version applied.
+	ON_UPDATE func(file *File)
+	// Called when a version can't be parsed, validated or built. The
+	// previous version keeps serving.
+	ON_ERROR func(err error)
+}
+
+// Live serves requests through the latest version of a rules file, as
+// pushed by a watcher such as etcdwatch or consulwatch, so limits change
+// across replicas without a redeploy. Versions are applied atomically:
+// requests in flight finish under the version they started with, and
+// limiters whose limit and store didn't change keep their buckets. Until
+// the first version arrives requests aren't limited.
+type Live struct {
+	LiveConfig
+	current *Set
+	// Stops each running limiter.
+	stops map[core.RateLimiter]context.CancelFunc
+	mx    sync.RWMutex
+	// Held by Update, so versions are applied one at a time.
+	updating sync.Mutex
+}
+
+func NewLive(config LiveConfig) *Live {
+	return &Live{LiveConfig: config, stops: map[core.RateLimiter]context.CancelFunc{}}
+}
+
+// Update parses, validates and builds a version of the rules file, then
+// swaps it in. A version that fails is reported to ON_ERROR and returned,
+// leaving the current one in place.
+func (l *Live) Update(data []byte) error {
+	l.updating.Lock()
+	defer l.updating.Unlock()
+
+	file, err := Parse(data)
+	if err == nil {
+		var next *Set
+		if next, err = file.build(l.OPTIONS, l.Set()); err == nil {
+			l.swap(next)
+			if l.ON_UPDATE != nil {
+				l.ON_UPDATE(file)
+			}
+			return nil
+		}
+	}
+	if l.ON_ERROR != nil {
+		l.ON_ERROR(err)
+	}
+	return err
+}
+
+// swap makes next the current set, running its new limiters and stopping
+// those it no longer has.
+func (l *Live) swap(next *Set) {
+	for _, limiter := range next.limiters {
+		if _, running := l.stops[limiter]; !running {
+			ctx, stop := context.WithCancel(context.Background())
+			limiter.RunContext(ctx)
+			l.stops[limiter] = stop
+		}
+	}
+
+	l.mx.Lock()
+	l.current = next
+	l.mx.Unlock()
+
+	kept := map[core.RateLimiter]bool{}
+	for _, limiter := range next.limiters {
+		kept[limiter] = true
+	}
+	for limiter, stop := range l.stops {
+		if !kept[limiter] {
+			stop()
+			delete(l.stops, limiter)
+		}
+	}
+}
+
+// Set returns the current version, nil before the first.
+func (l *Live) Set() *Set {
+	l.mx.RLock()
+	defer l.mx.RUnlock()
+	return l.current
+}
+
+// Limiters returns the current version's limiters by name.
+func (l *Live) Limiters() map[string]core.RateLimiter {
+	if set := l.Set(); set != nil {
+		return set.Limiters()
+	}
+	return map[string]core.RateLimiter{}
+}
+
+// Middleware limits the requests reaching next by the first rule of the
+// current version they match.
+func (l *Live) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		if set := l.Set(); set != nil {
+			set.serve(w, request, next)
+			return
+		}
+		next.ServeHTTP(w, request)
+	})
+}
+
+// Close stops the limiters.
+func (l *Live) Close() {
+	l.updating.Lock()
+	defer l.updating.Unlock()
+
+	for limiter, stop := range l.stops {
+		stop()
+		delete(l.stops, limiter)
+	}
+}
@@ -0,0 +1,58 @@
+package rulesfile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLive(t *testing.T) {
+	var applied, failed int
+	live := NewLive(LiveConfig{
+		ON_UPDATE: func(file *File) { applied++ },
+		ON_ERROR:  func(err error) { failed++ },
+	})
+	defer live.Close()
+	handler := live.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	request := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+		return w.Code
+	}
+
+	steps := []struct {
+		name string
+		// Version pushed before the request, none if empty.
+		data        string
+		wantErr     bool
+		want        int
+		wantApplied int
+		wantFailed  int
+	}{
+		{name: "before the first version", want: http.StatusOK},
+		{name: "first version", data: `rules: [{name: api, path: /api/, rate: 1/h}]`, want: http.StatusOK, wantApplied: 1},
+		{name: "limited", want: http.StatusTooManyRequests, wantApplied: 1},
+		{
+			name:        "unchanged limit keeps its buckets",
+			data:        `rules: [{name: login, path: /login, rate: 1/m}, {name: api, path: /api/, rate: 1/h}]`,
+			want:        http.StatusTooManyRequests,
+			wantApplied: 2,
+		},
+		{name: "invalid version", data: `rules: [{name: api, path: /api/, rate: lots}]`, wantErr: true, want: http.StatusTooManyRequests, wantApplied: 2, wantFailed: 1},
+		{name: "changed limit", data: `rules: [{name: api, path: /api/, rate: 2/h}]`, want: http.StatusOK, wantApplied: 3, wantFailed: 1},
+	}
+	for _, step := range steps {
+		if step.data != "" {
+			if err := live.Update([]byte(step.data)); (err != nil) != step.wantErr {
+				t.Fatalf("%s: update error %v", step.name, err)
+			}
+		}
+		if got := request(); got != step.want || applied != step.wantApplied || failed != step.wantFailed {
+			t.Fatalf("%s: status %d, %d applied, %d failed", step.name, got, applied, failed)
+		}
+	}
+
+	if limiters := live.Limiters(); len(limiters) != 1 || len(live.stops) != 1 {
+		t.Fatalf("%d limiters, %d running", len(limiters), len(live.stops))
+	}
+}
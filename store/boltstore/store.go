@@ -0,0 +1,240 @@
+package boltstore
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"go.etcd.io/bbolt"
+)
+
+type StoreConfig struct {
+	// An open bbolt database, e.g. from bbolt.Open("ratelimit.db", 0600,
+	// nil). It may hold other data too.
+	DB *bbolt.DB
+	// The bolt bucket rate limit buckets are kept in, one nested bucket per
+	// set. Defaults to "ratelimit".
+	BUCKET string
+	// How often buckets that are full and unlocked are deleted, since they
+	// are no different from new ones. Defaults to one minute; negative
+	// never deletes them.
+	SWEEP_INTERVAL time.Duration
+}
+
+// Store is a core.Store kept in an embedded bbolt database, for
+// single-node services whose quotas, such as daily limits, must survive
+// restarts without an external service. Every take is a bolt write
+// transaction, so they are serialized and durable once they return;
+// rejected takes only read. Buckets are refilled by the local clock.
+// Sweeps run in the background now and then from Take, and bbolt reuses
+// the pages of swept buckets, so the file stays at its high-water mark
+// rather than growing with every key ever seen.
+type Store struct {
+	StoreConfig
+	name      string
+	limit     int64
+	interval  time.Duration
+	lastSweep atomic.Int64
+	sweeping  atomic.Bool
+}
+
+// NewStore returns the store for one set of buckets, kept in a bolt bucket
+// of its own named name.
+func NewStore(config StoreConfig, name string, profile core.LimitProfile) *Store {
+	if config.BUCKET == "" {
+		config.BUCKET = "ratelimit"
+	}
+	if config.SWEEP_INTERVAL == 0 {
+		config.SWEEP_INTERVAL = time.Minute
+	}
+
+	s := &Store{
+		StoreConfig: config,
+		name:        name,
+		limit:       profile.RATE_LIMIT,
+		interval:    profile.REFILL_INTERVAL,
+	}
+	s.lastSweep.Store(time.Now().UnixNano())
+	return s
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in one bbolt database:
+//
+//	db, err := bbolt.Open("ratelimit.db", 0600, nil)
+//	...
+//	rateLimiter.SetConfig(core.RateLimiterConfig{
+//		...
+//		STORE: boltstore.Factory(boltstore.StoreConfig{DB: db}),
+//	})
+func Factory(config StoreConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewStore(config, name, profile)
+	}
+}
+
+func (s *Store) Take(key string, n int64) (allowed bool, remaining int64, resetAt time.Time, err error) {
+	s.maybeSweep()
+
+	err = s.update(key, func(b *bucket.State, now time.Time) bool {
+		allowed, remaining, resetAt = b.Take(s.limit, s.interval, n, now)
+		return allowed
+	})
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	return allowed, remaining, resetAt, nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	return s.update(key, func(b *bucket.State, now time.Time) bool {
+		b.Throttle(remaining, until)
+		return true
+	})
+}
+
+func (s *Store) Reset(key string) error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		set, err := s.set(tx)
+		if err != nil {
+			return err
+		}
+		return set.Delete([]byte(key))
+	})
+}
+
+func (s *Store) ResetAll() error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(s.BUCKET))
+		if root == nil || root.Bucket([]byte(s.name)) == nil {
+			return nil
+		}
+		return root.DeleteBucket([]byte(s.name))
+	})
+}
+
+// update loads and refills key's bucket and lets change modify it,
+// writing it back if change returns true.
+func (s *Store) update(key string, change func(b *bucket.State, now time.Time) bool) error {
+	// Checking in a read transaction first spares rejected takes the
+	// writer lock and the commit's fsync, which matters most under abuse.
+	var unchanged bool
+	err := s.DB.View(func(tx *bbolt.Tx) error {
+		b, err := s.load(tx.Bucket([]byte(s.BUCKET)), key, time.Now())
+		if err != nil {
+			return err
+		}
+		probe := b
+		unchanged = !change(&probe, time.Now())
+		return nil
+	})
+	if err != nil || unchanged {
+		return err
+	}
+
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		set, err := s.set(tx)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		b, err := s.load(tx.Bucket([]byte(s.BUCKET)), key, now)
+		if err != nil {
+			return err
+		}
+		if !change(&b, now) {
+			return nil
+		}
+		return set.Put([]byte(key), []byte(b.String()))
+	})
+}
+
+// load returns key's refilled bucket from root, a full one if it has none.
+func (s *Store) load(root *bbolt.Bucket, key string, now time.Time) (bucket.State, error) {
+	var value []byte
+	if root != nil {
+		if set := root.Bucket([]byte(s.name)); set != nil {
+			value = set.Get([]byte(key))
+		}
+	}
+	if value == nil {
+		return bucket.New(s.limit, now), nil
+	}
+
+	b, err := bucket.Parse(value)
+	if err != nil {
+		return bucket.State{}, fmt.Errorf("boltstore: %w", err)
+	}
+	b.Refill(s.limit, s.interval, now)
+	return b, nil
+}
+
+// set returns the store's bolt bucket, creating it if needed.
+func (s *Store) set(tx *bbolt.Tx) (*bbolt.Bucket, error) {
+	root, err := tx.CreateBucketIfNotExists([]byte(s.BUCKET))
+	if err != nil {
+		return nil, err
+	}
+	return root.CreateBucketIfNotExists([]byte(s.name))
+}
+
+// maybeSweep starts a sweep in the background once SWEEP_INTERVAL has
+// passed since the last one, unless one is running.
+func (s *Store) maybeSweep() {
+	if s.SWEEP_INTERVAL < 0 || s.interval <= 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	last := s.lastSweep.Load()
+	if time.Duration(now-last) < s.SWEEP_INTERVAL || !s.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+	if s.sweeping.CompareAndSwap(false, true) {
+		go func() {
+			defer s.sweeping.Store(false)
+			s.Sweep()
+		}()
+	}
+}
+
+// Sweep deletes the store's buckets that are full and unlocked. Take runs
+// it every SWEEP_INTERVAL.
+func (s *Store) Sweep() error {
+	return s.DB.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(s.BUCKET))
+		if root == nil {
+			return nil
+		}
+		set := root.Bucket([]byte(s.name))
+		if set == nil {
+			return nil
+		}
+
+		now := time.Now()
+		cursor := set.Cursor()
+		for key, value := cursor.First(); key != nil; {
+			b, err := bucket.Parse(value)
+			if err == nil {
+				b.Refill(s.limit, s.interval, now)
+			}
+			// Malformed buckets are dropped too, rather than failing every
+			// take of their key.
+			if err != nil || (b.Tokens >= float64(s.limit) && now.UnixNano() >= b.Locked) {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				key, value = cursor.Seek(key)
+				continue
+			}
+			key, value = cursor.Next()
+		}
+		return nil
+	})
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
@@ -0,0 +1,102 @@
+package boltstore
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"go.etcd.io/bbolt"
+)
+
+func openDB(t *testing.T, path string) *bbolt.DB {
+	t.Helper()
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestStore(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "ratelimit.db"))
+	defer db.Close()
+	store := NewStore(StoreConfig{DB: db}, "default", core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour})
+
+	steps := []struct {
+		name        string
+		do          func() error
+		n           int64
+		wantAllowed bool
+	}{
+		{name: "first", n: 1, wantAllowed: true},
+		{name: "second", n: 1, wantAllowed: true},
+		{name: "empty", n: 1, wantAllowed: false},
+		{name: "handed back", n: -1, wantAllowed: true},
+		{name: "after hand back", n: 1, wantAllowed: true},
+		{name: "after reset", do: func() error { return store.Reset("client") }, n: 2, wantAllowed: true},
+		{name: "throttled", do: func() error { return store.Throttle("client", -1, time.Now().Add(time.Hour)) }, n: -2, wantAllowed: true},
+		{name: "locked", n: 1, wantAllowed: false},
+		{name: "after reset all", do: store.ResetAll, n: 1, wantAllowed: true},
+	}
+	for _, step := range steps {
+		if step.do != nil {
+			if err := step.do(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		allowed, _, _, err := store.Take("client", step.n)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if allowed != step.wantAllowed {
+			t.Fatalf("%s: take %d allowed = %v, want %v", step.name, step.n, allowed, step.wantAllowed)
+		}
+	}
+}
+
+func TestStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.db")
+	profile := core.LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour}
+
+	db := openDB(t, path)
+	NewStore(StoreConfig{DB: db}, "daily", profile).Take("client", 2)
+	db.Close()
+
+	db = openDB(t, path)
+	defer db.Close()
+	_, remaining, _, err := NewStore(StoreConfig{DB: db}, "daily", profile).Take("client", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 {
+		t.Fatalf("remaining %d after reopening, want 1", remaining)
+	}
+}
+
+func TestSweep(t *testing.T) {
+	db := openDB(t, filepath.Join(t.TempDir(), "ratelimit.db"))
+	defer db.Close()
+	store := NewStore(StoreConfig{DB: db, SWEEP_INTERVAL: -1}, "default", core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: 10 * time.Millisecond})
+
+	store.Take("refilled", 1)
+	store.Take("locked", 1)
+	store.Throttle("locked", -1, time.Now().Add(time.Hour))
+	time.Sleep(30 * time.Millisecond)
+	store.Take("used", 2)
+
+	if err := store.Sweep(); err != nil {
+		t.Fatal(err)
+	}
+
+	var kept []string
+	db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("ratelimit")).Bucket([]byte("default")).ForEach(func(key, value []byte) error {
+			kept = append(kept, string(key))
+			return nil
+		})
+	})
+	if len(kept) != 2 || kept[0] != "locked" || kept[1] != "used" {
+		t.Fatalf("kept %v after the sweep, want [locked used]", kept)
+	}
+}
@@ -0,0 +1,282 @@
+package dynamostore
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrContention is returned when a bucket kept changing under an update
+// for MAX_RETRIES attempts in a row.
+var ErrContention = errors.New("dynamostore: too much contention on bucket")
+
+type StoreConfig struct {
+	CLIENT *dynamodb.Client
+	// The table buckets are kept in. Its partition key must be a string
+	// attribute named KEY_ATTRIBUTE, with no sort key.
+	TABLE string
+	// Name of the table's partition key. Defaults to "key".
+	KEY_ATTRIBUTE string
+	// Name of the attribute holding the Unix time in seconds a bucket
+	// expires at; enable DynamoDB TTL on it to have idle buckets deleted.
+	// Defaults to "expires_at".
+	TTL_ATTRIBUTE string
+	// Prepended to every key. Defaults to "ratelimit:".
+	PREFIX string
+	// How long an untouched bucket is kept. Defaults to the time a bucket
+	// takes to refill completely. DynamoDB deletes expired items within a
+	// few days, so expired buckets are treated as new until then.
+	TTL time.Duration
+	// Bounds each update, retries included. Defaults to one second.
+	TIMEOUT time.Duration
+	// How often an update is retried when another replica changed the
+	// bucket in between. Defaults to 10.
+	MAX_RETRIES int
+}
+
+// Store is a core.Store kept in DynamoDB, so serverless and Lambda
+// deployments can share limits without running a cache. Each update reads
+// the bucket with a consistent read and writes it back on condition that
+// its version is unchanged, retrying on conflicts. Buckets are refilled by
+// the callers' own clocks, and every request costs a read and a write
+// capacity unit.
+type Store struct {
+	StoreConfig
+	prefix   string
+	limit    int64
+	interval time.Duration
+}
+
+func NewStore(config StoreConfig, name string, profile core.LimitProfile) *Store {
+	if config.KEY_ATTRIBUTE == "" {
+		config.KEY_ATTRIBUTE = "key"
+	}
+	if config.TTL_ATTRIBUTE == "" {
+		config.TTL_ATTRIBUTE = "expires_at"
+	}
+	if config.PREFIX == "" {
+		config.PREFIX = "ratelimit:"
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Duration(profile.RATE_LIMIT) * profile.REFILL_INTERVAL
+	}
+	if config.TIMEOUT == 0 {
+		config.TIMEOUT = time.Second
+	}
+	if config.MAX_RETRIES == 0 {
+		config.MAX_RETRIES = 10
+	}
+
+	return &Store{
+		StoreConfig: config,
+		prefix:      config.PREFIX + name + ":",
+		limit:       profile.RATE_LIMIT,
+		interval:    profile.REFILL_INTERVAL,
+	}
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in one DynamoDB table.
+func Factory(config StoreConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewStore(config, name, profile)
+	}
+}
+
+func (s *Store) Take(key string, n int64) (allowed bool, remaining int64, resetAt time.Time, err error) {
+	err = s.update(key, func(b *bucket.State, now time.Time) bool {
+		allowed, remaining, resetAt = b.Take(s.limit, s.interval, n, now)
+		return allowed
+	})
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	return allowed, remaining, resetAt, nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	return s.update(key, func(b *bucket.State, now time.Time) bool {
+		b.Throttle(remaining, until)
+		return true
+	})
+}
+
+func (s *Store) Reset(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	_, err := s.CLIENT.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.TABLE),
+		Key:       s.itemKey(s.prefix + key),
+	})
+	return err
+}
+
+// ResetAll deletes every bucket of the store. It scans the whole table, so
+// it is slow and costly on tables holding many buckets. TIMEOUT bounds each
+// page of the scan and its deletes rather than the whole reset.
+func (s *Store) ResetAll() error {
+	paginator := dynamodb.NewScanPaginator(s.CLIENT, &dynamodb.ScanInput{
+		TableName:                aws.String(s.TABLE),
+		ProjectionExpression:     aws.String("#k"),
+		FilterExpression:         aws.String("begins_with(#k, :prefix)"),
+		ExpressionAttributeNames: map[string]string{"#k": s.KEY_ATTRIBUTE},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":prefix": &types.AttributeValueMemberS{Value: s.prefix},
+		},
+	})
+	for paginator.HasMorePages() {
+		if err := s.deletePage(paginator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletePage deletes the buckets of the scan's next page.
+func (s *Store) deletePage(paginator *dynamodb.ScanPaginator) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	page, err := paginator.NextPage(ctx)
+	if err != nil {
+		return err
+	}
+	for _, item := range page.Items {
+		_, err := s.CLIENT.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName: aws.String(s.TABLE),
+			Key:       map[string]types.AttributeValue{s.KEY_ATTRIBUTE: item[s.KEY_ATTRIBUTE]},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// update loads and refills key's bucket, lets change modify it and, if
+// change returns true, writes it back unless another replica wrote it
+// first, in which case it starts over.
+func (s *Store) update(key string, change func(b *bucket.State, now time.Time) bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	key = s.prefix + key
+	for attempt := 0; attempt < s.MAX_RETRIES; attempt++ {
+		now := time.Now()
+
+		response, err := s.CLIENT.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(s.TABLE),
+			Key:            s.itemKey(key),
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return err
+		}
+		b, version := s.parseItem(response.Item, now)
+		b.Refill(s.limit, s.interval, now)
+
+		if !change(&b, now) {
+			return nil
+		}
+
+		// Items written without a version, e.g. by hand, read as version
+		// zero and may be replaced as long as they still have none.
+		_, err = s.CLIENT.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                 aws.String(s.TABLE),
+			Item:                      s.item(key, b, version+1, now),
+			ConditionExpression:       aws.String("attribute_not_exists(#v) OR #v = :v"),
+			ExpressionAttributeNames:  map[string]string{"#v": "version"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{":v": number(version)},
+		})
+
+		var conflict *types.ConditionalCheckFailedException
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &conflict):
+			continue
+		default:
+			return err
+		}
+	}
+	return ErrContention
+}
+
+// parseItem returns the bucket an item holds and its version, or a full
+// bucket and version zero if there is none or it has expired. Items
+// missing an attribute read it as zero.
+func (s *Store) parseItem(item map[string]types.AttributeValue, now time.Time) (bucket.State, int64) {
+	if item == nil {
+		return bucket.New(s.limit, now), 0
+	}
+
+	b := bucket.State{
+		Refilled: intAttribute(item, "refilled"),
+		Locked:   intAttribute(item, "locked"),
+	}
+	if value, ok := item["tokens"].(*types.AttributeValueMemberN); ok {
+		b.Tokens, _ = strconv.ParseFloat(value.Value, 64)
+	}
+	version := intAttribute(item, "version")
+	if expiresAt := intAttribute(item, s.TTL_ATTRIBUTE); expiresAt > 0 && expiresAt <= now.Unix() {
+		b = bucket.New(s.limit, now)
+	}
+	return b, version
+}
+
+func (s *Store) item(key string, b bucket.State, version int64, now time.Time) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		s.KEY_ATTRIBUTE: &types.AttributeValueMemberS{Value: key},
+		"tokens":        &types.AttributeValueMemberN{Value: strconv.FormatFloat(b.Tokens, 'g', -1, 64)},
+		"refilled":      number(b.Refilled),
+		"locked":        number(b.Locked),
+		"version":       number(version),
+	}
+	if expiresAt := s.expiresAt(b, now); expiresAt > 0 {
+		item[s.TTL_ATTRIBUTE] = number(expiresAt)
+	}
+	return item
+}
+
+func (s *Store) itemKey(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{s.KEY_ATTRIBUTE: &types.AttributeValueMemberS{Value: key}}
+}
+
+// expiresAt is the Unix time in seconds the bucket expires at, covering
+// any lock, or zero if it is kept for good.
+func (s *Store) expiresAt(b bucket.State, now time.Time) int64 {
+	if s.TTL <= 0 {
+		return 0
+	}
+	ttl := s.TTL
+	if locked := time.Duration(b.Locked - now.UnixNano()); locked > 0 {
+		ttl += locked
+	}
+	return now.Add(ttl + time.Second - 1).Unix()
+}
+
+func intAttribute(item map[string]types.AttributeValue, name string) int64 {
+	value, ok := item[name].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0
+	}
+	i, _ := strconv.ParseInt(value.Value, 10, 64)
+	return i
+}
+
+func number(i int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(i, 10)}
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
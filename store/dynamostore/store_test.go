@@ -0,0 +1,146 @@
+package dynamostore
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestParseItem(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewStore(StoreConfig{}, "default", core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Second})
+	stored := bucket.State{Tokens: 1.5, Refilled: now.UnixNano(), Locked: now.Add(time.Minute).UnixNano()}
+
+	tests := []struct {
+		name        string
+		item        map[string]types.AttributeValue
+		want        bucket.State
+		wantVersion int64
+	}{
+		{name: "missing", item: nil, want: bucket.New(5, now)},
+		{name: "stored", item: store.item("ratelimit:default:a", stored, 3, now), want: stored, wantVersion: 3},
+		{
+			name:        "expired",
+			item:        store.item("ratelimit:default:a", bucket.State{Tokens: 1}, 3, now.Add(-time.Hour)),
+			want:        bucket.New(5, now),
+			wantVersion: 3,
+		},
+		{
+			name:        "without a version",
+			item:        map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: "ratelimit:default:a"}, "tokens": number(2)},
+			want:        bucket.State{Tokens: 2},
+			wantVersion: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, version := store.parseItem(test.item, now)
+			if got != test.want || version != test.wantVersion {
+				t.Fatalf("parseItem = %+v, %d, want %+v, %d", got, version, test.want, test.wantVersion)
+			}
+		})
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		state bucket.State
+		want  int64
+	}{
+		{name: "ttl", ttl: 10 * time.Second, state: bucket.State{}, want: now.Unix() + 10},
+		{name: "rounds up", ttl: 1500 * time.Millisecond, state: bucket.State{}, want: now.Unix() + 2},
+		{name: "covers the lock", ttl: 10 * time.Second, state: bucket.State{Locked: now.Add(time.Minute).UnixNano()}, want: now.Unix() + 70},
+		{name: "kept for good", ttl: -1, state: bucket.State{}, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(StoreConfig{TTL: test.ttl}, "default", core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Second})
+			if got := store.expiresAt(test.state, now); got != test.want {
+				t.Fatalf("expiresAt = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// TestStore runs against the DynamoDB endpoint at DYNAMODB_ENDPOINT, e.g.
+// DynamoDB Local, and is skipped without one. It creates and drops its own
+// table.
+func TestStore(t *testing.T) {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT not set")
+	}
+	ctx := context.Background()
+	client := dynamodb.New(dynamodb.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(endpoint),
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+
+	table := "ratelimit_test"
+	_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String(table),
+		AttributeDefinitions: []types.AttributeDefinition{{AttributeName: aws.String("key"), AttributeType: types.ScalarAttributeTypeS}},
+		KeySchema:            []types.KeySchemaElement{{AttributeName: aws.String("key"), KeyType: types.KeyTypeHash}},
+		BillingMode:          types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.DeleteTable(ctx, &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+
+	store := NewStore(StoreConfig{CLIENT: client, TABLE: table}, "default", core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour})
+
+	// A bucket written without a version is taken over.
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      map[string]types.AttributeValue{"key": &types.AttributeValueMemberS{Value: "ratelimit:default:manual"}, "tokens": number(2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		key         string
+		n           int64
+		wantAllowed bool
+	}{
+		{key: "client", n: 1, wantAllowed: true},
+		{key: "client", n: 1, wantAllowed: true},
+		{key: "client", n: 1, wantAllowed: false},
+		{key: "client", n: -1, wantAllowed: true},
+		{key: "client", n: 1, wantAllowed: true},
+		{key: "manual", n: 1, wantAllowed: true},
+	}
+	for i, step := range steps {
+		allowed, _, _, err := store.Take(step.key, step.n)
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if allowed != step.wantAllowed {
+			t.Fatalf("step %d: take %d allowed = %v, want %v", i, step.n, allowed, step.wantAllowed)
+		}
+	}
+
+	if err := store.ResetAll(); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, remaining, _, _ := store.Take("client", 1); !allowed || remaining != 1 {
+		t.Fatal("ResetAll left the bucket in place")
+	}
+}
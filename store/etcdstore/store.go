@@ -0,0 +1,180 @@
+package etcdstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// ErrContention is returned when a bucket kept changing under an update
+// for MAX_RETRIES attempts in a row.
+var ErrContention = errors.New("etcdstore: too much contention on bucket")
+
+type StoreConfig struct {
+	CLIENT *clientv3.Client
+	// Prepended to every key. Defaults to "/ratelimit/".
+	PREFIX string
+	// Bounds each update, retries included. Defaults to one second.
+	TIMEOUT time.Duration
+	// How often an update is retried when another replica changed the
+	// bucket in between. Defaults to 10.
+	MAX_RETRIES int
+}
+
+// Store is a core.Store kept in etcd, for teams that run etcd anyway and
+// want strongly consistent limits shared by a few replicas without adding
+// Redis. Every update is a transaction that only writes the bucket if it
+// is unchanged since it was read, so no tokens are lost or handed out
+// twice. Each request costs a consensus write, which suits login, signup
+// or admin endpoints better than busy APIs. Buckets are refilled by the
+// replicas' own clocks. Each write attaches a lease that expires once the
+// bucket would be full and unlocked again, so idle buckets clean
+// themselves up; buckets that never refill are kept until reset.
+type Store struct {
+	StoreConfig
+	prefix   string
+	limit    int64
+	interval time.Duration
+}
+
+func NewStore(config StoreConfig, name string, profile core.LimitProfile) *Store {
+	if config.PREFIX == "" {
+		config.PREFIX = "/ratelimit/"
+	}
+	if config.TIMEOUT == 0 {
+		config.TIMEOUT = time.Second
+	}
+	if config.MAX_RETRIES == 0 {
+		config.MAX_RETRIES = 10
+	}
+
+	return &Store{
+		StoreConfig: config,
+		prefix:      config.PREFIX + name + "/",
+		limit:       profile.RATE_LIMIT,
+		interval:    profile.REFILL_INTERVAL,
+	}
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in etcd.
+func Factory(config StoreConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewStore(config, name, profile)
+	}
+}
+
+func (s *Store) Take(key string, n int64) (allowed bool, remaining int64, resetAt time.Time, err error) {
+	err = s.update(key, func(b *bucket.State, now time.Time) bool {
+		allowed, remaining, resetAt = b.Take(s.limit, s.interval, n, now)
+		return allowed
+	})
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	return allowed, remaining, resetAt, nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	return s.update(key, func(b *bucket.State, now time.Time) bool {
+		b.Throttle(remaining, until)
+		return true
+	})
+}
+
+func (s *Store) Reset(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	_, err := s.CLIENT.Delete(ctx, s.prefix+key)
+	return err
+}
+
+func (s *Store) ResetAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	_, err := s.CLIENT.Delete(ctx, s.prefix, clientv3.WithPrefix())
+	return err
+}
+
+// update loads and refills key's bucket, lets change modify it and, if
+// change returns true, writes it back unless another replica wrote it
+// first, in which case it starts over from the bucket the failed
+// transaction read back.
+func (s *Store) update(key string, change func(b *bucket.State, now time.Time) bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	key = s.prefix + key
+	response, err := s.CLIENT.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	kvs := response.Kvs
+
+	for attempt := 0; attempt < s.MAX_RETRIES; attempt++ {
+		now := time.Now()
+
+		b := bucket.New(s.limit, now)
+		revision := int64(0)
+		if len(kvs) > 0 {
+			if b, err = bucket.Parse(kvs[0].Value); err != nil {
+				return fmt.Errorf("etcdstore: %w", err)
+			}
+			revision = kvs[0].ModRevision
+		}
+		b.Refill(s.limit, s.interval, now)
+
+		if !change(&b, now) {
+			return nil
+		}
+
+		var options []clientv3.OpOption
+		if ttl := s.leaseTTL(b, now); ttl > 0 {
+			lease, err := s.CLIENT.Grant(ctx, ttl)
+			if err != nil {
+				return err
+			}
+			options = append(options, clientv3.WithLease(lease.ID))
+		}
+
+		txn, err := s.CLIENT.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", revision)).
+			Then(clientv3.OpPut(key, b.String(), options...)).
+			Else(clientv3.OpGet(key)).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if txn.Succeeded {
+			return nil
+		}
+		kvs = txn.Responses[0].GetResponseRange().Kvs
+	}
+	return ErrContention
+}
+
+// leaseTTL is how long, in whole seconds and rounded up, until b is full
+// and unlocked again and no different from a new bucket, at least a second,
+// or 0 for a bucket that never refills.
+func (s *Store) leaseTTL(b bucket.State, now time.Time) int64 {
+	if s.interval <= 0 {
+		return 0
+	}
+	until := time.Duration((float64(s.limit) - b.Tokens) * float64(s.interval))
+	if locked := time.Unix(0, b.Locked).Sub(now); locked > until {
+		until = locked
+	}
+	return max(int64((until+time.Second-1)/time.Second), 1)
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
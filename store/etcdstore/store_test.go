@@ -0,0 +1,85 @@
+package etcdstore
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+func TestLeaseTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		state    bucket.State
+		want     int64
+	}{
+		{name: "refilling", interval: time.Second, state: bucket.State{Tokens: 7}, want: 3},
+		{name: "rounds up", interval: 300 * time.Millisecond, state: bucket.State{Tokens: 9}, want: 1},
+		{name: "full", interval: time.Second, state: bucket.State{Tokens: 10}, want: 1},
+		{name: "locked past the refill", interval: time.Second, state: bucket.State{Tokens: 9, Locked: now.Add(time.Minute).UnixNano()}, want: 60},
+		{name: "never refills", interval: 0, state: bucket.State{Tokens: 3}, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(StoreConfig{}, "default", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: test.interval})
+			if got := store.leaseTTL(test.state, now); got != test.want {
+				t.Fatalf("leaseTTL = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// TestStore runs against the etcd cluster at ETCD_ENDPOINTS, a comma
+// separated list, and is skipped without one.
+func TestStore(t *testing.T) {
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_ENDPOINTS not set")
+	}
+	client, err := clientv3.New(clientv3.Config{Endpoints: strings.Split(endpoints, ","), DialTimeout: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	store := NewStore(StoreConfig{CLIENT: client, PREFIX: "/ratelimit-test/"}, t.Name(),
+		core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour})
+	defer store.ResetAll()
+
+	steps := []struct {
+		n           int64
+		wantAllowed bool
+	}{
+		{n: 1, wantAllowed: true},
+		{n: 1, wantAllowed: true},
+		{n: 1, wantAllowed: false},
+		{n: -1, wantAllowed: true},
+		{n: 1, wantAllowed: true},
+	}
+	for i, step := range steps {
+		allowed, _, _, err := store.Take("client", step.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != step.wantAllowed {
+			t.Fatalf("step %d: take %d allowed = %v, want %v", i, step.n, allowed, step.wantAllowed)
+		}
+	}
+
+	response, err := client.Get(context.Background(), store.prefix+"client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Kvs) != 1 || response.Kvs[0].Lease == 0 {
+		t.Fatal("bucket stored without a lease")
+	}
+}
@@ -0,0 +1,299 @@
+package gossipstore
+
+import (
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"github.com/hashicorp/memberlist"
+)
+
+type ClusterConfig struct {
+	// Configuration of this member, e.g. memberlist.DefaultLANConfig()
+	// with a unique Name and the BindAddr and BindPort to listen on. Its
+	// Delegate is set by NewCluster.
+	MEMBERLIST *memberlist.Config
+	// Addresses of members to join, "host:port". Empty starts a new
+	// cluster.
+	PEERS []string
+	// How often the tokens taken here are sent to the other members.
+	// Shorter intervals tighten the limits at the cost of more messages.
+	// Defaults to 100 milliseconds.
+	SYNC_INTERVAL time.Duration
+}
+
+// Cluster shares rate limits between a small group of instances with no
+// datastore. Each member keeps every bucket in memory, admits requests
+// from it and every SYNC_INTERVAL sends the other members how many tokens
+// it took per key, which they take from their own copies. Limits are
+// approximate: the members together may admit up to a sync interval's
+// worth of requests each beyond the limit, more while messages are lost
+// or members join. Resets reach every member; Throttle only applies to
+// the member it is called on.
+type Cluster struct {
+	ClusterConfig
+	members *memberlist.Memberlist
+	sets    map[string]*Store
+	mx      sync.Mutex
+	done    chan struct{}
+}
+
+// message is what a member sends about one set of buckets.
+type message struct {
+	Set      string           `json:"set"`
+	Taken    map[string]int64 `json:"taken,omitempty"`
+	Reset    []string         `json:"reset,omitempty"`
+	ResetAll bool             `json:"reset_all,omitempty"`
+}
+
+// NewCluster starts this member and joins PEERS.
+func NewCluster(config ClusterConfig) (*Cluster, error) {
+	if config.MEMBERLIST == nil {
+		config.MEMBERLIST = memberlist.DefaultLANConfig()
+	}
+	if config.SYNC_INTERVAL == 0 {
+		config.SYNC_INTERVAL = 100 * time.Millisecond
+	}
+
+	c := &Cluster{
+		ClusterConfig: config,
+		sets:          map[string]*Store{},
+		done:          make(chan struct{}),
+	}
+	config.MEMBERLIST.Delegate = c
+
+	members, err := memberlist.Create(config.MEMBERLIST)
+	if err != nil {
+		return nil, err
+	}
+	c.members = members
+	if len(config.PEERS) > 0 {
+		if _, err := members.Join(config.PEERS); err != nil {
+			members.Shutdown()
+			return nil, err
+		}
+	}
+
+	go c.sync()
+	return c, nil
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in the cluster. Limiters sharing a cluster must give their sets
+// distinct names.
+func (c *Cluster) Factory() core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		c.mx.Lock()
+		defer c.mx.Unlock()
+
+		s := &Store{
+			name:      name,
+			limit:     profile.RATE_LIMIT,
+			interval:  profile.REFILL_INTERVAL,
+			buckets:   map[string]*bucket.State{},
+			taken:     map[string]int64{},
+			lastSweep: time.Now(),
+		}
+		c.sets[name] = s
+		return s
+	}
+}
+
+// Members returns the number of members this one knows to be alive,
+// itself included.
+func (c *Cluster) Members() int {
+	return c.members.NumMembers()
+}
+
+// Close leaves the cluster, waiting up to timeout for the other members
+// to learn of it, and stops this member.
+func (c *Cluster) Close(timeout time.Duration) error {
+	close(c.done)
+	if err := c.members.Leave(timeout); err != nil {
+		return err
+	}
+	return c.members.Shutdown()
+}
+
+// sync sends what every set has to tell the other members each
+// SYNC_INTERVAL until the cluster is closed.
+func (c *Cluster) sync() {
+	ticker := time.NewTicker(c.SYNC_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.mx.Lock()
+		sets := make([]*Store, 0, len(c.sets))
+		for _, s := range c.sets {
+			sets = append(sets, s)
+		}
+		c.mx.Unlock()
+
+		for _, s := range sets {
+			if msg, ok := s.flush(); ok {
+				c.broadcast(msg)
+			}
+		}
+	}
+}
+
+// broadcast sends msg to every other member. Members it can't reach miss
+// it, which only loosens their limits.
+func (c *Cluster) broadcast(msg message) {
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	local := c.members.LocalNode()
+	for _, node := range c.members.Members() {
+		if node.Name != local.Name {
+			c.members.SendReliable(node, buf)
+		}
+	}
+}
+
+// NotifyMsg applies a message from another member.
+func (c *Cluster) NotifyMsg(buf []byte) {
+	var msg message
+	if err := json.Unmarshal(buf, &msg); err != nil {
+		return
+	}
+
+	c.mx.Lock()
+	s, ok := c.sets[msg.Set]
+	c.mx.Unlock()
+	if ok {
+		s.apply(msg)
+	}
+}
+
+func (c *Cluster) NodeMeta(limit int) []byte                  { return nil }
+func (c *Cluster) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (c *Cluster) LocalState(join bool) []byte                { return nil }
+func (c *Cluster) MergeRemoteState(buf []byte, join bool)     {}
+
+// Store is one set of buckets of a Cluster.
+type Store struct {
+	name     string
+	limit    int64
+	interval time.Duration
+	buckets  map[string]*bucket.State
+	// Tokens taken here per key since the last sync.
+	taken     map[string]int64
+	reset     []string
+	resetAll  bool
+	lastSweep time.Time
+	mx        sync.Mutex
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	allowed, remaining, resetAt := bucket.Get(s.buckets, key, s.limit, s.interval, now).Take(s.limit, s.interval, n, now)
+	if allowed && n != 0 {
+		s.taken[key] += n
+	}
+	return allowed, remaining, resetAt, nil
+}
+
+// Throttle caps and locks key's bucket on this member only.
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	bucket.Get(s.buckets, key, s.limit, s.interval, time.Now()).Throttle(remaining, until)
+	return nil
+}
+
+// Reset drops key's bucket on every member.
+func (s *Store) Reset(key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.buckets, key)
+	delete(s.taken, key)
+	s.reset = append(s.reset, key)
+	return nil
+}
+
+// ResetAll drops every bucket of the set on every member.
+func (s *Store) ResetAll() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.buckets = map[string]*bucket.State{}
+	s.taken = map[string]int64{}
+	s.reset = nil
+	s.resetAll = true
+	return nil
+}
+
+// flush returns what happened here since the last sync, if anything, and
+// starts over.
+func (s *Store) flush() (message, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.sweep(time.Now())
+	if len(s.taken) == 0 && len(s.reset) == 0 && !s.resetAll {
+		return message{}, false
+	}
+	msg := message{Set: s.name, Taken: s.taken, Reset: s.reset, ResetAll: s.resetAll}
+	s.taken = map[string]int64{}
+	s.reset = nil
+	s.resetAll = false
+	return msg, true
+}
+
+// apply takes the tokens another member took from the buckets here,
+// letting them go below zero so overshoot is paid back.
+func (s *Store) apply(msg message) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if msg.ResetAll {
+		s.buckets = map[string]*bucket.State{}
+	}
+	for _, key := range msg.Reset {
+		delete(s.buckets, key)
+	}
+
+	now := time.Now()
+	for key, n := range msg.Taken {
+		b := bucket.Get(s.buckets, key, s.limit, s.interval, now)
+		b.Tokens = math.Min(float64(s.limit), b.Tokens-float64(n))
+	}
+}
+
+// sweep drops buckets that are full and unlocked, since they are no
+// different from new ones. The caller must hold s.mx.
+func (s *Store) sweep(now time.Time) {
+	if s.interval <= 0 || now.Sub(s.lastSweep) < s.interval*time.Duration(s.limit+1) {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		elapsed := float64(now.UnixNano()-b.Refilled) / float64(s.interval)
+		if b.Tokens+elapsed >= float64(s.limit) && now.UnixNano() >= b.Locked {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+var (
+	_ memberlist.Delegate  = (*Cluster)(nil)
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
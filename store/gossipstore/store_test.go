@@ -0,0 +1,108 @@
+package gossipstore
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"github.com/hashicorp/memberlist"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		thereTakes int64
+		takes      []int64
+		reset      bool
+		resetAll   bool
+		wantTokens float64
+	}{
+		{name: "tokens taken elsewhere", takes: []int64{2}, wantTokens: 3},
+		{name: "tokens handed back elsewhere", takes: []int64{3, -1}, wantTokens: 3},
+		{name: "overshoot is paid back", thereTakes: 3, takes: []int64{4}, wantTokens: -2},
+		{name: "reset", thereTakes: 1, takes: []int64{4}, reset: true, wantTokens: 5},
+		{name: "reset all", thereTakes: 1, takes: []int64{4}, resetAll: true, wantTokens: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cluster := &Cluster{sets: map[string]*Store{}}
+			profile := core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour}
+			here := cluster.Factory()("default", profile).(*Store)
+			there := cluster.Factory()("default", profile).(*Store)
+
+			// Each member takes from its own copy of the bucket.
+			there.Take("client", test.thereTakes)
+			for _, n := range test.takes {
+				here.Take("client", n)
+			}
+			if test.reset {
+				here.Reset("client")
+			}
+			if test.resetAll {
+				here.ResetAll()
+			}
+			msg, ok := here.flush()
+			if !ok {
+				t.Fatal("nothing to send")
+			}
+			there.apply(msg)
+
+			there.mx.Lock()
+			tokens := bucket.Get(there.buckets, "client", there.limit, there.interval, time.Now()).Tokens
+			there.mx.Unlock()
+			if math.Round(tokens) != test.wantTokens {
+				t.Fatalf("tokens %v, want %v", tokens, test.wantTokens)
+			}
+			if _, ok := here.flush(); ok {
+				t.Fatal("flush sent the same changes twice")
+			}
+		})
+	}
+}
+
+func newMember(t *testing.T, name string, peers ...string) *Cluster {
+	t.Helper()
+	config := memberlist.DefaultLocalConfig()
+	config.Name = name
+	config.BindAddr = "127.0.0.1"
+	config.BindPort = 0
+	config.LogOutput = io.Discard
+
+	cluster, err := NewCluster(ClusterConfig{MEMBERLIST: config, PEERS: peers, SYNC_INTERVAL: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cluster.Close(time.Second) })
+	return cluster
+}
+
+func TestCluster(t *testing.T) {
+	first := newMember(t, "first")
+	second := newMember(t, "second", fmt.Sprintf("127.0.0.1:%d", first.MEMBERLIST.BindPort))
+	if first.Members() != 2 || second.Members() != 2 {
+		t.Fatalf("members %d and %d, want 2", first.Members(), second.Members())
+	}
+
+	profile := core.LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour}
+	here := first.Factory()("default", profile)
+	there := second.Factory()("default", profile)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _, _, _ := here.Take("client", 1); !allowed {
+			t.Fatalf("take %d rejected", i)
+		}
+	}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, remaining, _, _ := there.Take("client", 0); remaining == 1 {
+			break
+		}
+	}
+	if allowed, _, _, _ := there.Take("client", 2); allowed {
+		t.Fatal("other member admitted tokens already taken")
+	}
+}
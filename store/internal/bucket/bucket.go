@@ -0,0 +1,96 @@
+// Package bucket is the token bucket arithmetic shared by the stores that
+// keep buckets as plain values and update them with compare-and-swap.
+package bucket
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// State is a bucket as stored: "tokens refilled locked", with both times in
+// Unix nanoseconds.
+type State struct {
+	Tokens   float64
+	Refilled int64
+	Locked   int64
+}
+
+// New returns the state of a full bucket.
+func New(limit int64, now time.Time) State {
+	return State{Tokens: float64(limit), Refilled: now.UnixNano()}
+}
+
+// Get returns the refilled bucket for key, adding a full one to buckets if
+// it has none, for the stores that hold their buckets in memory.
+func Get(buckets map[string]*State, key string, limit int64, interval time.Duration, now time.Time) *State {
+	b, ok := buckets[key]
+	if !ok {
+		state := New(limit, now)
+		b = &state
+		buckets[key] = b
+	}
+	b.Refill(limit, interval, now)
+	return b
+}
+
+func Parse(value []byte) (State, error) {
+	var s State
+	if _, err := fmt.Sscan(string(value), &s.Tokens, &s.Refilled, &s.Locked); err != nil {
+		return State{}, fmt.Errorf("malformed bucket %q: %w", value, err)
+	}
+	return s, nil
+}
+
+func (s State) String() string {
+	return strconv.FormatFloat(s.Tokens, 'g', -1, 64) + " " +
+		strconv.FormatInt(s.Refilled, 10) + " " + strconv.FormatInt(s.Locked, 10)
+}
+
+// Refill adds the tokens gained since the bucket was last refilled.
+func (s *State) Refill(limit int64, interval time.Duration, now time.Time) {
+	if interval > 0 {
+		elapsed := float64(now.UnixNano()-s.Refilled) / float64(interval)
+		s.Tokens = math.Min(float64(limit), s.Tokens+elapsed)
+	}
+	s.Refilled = now.UnixNano()
+}
+
+// Take removes n tokens if the bucket holds them and isn't locked, with the
+// results core.Store.Take reports. A negative n hands tokens back, even to
+// a locked bucket.
+func (s *State) Take(limit int64, interval time.Duration, n int64, now time.Time) (allowed bool, remaining int64, resetAt time.Time) {
+	if now.UnixNano() < s.Locked && n > 0 {
+		return false, 0, time.Unix(0, s.Locked)
+	}
+	if s.Tokens < float64(n) {
+		return false, int64(s.Tokens), now.Add(time.Duration((float64(n) - s.Tokens) * float64(interval)))
+	}
+
+	s.Tokens = math.Min(float64(limit), s.Tokens-float64(n))
+	return true, int64(s.Tokens), now.Add(time.Duration((float64(limit) - s.Tokens) * float64(interval)))
+}
+
+// Borrow removes up to n tokens, as many as the bucket holds unless it is
+// locked, and reports how many it removed. next is when the bucket holds a
+// token again.
+func (s *State) Borrow(interval time.Duration, n int64, now time.Time) (granted int64, next time.Time) {
+	if now.UnixNano() < s.Locked {
+		return 0, time.Unix(0, s.Locked)
+	}
+	granted = max(min(n, int64(math.Floor(s.Tokens))), 0)
+	s.Tokens -= float64(granted)
+	return granted, now.Add(time.Duration(math.Max(0, 1-s.Tokens) * float64(interval)))
+}
+
+// Throttle caps the bucket at remaining tokens, unless it is negative, and
+// locks it until until.
+func (s *State) Throttle(remaining int64, until time.Time) {
+	if remaining >= 0 && s.Tokens > float64(remaining) {
+		s.Tokens = float64(remaining)
+	}
+	if until.UnixNano() > s.Locked {
+		s.Locked = until.UnixNano()
+	}
+}
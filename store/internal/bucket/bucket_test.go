@@ -0,0 +1,154 @@
+package bucket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []State{
+		{Tokens: 3, Refilled: 1700000000000000000},
+		{Tokens: 0.25, Refilled: 1700000000000000000, Locked: 1700000001000000000},
+	}
+
+	for _, want := range tests {
+		t.Run(want.String(), func(t *testing.T) {
+			got, err := Parse([]byte(want.String()))
+			if err != nil || got != want {
+				t.Fatalf("Parse(%q) = %+v, %v", want.String(), got, err)
+			}
+		})
+	}
+
+	if _, err := Parse([]byte("garbage")); err == nil {
+		t.Fatal("Parse accepted a malformed bucket")
+	}
+}
+
+func TestTake(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	locked := now.Add(time.Minute).UnixNano()
+
+	tests := []struct {
+		name          string
+		state         State
+		n             int64
+		wantAllowed   bool
+		wantRemaining int64
+		wantTokens    float64
+	}{
+		{name: "take", state: State{Tokens: 3}, n: 1, wantAllowed: true, wantRemaining: 2, wantTokens: 2},
+		{name: "short", state: State{Tokens: 0.5}, n: 1, wantAllowed: false, wantRemaining: 0, wantTokens: 0.5},
+		{name: "refund", state: State{Tokens: 1}, n: -1, wantAllowed: true, wantRemaining: 2, wantTokens: 2},
+		{name: "refund caps at the limit", state: State{Tokens: 4}, n: -3, wantAllowed: true, wantRemaining: 5, wantTokens: 5},
+		{name: "locked", state: State{Tokens: 3, Locked: locked}, n: 1, wantAllowed: false, wantRemaining: 0, wantTokens: 3},
+		{name: "refund to a locked bucket", state: State{Tokens: 1, Locked: locked}, n: -1, wantAllowed: true, wantRemaining: 2, wantTokens: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			allowed, remaining, _ := state.Take(5, time.Second, test.n, now)
+			if allowed != test.wantAllowed || remaining != test.wantRemaining || state.Tokens != test.wantTokens {
+				t.Fatalf("Take = (%v, %d) leaving %g tokens, want (%v, %d) leaving %g",
+					allowed, remaining, state.Tokens, test.wantAllowed, test.wantRemaining, test.wantTokens)
+			}
+		})
+	}
+}
+
+func TestBorrow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name        string
+		state       State
+		n           int64
+		wantGranted int64
+		wantNext    time.Time
+	}{
+		{name: "all", state: State{Tokens: 5}, n: 3, wantGranted: 3, wantNext: now},
+		{name: "as many as held", state: State{Tokens: 2.5}, n: 4, wantGranted: 2, wantNext: now.Add(500 * time.Millisecond)},
+		{name: "empty", state: State{Tokens: 0.25}, n: 4, wantGranted: 0, wantNext: now.Add(750 * time.Millisecond)},
+		{name: "overdrawn", state: State{Tokens: -1}, n: 4, wantGranted: 0, wantNext: now.Add(2 * time.Second)},
+		{name: "locked", state: State{Tokens: 5, Locked: now.Add(time.Minute).UnixNano()}, n: 1, wantGranted: 0, wantNext: now.Add(time.Minute)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			granted, next := state.Borrow(time.Second, test.n, now)
+			if granted != test.wantGranted || !next.Equal(test.wantNext) {
+				t.Fatalf("Borrow = (%d, %v), want (%d, %v)", granted, next, test.wantGranted, test.wantNext)
+			}
+			if want := test.state.Tokens - float64(granted); state.Tokens != want {
+				t.Fatalf("left %g tokens, want %g", state.Tokens, want)
+			}
+		})
+	}
+}
+
+func TestRefill(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		elapsed  time.Duration
+		want     float64
+	}{
+		{name: "partial", interval: time.Second, elapsed: 1500 * time.Millisecond, want: 2.5},
+		{name: "capped", interval: time.Second, elapsed: time.Hour, want: 5},
+		{name: "no refill", interval: 0, elapsed: time.Hour, want: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := State{Tokens: 1, Refilled: start.UnixNano()}
+			state.Refill(5, test.interval, start.Add(test.elapsed))
+			if state.Tokens != test.want {
+				t.Fatalf("refilled to %g tokens, want %g", state.Tokens, test.want)
+			}
+		})
+	}
+}
+
+func TestGet(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	buckets := map[string]*State{}
+
+	b := Get(buckets, "client", 5, time.Second, start)
+	if b.Tokens != 5 || buckets["client"] != b {
+		t.Fatalf("new bucket %+v, held %v", b, buckets["client"] == b)
+	}
+	b.Tokens = 1
+	if got := Get(buckets, "client", 5, time.Second, start.Add(2*time.Second)); got != b || got.Tokens != 3 {
+		t.Fatalf("existing bucket %+v, want the same one refilled to 3 tokens", got)
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	until := time.Unix(1700000060, 0)
+	tests := []struct {
+		name       string
+		state      State
+		remaining  int64
+		wantTokens float64
+		wantLocked int64
+	}{
+		{name: "caps", state: State{Tokens: 4}, remaining: 1, wantTokens: 1, wantLocked: until.UnixNano()},
+		{name: "keeps fewer", state: State{Tokens: 0.5}, remaining: 1, wantTokens: 0.5, wantLocked: until.UnixNano()},
+		{name: "negative leaves tokens", state: State{Tokens: 4}, remaining: -1, wantTokens: 4, wantLocked: until.UnixNano()},
+		{name: "keeps a later lock", state: State{Tokens: 4, Locked: until.UnixNano() + 1}, remaining: -1, wantTokens: 4, wantLocked: until.UnixNano() + 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			state.Throttle(test.remaining, until)
+			if state.Tokens != test.wantTokens || state.Locked != test.wantLocked {
+				t.Fatalf("throttled to %+v, want %g tokens locked until %d", state, test.wantTokens, test.wantLocked)
+			}
+		})
+	}
+}
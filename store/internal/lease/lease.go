@@ -0,0 +1,303 @@
+// Package lease is the token lending shared by the stores that admit
+// requests from tokens borrowed in batches from a shared bucket, so the
+// hot path never waits on the network.
+package lease
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Lender hands out tokens of shared buckets.
+type Lender interface {
+	// Borrow takes up to n tokens from key's bucket, as many as it holds,
+	// and reports how many it got. next is when the bucket holds a token
+	// again.
+	Borrow(key string, n int64) (granted int64, next time.Time, err error)
+	// Take with a negative n hands tokens back.
+	Take(key string, n int64) (allowed bool, remaining int64, resetAt time.Time, err error)
+}
+
+type Config struct {
+	// Tokens borrowed at a time for a key. Defaults to a tenth of the
+	// limit, at least one.
+	Batch int64
+	// Tokens admitted for a key beyond those borrowed, to be charged by
+	// the next borrow. Defaults to Batch; negative means none.
+	MaxOvershoot int64
+	// How long a key's borrowed tokens are kept unused before they are
+	// handed back. Defaults to 10 seconds.
+	IdleTimeout time.Duration
+}
+
+// Store admits requests from tokens borrowed from a Lender. A key's tokens
+// are borrowed again in the background once half a batch is used. Until
+// the first borrow for a key returns, and whenever the borrowed tokens run
+// out before the next one does, up to MaxOvershoot requests are admitted
+// on credit. Once a key's credit is used up after a failed borrow, Take
+// returns the borrow's error.
+type Store struct {
+	lender       Lender
+	limit        int64
+	interval     time.Duration
+	batch        int64
+	maxOvershoot int64
+	idleTimeout  time.Duration
+	leases       map[string]*lease
+	lastSweep    time.Time
+	// Bumped by every reset, so borrows started before it hand their
+	// tokens back instead of crediting a lease that no longer counts.
+	generation uint64
+	// Takes served from borrowed tokens, and those that found too few.
+	hits   int64
+	misses int64
+	mx     sync.Mutex
+}
+
+// lease is the share of a key's bucket this replica holds.
+type lease struct {
+	// Borrowed and not used yet.
+	tokens int64
+	// Admitted beyond the borrowed tokens and owed to the lender.
+	debt      int64
+	borrowing bool
+	// Why the last borrow failed, nil once one succeeds.
+	err         error
+	emptyUntil  time.Time
+	lockedUntil time.Time
+	used        time.Time
+}
+
+func New(lender Lender, limit int64, interval time.Duration, config Config) *Store {
+	if config.Batch <= 0 {
+		config.Batch = max(limit/10, 1)
+	}
+	if config.MaxOvershoot == 0 {
+		config.MaxOvershoot = config.Batch
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = 10 * time.Second
+	}
+
+	return &Store{
+		lender:       lender,
+		limit:        limit,
+		interval:     interval,
+		batch:        config.Batch,
+		maxOvershoot: max(config.MaxOvershoot, 0),
+		idleTimeout:  config.IdleTimeout,
+		leases:       map[string]*lease{},
+		lastSweep:    time.Now(),
+	}
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	l, ok := s.leases[key]
+	if !ok {
+		l = &lease{}
+		s.leases[key] = l
+	}
+	l.used = now
+	defer s.refill(key, l, now)
+
+	if n > 0 && !now.Before(l.lockedUntil) {
+		if l.tokens >= n {
+			s.hits++
+		} else {
+			s.misses++
+		}
+	}
+
+	switch {
+	case n < 0:
+		repaid := min(-n, l.debt)
+		l.debt -= repaid
+		l.tokens += -n - repaid
+	case now.Before(l.lockedUntil):
+		return false, 0, l.lockedUntil, nil
+	case l.tokens >= n:
+		l.tokens -= n
+	case now.Before(l.emptyUntil):
+		return false, l.tokens, l.emptyUntil, nil
+	case l.debt+n-l.tokens <= s.maxOvershoot:
+		l.debt += n - l.tokens
+		l.tokens = 0
+	case l.err != nil:
+		return false, l.tokens, now.Add(s.interval), l.err
+	default:
+		return false, l.tokens, now.Add(s.interval), nil
+	}
+	return true, l.tokens, now.Add(time.Duration(s.limit-l.tokens) * s.interval), nil
+}
+
+// CacheStats reports how many takes were served from borrowed tokens and
+// how many found too few.
+func (s *Store) CacheStats() (hits, misses int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.hits, s.misses
+}
+
+// refill borrows tokens for key in the background once half a batch is
+// used or some are owed, unless the lender has none to lend yet. The
+// caller must hold s.mx.
+func (s *Store) refill(key string, l *lease, now time.Time) {
+	if l.borrowing || now.Before(l.emptyUntil) || now.Before(l.lockedUntil) {
+		return
+	}
+	if l.tokens >= s.batch/2 && l.debt == 0 {
+		return
+	}
+
+	l.borrowing = true
+	want := s.batch + l.debt
+	generation := s.generation
+	go func() {
+		granted, next, err := s.lender.Borrow(key, want)
+
+		s.mx.Lock()
+		defer s.mx.Unlock()
+
+		l.borrowing = false
+		l.err = err
+		if err != nil {
+			return
+		}
+		if generation != s.generation {
+			if granted > 0 {
+				go s.handBack(key, granted)
+			}
+			return
+		}
+		repaid := min(granted, l.debt)
+		l.debt -= repaid
+		l.tokens += granted - repaid
+		if granted < want {
+			l.emptyUntil = next
+		}
+	}()
+}
+
+// sweep hands back the tokens of keys unused for IdleTimeout and forgets
+// what they owe. The caller must hold s.mx.
+func (s *Store) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.idleTimeout {
+		return
+	}
+	s.lastSweep = now
+
+	for key, l := range s.leases {
+		if l.borrowing || now.Sub(l.used) < s.idleTimeout {
+			continue
+		}
+		delete(s.leases, key)
+		if l.tokens > 0 {
+			go s.handBack(key, l.tokens)
+		}
+	}
+}
+
+// handBack returns n borrowed tokens for key to the lender. Tokens it
+// couldn't take back are kept for the key again, to be used or handed back
+// by a later sweep.
+func (s *Store) handBack(key string, n int64) {
+	if _, _, _, err := s.lender.Take(key, -n); err != nil {
+		s.keep(key, n)
+	}
+}
+
+// keep adds n tokens the lender couldn't take back to key's lease.
+func (s *Store) keep(key string, n int64) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	l, ok := s.leases[key]
+	if !ok {
+		l = &lease{used: time.Now()}
+		s.leases[key] = l
+	}
+	l.tokens += n
+}
+
+// Throttle caps and locks this replica's share of key's bucket, once the
+// lender's bucket is throttled.
+func (s *Store) Throttle(key string, remaining int64, until time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	l, ok := s.leases[key]
+	if !ok {
+		l = &lease{used: time.Now()}
+		s.leases[key] = l
+	}
+	if remaining >= 0 && l.tokens > remaining {
+		l.tokens = remaining
+	}
+	if until.After(l.lockedUntil) {
+		l.lockedUntil = until
+	}
+}
+
+// Forget drops this replica's share of key's bucket, for a reset of the
+// lender's bucket.
+func (s *Store) Forget(key string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.leases, key)
+	s.generation++
+}
+
+// ForgetAll drops this replica's share of every bucket.
+func (s *Store) ForgetAll() {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.leases = map[string]*lease{}
+	s.generation++
+}
+
+// Close hands every borrowed token back to the lender, for graceful
+// shutdown, including those of borrows still in flight once they return.
+// Tokens the lender couldn't take back are kept, so Close can be retried,
+// and the errors are returned together.
+func (s *Store) Close() error {
+	s.mx.Lock()
+	leases := s.leases
+	s.leases = map[string]*lease{}
+	s.generation++
+	s.mx.Unlock()
+
+	var errs []error
+	for key, l := range leases {
+		if l.tokens <= 0 {
+			continue
+		}
+		if _, _, _, err := s.lender.Take(key, -l.tokens); err != nil {
+			errs = append(errs, err)
+			s.keep(key, l.tokens)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Borrowing reports whether any borrow is in flight.
+func (s *Store) Borrowing() bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for _, l := range s.leases {
+		if l.borrowing {
+			return true
+		}
+	}
+	return false
+}
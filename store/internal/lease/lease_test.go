@@ -0,0 +1,193 @@
+package lease
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+)
+
+// fakeLender lends the tokens of in-memory buckets, failing every call
+// with err, if set.
+type fakeLender struct {
+	limit   int64
+	buckets map[string]*bucket.State
+	err     error
+	mx      sync.Mutex
+}
+
+func newFakeLender(limit int64) *fakeLender {
+	return &fakeLender{limit: limit, buckets: map[string]*bucket.State{}}
+}
+
+func (l *fakeLender) get(key string) *bucket.State {
+	b, ok := l.buckets[key]
+	if !ok {
+		state := bucket.New(l.limit, time.Now())
+		b = &state
+		l.buckets[key] = b
+	}
+	return b
+}
+
+func (l *fakeLender) Borrow(key string, n int64) (int64, time.Time, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.err != nil {
+		return 0, time.Time{}, l.err
+	}
+	granted, next := l.get(key).Borrow(time.Hour, n, time.Now())
+	return granted, next, nil
+}
+
+func (l *fakeLender) Take(key string, n int64) (bool, int64, time.Time, error) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if l.err != nil {
+		return false, 0, time.Time{}, l.err
+	}
+	allowed, remaining, resetAt := l.get(key).Take(l.limit, time.Hour, n, time.Now())
+	return allowed, remaining, resetAt, nil
+}
+
+// tokens reports the tokens left in key's bucket.
+func (l *fakeLender) tokens(key string) int64 {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	return int64(l.get(key).Tokens)
+}
+
+// settle waits for the store's borrows in flight to return.
+func settle(t *testing.T, s *Store) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if !s.Borrowing() {
+			return
+		}
+	}
+	t.Fatal("borrow still in flight")
+}
+
+func TestTake(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		takes        int
+		wantAllowed  int
+		wantBorrowed int64
+		wantHits     int64
+	}{
+		{name: "within the limit", config: Config{Batch: 4}, takes: 8, wantAllowed: 8, wantBorrowed: 10, wantHits: 7},
+		{name: "up to the limit", config: Config{Batch: 4}, takes: 12, wantAllowed: 10, wantBorrowed: 10, wantHits: 9},
+		{name: "no overshoot", config: Config{Batch: 4, MaxOvershoot: -1}, takes: 12, wantAllowed: 10, wantBorrowed: 10, wantHits: 10},
+		{name: "default batch", takes: 3, wantAllowed: 3, wantBorrowed: 4, wantHits: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lender := newFakeLender(10)
+			store := New(lender, 10, time.Hour, test.config)
+
+			allowed := 0
+			for i := 0; i < test.takes; i++ {
+				settle(t, store)
+				if ok, _, _, _ := store.Take("client", 1); ok {
+					allowed++
+				}
+			}
+			settle(t, store)
+
+			if allowed != test.wantAllowed {
+				t.Fatalf("allowed %d of %d, want %d", allowed, test.takes, test.wantAllowed)
+			}
+			if borrowed := 10 - lender.tokens("client"); borrowed != test.wantBorrowed {
+				t.Fatalf("borrowed %d, want %d", borrowed, test.wantBorrowed)
+			}
+			if hits, misses := store.CacheStats(); hits != test.wantHits || misses != int64(test.takes)-test.wantHits {
+				t.Fatalf("cache hits %d and misses %d, want %d and %d", hits, misses, test.wantHits, int64(test.takes)-test.wantHits)
+			}
+		})
+	}
+}
+
+func TestTakeReturnsBorrowErrors(t *testing.T) {
+	lender := newFakeLender(10)
+	lender.err = errors.New("unavailable")
+	store := New(lender, 10, time.Hour, Config{Batch: 2, MaxOvershoot: 1})
+
+	if ok, _, _, err := store.Take("client", 1); !ok || err != nil {
+		t.Fatalf("first take = %v, %v, want it admitted on credit", ok, err)
+	}
+	settle(t, store)
+	if _, _, _, err := store.Take("client", 1); err != lender.err {
+		t.Fatalf("take after a failed borrow with no credit left returned %v, want %v", err, lender.err)
+	}
+}
+
+func TestForgetHandsBackStaleBorrows(t *testing.T) {
+	lender := newFakeLender(10)
+	store := New(lender, 10, time.Hour, Config{Batch: 4})
+
+	// Start a borrow and forget the key before it can return.
+	store.mx.Lock()
+	l := &lease{}
+	store.leases["client"] = l
+	store.refill("client", l, time.Now())
+	store.leases = map[string]*lease{}
+	store.generation++
+	store.mx.Unlock()
+
+	// The borrow hands its tokens back in the background.
+	deadline := time.Now().Add(time.Second)
+	for lender.tokens("client") != 10 {
+		if time.Now().After(deadline) {
+			t.Fatalf("lender holds %d tokens after the reset, want 10", lender.tokens("client"))
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if l.tokens != 0 {
+		t.Fatalf("stale borrow credited %d tokens", l.tokens)
+	}
+}
+
+func TestClose(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantTokens int64
+	}{
+		{name: "hands tokens back", wantTokens: 9},
+		{name: "keeps tokens it couldn't hand back", err: errors.New("unavailable"), wantTokens: 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lender := newFakeLender(10)
+			store := New(lender, 10, time.Hour, Config{Batch: 4})
+			store.Take("client", 1)
+			settle(t, store)
+
+			lender.err = test.err
+			if err := store.Close(); !errors.Is(err, test.err) {
+				t.Fatalf("Close error %v, want %v", err, test.err)
+			}
+			lender.err = nil
+			if remaining := lender.tokens("client"); remaining != test.wantTokens {
+				t.Fatalf("lender holds %d tokens after Close, want %d", remaining, test.wantTokens)
+			}
+
+			// Tokens kept by a failed Close are handed back by the next.
+			if err := store.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if remaining := lender.tokens("client"); remaining != 9 {
+				t.Fatalf("lender holds %d tokens after retrying Close, want 9", remaining)
+			}
+		})
+	}
+}
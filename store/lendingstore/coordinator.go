@@ -0,0 +1,167 @@
+package lendingstore
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+)
+
+// request is what a Store sends the Coordinator. Times are durations from
+// now, so the members' clocks don't matter.
+type request struct {
+	Set       string        `json:"set"`
+	Key       string        `json:"key,omitempty"`
+	Limit     int64         `json:"limit"`
+	Interval  time.Duration `json:"interval"`
+	N         int64         `json:"n,omitempty"`
+	Remaining int64         `json:"remaining,omitempty"`
+	Pause     time.Duration `json:"pause,omitempty"`
+}
+
+type response struct {
+	Allowed   bool  `json:"allowed,omitempty"`
+	Granted   int64 `json:"granted,omitempty"`
+	Remaining int64 `json:"remaining,omitempty"`
+	// Until the bucket is full again, or holds the tokens asked for.
+	Wait time.Duration `json:"wait,omitempty"`
+}
+
+// Coordinator keeps the buckets of a service's replicas in memory and
+// lends their tokens in batches over HTTP. It is the single source of
+// truth for the limits, so run one per service, on a trusted network: it
+// takes any request it is sent.
+//
+//	http.ListenAndServe(":8700", lendingstore.NewCoordinator())
+//
+// Buckets that are full and unlocked are dropped now and then, since
+// they are no different from new ones.
+type Coordinator struct {
+	sets      map[string]*set
+	lastSweep time.Time
+	mx        sync.Mutex
+}
+
+// set is one set of buckets, with the limit its replicas last sent.
+type set struct {
+	limit    int64
+	interval time.Duration
+	buckets  map[string]*bucket.State
+}
+
+func NewCoordinator() *Coordinator {
+	return &Coordinator{sets: map[string]*set{}, lastSweep: time.Now()}
+}
+
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp response
+	switch r.URL.Path {
+	case "/borrow":
+		resp = c.borrow(req)
+	case "/take":
+		resp = c.take(req)
+	case "/throttle":
+		c.throttle(req)
+	case "/reset":
+		c.reset(req)
+	case "/reset-all":
+		c.resetAll(req)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (c *Coordinator) borrow(req request) response {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	s := c.set(req, now)
+	granted, next := bucket.Get(s.buckets, req.Key, s.limit, s.interval, now).Borrow(s.interval, req.N, now)
+	return response{Granted: granted, Wait: next.Sub(now)}
+}
+
+func (c *Coordinator) take(req request) response {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	s := c.set(req, now)
+	allowed, remaining, resetAt := bucket.Get(s.buckets, req.Key, s.limit, s.interval, now).Take(s.limit, s.interval, req.N, now)
+	return response{Allowed: allowed, Remaining: remaining, Wait: resetAt.Sub(now)}
+}
+
+func (c *Coordinator) throttle(req request) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	s := c.set(req, now)
+	bucket.Get(s.buckets, req.Key, s.limit, s.interval, now).Throttle(req.Remaining, now.Add(req.Pause))
+}
+
+func (c *Coordinator) reset(req request) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	delete(c.set(req, time.Now()).buckets, req.Key)
+}
+
+func (c *Coordinator) resetAll(req request) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	delete(c.sets, req.Set)
+}
+
+// set returns the set req is about, taking on the limit it was sent with.
+// The caller must hold c.mx.
+func (c *Coordinator) set(req request, now time.Time) *set {
+	c.sweep(now)
+
+	s, ok := c.sets[req.Set]
+	if !ok {
+		s = &set{buckets: map[string]*bucket.State{}}
+		c.sets[req.Set] = s
+	}
+	s.limit = req.Limit
+	s.interval = req.Interval
+	return s
+}
+
+// sweep drops the buckets that are full and unlocked once a minute. The
+// caller must hold c.mx.
+func (c *Coordinator) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+
+	for _, s := range c.sets {
+		if s.interval <= 0 {
+			continue
+		}
+		for key, b := range s.buckets {
+			b.Refill(s.limit, s.interval, now)
+			if b.Tokens >= float64(s.limit) && now.UnixNano() >= b.Locked {
+				delete(s.buckets, key)
+			}
+		}
+	}
+}
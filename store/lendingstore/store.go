@@ -0,0 +1,189 @@
+package lendingstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/lease"
+)
+
+type StoreConfig struct {
+	// Base URL of the Coordinator, e.g. "http://ratelimit-coordinator:8700".
+	URL string
+	// Defaults to http.DefaultClient.
+	HTTP_CLIENT *http.Client
+	// Bounds each call to the Coordinator. Defaults to one second.
+	TIMEOUT time.Duration
+	// Tokens borrowed from the Coordinator at a time for a key. Larger
+	// batches mean fewer round trips but more tokens held back by each
+	// replica. Defaults to a tenth of the limit, at least one.
+	BATCH int64
+	// How many tokens a replica may admit for a key beyond those it has
+	// borrowed, to be charged by the next borrow. Defaults to BATCH;
+	// negative means none.
+	MAX_OVERSHOOT int64
+	// How long a key's borrowed tokens are kept unused before they are
+	// handed back. Defaults to 10 seconds.
+	IDLE_TIMEOUT time.Duration
+}
+
+// Store admits requests from tokens it borrows from a Coordinator in
+// batches, so limits are shared across the replicas of a service without
+// a datastore and the hot path never waits on the network. It behaves
+// like redisstore.HybridStore: limits can be exceeded by MAX_OVERSHOOT per
+// replica and key, and remaining reports only the tokens this replica
+// holds. Throttle and the resets go straight to the Coordinator.
+type Store struct {
+	remote *client
+	leases *lease.Store
+}
+
+// NewStore returns the store for one set of buckets, which the Coordinator
+// tells apart by name.
+func NewStore(config StoreConfig, name string, profile core.LimitProfile) *Store {
+	if config.HTTP_CLIENT == nil {
+		config.HTTP_CLIENT = http.DefaultClient
+	}
+	if config.TIMEOUT == 0 {
+		config.TIMEOUT = time.Second
+	}
+
+	remote := &client{
+		StoreConfig: config,
+		url:         strings.TrimSuffix(config.URL, "/"),
+		set:         name,
+		limit:       profile.RATE_LIMIT,
+		interval:    profile.REFILL_INTERVAL,
+	}
+	return &Store{
+		remote: remote,
+		leases: lease.New(remote, profile.RATE_LIMIT, profile.REFILL_INTERVAL, lease.Config{
+			Batch:        config.BATCH,
+			MaxOvershoot: config.MAX_OVERSHOOT,
+			IdleTimeout:  config.IDLE_TIMEOUT,
+		}),
+	}
+}
+
+// Factory returns a core.StoreFactory admitting every set of a limiter's
+// buckets from tokens borrowed from a Coordinator:
+//
+//	rateLimiter.SetConfig(core.RateLimiterConfig{
+//		...
+//		STORE: lendingstore.Factory(lendingstore.StoreConfig{URL: "http://ratelimit-coordinator:8700"}),
+//	})
+func Factory(config StoreConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewStore(config, name, profile)
+	}
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	return s.leases.Take(key, n)
+}
+
+// Throttle throttles key's bucket on the Coordinator and caps and locks
+// this replica's share of it.
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	if _, err := s.remote.call("/throttle", request{Key: key, Remaining: remaining, Pause: time.Until(until)}); err != nil {
+		return err
+	}
+	s.leases.Throttle(key, remaining, until)
+	return nil
+}
+
+func (s *Store) Reset(key string) error {
+	s.leases.Forget(key)
+	_, err := s.remote.call("/reset", request{Key: key})
+	return err
+}
+
+func (s *Store) ResetAll() error {
+	s.leases.ForgetAll()
+	_, err := s.remote.call("/reset-all", request{})
+	return err
+}
+
+// Close hands every borrowed token back to the Coordinator, for graceful
+// shutdown. Tokens it couldn't take back are kept, so Close can be
+// retried.
+func (s *Store) Close() error {
+	return s.leases.Close()
+}
+
+// client is one set of buckets on the Coordinator.
+type client struct {
+	StoreConfig
+	url      string
+	set      string
+	limit    int64
+	interval time.Duration
+}
+
+func (c *client) Borrow(key string, n int64) (int64, time.Time, error) {
+	resp, err := c.call("/borrow", request{Key: key, N: n})
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return resp.Granted, time.Now().Add(resp.Wait), nil
+}
+
+func (c *client) Take(key string, n int64) (bool, int64, time.Time, error) {
+	resp, err := c.call("/take", request{Key: key, N: n})
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	return resp.Allowed, resp.Remaining, time.Now().Add(resp.Wait), nil
+}
+
+// call sends req about the client's set to the Coordinator's path.
+func (c *client) call(path string, req request) (response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.TIMEOUT)
+	defer cancel()
+
+	req.Set = c.set
+	req.Limit = c.limit
+	req.Interval = c.interval
+	body, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := c.HTTP_CLIENT.Do(httpReq)
+	if err != nil {
+		return response{}, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return response{}, fmt.Errorf("lendingstore: coordinator answered %s", httpResp.Status)
+	}
+
+	var resp response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return response{}, fmt.Errorf("lendingstore: %w", err)
+	}
+	return resp, nil
+}
+
+// CacheStats reports how many takes were served from tokens borrowed from
+// the Coordinator and how many found too few.
+func (s *Store) CacheStats() (hits, misses int64) {
+	return s.leases.CacheStats()
+}
+
+var (
+	_ core.CachingStore    = (*Store)(nil)
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
@@ -0,0 +1,148 @@
+package lendingstore
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// settle waits for the store's borrows in flight to return.
+func settle(t *testing.T, s *Store) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if !s.leases.Borrowing() {
+			return
+		}
+	}
+	t.Fatal("borrow still in flight")
+}
+
+func newReplicas(t *testing.T, config StoreConfig, n int) []*Store {
+	t.Helper()
+	server := httptest.NewServer(NewCoordinator())
+	t.Cleanup(server.Close)
+
+	config.URL = server.URL + "/"
+	replicas := make([]*Store, n)
+	for i := range replicas {
+		replicas[i] = NewStore(config, "default", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour})
+	}
+	return replicas
+}
+
+func TestStoreSharesLimit(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      StoreConfig
+		takes       int
+		wantAllowed int
+	}{
+		{name: "within the limit", config: StoreConfig{BATCH: 2}, takes: 4, wantAllowed: 8},
+		{name: "up to the limit", config: StoreConfig{BATCH: 2}, takes: 8, wantAllowed: 10},
+		{name: "no overshoot", config: StoreConfig{BATCH: 3, MAX_OVERSHOOT: -1}, takes: 8, wantAllowed: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			replicas := newReplicas(t, test.config, 2)
+
+			allowed := 0
+			for i := 0; i < test.takes; i++ {
+				for _, replica := range replicas {
+					settle(t, replica)
+					ok, _, _, err := replica.Take("client", 1)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if ok {
+						allowed++
+					}
+				}
+			}
+			if allowed != test.wantAllowed {
+				t.Fatalf("allowed %d of %d, want %d", allowed, 2*test.takes, test.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestStoreResetAndClose(t *testing.T) {
+	replicas := newReplicas(t, StoreConfig{BATCH: 4}, 1)
+	store := replicas[0]
+
+	store.Take("client", 1)
+	settle(t, store)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, remaining, _, _ := store.remote.Take("client", 0); remaining != 9 {
+		t.Fatalf("coordinator holds %d tokens after Close, want 9", remaining)
+	}
+
+	if err := store.Reset("client"); err != nil {
+		t.Fatal(err)
+	}
+	if _, remaining, _, _ := store.remote.Take("client", 0); remaining != 10 {
+		t.Fatalf("coordinator holds %d tokens after Reset, want 10", remaining)
+	}
+
+	if err := store.Throttle("client", 0, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, _, _ := store.Take("client", 1); ok {
+		t.Fatal("throttled key admitted")
+	}
+	if err := store.ResetAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, remaining, _, _ := store.remote.Take("client", 0); remaining != 10 {
+		t.Fatalf("coordinator holds %d tokens after ResetAll, want 10", remaining)
+	}
+}
+
+func TestStoreCoordinatorErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(server.Close)
+
+	store := NewStore(StoreConfig{URL: server.URL, BATCH: 2, MAX_OVERSHOOT: 1}, "default",
+		core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour})
+	if ok, _, _, err := store.Take("client", 1); !ok || err != nil {
+		t.Fatalf("first take = %v, %v, want it admitted on credit", ok, err)
+	}
+	settle(t, store)
+	if _, _, _, err := store.Take("client", 1); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("take after a failed borrow returned %v, want the coordinator's status", err)
+	}
+}
+
+func TestCoordinatorRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{name: "borrow", method: http.MethodPost, path: "/borrow", body: `{"set":"default","key":"client","limit":10,"interval":1000000000,"n":3}`, want: http.StatusOK},
+		{name: "wrong method", method: http.MethodGet, path: "/borrow", want: http.StatusMethodNotAllowed},
+		{name: "unknown path", method: http.MethodPost, path: "/lend", body: `{}`, want: http.StatusNotFound},
+		{name: "malformed body", method: http.MethodPost, path: "/take", body: `{`, want: http.StatusBadRequest},
+	}
+
+	coordinator := NewCoordinator()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			coordinator.ServeHTTP(w, httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)))
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package memcachestore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// ErrContention is returned when a bucket kept changing under an update
+// for MAX_RETRIES attempts in a row.
+var ErrContention = errors.New("memcachestore: too much contention on bucket")
+
+// ErrResetAllUnsupported is returned by ResetAll: Memcached can't list the
+// keys of a store. Buckets still refill on their own, and a new PREFIX
+// starts every key afresh.
+var ErrResetAllUnsupported = errors.New("memcachestore: memcached can't reset all buckets")
+
+// maxKeyLength is the longest key Memcached accepts.
+const maxKeyLength = 250
+
+// maxRelativeExpiration is the longest expiry Memcached takes in seconds
+// from now; larger values are read as Unix timestamps.
+const maxRelativeExpiration = 30 * 24 * 60 * 60
+
+type StoreConfig struct {
+	CLIENT *memcache.Client
+	// Prepended to every key. Defaults to "ratelimit:".
+	PREFIX string
+	// How long an untouched bucket is kept. Defaults to the time a bucket
+	// takes to refill completely, rounded up to whole seconds.
+	TTL time.Duration
+	// How often an update is retried when another replica changed the
+	// bucket in between. Defaults to 10.
+	MAX_RETRIES int
+}
+
+// Store is a core.Store kept in Memcached, for environments that have
+// Memcached but not Redis. Each update reads the bucket and writes it back
+// with compare-and-swap, retrying on conflicts, so no tokens are lost or
+// handed out twice, with these trade-offs against the Redis store:
+//
+//   - Buckets are refilled by the replicas' own clocks, so clock skew
+//     between them shifts refills by as much.
+//   - Hot keys cost a round trip per retry under contention, and fail with
+//     ErrContention once MAX_RETRIES is used up.
+//   - Memcached may evict buckets under memory pressure, which refills
+//     them.
+//   - ResetAll isn't supported.
+type Store struct {
+	StoreConfig
+	prefix   string
+	limit    int64
+	interval time.Duration
+}
+
+func NewStore(config StoreConfig, name string, profile core.LimitProfile) *Store {
+	if config.PREFIX == "" {
+		config.PREFIX = "ratelimit:"
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Duration(profile.RATE_LIMIT) * profile.REFILL_INTERVAL
+	}
+	if config.MAX_RETRIES == 0 {
+		config.MAX_RETRIES = 10
+	}
+
+	return &Store{
+		StoreConfig: config,
+		prefix:      config.PREFIX + name + ":",
+		limit:       profile.RATE_LIMIT,
+		interval:    profile.REFILL_INTERVAL,
+	}
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in Memcached.
+func Factory(config StoreConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewStore(config, name, profile)
+	}
+}
+
+func (s *Store) Take(key string, n int64) (allowed bool, remaining int64, resetAt time.Time, err error) {
+	err = s.update(key, func(b *bucket.State, now time.Time) bool {
+		allowed, remaining, resetAt = b.Take(s.limit, s.interval, n, now)
+		return allowed
+	})
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	return allowed, remaining, resetAt, nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	return s.update(key, func(b *bucket.State, now time.Time) bool {
+		b.Throttle(remaining, until)
+		return true
+	})
+}
+
+func (s *Store) Reset(key string) error {
+	err := s.CLIENT.Delete(s.memcacheKey(key))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+func (s *Store) ResetAll() error {
+	return ErrResetAllUnsupported
+}
+
+// update loads and refills key's bucket, lets change modify it and, if
+// change returns true, writes it back unless another replica wrote it
+// first, in which case it starts over.
+func (s *Store) update(key string, change func(b *bucket.State, now time.Time) bool) error {
+	key = s.memcacheKey(key)
+
+	for attempt := 0; attempt < s.MAX_RETRIES; attempt++ {
+		now := time.Now()
+
+		item, err := s.CLIENT.Get(key)
+		var b bucket.State
+		switch {
+		case errors.Is(err, memcache.ErrCacheMiss):
+			item = nil
+			b = bucket.New(s.limit, now)
+		case err != nil:
+			return err
+		default:
+			if b, err = bucket.Parse(item.Value); err != nil {
+				return fmt.Errorf("memcachestore: %w", err)
+			}
+		}
+		b.Refill(s.limit, s.interval, now)
+
+		if !change(&b, now) {
+			return nil
+		}
+
+		value := []byte(b.String())
+		if item == nil {
+			err = s.CLIENT.Add(&memcache.Item{Key: key, Value: value, Expiration: s.expiration(b, now)})
+		} else {
+			item.Value = value
+			item.Expiration = s.expiration(b, now)
+			err = s.CLIENT.CompareAndSwap(item)
+		}
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, memcache.ErrNotStored), errors.Is(err, memcache.ErrCASConflict), errors.Is(err, memcache.ErrCacheMiss):
+			continue
+		default:
+			return err
+		}
+	}
+	return ErrContention
+}
+
+// expiration is the bucket's expiry in seconds, covering any lock.
+func (s *Store) expiration(b bucket.State, now time.Time) int32 {
+	ttl := s.TTL
+	if locked := time.Duration(b.Locked - now.UnixNano()); locked > 0 {
+		ttl += locked
+	}
+	if ttl <= 0 {
+		return 0
+	}
+
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if seconds > maxRelativeExpiration {
+		seconds += now.Unix()
+	}
+	return int32(seconds)
+}
+
+// memcacheKey is the Memcached key for key. Keys Memcached would refuse,
+// for their length or characters, are hashed.
+func (s *Store) memcacheKey(key string) string {
+	full := s.prefix + key
+	if len(full) <= maxKeyLength && !strings.ContainsFunc(full, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return full
+	}
+	sum := sha256.Sum256([]byte(key))
+	return s.prefix + "sha256:" + hex.EncodeToString(sum[:])
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
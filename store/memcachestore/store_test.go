@@ -0,0 +1,100 @@
+package memcachestore
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+func TestMemcacheKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		wantHashed bool
+	}{
+		{name: "plain", key: "203.0.113.7"},
+		{name: "space", key: "user alice", wantHashed: true},
+		{name: "control character", key: "user\nalice", wantHashed: true},
+		{name: "too long", key: strings.Repeat("k", maxKeyLength), wantHashed: true},
+	}
+
+	store := NewStore(StoreConfig{}, "default", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Second})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := store.memcacheKey(test.key)
+			if hashed := strings.HasPrefix(got, "ratelimit:default:sha256:"); hashed != test.wantHashed {
+				t.Fatalf("key %q hashed = %v, want %v", got, hashed, test.wantHashed)
+			}
+			if len(got) > maxKeyLength {
+				t.Fatalf("key is %d bytes, longer than Memcached accepts", len(got))
+			}
+		})
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name  string
+		ttl   time.Duration
+		state bucket.State
+		want  int32
+	}{
+		{name: "rounds up", ttl: 1500 * time.Millisecond, want: 2},
+		{name: "covers the lock", ttl: 10 * time.Second, state: bucket.State{Locked: now.Add(time.Minute).UnixNano()}, want: 70},
+		{name: "kept for good", ttl: -1, want: 0},
+		{name: "absolute past 30 days", ttl: 31 * 24 * time.Hour, want: int32(now.Unix()) + 31*24*60*60},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(StoreConfig{TTL: test.ttl}, "default", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Second})
+			if got := store.expiration(test.state, now); got != test.want {
+				t.Fatalf("expiration = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+// TestStore runs against the Memcached server at MEMCACHE_ADDR and is
+// skipped without one.
+func TestStore(t *testing.T) {
+	addr := os.Getenv("MEMCACHE_ADDR")
+	if addr == "" {
+		t.Skip("MEMCACHE_ADDR not set")
+	}
+
+	store := NewStore(StoreConfig{CLIENT: memcache.New(addr), PREFIX: "ratelimit-test:"}, t.Name(),
+		core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour})
+	defer store.Reset("client")
+
+	steps := []struct {
+		n           int64
+		wantAllowed bool
+	}{
+		{n: 1, wantAllowed: true},
+		{n: 1, wantAllowed: true},
+		{n: 1, wantAllowed: false},
+		{n: -1, wantAllowed: true},
+		{n: 1, wantAllowed: true},
+	}
+	for i, step := range steps {
+		allowed, _, _, err := store.Take("client", step.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != step.wantAllowed {
+			t.Fatalf("step %d: take %d allowed = %v, want %v", i, step.n, allowed, step.wantAllowed)
+		}
+	}
+
+	if err := store.ResetAll(); err != ErrResetAllUnsupported {
+		t.Fatalf("ResetAll error %v, want %v", err, ErrResetAllUnsupported)
+	}
+}
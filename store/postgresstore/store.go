@@ -0,0 +1,209 @@
+package postgresstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+)
+
+// now is the database server's clock in Unix nanoseconds, so replicas'
+// clocks don't matter.
+const now = `(extract(epoch FROM clock_timestamp()) * 1000000000)::bigint`
+
+// level is a stored bucket's tokens refilled up to EXCLUDED.refilled, with
+// $2 the limit and $3 the interval in nanoseconds.
+const level = `CASE WHEN $3::bigint > 0
+	THEN LEAST($2::float8, b.tokens + (EXCLUDED.refilled - b.refilled)::float8 / $3::bigint)
+	ELSE b.tokens END`
+
+// takeQuery refills and charges $4 tokens from bucket $1 in one statement.
+// A bucket that is locked or short of tokens is left alone and no row is
+// returned.
+const takeQuery = `
+INSERT INTO %[1]s AS b (key, tokens, refilled, locked)
+SELECT $1, LEAST($2::float8, $2::float8 - $4::float8), ` + now + `, 0
+WHERE $4::float8 <= $2::float8
+ON CONFLICT (key) DO UPDATE SET
+	tokens = LEAST($2::float8, ` + level + ` - $4::float8),
+	refilled = EXCLUDED.refilled
+WHERE b.locked <= EXCLUDED.refilled AND ` + level + ` >= $4::float8
+RETURNING tokens`
+
+// throttleQuery caps bucket $1 at $4 tokens, unless it is negative, and
+// locks it for $5 nanoseconds.
+const throttleQuery = `
+INSERT INTO %[1]s AS b (key, tokens, refilled, locked)
+SELECT $1, CASE WHEN $4::float8 >= 0 THEN LEAST($2::float8, $4::float8) ELSE $2::float8 END,
+	n.now, n.now + $5::bigint
+FROM (SELECT ` + now + ` AS now) n
+ON CONFLICT (key) DO UPDATE SET
+	tokens = CASE WHEN $4::float8 >= 0 THEN LEAST(` + level + `, $4::float8) ELSE ` + level + ` END,
+	refilled = EXCLUDED.refilled,
+	locked = GREATEST(b.locked, EXCLUDED.locked)`
+
+const selectQuery = `SELECT tokens, refilled, locked, ` + now + ` FROM %[1]s WHERE key = $1`
+
+const deleteQuery = `DELETE FROM %[1]s WHERE key = $1`
+
+const deleteAllQuery = `DELETE FROM %[1]s WHERE left(key, length($1)) = $1`
+
+// sweepQuery deletes the store's buckets that are full and unlocked, with
+// $2 the limit and $3 the interval in nanoseconds.
+const sweepQuery = `
+DELETE FROM %[1]s
+WHERE left(key, length($1)) = $1 AND $3::bigint > 0
+	AND locked <= ` + now + `
+	AND refilled + (($2::float8 - tokens) * $3::bigint)::bigint <= ` + now
+
+const createTableQuery = `
+CREATE TABLE IF NOT EXISTS %[1]s (
+	key text PRIMARY KEY,
+	tokens double precision NOT NULL,
+	refilled bigint NOT NULL,
+	locked bigint NOT NULL DEFAULT 0
+)`
+
+type StoreConfig struct {
+	// Any database/sql handle to PostgreSQL, e.g. from the pgx stdlib or
+	// lib/pq driver.
+	DB *sql.DB
+	// The table buckets are kept in, optionally schema-qualified. It is
+	// put into the queries as is, so it must be a trusted identifier.
+	// Defaults to "ratelimit_buckets".
+	TABLE string
+	// Bounds each query. Defaults to one second.
+	TIMEOUT time.Duration
+}
+
+// Store is a core.Store kept in PostgreSQL, for low-traffic services such
+// as admin APIs that run several instances but don't warrant Redis. Each
+// take is a single upsert that refills and charges the bucket by the
+// database's clock, so replicas never race and need no advisory locks.
+// Rejected takes read the bucket back once more to report when they could
+// succeed. Buckets are kept until reset or swept with Sweep.
+type Store struct {
+	StoreConfig
+	prefix   string
+	limit    int64
+	interval time.Duration
+}
+
+// NewStore returns the store for one set of buckets, whose keys are put
+// under name + ":".
+func NewStore(config StoreConfig, name string, profile core.LimitProfile) *Store {
+	if config.TABLE == "" {
+		config.TABLE = "ratelimit_buckets"
+	}
+	if config.TIMEOUT == 0 {
+		config.TIMEOUT = time.Second
+	}
+
+	return &Store{
+		StoreConfig: config,
+		prefix:      name + ":",
+		limit:       profile.RATE_LIMIT,
+		interval:    profile.REFILL_INTERVAL,
+	}
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in one PostgreSQL table.
+func Factory(config StoreConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewStore(config, name, profile)
+	}
+}
+
+// CreateTable creates the bucket table unless it exists, for services that
+// don't manage it in their own migrations.
+func (s *Store) CreateTable(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, s.query(createTableQuery))
+	return err
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	var tokens float64
+	err := s.DB.QueryRowContext(ctx, s.query(takeQuery),
+		s.prefix+key, float64(s.limit), s.interval.Nanoseconds(), float64(n)).Scan(&tokens)
+	switch {
+	case err == nil:
+		resetAt := time.Now().Add(time.Duration((float64(s.limit) - tokens) * float64(s.interval)))
+		return true, int64(math.Floor(tokens)), resetAt, nil
+	case errors.Is(err, sql.ErrNoRows):
+		return s.rejected(ctx, key, n)
+	default:
+		return false, 0, time.Time{}, err
+	}
+}
+
+// rejected reads back key's bucket after a take of n tokens was refused,
+// to report what it holds and when the take could succeed.
+func (s *Store) rejected(ctx context.Context, key string, n int64) (bool, int64, time.Time, error) {
+	var b bucket.State
+	var serverNow int64
+	err := s.DB.QueryRowContext(ctx, s.query(selectQuery), s.prefix+key).
+		Scan(&b.Tokens, &b.Refilled, &b.Locked, &serverNow)
+	at := time.Unix(0, serverNow)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		at = time.Now()
+		b = bucket.New(s.limit, at)
+	case err != nil:
+		return false, 0, time.Time{}, err
+	}
+	b.Refill(s.limit, s.interval, at)
+	allowed, remaining, resetAt := b.Take(s.limit, s.interval, n, at)
+	return allowed, remaining, time.Now().Add(resetAt.Sub(at)), nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, s.query(throttleQuery),
+		s.prefix+key, float64(s.limit), s.interval.Nanoseconds(), float64(remaining), time.Until(until).Nanoseconds())
+	return err
+}
+
+func (s *Store) Reset(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, s.query(deleteQuery), s.prefix+key)
+	return err
+}
+
+func (s *Store) ResetAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, s.query(deleteAllQuery), s.prefix)
+	return err
+}
+
+// Sweep deletes the store's buckets that are full and unlocked, since they
+// are no different from new ones. Run it now and then, e.g. from a cron
+// job, to keep the table small.
+func (s *Store) Sweep(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, s.query(sweepQuery), s.prefix, float64(s.limit), s.interval.Nanoseconds())
+	return err
+}
+
+func (s *Store) query(format string) string {
+	return fmt.Sprintf(strings.TrimSpace(format), s.TABLE)
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
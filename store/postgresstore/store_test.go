@@ -0,0 +1,89 @@
+package postgresstore
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	_ "github.com/lib/pq"
+)
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+		want  string
+	}{
+		{name: "default table", want: "DELETE FROM ratelimit_buckets WHERE key = $1"},
+		{name: "schema-qualified", table: "limits.buckets", want: "DELETE FROM limits.buckets WHERE key = $1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(StoreConfig{TABLE: test.table}, "default", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Second})
+			if got := store.query(deleteQuery); got != test.want {
+				t.Fatalf("query %q, want %q", got, test.want)
+			}
+			if got := store.query(takeQuery); strings.Contains(got, "%!") || strings.HasPrefix(got, "\n") {
+				t.Fatalf("malformed take query %q", got)
+			}
+		})
+	}
+}
+
+// TestStore runs against the PostgreSQL database at POSTGRES_DSN and is
+// skipped without one.
+func TestStore(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_DSN not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	store := NewStore(StoreConfig{DB: db, TABLE: "ratelimit_test"}, t.Name(),
+		core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour})
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec("DROP TABLE ratelimit_test")
+
+	steps := []struct {
+		n             int64
+		wantAllowed   bool
+		wantRemaining int64
+	}{
+		{n: 1, wantAllowed: true, wantRemaining: 1},
+		{n: 1, wantAllowed: true, wantRemaining: 0},
+		{n: 1, wantAllowed: false, wantRemaining: 0},
+		{n: -1, wantAllowed: true, wantRemaining: 1},
+		{n: 1, wantAllowed: true, wantRemaining: 0},
+	}
+	for i, step := range steps {
+		allowed, remaining, _, err := store.Take("client", step.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed != step.wantAllowed || remaining != step.wantRemaining {
+			t.Fatalf("step %d: take %d allowed = %v, remaining %d, want %v, %d",
+				i, step.n, allowed, remaining, step.wantAllowed, step.wantRemaining)
+		}
+	}
+
+	if err := store.Throttle("client", -1, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ResetAll(); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, _, _, err := store.Take("client", 2); err != nil || !allowed {
+		t.Fatalf("take after ResetAll allowed = %v, error %v", allowed, err)
+	}
+}
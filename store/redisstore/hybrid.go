@@ -0,0 +1,103 @@
+package redisstore
+
+import (
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/lease"
+)
+
+type HybridConfig struct {
+	StoreConfig
+	// Tokens borrowed from Redis at a time for a key. Larger batches mean
+	// fewer round trips but more tokens held back by each replica.
+	// Defaults to a tenth of the limit, at least one.
+	BATCH int64
+	// How many tokens a replica may admit for a key beyond those it has
+	// borrowed, e.g. while its first borrow is still in flight, to be
+	// charged by the next borrow. This is the overshoot per replica and
+	// key. Defaults to BATCH; negative means none.
+	MAX_OVERSHOOT int64
+	// How long a key's borrowed tokens are kept unused before they are
+	// handed back to Redis. Defaults to 10 seconds.
+	IDLE_TIMEOUT time.Duration
+}
+
+// HybridStore admits requests from tokens it has borrowed from Redis in
+// batches, so the hot path never waits on the network. A key's tokens are
+// borrowed again in the background once half a batch is used. Until the
+// first borrow for a key returns, and whenever the borrowed tokens run
+// out before the next one does, up to MAX_OVERSHOOT requests are admitted
+// on credit, so limits can be exceeded by that much per replica. Tokens
+// other replicas could have used are held back in the meantime, and
+// remaining reports only the tokens this replica holds. Once a key's
+// credit is used up after a failed borrow, Take returns the borrow's error
+// as Store would.
+type HybridStore struct {
+	remote *Store
+	leases *lease.Store
+}
+
+func NewHybridStore(config HybridConfig, name string, profile core.LimitProfile) *HybridStore {
+	remote := NewStore(config.StoreConfig, name, profile)
+	return &HybridStore{
+		remote: remote,
+		leases: lease.New(remote, profile.RATE_LIMIT, profile.REFILL_INTERVAL, lease.Config{
+			Batch:        config.BATCH,
+			MaxOvershoot: config.MAX_OVERSHOOT,
+			IdleTimeout:  config.IDLE_TIMEOUT,
+		}),
+	}
+}
+
+// HybridFactory returns a core.StoreFactory admitting every set of a
+// limiter's buckets from tokens borrowed from Redis.
+func HybridFactory(config HybridConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewHybridStore(config, name, profile)
+	}
+}
+
+func (s *HybridStore) Take(key string, n int64) (bool, int64, time.Time, error) {
+	return s.leases.Take(key, n)
+}
+
+// Throttle throttles key's bucket in Redis and caps and locks this
+// replica's share of it. Other replicas' shares are used up first.
+func (s *HybridStore) Throttle(key string, remaining int64, until time.Time) error {
+	if err := s.remote.Throttle(key, remaining, until); err != nil {
+		return err
+	}
+	s.leases.Throttle(key, remaining, until)
+	return nil
+}
+
+func (s *HybridStore) Reset(key string) error {
+	s.leases.Forget(key)
+	return s.remote.Reset(key)
+}
+
+func (s *HybridStore) ResetAll() error {
+	s.leases.ForgetAll()
+	return s.remote.ResetAll()
+}
+
+// Close hands every borrowed token back to Redis, for graceful shutdown,
+// including those of borrows still in flight once they return. Tokens
+// Redis couldn't take back are kept, so Close can be retried, and the
+// errors are returned together.
+func (s *HybridStore) Close() error {
+	return s.leases.Close()
+}
+
+// CacheStats reports how many takes were served from tokens borrowed from
+// Redis and how many found too few.
+func (s *HybridStore) CacheStats() (hits, misses int64) {
+	return s.leases.CacheStats()
+}
+
+var (
+	_ core.CachingStore    = (*HybridStore)(nil)
+	_ core.ResettableStore = (*HybridStore)(nil)
+	_ core.ThrottlingStore = (*HybridStore)(nil)
+)
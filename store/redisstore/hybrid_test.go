@@ -0,0 +1,112 @@
+package redisstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// settle waits for the store's borrows in flight to return.
+func settle(t *testing.T, s *HybridStore) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if !s.leases.Borrowing() {
+			return
+		}
+	}
+	t.Fatal("borrow still in flight")
+}
+
+// remoteTokens reports the tokens left in key's bucket in Redis.
+func remoteTokens(t *testing.T, s *HybridStore, key string) int64 {
+	t.Helper()
+	_, remaining, _, err := s.remote.Take(key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return remaining
+}
+
+func TestHybridStoreTake(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       HybridConfig
+		takes        int
+		wantAllowed  int
+		wantBorrowed int64
+	}{
+		{name: "within the limit", config: HybridConfig{BATCH: 4}, takes: 8, wantAllowed: 8, wantBorrowed: 10},
+		{name: "up to the limit", config: HybridConfig{BATCH: 4}, takes: 12, wantAllowed: 10, wantBorrowed: 10},
+		{name: "no overshoot", config: HybridConfig{BATCH: 4, MAX_OVERSHOOT: -1}, takes: 12, wantAllowed: 10, wantBorrowed: 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.config.CLIENT = testClient(t)
+			test.config.PREFIX = "ratelimit-test:"
+			store := NewHybridStore(test.config, "hybrid", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour})
+
+			allowed := 0
+			for i := 0; i < test.takes; i++ {
+				// Taking one at a time after the last borrow returned
+				// keeps the test from depending on how borrows race.
+				settle(t, store)
+				ok, _, _, err := store.Take("client", 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok {
+					allowed++
+				}
+			}
+			settle(t, store)
+
+			if allowed != test.wantAllowed {
+				t.Fatalf("allowed %d of %d, want %d", allowed, test.takes, test.wantAllowed)
+			}
+			if borrowed := 10 - remoteTokens(t, store, "client"); borrowed != test.wantBorrowed {
+				t.Fatalf("borrowed %d from Redis, want %d", borrowed, test.wantBorrowed)
+			}
+		})
+	}
+}
+
+func TestHybridStoreReturnsBorrowErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	server.Close()
+
+	store := NewHybridStore(HybridConfig{
+		StoreConfig:   StoreConfig{CLIENT: client, TIMEOUT: 100 * time.Millisecond},
+		BATCH:         2,
+		MAX_OVERSHOOT: 1,
+	}, "hybrid", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour})
+
+	if ok, _, _, err := store.Take("client", 1); !ok || err != nil {
+		t.Fatalf("first take = %v, %v, want it admitted on credit", ok, err)
+	}
+	settle(t, store)
+	if _, _, _, err := store.Take("client", 1); err == nil {
+		t.Fatal("take after a failed borrow with no credit left returned no error")
+	}
+}
+
+func TestHybridStoreClose(t *testing.T) {
+	store := NewHybridStore(HybridConfig{
+		StoreConfig: StoreConfig{CLIENT: testClient(t), PREFIX: "ratelimit-test:"},
+		BATCH:       4,
+	}, "hybrid", core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour})
+
+	store.Take("client", 1)
+	settle(t, store)
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if remaining := remoteTokens(t, store, "client"); remaining != 9 {
+		t.Fatalf("Redis holds %d tokens after Close, want 9", remaining)
+	}
+}
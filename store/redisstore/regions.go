@@ -0,0 +1,72 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RegionBalancer is a regionstore.Balancer keeping the regions' demand in
+// one Redis hash, e.g. on a global Redis every region reaches once per
+// rebalance:
+//
+//	regions := regionstore.New(regionstore.Config{
+//		REGION:   "eu-west",
+//		WEIGHTS:  map[string]float64{"us-east": 2, "eu-west": 1},
+//		LOCAL:    redisstore.Factory(redisstore.StoreConfig{CLIENT: regional}),
+//		BALANCER: &redisstore.RegionBalancer{CLIENT: global},
+//	})
+type RegionBalancer struct {
+	CLIENT redis.UniversalClient
+	// The hash holding the demand. Defaults to "ratelimit:regions".
+	KEY string
+	// Demand published longer ago than this is ignored, so regions that
+	// went away stop holding on to their share. Defaults to five minutes.
+	STALE_AFTER time.Duration
+	// Bounds each exchange. Defaults to one second.
+	TIMEOUT time.Duration
+}
+
+func (b *RegionBalancer) Exchange(region string, demand float64) (map[string]float64, error) {
+	key := b.KEY
+	if key == "" {
+		key = "ratelimit:regions"
+	}
+	staleAfter := b.STALE_AFTER
+	if staleAfter == 0 {
+		staleAfter = 5 * time.Minute
+	}
+	timeout := b.TIMEOUT
+	if timeout == 0 {
+		timeout = time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	now := time.Now()
+	var all *redis.MapStringStringCmd
+	_, err := b.CLIENT.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, region, fmt.Sprint(demand, " ", now.UnixMilli()))
+		all = pipe.HGetAll(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	demands := map[string]float64{}
+	for region, value := range all.Val() {
+		var demand float64
+		var published int64
+		if _, err := fmt.Sscan(value, &demand, &published); err != nil {
+			continue
+		}
+		if now.Sub(time.UnixMilli(published)) <= staleAfter {
+			demands[region] = demand
+		}
+	}
+	return demands, nil
+}
@@ -0,0 +1,587 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript refills and charges a bucket in one step, so replicas sharing
+// a bucket never race. Buckets are hashes of their tokens, the time they
+// were last refilled and the time they are locked until, in microseconds
+// of the Redis server's clock, so replicas' clocks don't matter. It returns
+// whether the tokens were taken, the tokens left and, in microseconds, how
+// long until the bucket is full again or, if rejected, until it could be
+// charged. A negative ARGV[3] hands tokens back, locked bucket or not.
+var takeScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'refilled', 'locked')
+local tokens = tonumber(state[1])
+local refilled = tonumber(state[2])
+local locked = tonumber(state[3]) or 0
+if tokens == nil then
+	tokens = limit
+	refilled = now
+end
+if interval > 0 then
+	tokens = math.min(limit, tokens + (now - refilled) / interval)
+end
+
+if now < locked and n > 0 then
+	return {0, 0, locked - now}
+end
+if tokens < n then
+	return {0, math.floor(tokens), math.ceil((n - tokens) * interval)}
+end
+
+tokens = math.min(limit, tokens - n)
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'refilled', now)
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return {1, math.floor(tokens), math.ceil((limit - tokens) * interval)}
+`)
+
+// batchTakeScript is takeScript charging the bucket for each of ARGV[4]
+// onwards in turn, all or nothing each, with ARGV[3] the TTL. It returns
+// takeScript's three results for each.
+var batchTakeScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'refilled', 'locked')
+local tokens = tonumber(state[1])
+local refilled = tonumber(state[2])
+local locked = tonumber(state[3]) or 0
+if tokens == nil then
+	tokens = limit
+	refilled = now
+end
+if interval > 0 then
+	tokens = math.min(limit, tokens + (now - refilled) / interval)
+end
+
+local results = {}
+local taken = false
+for i = 4, #ARGV do
+	local n = tonumber(ARGV[i])
+	if now < locked and n > 0 then
+		table.insert(results, 0)
+		table.insert(results, 0)
+		table.insert(results, locked - now)
+	elseif tokens < n then
+		table.insert(results, 0)
+		table.insert(results, math.floor(tokens))
+		table.insert(results, math.ceil((n - tokens) * interval))
+	else
+		tokens = math.min(limit, tokens - n)
+		taken = true
+		table.insert(results, 1)
+		table.insert(results, math.floor(tokens))
+		table.insert(results, math.ceil((limit - tokens) * interval))
+	end
+end
+
+if taken then
+	redis.call('HSET', KEYS[1], 'tokens', tokens, 'refilled', now)
+	if ttl > 0 then
+		redis.call('PEXPIRE', KEYS[1], ttl)
+	end
+end
+return results
+`)
+
+// borrowScript is takeScript handing out as many of the ARGV[3] tokens as
+// the bucket holds instead of all or none. It returns how many were taken,
+// the tokens left and, in microseconds, how long until the bucket holds a
+// token again.
+var borrowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'refilled', 'locked')
+local tokens = tonumber(state[1])
+local refilled = tonumber(state[2])
+local locked = tonumber(state[3]) or 0
+if tokens == nil then
+	tokens = limit
+	refilled = now
+end
+if interval > 0 then
+	tokens = math.min(limit, tokens + (now - refilled) / interval)
+end
+
+if now < locked then
+	return {0, 0, locked - now}
+end
+local granted = math.min(n, math.floor(tokens))
+if granted <= 0 then
+	return {0, math.floor(tokens), math.ceil((1 - tokens) * interval)}
+end
+
+tokens = tokens - granted
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'refilled', now)
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return {granted, math.floor(tokens), math.ceil(math.max(0, 1 - tokens) * interval)}
+`)
+
+// throttleScript caps a bucket at ARGV[3] tokens, unless it is negative,
+// and locks it for ARGV[4] microseconds.
+var throttleScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local remaining = tonumber(ARGV[3])
+local pause = tonumber(ARGV[4])
+local ttl = tonumber(ARGV[5])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'refilled', 'locked')
+local tokens = tonumber(state[1]) or limit
+local refilled = tonumber(state[2]) or now
+local locked = tonumber(state[3]) or 0
+if interval > 0 then
+	tokens = math.min(limit, tokens + (now - refilled) / interval)
+end
+
+if remaining >= 0 and tokens > remaining then
+	tokens = remaining
+end
+locked = math.max(locked, now + pause)
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'refilled', now, 'locked', locked)
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], math.max(ttl, math.ceil(pause / 1000) + ttl))
+end
+return 1
+`)
+
+type StoreConfig struct {
+	// Any go-redis client: *redis.Client, *redis.ClusterClient, *redis.Ring
+	// or a Sentinel client from redis.NewFailoverClient or
+	// redis.NewFailoverClusterClient. The scripts are loaded on first use
+	// and reloaded whenever a node answers that it doesn't know them, as
+	// a promoted replica or a new cluster node does.
+	CLIENT redis.UniversalClient
+	// Prepended to every Redis key. Defaults to "ratelimit:".
+	PREFIX string
+	// How long an untouched bucket is kept. Defaults to the time a bucket
+	// takes to refill completely, after which it is no different from a
+	// new one; shorter TTLs hand out tokens early. Buckets that never
+	// refill are kept for good.
+	TTL time.Duration
+	// Bounds each Redis call. Defaults to one second.
+	TIMEOUT time.Duration
+	// How long takes of a key are collected while another is in flight,
+	// to be sent together in one script call. Takes of a key with none in
+	// flight go straight to Redis, so only hot keys wait, and they cost
+	// about one call per window instead of one each. Zero sends every
+	// take on its own.
+	BATCH_WINDOW time.Duration
+	// Wraps the bucket key in a Redis Cluster hash tag, e.g.
+	// ratelimit:default:{203.0.113.7}, so every bucket of one key lands
+	// in the same slot and braces inside keys can't pick the slot instead.
+	HASH_TAG bool
+}
+
+// Store is a core.Store kept in Redis, so limits are shared across the
+// replicas of a service.
+type Store struct {
+	StoreConfig
+	prefix   string
+	limit    int64
+	interval time.Duration
+	// Keys with takes in flight, with BATCH_WINDOW.
+	hot map[string]*hotKey
+	mx  sync.Mutex
+}
+
+// hotKey is a key with takes in flight, and those collected to follow.
+type hotKey struct {
+	inFlight int
+	pending  *batch
+}
+
+// batch is takes of one key sent together.
+type batch struct {
+	ns      []int64
+	results []takeResult
+	err     error
+	done    chan struct{}
+}
+
+type takeResult struct {
+	allowed   bool
+	remaining int64
+	resetAt   time.Time
+}
+
+// maxBatch bounds the takes sent in one script call.
+const maxBatch = 1000
+
+// NewStore returns the store for one set of buckets, whose keys are put
+// under PREFIX + name + ":".
+func NewStore(config StoreConfig, name string, profile core.LimitProfile) *Store {
+	if config.PREFIX == "" {
+		config.PREFIX = "ratelimit:"
+	}
+	if config.TTL == 0 {
+		config.TTL = time.Duration(profile.RATE_LIMIT) * profile.REFILL_INTERVAL
+	}
+	if config.TIMEOUT == 0 {
+		config.TIMEOUT = time.Second
+	}
+
+	return &Store{
+		StoreConfig: config,
+		prefix:      config.PREFIX + name + ":",
+		limit:       profile.RATE_LIMIT,
+		interval:    profile.REFILL_INTERVAL,
+		hot:         map[string]*hotKey{},
+	}
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in Redis:
+//
+//	rateLimiter.SetConfig(core.RateLimiterConfig{
+//		...
+//		STORE: redisstore.Factory(redisstore.StoreConfig{CLIENT: client, PREFIX: "api:"}),
+//	})
+func Factory(config StoreConfig) core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return NewStore(config, name, profile)
+	}
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	if s.BATCH_WINDOW <= 0 {
+		return s.take(key, n)
+	}
+
+	s.mx.Lock()
+	k, ok := s.hot[key]
+	if !ok {
+		k = &hotKey{}
+		s.hot[key] = k
+	}
+	if k.inFlight == 0 {
+		k.inFlight++
+		s.mx.Unlock()
+		defer s.landed(key, k)
+		return s.take(key, n)
+	}
+
+	b := k.pending
+	leader := b == nil
+	if leader {
+		b = &batch{done: make(chan struct{})}
+		k.pending = b
+	}
+	i := len(b.ns)
+	b.ns = append(b.ns, n)
+	if len(b.ns) >= maxBatch {
+		k.pending = nil
+	}
+	s.mx.Unlock()
+
+	if leader {
+		s.send(key, k, b)
+	} else {
+		<-b.done
+	}
+	if b.err != nil {
+		return false, 0, time.Time{}, b.err
+	}
+	result := b.results[i]
+	return result.allowed, result.remaining, result.resetAt, nil
+}
+
+// take sends a take of n tokens on its own.
+func (s *Store) take(key string, n int64) (bool, int64, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	result, err := takeScript.Run(ctx, s.CLIENT, []string{s.redisKey(key)},
+		s.limit, s.interval.Microseconds(), n, s.ttl()).Int64Slice()
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	resetAt := time.Now().Add(time.Duration(result[2]) * time.Microsecond)
+	return result[0] == 1, result[1], resetAt, nil
+}
+
+// send sends batch b of key's takes once BATCH_WINDOW has passed and
+// fans the results out.
+func (s *Store) send(key string, k *hotKey, b *batch) {
+	time.Sleep(s.BATCH_WINDOW)
+
+	s.mx.Lock()
+	if k.pending == b {
+		k.pending = nil
+	}
+	k.inFlight++
+	s.mx.Unlock()
+	defer close(b.done)
+	defer s.landed(key, k)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	args := []interface{}{s.limit, s.interval.Microseconds(), s.ttl()}
+	for _, n := range b.ns {
+		args = append(args, n)
+	}
+	result, err := batchTakeScript.Run(ctx, s.CLIENT, []string{s.redisKey(key)}, args...).Int64Slice()
+	if err == nil && len(result) != 3*len(b.ns) {
+		err = fmt.Errorf("redisstore: batch of %d takes answered with %d results", len(b.ns), len(result))
+	}
+	if err != nil {
+		b.err = err
+		return
+	}
+	now := time.Now()
+	b.results = make([]takeResult, len(b.ns))
+	for i := range b.results {
+		b.results[i] = takeResult{
+			allowed:   result[3*i] == 1,
+			remaining: result[3*i+1],
+			resetAt:   now.Add(time.Duration(result[3*i+2]) * time.Microsecond),
+		}
+	}
+}
+
+// landed notes that a call for key returned, forgetting the key once
+// nothing is in flight or collected for it.
+func (s *Store) landed(key string, k *hotKey) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	k.inFlight--
+	if k.inFlight == 0 && k.pending == nil && s.hot[key] == k {
+		delete(s.hot, key)
+	}
+}
+
+// Borrow takes up to n tokens from key's bucket, as many as it holds, and
+// reports how many it got. next is when the bucket holds a token again.
+func (s *Store) Borrow(key string, n int64) (granted int64, next time.Time, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	result, err := borrowScript.Run(ctx, s.CLIENT, []string{s.redisKey(key)},
+		s.limit, s.interval.Microseconds(), n, s.ttl()).Int64Slice()
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return result[0], time.Now().Add(time.Duration(result[2]) * time.Microsecond), nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	return throttleScript.Run(ctx, s.CLIENT, []string{s.redisKey(key)},
+		s.limit, s.interval.Microseconds(), remaining, time.Until(until).Microseconds(), s.ttl()).Err()
+}
+
+func (s *Store) Reset(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.TIMEOUT)
+	defer cancel()
+
+	return s.CLIENT.Del(ctx, s.redisKey(key)).Err()
+}
+
+// ResetAll deletes every bucket of the store, scanning every master of a
+// cluster or shard of a ring for its keys. TIMEOUT bounds each batch of
+// keys rather than the whole scan, so large stores can be reset.
+func (s *Store) ResetAll() error {
+	return s.forEachNode(context.Background(), s.deleteBuckets)
+}
+
+// deleteBuckets deletes the store's keys on one node a scanned batch at a
+// time, each key on its own as they may lie in different cluster slots.
+func (s *Store) deleteBuckets(ctx context.Context, client redis.Cmdable) error {
+	pattern := globEscaper.Replace(s.prefix) + "*"
+	var cursor uint64
+	for {
+		batchCtx, cancel := context.WithTimeout(ctx, s.TIMEOUT)
+		keys, next, err := client.Scan(batchCtx, cursor, pattern, 1000).Result()
+		if err == nil && len(keys) > 0 {
+			_, err = client.Pipelined(batchCtx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					pipe.Del(batchCtx, key)
+				}
+				return nil
+			})
+		}
+		cancel()
+		if err != nil || next == 0 {
+			return err
+		}
+		cursor = next
+	}
+}
+
+// Export returns every bucket of the store, for core's ExportState,
+// scanning every master of a cluster or shard of a ring as ResetAll does.
+// Times are moved from the Redis server's clock to this process's.
+func (s *Store) Export() ([]core.BucketState, error) {
+	var buckets []core.BucketState
+	var mx sync.Mutex
+	err := s.forEachNode(context.Background(), func(ctx context.Context, node redis.Cmdable) error {
+		found, err := s.exportBuckets(ctx, node)
+		mx.Lock()
+		defer mx.Unlock()
+		buckets = append(buckets, found...)
+		return err
+	})
+	return buckets, err
+}
+
+// exportBuckets reads the store's buckets on one node a scanned batch at
+// a time.
+func (s *Store) exportBuckets(ctx context.Context, client redis.Cmdable) ([]core.BucketState, error) {
+	timeCtx, cancel := context.WithTimeout(ctx, s.TIMEOUT)
+	serverNow, err := client.Time(timeCtx).Result()
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+	// The server's clock is ahead of this process's by skew.
+	skew := serverNow.Sub(time.Now())
+	at := func(micros float64) time.Time {
+		return time.UnixMicro(int64(micros)).Add(-skew)
+	}
+
+	var buckets []core.BucketState
+	pattern := globEscaper.Replace(s.prefix) + "*"
+	var cursor uint64
+	for {
+		batchCtx, cancel := context.WithTimeout(ctx, s.TIMEOUT)
+		keys, next, err := client.Scan(batchCtx, cursor, pattern, 1000).Result()
+		var states []*redis.SliceCmd
+		if err == nil && len(keys) > 0 {
+			_, err = client.Pipelined(batchCtx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					states = append(states, pipe.HMGet(batchCtx, key, "tokens", "refilled", "locked"))
+				}
+				return nil
+			})
+		}
+		cancel()
+		if err != nil {
+			return buckets, err
+		}
+
+		for i, state := range states {
+			values := state.Val()
+			tokens, ok := redisFloat(values[0])
+			refilled, ok2 := redisFloat(values[1])
+			if !ok || !ok2 {
+				// Deleted or expired since the scan.
+				continue
+			}
+			bucket := core.BucketState{Key: s.bucketKey(keys[i]), Tokens: tokens, Refilled: at(refilled)}
+			if locked, ok := redisFloat(values[2]); ok && locked > 0 {
+				bucket.LockedUntil = at(locked)
+			}
+			buckets = append(buckets, bucket)
+		}
+		if next == 0 {
+			return buckets, nil
+		}
+		cursor = next
+	}
+}
+
+// redisFloat parses a hash field HMGET returned, nil if missing.
+func redisFloat(value interface{}) (float64, bool) {
+	text, ok := value.(string)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	return f, err == nil
+}
+
+// globEscaper escapes the characters SCAN's MATCH would read as a pattern,
+// so prefixes and names holding them match only themselves.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
+
+// Ping checks that every master of a cluster, every shard of a ring or
+// the single server answers, for readiness probes and health checks.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.forEachNode(ctx, func(ctx context.Context, node redis.Cmdable) error {
+		return node.Ping(ctx).Err()
+	})
+}
+
+// forEachNode calls fn for every node holding part of the keyspace.
+func (s *Store) forEachNode(ctx context.Context, fn func(ctx context.Context, node redis.Cmdable) error) error {
+	each := func(ctx context.Context, node *redis.Client) error {
+		return fn(ctx, node)
+	}
+	switch client := s.CLIENT.(type) {
+	case *redis.ClusterClient:
+		return client.ForEachMaster(ctx, each)
+	case *redis.Ring:
+		return client.ForEachShard(ctx, each)
+	}
+	return fn(ctx, s.CLIENT)
+}
+
+func (s *Store) redisKey(key string) string {
+	if s.HASH_TAG {
+		return s.prefix + "{" + key + "}"
+	}
+	return s.prefix + key
+}
+
+// bucketKey is the key whose bucket is kept under redisKey.
+func (s *Store) bucketKey(redisKey string) string {
+	key := strings.TrimPrefix(redisKey, s.prefix)
+	if s.HASH_TAG {
+		key = strings.TrimSuffix(strings.TrimPrefix(key, "{"), "}")
+	}
+	return key
+}
+
+// ttl is the key expiry in whole milliseconds, zero for none.
+func (s *Store) ttl() int64 {
+	if s.TTL <= 0 {
+		return 0
+	}
+	return int64((s.TTL + time.Millisecond - 1) / time.Millisecond)
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+	_ core.ExportableStore = (*Store)(nil)
+)
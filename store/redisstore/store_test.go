@@ -0,0 +1,366 @@
+package redisstore
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// testClient connects to the Redis server at REDIS_ADDR or else to an
+// in-process miniredis. The tests use keys under "ratelimit-test:".
+func testClient(t *testing.T) redis.UniversalClient {
+	t.Helper()
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = miniredis.RunT(t).Addr()
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestGlobEscaper(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: "ratelimit:default:", want: "ratelimit:default:"},
+		{prefix: "api*:", want: `api\*:`},
+		{prefix: "a?b:", want: `a\?b:`},
+		{prefix: "[v1]:", want: `\[v1\]:`},
+		{prefix: `back\slash:`, want: `back\\slash:`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.prefix, func(t *testing.T) {
+			if got := globEscaper.Replace(test.prefix); got != test.want {
+				t.Fatalf("escaped %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResetAllMatchesPrefixLiterally(t *testing.T) {
+	client := testClient(t)
+	profile := core.LimitProfile{RATE_LIMIT: 2, REFILL_INTERVAL: time.Hour}
+	wild := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:*:"}, "default", profile)
+	other := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:x:"}, "default", profile)
+	t.Cleanup(func() {
+		wild.ResetAll()
+		other.ResetAll()
+	})
+
+	for _, store := range []*Store{wild, other} {
+		if _, _, _, err := store.Take("client", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wild.ResetAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if n, _ := client.Exists(ctx, wild.redisKey("client")).Result(); n != 0 {
+		t.Fatal("ResetAll kept the store's own bucket")
+	}
+	if n, _ := client.Exists(ctx, other.redisKey("client")).Result(); n != 1 {
+		t.Fatal("ResetAll deleted a bucket of another prefix")
+	}
+}
+
+func TestStoreTake(t *testing.T) {
+	tests := []struct {
+		name          string
+		takes         []int64
+		wantAllowed   bool
+		wantRemaining int64
+	}{
+		{name: "within the limit", takes: []int64{1, 1}, wantAllowed: true, wantRemaining: 1},
+		{name: "beyond the limit", takes: []int64{2, 1, 1}, wantAllowed: false, wantRemaining: 0},
+		{name: "more than the bucket holds", takes: []int64{4}, wantAllowed: false, wantRemaining: 3},
+		{name: "refund", takes: []int64{3, -2}, wantAllowed: true, wantRemaining: 2},
+		{name: "refund caps at the limit", takes: []int64{1, -5}, wantAllowed: true, wantRemaining: 3},
+	}
+
+	client := testClient(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:"}, t.Name(),
+				core.LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour})
+			t.Cleanup(func() { store.ResetAll() })
+
+			var allowed bool
+			var remaining int64
+			for _, n := range test.takes {
+				var err error
+				if allowed, remaining, _, err = store.Take("client", n); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if allowed != test.wantAllowed || remaining != test.wantRemaining {
+				t.Fatalf("last take (%v, %d), want (%v, %d)", allowed, remaining, test.wantAllowed, test.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestBatchTake(t *testing.T) {
+	tests := []struct {
+		name        string
+		takes       []int64
+		wantAllowed []bool
+		wantTokens  []int64
+	}{
+		{name: "within the limit", takes: []int64{1, 1}, wantAllowed: []bool{true, true}, wantTokens: []int64{2, 1}},
+		{name: "beyond the limit", takes: []int64{2, 1, 1}, wantAllowed: []bool{true, true, false}, wantTokens: []int64{1, 0, 0}},
+		{name: "later smaller takes fit", takes: []int64{2, 2, 1}, wantAllowed: []bool{true, false, true}, wantTokens: []int64{1, 1, 0}},
+		{name: "refund", takes: []int64{3, -2, 2}, wantAllowed: []bool{true, true, true}, wantTokens: []int64{0, 2, 0}},
+	}
+
+	client := testClient(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:"}, t.Name(),
+				core.LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour})
+			t.Cleanup(func() { store.ResetAll() })
+
+			b := &batch{ns: test.takes, done: make(chan struct{})}
+			store.send("client", &hotKey{}, b)
+			if b.err != nil {
+				t.Fatal(b.err)
+			}
+			for i, result := range b.results {
+				if result.allowed != test.wantAllowed[i] || result.remaining != test.wantTokens[i] {
+					t.Fatalf("take %d of %d = (%v, %d), want (%v, %d)", i, test.takes[i],
+						result.allowed, result.remaining, test.wantAllowed[i], test.wantTokens[i])
+				}
+			}
+		})
+	}
+}
+
+// scriptCounter counts the script calls of a client.
+type scriptCounter struct {
+	calls atomic.Int64
+}
+
+func (c *scriptCounter) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (c *scriptCounter) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if name := cmd.Name(); name == "evalsha" || name == "eval" {
+			c.calls.Add(1)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (c *scriptCounter) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestStoreBatchesHotKeys(t *testing.T) {
+	client := testClient(t)
+	counter := &scriptCounter{}
+	client.AddHook(counter)
+	store := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:", BATCH_WINDOW: 20 * time.Millisecond}, "hot",
+		core.LimitProfile{RATE_LIMIT: 10, REFILL_INTERVAL: time.Hour})
+	t.Cleanup(func() { store.ResetAll() })
+
+	start := make(chan struct{})
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			ok, _, _, err := store.Take("client", 1)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if allowed.Load() != 10 {
+		t.Fatalf("allowed %d of 50 takes, want 10", allowed.Load())
+	}
+	// A take on its own and a batch, each an EVALSHA and an EVAL the
+	// first time, with room for stragglers.
+	if calls := counter.calls.Load(); calls > 6 {
+		t.Fatalf("%d script calls for 50 takes, want them batched", calls)
+	}
+	if len(store.hot) != 0 {
+		t.Fatalf("%d hot keys left once every take returned", len(store.hot))
+	}
+}
+
+func TestStoreLocked(t *testing.T) {
+	tests := []struct {
+		name          string
+		take          int64
+		wantAllowed   bool
+		wantRemaining int64
+	}{
+		{name: "take", take: 1, wantAllowed: false, wantRemaining: 0},
+		{name: "refund", take: -2, wantAllowed: true, wantRemaining: 3},
+	}
+
+	client := testClient(t)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:", HASH_TAG: true}, t.Name(),
+				core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour})
+			t.Cleanup(func() { store.ResetAll() })
+
+			if err := store.Throttle("client", 1, time.Now().Add(time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+			allowed, remaining, _, err := store.Take("client", test.take)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if allowed != test.wantAllowed || remaining != test.wantRemaining {
+				t.Fatalf("take (%v, %d), want (%v, %d)", allowed, remaining, test.wantAllowed, test.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestStoreExport(t *testing.T) {
+	client := testClient(t)
+	for _, hashTag := range []bool{false, true} {
+		t.Run(fmt.Sprint("hash tag ", hashTag), func(t *testing.T) {
+			store := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:", HASH_TAG: hashTag}, t.Name(),
+				core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour})
+			t.Cleanup(func() { store.ResetAll() })
+
+			store.Take("alice", 2)
+			until := time.Now().Add(time.Hour)
+			store.Throttle("bob", 1, until)
+			buckets, err := store.Export()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := map[string]core.BucketState{}
+			for _, bucket := range buckets {
+				got[bucket.Key] = bucket
+			}
+			alice, bob := got["alice"], got["bob"]
+			if len(got) != 2 || int(alice.Tokens) != 3 || !alice.LockedUntil.IsZero() {
+				t.Fatalf("exported %+v", buckets)
+			}
+			if int(bob.Tokens) != 1 || bob.LockedUntil.Sub(until).Abs() > time.Second {
+				t.Fatalf("bob exported as %+v, want locked until %v", bob, until)
+			}
+		})
+	}
+}
+
+// Moving a limiter's state from Redis to memory keeps its quotas and locks.
+func TestStoreExportToMemory(t *testing.T) {
+	client := testClient(t)
+	config := core.RateLimiterConfig{
+		RATE_LIMIT:      3,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	}
+	decide := func(limiter core.RateLimiter, client string) core.Decision {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-Client", client)
+		return limiter.Decide(r)
+	}
+
+	redisConfig := config
+	redisConfig.STORE = Factory(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:migrate:"})
+	before := core.New()
+	before.SetConfig(redisConfig)
+	t.Cleanup(before.ResetAll)
+	decide(before, "alice")
+	before.ThrottleKey("bob", -1, time.Hour)
+
+	state, err := before.ExportState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := core.New()
+	after.SetConfig(config)
+	if err := after.ImportState(state); err != nil {
+		t.Fatal(err)
+	}
+	if d := decide(after, "alice"); !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("alice allowed %v with %d left, want 1", d.Allowed, d.Remaining)
+	}
+	if d := decide(after, "bob"); d.Allowed {
+		t.Fatal("bob's lock was lost")
+	}
+}
+
+func TestStorePing(t *testing.T) {
+	store := NewStore(StoreConfig{CLIENT: testClient(t)}, "default", core.LimitProfile{RATE_LIMIT: 1, REFILL_INTERVAL: time.Second})
+	if err := store.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// After a failover the new master doesn't know the scripts yet.
+func TestStoreReloadsScripts(t *testing.T) {
+	client := testClient(t)
+	store := NewStore(StoreConfig{CLIENT: client, PREFIX: "ratelimit-test:"}, t.Name(),
+		core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour})
+	t.Cleanup(func() { store.ResetAll() })
+
+	if _, _, _, err := store.Take("client", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ScriptFlush(context.Background()).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if allowed, remaining, _, err := store.Take("client", 1); err != nil || !allowed || remaining != 3 {
+		t.Fatalf("take after SCRIPT FLUSH = (%v, %d, %v), want (true, 3, nil)", allowed, remaining, err)
+	}
+}
+
+func TestRegionBalancer(t *testing.T) {
+	client := testClient(t)
+	balancer := &RegionBalancer{CLIENT: client, KEY: "ratelimit-test:regions", STALE_AFTER: time.Minute}
+	t.Cleanup(func() { client.Del(context.Background(), balancer.KEY) })
+	stale := fmt.Sprint(7, " ", time.Now().Add(-time.Hour).UnixMilli())
+	client.HSet(context.Background(), balancer.KEY, "ap", stale)
+
+	steps := []struct {
+		region string
+		demand float64
+		want   map[string]float64
+	}{
+		{region: "us", demand: 10, want: map[string]float64{"us": 10}},
+		{region: "eu", demand: 2.5, want: map[string]float64{"us": 10, "eu": 2.5}},
+		{region: "us", demand: 0, want: map[string]float64{"us": 0, "eu": 2.5}},
+	}
+	for _, step := range steps {
+		got, err := balancer.Exchange(step.region, step.demand)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(got, step.want) {
+			t.Fatalf("%s published %v and got %v, want %v", step.region, step.demand, got, step.want)
+		}
+	}
+}
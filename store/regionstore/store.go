@@ -0,0 +1,237 @@
+package regionstore
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+// Balancer shares the regions' demand, e.g. through a global Redis reached
+// once per rebalance rather than on every request.
+type Balancer interface {
+	// Exchange publishes region's demand, in tokens asked for per second,
+	// and returns the latest demand every region published, region's
+	// included.
+	Exchange(region string, demand float64) (map[string]float64, error)
+}
+
+type Config struct {
+	// This deployment's region, e.g. "eu-west".
+	REGION string
+	// Weight of each region's share of every limit, e.g.
+	// {"us-east": 2, "eu-west": 1}. Regions left out only get a share by
+	// demand, and at least one token.
+	WEIGHTS map[string]float64
+	// Keeps this region's buckets, e.g. redisstore.Factory with a Redis in
+	// the region. Set names are prefixed with REGION and ":", so regions
+	// can share one store too.
+	LOCAL core.StoreFactory
+	// Rebalances the shares by the regions' demand. Nil keeps WEIGHTS.
+	BALANCER Balancer
+	// How often the shares are rebalanced. Defaults to one minute.
+	REBALANCE_INTERVAL time.Duration
+	// Fraction of every limit split by WEIGHTS whatever the demand, so
+	// quiet regions keep some quota for when traffic moves. The rest is
+	// split by demand. Defaults to 0.2; negative splits it all by demand.
+	FLOOR float64
+	// Called when a rebalance fails, after which the shares are kept.
+	ON_ERROR func(err error)
+}
+
+// Regions splits every limit of a global quota between the regions of a
+// deployment, so each enforces its share against a store close by instead
+// of a single global one far away. A region's share of a limit of L tokens
+// refilled one every interval is L*share tokens refilled share times as
+// fast. Shares follow WEIGHTS, and with a BALANCER, every
+// REBALANCE_INTERVAL, the demand each region saw; the regions together
+// admit the global limit, give or take rounding, once they have all
+// rebalanced on the same demand.
+type Regions struct {
+	Config
+	share  atomic.Uint64
+	demand atomic.Int64
+	stores []*Store
+	mx     sync.Mutex
+	done   chan struct{}
+}
+
+// New starts rebalancing the region's share if BALANCER is set.
+func New(config Config) *Regions {
+	if config.LOCAL == nil {
+		config.LOCAL = func(name string, profile core.LimitProfile) core.Store {
+			return core.NewMemoryStore(profile)
+		}
+	}
+	if config.REBALANCE_INTERVAL == 0 {
+		config.REBALANCE_INTERVAL = time.Minute
+	}
+	if config.FLOOR == 0 {
+		config.FLOOR = 0.2
+	}
+
+	r := &Regions{Config: config, done: make(chan struct{})}
+	r.share.Store(math.Float64bits(r.shareOf(nil)))
+	if config.BALANCER != nil {
+		go r.rebalance()
+	}
+	return r
+}
+
+// Factory returns a core.StoreFactory keeping this region's share of
+// every set of a limiter's buckets in LOCAL.
+func (r *Regions) Factory() core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		s := &Store{regions: r, name: r.REGION + ":" + name, profile: profile}
+		s.resize(r.Share())
+
+		r.mx.Lock()
+		r.stores = append(r.stores, s)
+		r.mx.Unlock()
+		return s
+	}
+}
+
+// Share returns the fraction of every limit this region enforces.
+func (r *Regions) Share() float64 {
+	return math.Float64frombits(r.share.Load())
+}
+
+// Close stops rebalancing.
+func (r *Regions) Close() {
+	close(r.done)
+}
+
+// shareOf returns the region's share given the regions' demand, by
+// WEIGHTS alone if none was seen.
+func (r *Regions) shareOf(demand map[string]float64) float64 {
+	var weights, total float64
+	for region, weight := range r.WEIGHTS {
+		weights += weight
+		total += demand[region]
+	}
+	if weights <= 0 {
+		return 1
+	}
+	static := r.WEIGHTS[r.REGION] / weights
+	if total <= 0 {
+		return static
+	}
+	floor := min(max(r.FLOOR, 0), 1)
+	return floor*static + (1-floor)*demand[r.REGION]/total
+}
+
+// rebalance exchanges the region's demand and resizes its share every
+// REBALANCE_INTERVAL until closed.
+func (r *Regions) rebalance() {
+	ticker := time.NewTicker(r.REBALANCE_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+
+		demand := float64(r.demand.Swap(0)) / r.REBALANCE_INTERVAL.Seconds()
+		demands, err := r.BALANCER.Exchange(r.REGION, demand)
+		if err != nil {
+			if r.ON_ERROR != nil {
+				r.ON_ERROR(err)
+			}
+			continue
+		}
+		share := r.shareOf(demands)
+		r.share.Store(math.Float64bits(share))
+
+		r.mx.Lock()
+		stores := append([]*Store(nil), r.stores...)
+		r.mx.Unlock()
+		for _, s := range stores {
+			s.resize(share)
+		}
+	}
+}
+
+// Store is the region's share of one set of buckets.
+type Store struct {
+	regions *Regions
+	name    string
+	profile core.LimitProfile
+	local   core.Store
+	limit   int64
+	mx      sync.Mutex
+}
+
+// resize makes the store enforce share of its limit. Resizing replaces the
+// local store, so buckets kept in the process start over, while those kept
+// in a store like Redis carry over, capped at the new limit.
+func (s *Store) resize(share float64) {
+	profile := s.profile
+	if share < 1 {
+		profile.RATE_LIMIT = max(int64(math.Round(float64(s.profile.RATE_LIMIT)*share)), 1)
+		if share > 0 {
+			profile.REFILL_INTERVAL = time.Duration(float64(s.profile.REFILL_INTERVAL) / share)
+		}
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.local != nil && profile.RATE_LIMIT == s.limit {
+		return
+	}
+	s.local = s.regions.LOCAL(s.name, profile)
+	s.limit = profile.RATE_LIMIT
+}
+
+func (s *Store) current() core.Store {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.local
+}
+
+// Limit returns the tokens of the limit this region enforces.
+func (s *Store) Limit() int64 {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.limit
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	if n > 0 {
+		s.regions.demand.Add(n)
+	}
+	return s.current().Take(key, n)
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	if store, ok := s.current().(core.ThrottlingStore); ok {
+		return store.Throttle(key, remaining, until)
+	}
+	return nil
+}
+
+func (s *Store) Reset(key string) error {
+	if store, ok := s.current().(core.ResettableStore); ok {
+		return store.Reset(key)
+	}
+	return nil
+}
+
+func (s *Store) ResetAll() error {
+	if store, ok := s.current().(core.ResettableStore); ok {
+		return store.ResetAll()
+	}
+	return nil
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
@@ -0,0 +1,120 @@
+package regionstore
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func TestShare(t *testing.T) {
+	tests := []struct {
+		name    string
+		region  string
+		weights map[string]float64
+		floor   float64
+		demand  map[string]float64
+		want    float64
+	}{
+		{name: "no weights", region: "eu", want: 1},
+		{name: "by weight", region: "eu", weights: map[string]float64{"us": 3, "eu": 1}, want: 0.25},
+		{name: "left out", region: "ap", weights: map[string]float64{"us": 3, "eu": 1}, want: 0},
+		{name: "no demand yet", region: "eu", weights: map[string]float64{"us": 1, "eu": 1}, demand: map[string]float64{}, want: 0.5},
+		{name: "by demand above the floor", region: "eu", weights: map[string]float64{"us": 1, "eu": 1}, floor: 0.2,
+			demand: map[string]float64{"us": 10, "eu": 30}, want: 0.2*0.5 + 0.8*0.75},
+		{name: "unknown regions' demand ignored", region: "eu", weights: map[string]float64{"us": 1, "eu": 1}, floor: 0.2,
+			demand: map[string]float64{"us": 10, "eu": 10, "ap": 100}, want: 0.5},
+		{name: "all by demand", region: "us", weights: map[string]float64{"us": 1, "eu": 1}, floor: -1,
+			demand: map[string]float64{"us": 0, "eu": 10}, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			regions := New(Config{REGION: test.region, WEIGHTS: test.weights, FLOOR: test.floor})
+			if got := regions.shareOf(test.demand); math.Abs(got-test.want) > 1e-9 {
+				t.Fatalf("share %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStoreEnforcesShare(t *testing.T) {
+	var profiles []core.LimitProfile
+	regions := New(Config{
+		REGION:  "eu",
+		WEIGHTS: map[string]float64{"us": 3, "eu": 1},
+		LOCAL: func(name string, profile core.LimitProfile) core.Store {
+			if name != "eu:default" {
+				t.Errorf("local store named %q, want it prefixed with the region", name)
+			}
+			profiles = append(profiles, profile)
+			return core.NewMemoryStore(profile)
+		},
+	})
+	store := regions.Factory()("default", core.LimitProfile{RATE_LIMIT: 100, REFILL_INTERVAL: time.Second})
+
+	want := core.LimitProfile{RATE_LIMIT: 25, REFILL_INTERVAL: 4 * time.Second}
+	if len(profiles) != 1 || profiles[0] != want {
+		t.Fatalf("local profiles %v, want [%v]", profiles, want)
+	}
+	for i := 0; i < 25; i++ {
+		if allowed, _, _, _ := store.Take("client", 1); !allowed {
+			t.Fatalf("take %d of the region's 25 rejected", i)
+		}
+	}
+	if allowed, _, _, _ := store.Take("client", 1); allowed {
+		t.Fatal("take beyond the region's share allowed")
+	}
+}
+
+// fakeBalancer reports fixed demand for the other regions and records
+// what it is sent.
+type fakeBalancer struct {
+	others map[string]float64
+	sent   []float64
+	mx     sync.Mutex
+}
+
+func (b *fakeBalancer) Exchange(region string, demand float64) (map[string]float64, error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	b.sent = append(b.sent, demand)
+	demands := map[string]float64{region: demand}
+	for other, d := range b.others {
+		demands[other] = d
+	}
+	return demands, nil
+}
+
+func TestRebalance(t *testing.T) {
+	balancer := &fakeBalancer{others: map[string]float64{"us": 0}}
+	regions := New(Config{
+		REGION:             "eu",
+		WEIGHTS:            map[string]float64{"us": 1, "eu": 1},
+		BALANCER:           balancer,
+		REBALANCE_INTERVAL: 20 * time.Millisecond,
+		FLOOR:              0.5,
+	})
+	defer regions.Close()
+	store := regions.Factory()("default", core.LimitProfile{RATE_LIMIT: 100, REFILL_INTERVAL: time.Second}).(*Store)
+	if limit := store.Limit(); limit != 50 {
+		t.Fatalf("limit %d before rebalancing, want 50", limit)
+	}
+
+	store.Take("client", 10)
+	for deadline := time.Now().Add(time.Second); store.Limit() == 50 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Half by weight, the other half all to the only region asking.
+	if limit := store.Limit(); limit != 75 {
+		t.Fatalf("limit %d after rebalancing, want 75", limit)
+	}
+	balancer.mx.Lock()
+	defer balancer.mx.Unlock()
+	if len(balancer.sent) == 0 || balancer.sent[0] != 10/0.02 {
+		t.Fatalf("published demand %v, want 500 tokens a second first", balancer.sent)
+	}
+}
@@ -0,0 +1,533 @@
+// Package ringstore shares buckets between the instances of a service
+// peer to peer, with no datastore.
+//
+// Members serve their buckets to each other over plain HTTP, which takes
+// and resets any bucket for whoever can reach it. Keep the addresses
+// members bind to on a private network, set SECRET so calls from outside
+// the cluster are refused, and set MEMBERLIST.SecretKey to encrypt the
+// gossip. Without MEMBERLIST, a member only binds to the loopback address.
+package ringstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+	"github.com/hashicorp/memberlist"
+)
+
+type ClusterConfig struct {
+	// Configuration of this member, e.g. memberlist.DefaultLANConfig()
+	// with a unique Name and the BindAddr and BindPort to listen on. Its
+	// Delegate is set by NewCluster. Defaults to memberlist.DefaultLANConfig()
+	// bound to 127.0.0.1, so only members on this host can join.
+	MEMBERLIST *memberlist.Config
+	// Addresses of members to join, "host:port". Empty starts a new
+	// cluster.
+	PEERS []string
+	// Address the buckets this member owns are served on to the others,
+	// "host:port". They reach it at the address memberlist advertises, on
+	// this port. Defaults to the memberlist BindAddr and any free port.
+	LISTEN string
+	// How many other members keep a copy of each bucket, to carry on from
+	// when its owner leaves or fails. Defaults to 1; negative keeps none.
+	REPLICAS int
+	// How often owners send the buckets they changed to their replicas.
+	// Defaults to 100 milliseconds.
+	SYNC_INTERVAL time.Duration
+	// Bounds each call to another member. Defaults to one second.
+	TIMEOUT time.Duration
+	// Shared by every member and sent with each call to another, which
+	// refuses calls without it. Empty accepts calls from anyone who can
+	// reach LISTEN.
+	SECRET string
+}
+
+// Cluster shares rate limits between the instances of a service peer to
+// peer, like an embedded distributed cache, with no datastore. Every
+// bucket is owned by one member, picked by rendezvous hashing over the
+// live members, which admits all of its requests; the others forward
+// theirs to it over HTTP, so limits are exact while membership is stable.
+// Every SYNC_INTERVAL owners copy the buckets they changed to the next
+// REPLICAS members of the key's ring, so the member taking over a key when
+// its owner leaves or fails carries on from a copy at most that old. Keys
+// a joining member takes over that weren't changed since start from full
+// buckets.
+type Cluster struct {
+	ClusterConfig
+	members *memberlist.Memberlist
+	server  *http.Server
+	port    string
+	client  *http.Client
+	sets    map[string]*set
+	// Keys changed here per set since the last sync.
+	dirty     map[string]map[string]bool
+	lastSweep time.Time
+	mx        sync.Mutex
+	done      chan struct{}
+}
+
+// set is one set of buckets held by a member, with the limit it was last
+// sent.
+type set struct {
+	limit    int64
+	interval time.Duration
+	buckets  map[string]*bucket.State
+}
+
+// request is what a member sends the owner of a key, or the replicas of
+// the buckets it changed. Times are durations from now, so the members'
+// clocks don't matter.
+type request struct {
+	Set       string             `json:"set"`
+	Key       string             `json:"key,omitempty"`
+	Limit     int64              `json:"limit"`
+	Interval  time.Duration      `json:"interval"`
+	N         int64              `json:"n,omitempty"`
+	Remaining int64              `json:"remaining,omitempty"`
+	Pause     time.Duration      `json:"pause,omitempty"`
+	Copies    map[string]replica `json:"copies,omitempty"`
+}
+
+type response struct {
+	Allowed   bool          `json:"allowed,omitempty"`
+	Remaining int64         `json:"remaining,omitempty"`
+	Wait      time.Duration `json:"wait,omitempty"`
+}
+
+// replica is a copy of a bucket, or word that it was reset.
+type replica struct {
+	Tokens  float64       `json:"tokens"`
+	Locked  time.Duration `json:"locked,omitempty"`
+	Deleted bool          `json:"deleted,omitempty"`
+}
+
+// NewCluster starts serving this member's buckets and joins PEERS.
+func NewCluster(config ClusterConfig) (*Cluster, error) {
+	if config.MEMBERLIST == nil {
+		config.MEMBERLIST = memberlist.DefaultLANConfig()
+		config.MEMBERLIST.BindAddr = "127.0.0.1"
+	}
+	if config.LISTEN == "" {
+		config.LISTEN = net.JoinHostPort(config.MEMBERLIST.BindAddr, "0")
+	}
+	if config.REPLICAS == 0 {
+		config.REPLICAS = 1
+	}
+	if config.SYNC_INTERVAL == 0 {
+		config.SYNC_INTERVAL = 100 * time.Millisecond
+	}
+	if config.TIMEOUT == 0 {
+		config.TIMEOUT = time.Second
+	}
+
+	listener, err := net.Listen("tcp", config.LISTEN)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cluster{
+		ClusterConfig: config,
+		client:        &http.Client{Timeout: config.TIMEOUT},
+		sets:          map[string]*set{},
+		dirty:         map[string]map[string]bool{},
+		lastSweep:     time.Now(),
+		done:          make(chan struct{}),
+	}
+	_, c.port, _ = net.SplitHostPort(listener.Addr().String())
+	c.server = &http.Server{Handler: http.HandlerFunc(c.serveHTTP)}
+	go c.server.Serve(listener)
+
+	config.MEMBERLIST.Delegate = c
+	members, err := memberlist.Create(config.MEMBERLIST)
+	if err != nil {
+		c.server.Close()
+		return nil, err
+	}
+	c.members = members
+	if len(config.PEERS) > 0 {
+		if _, err := members.Join(config.PEERS); err != nil {
+			members.Shutdown()
+			c.server.Close()
+			return nil, err
+		}
+	}
+
+	go c.sync()
+	return c, nil
+}
+
+// Factory returns a core.StoreFactory keeping every set of a limiter's
+// buckets in the cluster. Limiters sharing a cluster must give their sets
+// distinct names.
+func (c *Cluster) Factory() core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return &Store{cluster: c, name: name, limit: profile.RATE_LIMIT, interval: profile.REFILL_INTERVAL}
+	}
+}
+
+// Members returns the number of members this one knows to be alive,
+// itself included.
+func (c *Cluster) Members() int {
+	return c.members.NumMembers()
+}
+
+// Close hands the buckets this member owns to the members taking them
+// over, leaves the cluster, waiting up to timeout for the other members to
+// learn of it, and stops this member.
+func (c *Cluster) Close(timeout time.Duration) error {
+	close(c.done)
+
+	c.mx.Lock()
+	for name, s := range c.sets {
+		for key := range s.buckets {
+			c.markDirty(name, key)
+		}
+	}
+	c.mx.Unlock()
+	c.flush(true)
+
+	err := c.members.Leave(timeout)
+	if err == nil {
+		err = c.members.Shutdown()
+	}
+	return errors.Join(err, c.server.Close())
+}
+
+// ring returns the members ranked for key of set, its owner first and
+// its replicas next, leaving this one out if leaving.
+func (c *Cluster) ring(name, key string, leaving bool) []*memberlist.Node {
+	local := c.members.LocalNode().Name
+	nodes := c.members.Members()
+	scores := make(map[string]uint64, len(nodes))
+	ranked := nodes[:0]
+	for _, node := range nodes {
+		if leaving && node.Name == local {
+			continue
+		}
+		scores[node.Name] = score(node.Name, name, key)
+		ranked = append(ranked, node)
+	}
+	sort.Slice(ranked, func(i, j int) bool { return scores[ranked[i].Name] > scores[ranked[j].Name] })
+	return ranked
+}
+
+// score is the rendezvous hash of a member for key of set.
+func score(member, name, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(member))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	// FNV spreads similar inputs poorly; a finalizer evens the ranking
+	// out.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+// call sends req to the owner of its key, or handles it here if this
+// member owns it.
+func (c *Cluster) call(path string, req request) (response, error) {
+	ring := c.ring(req.Set, req.Key, false)
+	if len(ring) == 0 || ring[0].Name == c.members.LocalNode().Name {
+		return c.handle(path, req), nil
+	}
+	return c.send(ring[0], path, req)
+}
+
+// send posts req to node's path.
+func (c *Cluster) send(node *memberlist.Node, path string, req request) (response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.TIMEOUT)
+	defer cancel()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+	url := "http://" + net.JoinHostPort(node.Addr.String(), string(node.Meta)) + path
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.SECRET != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.SECRET)
+	}
+
+	httpResp, err := c.client.Do(httpReq)
+	if err != nil {
+		return response{}, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return response{}, fmt.Errorf("ringstore: member %s answered %s", node.Name, httpResp.Status)
+	}
+
+	var resp response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return response{}, fmt.Errorf("ringstore: %w", err)
+	}
+	return resp, nil
+}
+
+// resetAll drops every bucket of set on every member.
+func (c *Cluster) resetAll(req request) error {
+	c.handle("/reset-all", req)
+
+	local := c.members.LocalNode().Name
+	var errs []error
+	for _, node := range c.members.Members() {
+		if node.Name != local {
+			if _, err := c.send(node, "/reset-all", req); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cluster) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if c.SECRET != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+c.SECRET)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/take", "/throttle", "/reset", "/reset-all", "/replicate":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c.handle(r.URL.Path, req))
+}
+
+// handle applies req to the buckets held here.
+func (c *Cluster) handle(path string, req request) response {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	s := c.set(req)
+	switch path {
+	case "/take":
+		allowed, remaining, resetAt := bucket.Get(s.buckets, req.Key, s.limit, s.interval, now).Take(s.limit, s.interval, req.N, now)
+		if allowed && req.N != 0 {
+			c.markDirty(req.Set, req.Key)
+		}
+		return response{Allowed: allowed, Remaining: remaining, Wait: resetAt.Sub(now)}
+	case "/throttle":
+		bucket.Get(s.buckets, req.Key, s.limit, s.interval, now).Throttle(req.Remaining, now.Add(req.Pause))
+		c.markDirty(req.Set, req.Key)
+	case "/reset":
+		delete(s.buckets, req.Key)
+		c.markDirty(req.Set, req.Key)
+	case "/reset-all":
+		delete(c.sets, req.Set)
+		delete(c.dirty, req.Set)
+	case "/replicate":
+		c.replicate(s, req, now)
+	}
+	return response{}
+}
+
+// replicate keeps the copies another member sent. A key this member owns
+// keeps its own bucket, which is newer than any copy of it.
+// The caller must hold c.mx.
+func (c *Cluster) replicate(s *set, req request, now time.Time) {
+	local := c.members.LocalNode().Name
+	for key, state := range req.Copies {
+		if _, ok := s.buckets[key]; ok && c.ring(req.Set, key, false)[0].Name == local {
+			continue
+		}
+		if state.Deleted {
+			delete(s.buckets, key)
+			continue
+		}
+		s.buckets[key] = &bucket.State{Tokens: state.Tokens, Refilled: now.UnixNano(), Locked: now.Add(state.Locked).UnixNano()}
+	}
+}
+
+// set returns the set req is about, taking on the limit it was sent with.
+// The caller must hold c.mx.
+func (c *Cluster) set(req request) *set {
+	s, ok := c.sets[req.Set]
+	if !ok {
+		s = &set{buckets: map[string]*bucket.State{}}
+		c.sets[req.Set] = s
+	}
+	s.limit = req.Limit
+	s.interval = req.Interval
+	return s
+}
+
+// markDirty notes that key of set changed here. The caller must hold c.mx.
+func (c *Cluster) markDirty(name, key string) {
+	if c.dirty[name] == nil {
+		c.dirty[name] = map[string]bool{}
+	}
+	c.dirty[name][key] = true
+}
+
+// sync sends the buckets changed here to their replicas each
+// SYNC_INTERVAL until the cluster is closed.
+func (c *Cluster) sync() {
+	ticker := time.NewTicker(c.SYNC_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		c.flush(false)
+	}
+}
+
+// flush sends the buckets changed here since the last sync to the other
+// members of their rings, those that will own them once this one is gone
+// if leaving. Members it can't reach miss them, which only loses what a
+// failover would carry on from.
+func (c *Cluster) flush(leaving bool) {
+	c.mx.Lock()
+	now := time.Now()
+	c.sweep(now)
+
+	local := c.members.LocalNode().Name
+	batches := map[string]map[string]*request{}
+	nodes := map[string]*memberlist.Node{}
+	for name, keys := range c.dirty {
+		s := c.sets[name]
+		for key := range keys {
+			state := replica{Deleted: true}
+			if b, ok := s.buckets[key]; ok {
+				b.Refill(s.limit, s.interval, now)
+				state = replica{Tokens: b.Tokens, Locked: max(time.Unix(0, b.Locked).Sub(now), 0)}
+			}
+
+			ring := c.ring(name, key, leaving)
+			for _, node := range ring[:min(len(ring), 1+max(c.REPLICAS, 0))] {
+				if node.Name == local {
+					continue
+				}
+				if batches[node.Name] == nil {
+					batches[node.Name] = map[string]*request{}
+				}
+				req, ok := batches[node.Name][name]
+				if !ok {
+					req = &request{Set: name, Limit: s.limit, Interval: s.interval, Copies: map[string]replica{}}
+					batches[node.Name][name] = req
+				}
+				req.Copies[key] = state
+				nodes[node.Name] = node
+			}
+		}
+	}
+	c.dirty = map[string]map[string]bool{}
+	c.mx.Unlock()
+
+	for node, sets := range batches {
+		for _, req := range sets {
+			c.send(nodes[node], "/replicate", *req)
+		}
+	}
+}
+
+// sweep drops the buckets that are full and unlocked once a minute, since
+// they are no different from new ones. The caller must hold c.mx.
+func (c *Cluster) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Minute {
+		return
+	}
+	c.lastSweep = now
+
+	for name, s := range c.sets {
+		if s.interval <= 0 {
+			continue
+		}
+		for key, b := range s.buckets {
+			b.Refill(s.limit, s.interval, now)
+			if b.Tokens >= float64(s.limit) && now.UnixNano() >= b.Locked && !c.dirty[name][key] {
+				delete(s.buckets, key)
+			}
+		}
+	}
+}
+
+// NodeMeta tells the other members the port this one serves on.
+func (c *Cluster) NodeMeta(limit int) []byte                  { return []byte(c.port) }
+func (c *Cluster) NotifyMsg(buf []byte)                       {}
+func (c *Cluster) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+func (c *Cluster) LocalState(join bool) []byte                { return nil }
+func (c *Cluster) MergeRemoteState(buf []byte, join bool)     {}
+
+// Store is one set of buckets of a Cluster.
+type Store struct {
+	cluster  *Cluster
+	name     string
+	limit    int64
+	interval time.Duration
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	req := s.request(key)
+	req.N = n
+	resp, err := s.cluster.call("/take", req)
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	return resp.Allowed, resp.Remaining, time.Now().Add(resp.Wait), nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	req := s.request(key)
+	req.Remaining = remaining
+	req.Pause = time.Until(until)
+	_, err := s.cluster.call("/throttle", req)
+	return err
+}
+
+func (s *Store) Reset(key string) error {
+	_, err := s.cluster.call("/reset", s.request(key))
+	return err
+}
+
+// ResetAll drops every bucket of the set on every member.
+func (s *Store) ResetAll() error {
+	return s.cluster.resetAll(s.request(""))
+}
+
+func (s *Store) request(key string) request {
+	return request{Set: s.name, Key: key, Limit: s.limit, Interval: s.interval}
+}
+
+var (
+	_ memberlist.Delegate  = (*Cluster)(nil)
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
@@ -0,0 +1,188 @@
+package ringstore
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/hashicorp/memberlist"
+)
+
+func newMember(t *testing.T, name string, peers ...string) *Cluster {
+	t.Helper()
+	config := memberlist.DefaultLocalConfig()
+	config.Name = name
+	config.BindAddr = "127.0.0.1"
+	config.BindPort = 0
+	config.LogOutput = io.Discard
+
+	cluster, err := NewCluster(ClusterConfig{MEMBERLIST: config, PEERS: peers, SYNC_INTERVAL: 10 * time.Millisecond, SECRET: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cluster
+}
+
+// newRing starts n members joined to the first and waits for all of them
+// to know each other.
+func newRing(t *testing.T, n int) []*Cluster {
+	t.Helper()
+	members := []*Cluster{newMember(t, "member-0")}
+	seed := fmt.Sprintf("127.0.0.1:%d", members[0].MEMBERLIST.BindPort)
+	for i := 1; i < n; i++ {
+		members = append(members, newMember(t, fmt.Sprintf("member-%d", i), seed))
+	}
+	waitMembers(t, members, n)
+	return members
+}
+
+func waitMembers(t *testing.T, members []*Cluster, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		settled := true
+		for _, member := range members {
+			settled = settled && member.Members() == n
+		}
+		if settled {
+			return
+		}
+	}
+	t.Fatalf("members didn't settle on %d", n)
+}
+
+func TestCluster(t *testing.T) {
+	members := newRing(t, 3)
+	for _, member := range members {
+		t.Cleanup(func() { member.Close(time.Second) })
+	}
+
+	profile := core.LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour}
+	stores := make([]core.Store, len(members))
+	for i, member := range members {
+		stores[i] = member.Factory()("default", profile)
+	}
+
+	tests := []struct {
+		name        string
+		member      int
+		do          func() error
+		n           int64
+		wantAllowed bool
+		wantTokens  int64
+	}{
+		{name: "first", member: 0, n: 1, wantAllowed: true, wantTokens: 2},
+		{name: "second, elsewhere", member: 1, n: 1, wantAllowed: true, wantTokens: 1},
+		{name: "third, elsewhere", member: 2, n: 1, wantAllowed: true, wantTokens: 0},
+		{name: "empty everywhere", member: 0, n: 1, wantAllowed: false},
+		{name: "handed back", member: 2, n: -1, wantAllowed: true, wantTokens: 1},
+		{name: "after reset", member: 1, do: func() error { return stores[0].(*Store).Reset("client") }, n: 0, wantAllowed: true, wantTokens: 3},
+		{name: "throttled", member: 2, do: func() error { return stores[1].(*Store).Throttle("client", 2, time.Now().Add(time.Hour)) }, n: 1, wantAllowed: false},
+		{name: "after reset all", member: 0, do: stores[2].(*Store).ResetAll, n: 1, wantAllowed: true, wantTokens: 2},
+	}
+	for _, test := range tests {
+		if test.do != nil {
+			if err := test.do(); err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+		}
+		allowed, remaining, _, err := stores[test.member].Take("client", test.n)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if allowed != test.wantAllowed || (allowed && remaining != test.wantTokens) {
+			t.Fatalf("%s: take %d = %v, %d; want %v, %d", test.name, test.n, allowed, remaining, test.wantAllowed, test.wantTokens)
+		}
+	}
+}
+
+func TestClusterSecret(t *testing.T) {
+	member := newMember(t, "member-0")
+	t.Cleanup(func() { member.Close(time.Second) })
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{name: "no secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong secret", authorization: "Bearer guess", wantStatus: http.StatusUnauthorized},
+		{name: "secret", authorization: "Bearer s3cret", wantStatus: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1:"+member.port+"/reset-all", strings.NewReader(`{"set": "default"}`))
+			if test.authorization != "" {
+				r.Header.Set("Authorization", test.authorization)
+			}
+			resp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Fatalf("status %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestClusterHandsOverOnLeave(t *testing.T) {
+	members := newRing(t, 3)
+	profile := core.LimitProfile{RATE_LIMIT: 5, REFILL_INTERVAL: time.Hour}
+
+	owner := members[0].ring("default", "client", false)[0].Name
+	var leaving *Cluster
+	var staying []*Cluster
+	for _, member := range members {
+		if member.MEMBERLIST.Name == owner {
+			leaving = member
+		} else {
+			staying = append(staying, member)
+			t.Cleanup(func() { member.Close(time.Second) })
+		}
+	}
+
+	if allowed, _, _, _ := leaving.Factory()("default", profile).Take("client", 4); !allowed {
+		t.Fatal("take rejected")
+	}
+	if err := leaving.Close(time.Second); err != nil {
+		t.Fatal(err)
+	}
+	waitMembers(t, staying, 2)
+
+	_, remaining, _, err := staying[0].Factory()("default", profile).Take("client", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 1 {
+		t.Fatalf("remaining %d after the owner left, want 1", remaining)
+	}
+}
+
+func TestRing(t *testing.T) {
+	members := newRing(t, 3)
+	for _, member := range members {
+		t.Cleanup(func() { member.Close(time.Second) })
+	}
+
+	owners := map[string]int{}
+	for i := 0; i < 300; i++ {
+		key := fmt.Sprintf("client-%d", i)
+		ring := members[0].ring("default", key, false)
+		for _, member := range members[1:] {
+			if other := member.ring("default", key, false); other[0].Name != ring[0].Name {
+				t.Fatalf("members disagree on the owner of %s: %s and %s", key, ring[0].Name, other[0].Name)
+			}
+		}
+		owners[ring[0].Name]++
+	}
+	for name, n := range owners {
+		if n < 50 {
+			t.Errorf("%s owns %d of 300 keys", name, n)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package socketstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/store/internal/bucket"
+)
+
+type NodeConfig struct {
+	// Path of the Unix socket the processes meet on, e.g.
+	// "/run/myapp/ratelimit.sock". Its directory must be writable by all
+	// of them.
+	PATH string
+	// Bounds each call to the broker. Defaults to one second.
+	TIMEOUT time.Duration
+	// How often a process checks that a broker answers, taking over if
+	// none does, and the broker that the socket is still its own.
+	// Defaults to one second.
+	CHECK_INTERVAL time.Duration
+}
+
+// Node shares rate limits between processes on one host, e.g. preforked
+// workers, over a Unix socket with no Redis. One of them is the broker,
+// keeping every bucket in memory and serving the others; whenever no
+// broker answers, e.g. after it exited, the first process to notice
+// becomes the next one, and limits start over with full buckets.
+type Node struct {
+	NodeConfig
+	client *http.Client
+	// Set while this process is the broker.
+	broker *broker
+	done   chan struct{}
+	mx     sync.Mutex
+}
+
+// broker is the serving end of the socket.
+type broker struct {
+	server *http.Server
+	// The socket file as created, to tell when another process replaced
+	// it.
+	socket    os.FileInfo
+	sets      map[string]*set
+	lastSweep time.Time
+	mx        sync.Mutex
+}
+
+// set is one set of buckets, with the limit it was last sent.
+type set struct {
+	limit    int64
+	interval time.Duration
+	buckets  map[string]*bucket.State
+}
+
+// request is what a Store sends the broker.
+type request struct {
+	Set       string        `json:"set"`
+	Key       string        `json:"key,omitempty"`
+	Limit     int64         `json:"limit"`
+	Interval  time.Duration `json:"interval"`
+	N         int64         `json:"n,omitempty"`
+	Remaining int64         `json:"remaining,omitempty"`
+	Pause     time.Duration `json:"pause,omitempty"`
+}
+
+type response struct {
+	Allowed   bool          `json:"allowed,omitempty"`
+	Remaining int64         `json:"remaining,omitempty"`
+	Wait      time.Duration `json:"wait,omitempty"`
+}
+
+// NewNode joins the processes meeting on PATH, becoming the broker if none
+// answers.
+func NewNode(config NodeConfig) (*Node, error) {
+	if config.TIMEOUT == 0 {
+		config.TIMEOUT = time.Second
+	}
+	if config.CHECK_INTERVAL == 0 {
+		config.CHECK_INTERVAL = time.Second
+	}
+
+	dialer := &net.Dialer{}
+	n := &Node{
+		NodeConfig: config,
+		client: &http.Client{
+			Timeout: config.TIMEOUT,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", config.PATH)
+				},
+			},
+		},
+		done: make(chan struct{}),
+	}
+	if err := n.elect(); err != nil {
+		return nil, err
+	}
+	go n.check()
+	return n, nil
+}
+
+// Factory returns a core.StoreFactory sharing every set of a limiter's
+// buckets through the broker. Limiters sharing a socket must give their
+// sets distinct names.
+func (n *Node) Factory() core.StoreFactory {
+	return func(name string, profile core.LimitProfile) core.Store {
+		return &Store{node: n, name: name, limit: profile.RATE_LIMIT, interval: profile.REFILL_INTERVAL}
+	}
+}
+
+// IsBroker reports whether this process is serving the others.
+func (n *Node) IsBroker() bool {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	return n.broker != nil
+}
+
+// Close stops checking on the broker and, if this process is it, stops
+// serving and removes the socket, so the next process to call takes over.
+func (n *Node) Close() error {
+	close(n.done)
+
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	return n.stepDown()
+}
+
+// elect becomes the broker unless one answers on PATH. A socket file
+// nothing answers on is left over from a broker that died, and replaced.
+func (n *Node) elect() error {
+	n.mx.Lock()
+	defer n.mx.Unlock()
+
+	if n.broker != nil {
+		return nil
+	}
+	listener, err := net.Listen("unix", n.PATH)
+	if err != nil {
+		conn, dialErr := net.DialTimeout("unix", n.PATH, n.TIMEOUT)
+		if dialErr == nil {
+			conn.Close()
+			return nil
+		}
+		os.Remove(n.PATH)
+		if listener, err = net.Listen("unix", n.PATH); err != nil {
+			return err
+		}
+	}
+	// Removing the socket is up to stepDown, which knows whether it is
+	// still this process's.
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	socket, err := os.Stat(n.PATH)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	b := &broker{socket: socket, sets: map[string]*set{}, lastSweep: time.Now()}
+	b.server = &http.Server{Handler: http.HandlerFunc(b.serveHTTP)}
+	go b.server.Serve(listener)
+	n.broker = b
+	return nil
+}
+
+// stepDown stops serving, if this process is the broker. The caller must
+// hold n.mx.
+func (n *Node) stepDown() error {
+	if n.broker == nil {
+		return nil
+	}
+	b := n.broker
+	n.broker = nil
+
+	err := b.server.Close()
+	if socket, statErr := os.Stat(n.PATH); statErr == nil && os.SameFile(socket, b.socket) {
+		err = errors.Join(err, os.Remove(n.PATH))
+	}
+	return err
+}
+
+// check elects a broker every CHECK_INTERVAL if none answers, and steps
+// this one down if another process replaced its socket.
+func (n *Node) check() {
+	ticker := time.NewTicker(n.CHECK_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+
+		n.mx.Lock()
+		if n.broker != nil {
+			if socket, err := os.Stat(n.PATH); err != nil || !os.SameFile(socket, n.broker.socket) {
+				n.stepDown()
+			}
+		}
+		n.mx.Unlock()
+		n.elect()
+	}
+}
+
+// call handles req here if this process is the broker and sends it to the
+// broker otherwise, electing a new one if it doesn't answer.
+func (n *Node) call(path string, req request) (response, error) {
+	resp, err := n.try(path, req)
+	if err == nil {
+		return resp, nil
+	}
+	var netErr *net.OpError
+	if !errors.As(err, &netErr) || netErr.Op != "dial" {
+		return response{}, err
+	}
+	if err := n.elect(); err != nil {
+		return response{}, err
+	}
+	return n.try(path, req)
+}
+
+func (n *Node) try(path string, req request) (response, error) {
+	n.mx.Lock()
+	b := n.broker
+	n.mx.Unlock()
+	if b != nil {
+		return b.handle(path, req), nil
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, "http://broker"+path, bytes.NewReader(body))
+	if err != nil {
+		return response{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := n.client.Do(httpReq)
+	if err != nil {
+		return response{}, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return response{}, fmt.Errorf("socketstore: broker answered %s", httpResp.Status)
+	}
+
+	var resp response
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return response{}, fmt.Errorf("socketstore: %w", err)
+	}
+	return resp, nil
+}
+
+func (b *broker) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch r.URL.Path {
+	case "/take", "/throttle", "/reset", "/reset-all":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b.handle(r.URL.Path, req))
+}
+
+// handle applies req to the broker's buckets.
+func (b *broker) handle(path string, req request) response {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	now := time.Now()
+	b.sweep(now)
+	s, ok := b.sets[req.Set]
+	if !ok {
+		s = &set{buckets: map[string]*bucket.State{}}
+		b.sets[req.Set] = s
+	}
+	s.limit = req.Limit
+	s.interval = req.Interval
+
+	switch path {
+	case "/take":
+		allowed, remaining, resetAt := bucket.Get(s.buckets, req.Key, s.limit, s.interval, now).Take(s.limit, s.interval, req.N, now)
+		return response{Allowed: allowed, Remaining: remaining, Wait: resetAt.Sub(now)}
+	case "/throttle":
+		bucket.Get(s.buckets, req.Key, s.limit, s.interval, now).Throttle(req.Remaining, now.Add(req.Pause))
+	case "/reset":
+		delete(s.buckets, req.Key)
+	case "/reset-all":
+		delete(b.sets, req.Set)
+	}
+	return response{}
+}
+
+// sweep drops the buckets that are full and unlocked once a minute, since
+// they are no different from new ones. The caller must hold b.mx.
+func (b *broker) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < time.Minute {
+		return
+	}
+	b.lastSweep = now
+
+	for _, s := range b.sets {
+		if s.interval <= 0 {
+			continue
+		}
+		for key, state := range s.buckets {
+			state.Refill(s.limit, s.interval, now)
+			if state.Tokens >= float64(s.limit) && now.UnixNano() >= state.Locked {
+				delete(s.buckets, key)
+			}
+		}
+	}
+}
+
+// Store is one set of buckets shared through a Node.
+type Store struct {
+	node     *Node
+	name     string
+	limit    int64
+	interval time.Duration
+}
+
+func (s *Store) Take(key string, n int64) (bool, int64, time.Time, error) {
+	req := s.request(key)
+	req.N = n
+	resp, err := s.node.call("/take", req)
+	if err != nil {
+		return false, 0, time.Time{}, err
+	}
+	return resp.Allowed, resp.Remaining, time.Now().Add(resp.Wait), nil
+}
+
+func (s *Store) Throttle(key string, remaining int64, until time.Time) error {
+	req := s.request(key)
+	req.Remaining = remaining
+	req.Pause = time.Until(until)
+	_, err := s.node.call("/throttle", req)
+	return err
+}
+
+func (s *Store) Reset(key string) error {
+	_, err := s.node.call("/reset", s.request(key))
+	return err
+}
+
+func (s *Store) ResetAll() error {
+	_, err := s.node.call("/reset-all", s.request(""))
+	return err
+}
+
+func (s *Store) request(key string) request {
+	return request{Set: s.name, Key: key, Limit: s.limit, Interval: s.interval}
+}
+
+var (
+	_ core.ResettableStore = (*Store)(nil)
+	_ core.ThrottlingStore = (*Store)(nil)
+)
@@ -0,0 +1,100 @@
+package socketstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+func newNode(t *testing.T, path string) *Node {
+	t.Helper()
+	node, err := NewNode(NodeConfig{PATH: path, CHECK_INTERVAL: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestNode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.sock")
+	broker := newNode(t, path)
+	worker := newNode(t, path)
+	t.Cleanup(func() { worker.Close() })
+	if !broker.IsBroker() || worker.IsBroker() {
+		t.Fatalf("brokers %v and %v, want only the first", broker.IsBroker(), worker.IsBroker())
+	}
+
+	profile := core.LimitProfile{RATE_LIMIT: 3, REFILL_INTERVAL: time.Hour}
+	stores := []core.Store{broker.Factory()("default", profile), worker.Factory()("default", profile)}
+
+	steps := []struct {
+		name        string
+		store       int
+		do          func() error
+		n           int64
+		wantAllowed bool
+		wantTokens  int64
+	}{
+		{name: "broker", store: 0, n: 2, wantAllowed: true, wantTokens: 1},
+		{name: "worker", store: 1, n: 1, wantAllowed: true, wantTokens: 0},
+		{name: "empty for both", store: 0, n: 1, wantAllowed: false},
+		{name: "after reset", store: 0, do: func() error { return stores[1].(*Store).Reset("client") }, n: 1, wantAllowed: true, wantTokens: 2},
+		{name: "throttled", store: 0, do: func() error { return stores[1].(*Store).Throttle("client", -1, time.Now().Add(time.Hour)) }, n: 1, wantAllowed: false},
+		{name: "after reset all", store: 1, do: stores[0].(*Store).ResetAll, n: 1, wantAllowed: true, wantTokens: 2},
+		{name: "worker takes over", store: 1, do: broker.Close, n: 1, wantAllowed: true, wantTokens: 2},
+	}
+	for _, step := range steps {
+		if step.do != nil {
+			if err := step.do(); err != nil {
+				t.Fatalf("%s: %v", step.name, err)
+			}
+		}
+		allowed, remaining, _, err := stores[step.store].Take("client", step.n)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if allowed != step.wantAllowed || (allowed && remaining != step.wantTokens) {
+			t.Fatalf("%s: take %d = %v, %d; want %v, %d", step.name, step.n, allowed, remaining, step.wantAllowed, step.wantTokens)
+		}
+	}
+	if !worker.IsBroker() {
+		t.Fatal("worker didn't take over from the closed broker")
+	}
+}
+
+func TestNodeReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.sock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	node := newNode(t, path)
+	defer node.Close()
+	if !node.IsBroker() {
+		t.Fatal("node didn't become the broker over a socket nothing answers on")
+	}
+}
+
+func TestNodeStepsDownWhenReplaced(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.sock")
+	first := newNode(t, path)
+	defer first.Close()
+
+	// Another process took the socket over, e.g. after finding it stale.
+	os.Remove(path)
+	second := newNode(t, path)
+	defer second.Close()
+
+	for deadline := time.Now().Add(time.Second); first.IsBroker() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if first.IsBroker() || !second.IsBroker() {
+		t.Fatalf("brokers %v and %v, want only the second", first.IsBroker(), second.IsBroker())
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("the first broker stepping down removed the second's socket: %v", err)
+	}
+}
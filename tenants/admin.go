@@ -0,0 +1,67 @@
+package tenants
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+)
+
+type AdminConfig struct {
+	// Path the tenants' endpoints are served under. Defaults to
+	// "/admin/tenants".
+	PREFIX string
+	// Returns what decides whether a request may manage the tenant, e.g.
+	// stdhttp.BearerAuth with the tenant's own token, so no tenant reaches
+	// another's buckets. Nil serves everyone, so the handler must be
+	// protected some other way.
+	AUTH func(tenant string) stdhttp.AuthFunc
+}
+
+// Admin returns the admin API of stdhttp.NewAdmin for each tenant, under
+// the tenant's own path with its limiter named "default":
+//
+//	GET    /admin/tenants/{tenant}/limiters/default/keys
+//	DELETE /admin/tenants/{tenant}/limiters/default/keys/{key}
+//	PUT    /admin/tenants/{tenant}/limiters/default/limit
+//	...
+//
+// Requests are authorized for the tenant before its limiter is looked up,
+// so unauthorized ones can't tell which tenants exist.
+func (t *Tenants) Admin(config AdminConfig) http.Handler {
+	if config.PREFIX == "" {
+		config.PREFIX = "/admin/tenants"
+	}
+	prefix := strings.TrimSuffix(config.PREFIX, "/") + "/"
+
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		rest, ok := strings.CutPrefix(request.URL.Path, prefix)
+		tenant, _, _ := strings.Cut(rest, "/")
+		if !ok || tenant == "" {
+			http.NotFound(w, request)
+			return
+		}
+
+		var auth stdhttp.AuthFunc
+		if config.AUTH != nil {
+			auth = config.AUTH(tenant)
+		}
+		stdhttp.RequireAuth(auth, http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+			limiter, err := t.Limiter(tenant)
+			if errors.Is(err, ErrUnknownTenant) {
+				http.NotFound(w, request)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			stdhttp.NewAdmin(stdhttp.AdminConfig{
+				LIMITERS: map[string]core.RateLimiter{"default": limiter},
+				PREFIX:   prefix + tenant,
+			}).ServeHTTP(w, request)
+		})).ServeHTTP(w, request)
+	})
+}
@@ -0,0 +1,55 @@
+package tenants
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+)
+
+func TestAdmin(t *testing.T) {
+	tenants := New(Config{
+		RESOLVE: func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+		LOOKUP:  plans,
+	})
+	defer tenants.Close()
+	tokens := map[string]string{"acme": "acme-t0ken", "globex": "globex-t0ken", "initech": "initech-t0ken"}
+	admin := tenants.Admin(AdminConfig{AUTH: func(tenant string) stdhttp.AuthFunc {
+		return stdhttp.BearerAuth(tokens[tenant])
+	}})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Tenant", "acme")
+	r.Header.Set("X-Client", "alice")
+	tenants.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+
+	tests := []struct {
+		name     string
+		path     string
+		token    string
+		want     int
+		wantBody string
+	}{
+		{name: "own keys", path: "/admin/tenants/acme/limiters/default/keys", token: "acme-t0ken", want: http.StatusOK, wantBody: `"Key":"alice"`},
+		{name: "another tenant's token", path: "/admin/tenants/acme/limiters/default/keys", token: "globex-t0ken", want: http.StatusUnauthorized},
+		{name: "no token", path: "/admin/tenants/acme/limiters/default/keys", want: http.StatusUnauthorized},
+		{name: "other tenant with its token", path: "/admin/tenants/globex/limiters/default/keys", token: "globex-t0ken", want: http.StatusOK, wantBody: `[]`},
+		{name: "unknown tenant", path: "/admin/tenants/initech/limiters/default/keys", token: "initech-t0ken", want: http.StatusNotFound},
+		{name: "no tenant", path: "/admin/tenants/", token: "acme-t0ken", want: http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, test.path, nil)
+			if test.token != "" {
+				r.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, r)
+			if w.Code != test.want || !strings.Contains(w.Body.String(), test.wantBody) {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.want, w.Body)
+			}
+		})
+	}
+}
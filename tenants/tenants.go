@@ -0,0 +1,240 @@
+// Package tenants gives each tenant of a multi-tenant gateway a namespace
+// of its own: a limiter with the tenant's limits, store keys apart from
+// every other tenant's, a "tenant" metrics label and an admin API that
+// only reaches its own buckets. Limiters are created the first time a
+// tenant is seen, so one process can serve thousands of tenants:
+//
+//	t := tenants.New(tenants.Config{
+//		RESOLVE: func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+//		LOOKUP:  plans.LimiterConfig,
+//		STORE:   redisstore.Factory(redisstore.StoreConfig{CLIENT: client}),
+//	})
+//	defer t.Close()
+//	http.ListenAndServe(":8080", t.Middleware(mux))
+package tenants
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/adapter/stdhttp"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/metrics/labels"
+)
+
+// ErrUnknownTenant is returned by LOOKUP for tenants that don't exist.
+var ErrUnknownTenant = errors.New("tenants: unknown tenant")
+
+type Config struct {
+	// Tells the tenant of a request, e.g. from a header, the host or a
+	// claim of its token.
+	RESOLVE func(r *http.Request) string
+	// Returns the config of a tenant's limiter, or ErrUnknownTenant. It is
+	// called the first time a tenant is seen and again after Reload, and
+	// for unknown tenants on every request, so it must be cheap for them.
+	LOOKUP func(tenant string) (core.RateLimiterConfig, error)
+	// Creates the stores of tenants whose config has no STORE of its own.
+	// Defaults to in-memory stores.
+	STORE core.StoreFactory
+	// Most tenants with a live limiter. The least recently seen one is
+	// dropped past it, and with it the buckets of in-memory stores.
+	// Defaults to 10000.
+	MAX_TENANTS int
+	// Called with the decisions of every tenant, after the tenant's own
+	// ON_DECISION, e.g. the Observe of a promlimiter.Collector with Label
+	// among its LABELS.
+	ON_DECISION func(r *http.Request, d core.Decision, elapsed time.Duration)
+	// Serves requests of tenants LOOKUP fails for. Defaults to 403
+	// Forbidden.
+	UNKNOWN http.Handler
+	// Called when LOOKUP fails for a tenant, or returns a config that
+	// doesn't validate, unless with ErrUnknownTenant.
+	ON_ERROR func(tenant string, err error)
+}
+
+// Tenants holds the live limiter of every tenant seen recently.
+type Tenants struct {
+	Config
+	tenants map[string]*namespace
+	// Tenants, the most recently seen first.
+	recent *list.List
+	mx     sync.Mutex
+}
+
+type namespace struct {
+	tenant  string
+	limiter core.RateLimiter
+	// Stops the limiter.
+	stop    context.CancelFunc
+	element *list.Element
+}
+
+type tenantKey struct{}
+
+func New(config Config) *Tenants {
+	if config.MAX_TENANTS <= 0 {
+		config.MAX_TENANTS = 10000
+	}
+	if config.UNKNOWN == nil {
+		config.UNKNOWN = http.HandlerFunc(unknownTenant)
+	}
+	return &Tenants{Config: config, tenants: map[string]*namespace{}, recent: list.New()}
+}
+
+// Limiter returns the tenant's limiter, creating and running it the first
+// time.
+func (t *Tenants) Limiter(tenant string) (core.RateLimiter, error) {
+	t.mx.Lock()
+	if ns, ok := t.tenants[tenant]; ok {
+		t.recent.MoveToFront(ns.element)
+		t.mx.Unlock()
+		return ns.limiter, nil
+	}
+	t.mx.Unlock()
+
+	config, err := t.LOOKUP(tenant)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tenants: %q: %w", tenant, err)
+	}
+	limiter := core.New()
+	limiter.SetConfig(t.namespaced(tenant, config))
+
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	// Another request may have created it meanwhile.
+	if ns, ok := t.tenants[tenant]; ok {
+		t.recent.MoveToFront(ns.element)
+		return ns.limiter, nil
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	limiter.RunContext(ctx)
+	ns := &namespace{tenant: tenant, limiter: limiter, stop: stop}
+	ns.element = t.recent.PushFront(ns)
+	t.tenants[tenant] = ns
+	for t.recent.Len() > t.MAX_TENANTS {
+		t.drop(t.recent.Back().Value.(*namespace))
+	}
+	return limiter, nil
+}
+
+// namespaced puts the tenant's stores under names of their own, e.g.
+// "acme:default" for redisstore keys like ratelimit:acme:default:<key>,
+// so stores shared between tenants keep their buckets apart.
+func (t *Tenants) namespaced(tenant string, config core.RateLimiterConfig) core.RateLimiterConfig {
+	if config.STORE == nil {
+		config.STORE = t.STORE
+	}
+	if store := config.STORE; store != nil {
+		config.STORE = func(name string, profile core.LimitProfile) core.Store {
+			return store(tenant+":"+name, profile)
+		}
+	}
+	if own, all := config.ON_DECISION, t.ON_DECISION; all != nil {
+		config.ON_DECISION = func(r *http.Request, d core.Decision, elapsed time.Duration) {
+			if own != nil {
+				own(r, d, elapsed)
+			}
+			all(r, d, elapsed)
+		}
+	}
+	return config
+}
+
+// Reload drops the tenant's limiter, so the next request looks its config
+// up again. Buckets kept in a shared STORE carry over.
+func (t *Tenants) Reload(tenant string) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	if ns, ok := t.tenants[tenant]; ok {
+		t.drop(ns)
+	}
+}
+
+// drop stops a tenant's limiter and forgets it. The caller must hold t.mx.
+func (t *Tenants) drop(ns *namespace) {
+	ns.stop()
+	t.recent.Remove(ns.element)
+	delete(t.tenants, ns.tenant)
+}
+
+// Tenants returns the tenants with a live limiter, sorted.
+func (t *Tenants) Tenants() []string {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	tenants := make([]string, 0, len(t.tenants))
+	for tenant := range t.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Close stops every tenant's limiter.
+func (t *Tenants) Close() {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+
+	for _, ns := range t.tenants {
+		t.drop(ns)
+	}
+}
+
+// Middleware limits requests with the limiter of their tenant, which
+// FromContext tells from then on.
+func (t *Tenants) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		tenant := t.RESOLVE(request)
+		request = request.WithContext(context.WithValue(request.Context(), tenantKey{}, tenant))
+
+		limiter, err := t.Limiter(tenant)
+		if err != nil {
+			if t.ON_ERROR != nil && !errors.Is(err, ErrUnknownTenant) {
+				t.ON_ERROR(tenant, err)
+			}
+			t.UNKNOWN.ServeHTTP(w, request)
+			return
+		}
+		if stdhttp.Allow(limiter, w, request) {
+			next.ServeHTTP(w, request)
+		}
+	})
+}
+
+// FromContext returns the tenant Middleware resolved for the request.
+func FromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// Label labels decision metrics "tenant" with the request's tenant, or
+// labels.Other past maxValues tenants, zero for labels.DefaultMaxValues.
+func Label(maxValues int) labels.Label {
+	return labels.Label{NAME: "tenant", MAX_VALUES: maxValues, VALUE: func(r *http.Request, d core.Decision) string {
+		if tenant, ok := FromContext(r.Context()); ok {
+			return tenant
+		}
+		return labels.Other
+	}}
+}
+
+func unknownTenant(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": false,
+		"message": "Unknown tenant",
+	})
+}
@@ -0,0 +1,132 @@
+package tenants
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/core"
+	"github.com/SaidakbarPardaboyev/Token-Bucket-Rate-Limiter/metrics/labels"
+)
+
+// plans is the config of each tenant: acme gets two requests a client,
+// globex one.
+func plans(tenant string) (core.RateLimiterConfig, error) {
+	limits := map[string]int64{"acme": 2, "globex": 1}
+	limit, ok := limits[tenant]
+	if !ok {
+		return core.RateLimiterConfig{}, ErrUnknownTenant
+	}
+	return core.RateLimiterConfig{
+		RATE_LIMIT:      limit,
+		REFILL_INTERVAL: time.Hour,
+		KEY_FUNC:        func(r *http.Request) string { return r.Header.Get("X-Client") },
+	}, nil
+}
+
+func TestMiddleware(t *testing.T) {
+	var mx sync.Mutex
+	stores := map[string]core.Store{}
+	var seen []string
+	set := labels.NewSet(Label(0))
+	tenants := New(Config{
+		RESOLVE: func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+		LOOKUP:  plans,
+		// One store for everyone, as a shared Redis would be.
+		STORE: func(name string, profile core.LimitProfile) core.Store {
+			mx.Lock()
+			defer mx.Unlock()
+			if stores[name] == nil {
+				stores[name] = core.NewMemoryStore(profile)
+			}
+			return stores[name]
+		},
+		ON_DECISION: func(r *http.Request, d core.Decision, elapsed time.Duration) {
+			seen = append(seen, set.Values(r, d)[0])
+		},
+	})
+	defer tenants.Close()
+	handler := tenants.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name   string
+		tenant string
+		client string
+		// Requests sent; the status of the last one is checked.
+		times int
+		want  int
+	}{
+		{name: "within the tenant's limit", tenant: "acme", client: "alice", times: 2, want: http.StatusOK},
+		{name: "past the tenant's limit", tenant: "acme", client: "alice", times: 1, want: http.StatusTooManyRequests},
+		{name: "same key in another tenant", tenant: "globex", client: "alice", times: 1, want: http.StatusOK},
+		{name: "other tenant's own limit", tenant: "globex", client: "alice", times: 1, want: http.StatusTooManyRequests},
+		{name: "unknown tenant", tenant: "initech", client: "alice", times: 1, want: http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var w *httptest.ResponseRecorder
+			for i := 0; i < test.times; i++ {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.Header.Set("X-Tenant", test.tenant)
+				r.Header.Set("X-Client", test.client)
+				w = httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+			}
+			if w.Code != test.want {
+				t.Fatalf("status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+
+	var names []string
+	for name := range stores {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"acme:default", "acme:verified", "globex:default", "globex:verified"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("stores %v, want %v", names, want)
+	}
+	if want := []string{"acme", "acme", "acme", "globex", "globex"}; !reflect.DeepEqual(seen, want) {
+		t.Fatalf("labeled %v, want %v", seen, want)
+	}
+}
+
+func TestMaxTenants(t *testing.T) {
+	tenants := New(Config{LOOKUP: plans, MAX_TENANTS: 1})
+	defer tenants.Close()
+
+	steps := []struct {
+		name        string
+		use         string
+		reload      string
+		wantTenants []string
+		wantSame    bool
+	}{
+		{name: "first", use: "acme", wantTenants: []string{"acme"}},
+		{name: "seen again", use: "acme", wantTenants: []string{"acme"}, wantSame: true},
+		{name: "second drops the first", use: "globex", wantTenants: []string{"globex"}},
+		{name: "first again", use: "acme", wantTenants: []string{"acme"}},
+		{name: "reloaded", reload: "acme", use: "acme", wantTenants: []string{"acme"}},
+	}
+	var previous core.RateLimiter
+	for _, step := range steps {
+		if step.reload != "" {
+			tenants.Reload(step.reload)
+		}
+		limiter, err := tenants.Limiter(step.use)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (limiter == previous) != step.wantSame {
+			t.Fatalf("%s: same limiter %v", step.name, limiter == previous)
+		}
+		if got := tenants.Tenants(); !reflect.DeepEqual(got, step.wantTenants) {
+			t.Fatalf("%s: tenants %v", step.name, got)
+		}
+		previous = limiter
+	}
+}